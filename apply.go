@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// applyOptions controls how a batch is applied
+type applyOptions struct {
+	itemsPath    string
+	skipExisting bool
+	// resolveDuplicate decides what to do with the user stories found by
+	// skipExisting
+	resolveDuplicate adobatch.DuplicateResolver
+	maxFailures      int
+	maxFailureRate   float64
+	failFast         bool
+	// retries is the number of times the creation of a work item is retried
+	// after an ambiguous failure
+	retries int
+	// taskConcurrency is the number of tasks of a user story created in
+	// parallel
+	taskConcurrency int
+	// twoPhase creates the user stories with the batch API, then their tasks
+	twoPhase bool
+	// batchSize is the number of work items updated by a request of the
+	// follow-up updates
+	batchSize int
+	// chunkSize, when set, saves a checkpoint to checkpointFile and writes
+	// the reports after every chunk of that many user stories
+	chunkSize      int
+	checkpointFile string
+	// resume continues the run recorded by checkpointFile
+	resume bool
+	// resumed are the user stories recorded by the checkpoint resumed
+	resumed []adobatch.ItemResult
+	// verify re-reads the created work items after the run
+	verify bool
+	// checkStates checks the states of the items against their work item
+	// types before the run
+	checkStates bool
+	// stateReasons are the reasons set with each state
+	stateReasons map[string]string
+	// transitionStates creates the work items in their initial state and
+	// moves them to their state after
+	transitionStates bool
+	// iteration is set on the items that do not set one
+	iteration string
+	// lane is set on the user stories that do not set one
+	lane string
+	// tags are added to every work item, before the tags of the items
+	tags []string
+	// titles transforms the titles of the work items
+	titles adobatch.TitleFormat
+	// assignmentRules set the owners of the work items without one
+	assignmentRules []adobatch.AssignmentRule
+	// assignment picks the team member of "@Team Name" owners
+	assignment adobatch.AssignmentStrategy
+	// resolveOwners resolves the owners through the identities API
+	resolveOwners bool
+	// fuzzyOwners picks the closest identity of an owner that is not found
+	fuzzyOwners bool
+	// enforceCapacity aborts the run when the task estimates of an owner
+	// exceed their capacity by more than capacityTolerance
+	enforceCapacity   bool
+	capacityTolerance float64
+	// orderField is set in the order of the items file once every work item
+	// is created
+	orderField string
+	// reorder moves the work items created to the top of the backlog
+	reorder bool
+	// provenance adds a comment recording who ran the tool and from which
+	// commit to every work item created
+	provenance bool
+	// runID is added as a "run-<id>" tag to every work item, applyItems
+	// generates one when it is empty
+	runID   string
+	output  string
+	reports reportOptions
+	// errorsFile receives the failed work items when the run has failures
+	errorsFile string
+	// pushgateway receives the metrics after the run when set
+	pushgateway string
+	// plugins transform the items before the run, in order
+	plugins []string
+	// script is a Starlark script transforming every item after the plugins
+	script string
+	// hooks are the commands run before, during and after the run
+	hooks runHooks
+	// notifications receive the summary of the run
+	notifications notifyOptions
+	// progress, when set, is called after every user story of the run
+	progress func(adobatch.Result)
+}
+
+// applyItems creates every work item of the items file and returns the exit
+// code of the run
+func applyItems(ctx context.Context, settings models.AdoSettings, options applyOptions, logger *zap.Logger) int {
+	file, err := openItemsFile(options.itemsPath)
+	if err != nil {
+		logger.Error("Failed to read items file", zap.String("path", options.itemsPath), zap.Error(err))
+		return exitValidation
+	}
+
+	plan, err := adobatch.DecodePlan(file)
+	file.Close()
+	if err != nil {
+		logger.Error("Failed to decode items file", zap.String("path", options.itemsPath), zap.Error(err))
+		return exitValidation
+	}
+
+	// Every run is tagged with its ID, for the cleanup commands
+	if options.runID == "" {
+		options.runID = newRunID(time.Now())
+	}
+	if options.resume {
+		checkpoint, err := readCheckpoint(options.checkpointFile)
+		if err != nil {
+			logger.Error("Failed to read checkpoint", zap.String("path", options.checkpointFile), zap.Error(err))
+			return exitValidation
+		}
+		options.resumed = checkpoint.UserStories
+		if checkpoint.RunID != "" {
+			options.runID = checkpoint.RunID
+		}
+		logger.Info("Resuming run", zap.String("run_id", options.runID), zap.Int("user_stories", len(options.resumed)))
+	} else {
+		logger.Info("Starting run", zap.String("run_id", options.runID))
+	}
+
+	userStories, err := transformItems(ctx, options, plan.Items, logger)
+	if err != nil {
+		logger.Error("Failed to transform items", zap.Error(err))
+		return exitValidation
+	}
+
+	results, exitCode := runBatch(ctx, settings, userStories, options, logger)
+
+	if options.verify && results.Summary.Created > 0 {
+		verifyRun(ctx, settings, results.Items, logger)
+	}
+
+	if err := printOutput(os.Stdout, options.output, results, func(w io.Writer) { printSummary(w, results) }); err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+	}
+
+	writeReports(options.reports, results, logger)
+
+	if runningInAzurePipelines() {
+		// Keep stdout valid JSON, the agent reads logging commands from stderr too
+		commands := io.Writer(os.Stdout)
+		if options.output == outputJSON {
+			commands = os.Stderr
+		}
+		writeAzurePipelinesCommands(commands, results, options.reports.resultsFile)
+	}
+
+	if err := writeGitHubActionsOutputs(results, options.reports.resultsFile); err != nil {
+		logger.Error("Failed to write GitHub Actions outputs", zap.Error(err))
+	}
+
+	if results.Summary.Failed > 0 && options.errorsFile != "" {
+		report := newErrorReport(options.runID, results.Items, settings.Pat, settings.ClientSecret)
+		if err := writeErrorReport(options.errorsFile, report); err != nil {
+			logger.Error("Failed to write error report", zap.String("path", options.errorsFile), zap.Error(err))
+		} else {
+			logger.Info("Wrote error report", zap.String("path", options.errorsFile), zap.Int("errors", len(report.Errors)))
+		}
+	}
+
+	notifyRun(ctx, options.notifications, results, logger)
+
+	if options.pushgateway != "" {
+		// Push even when the run was interrupted
+		if err := appMetrics.push(context.WithoutCancel(ctx), options.pushgateway); err != nil {
+			logger.Error("Failed to push metrics", zap.String("url", options.pushgateway), zap.Error(err))
+		}
+	}
+
+	return exitCode
+}
+
+// transformItems passes the user stories through the plugins, then the
+// Starlark script
+func transformItems(ctx context.Context, options applyOptions, userStories []models.UserStory, logger *zap.Logger) ([]models.UserStory, error) {
+	userStories, err := applyPlugins(ctx, options.plugins, userStories, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if userStories, err = applyScript(options.script, userStories); err != nil {
+		return nil, err
+	}
+
+	// Plugins and scripts can set priorities the items file was not checked for
+	return userStories, (&adobatch.Plan{Items: userStories}).CheckPriorities()
+}
+
+// runBatch creates the user stories of a batch with their tasks with the
+// engine, and returns the results and the exit code of the run
+func runBatch(ctx context.Context, settings models.AdoSettings, userStories []models.UserStory, options applyOptions, logger *zap.Logger) (adobatch.Results, int) {
+	plan := &adobatch.Plan{Items: userStories}
+
+	ctx, runSpan := startSpan(ctx, "run", spanKindInternal, map[string]any{"run.id": options.runID, "work_items.total": plan.WorkItems()})
+	defer func() {
+		runSpan.end(nil)
+		// Export every run, long running modes would otherwise hold the spans
+		if err := appTracer.flush(context.WithoutCancel(ctx)); err != nil {
+			logger.Error("Failed to export traces", zap.Error(err))
+		}
+	}()
+
+	comment := ""
+	if options.provenance {
+		comment = provenanceComment(ctx, options)
+	}
+
+	var checkpoint func(ctx context.Context, items []adobatch.Result) error
+	if options.chunkSize > 0 && options.checkpointFile != "" {
+		start := time.Now()
+		checkpoint = func(ctx context.Context, items []adobatch.Result) error {
+			results := adobatch.NewResults(options.runID, items, time.Since(start))
+			if err := writeCheckpoint(options.checkpointFile, results); err != nil {
+				return err
+			}
+			writeReports(options.reports, results, logger)
+			return nil
+		}
+	}
+
+	client := newClient(settings, logger)
+	client.BatchSize = options.batchSize
+	results := client.Apply(ctx, plan, adobatch.Options{
+		RunID:             options.runID,
+		SkipExisting:      options.skipExisting,
+		ResolveDuplicate:  options.resolveDuplicate,
+		CheckStates:       options.checkStates,
+		StateReasons:      options.stateReasons,
+		TransitionStates:  options.transitionStates,
+		Iteration:         options.iteration,
+		Lane:              options.lane,
+		Tags:              options.tags,
+		Titles:            options.titles,
+		AssignmentRules:   options.assignmentRules,
+		Assignment:        options.assignment,
+		ResolveOwners:     options.resolveOwners,
+		FuzzyOwners:       options.fuzzyOwners,
+		EnforceCapacity:   options.enforceCapacity,
+		CapacityTolerance: options.capacityTolerance,
+		OrderField:        options.orderField,
+		Retries:           options.retries,
+		TaskConcurrency:   options.taskConcurrency,
+		TwoPhase:          options.twoPhase,
+		Reorder:           options.reorder,
+		Comment:           comment,
+		ChunkSize:         options.chunkSize,
+		Checkpoint:        checkpoint,
+		Resume:            options.resumed,
+		FailurePolicy: adobatch.FailurePolicy{
+			MaxFailures:    options.maxFailures,
+			MaxFailureRate: options.maxFailureRate,
+			FailFast:       options.failFast,
+		},
+		BeforeRun: func(ctx context.Context, plan *adobatch.Plan) error {
+			err := runPreRunHook(ctx, options.hooks, options.runID, plan.Items)
+			if err != nil {
+				logger.Error("Pre-run hook failed, skipping the run", zap.Error(err))
+			}
+			return err
+		},
+		Progress: func(result adobatch.Result) {
+			if err := runPostItemHook(ctx, options.hooks, options.runID, result); err != nil {
+				logger.Error("Post-item hook failed", zap.String("name", result.Item.Name), zap.Error(err))
+			}
+			if options.progress != nil {
+				options.progress(result)
+			}
+		},
+		Tracer: engineTracer{},
+	})
+
+	logger.Info("Run finished",
+		zap.Int("created", results.Summary.Created),
+		zap.Int("skipped", results.Summary.Skipped),
+		zap.Int("failed", results.Summary.Failed),
+		zap.Any("by_type", results.Summary.ByType),
+		zap.Float64("duration_seconds", results.Summary.DurationSeconds),
+		zap.Float64("average_latency_ms", results.Summary.AverageLatencyMs),
+	)
+
+	// A finished run cannot be resumed, its follow-up updates were applied
+	if checkpoint != nil && results.AbortReason == "" && ctx.Err() == nil {
+		if err := os.Remove(options.checkpointFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Error("Failed to remove checkpoint", zap.String("path", options.checkpointFile), zap.Error(err))
+		}
+	}
+
+	runSpan.setAttribute("work_items.created", results.Summary.Created)
+	runSpan.setAttribute("work_items.failed", results.Summary.Failed)
+
+	exitCode := exitCodeFor(results.Status)
+	appMetrics.observeRun(results.Items, exitCode)
+
+	// Run even when the run was interrupted
+	if err := runPostRunHook(context.WithoutCancel(ctx), options.hooks, results, exitCode); err != nil {
+		logger.Error("Post-run hook failed", zap.Error(err))
+	}
+
+	return results, exitCode
+}
+
+// newClient returns an engine client sending requests through the shared
+// HTTP client and the configured authentication
+func newClient(settings models.AdoSettings, logger *zap.Logger) *adobatch.Client {
+	client := adobatch.NewClient(settings)
+	client.Authorize = authorize
+	client.HTTPClient = httpClient
+	client.Logger = logger
+
+	return client
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// defaultArchiveState is the state the archive command moves the work items to
+const defaultArchiveState = "Removed"
+
+// archiveOptions selects the run the archive command closes and how
+type archiveOptions struct {
+	runID string
+	// state is the state the work items are moved to, with the reason
+	// configured for it in stateReasons
+	state string
+	// comment is added to every work item archived, a default naming the run
+	// when empty
+	comment string
+	// dryRun lists the work items without archiving them
+	dryRun bool
+	// yes skips the confirmation prompt
+	yes bool
+}
+
+// archiveWorkItems moves the work items of a run that are still open to the
+// archive state and comments on them, after listing them and asking for
+// confirmation
+func archiveWorkItems(ctx context.Context, settings models.AdoSettings, archive archiveOptions, options applyOptions, logger *zap.Logger) int {
+	if archive.runID == "" {
+		logger.Error("No run to archive, set --run")
+		return exitValidation
+	}
+	state := valueOr(archive.state, defaultArchiveState)
+	comment := archive.comment
+	if comment == "" {
+		comment = fmt.Sprintf("Archived: the work items of run %s were abandoned.", archive.runID)
+	}
+
+	query, err := bulkSelection{runID: archive.runID, open: true}.query()
+	if err != nil {
+		logger.Error("Invalid archive selection", zap.Error(err))
+		return exitValidation
+	}
+
+	client := newClient(settings, logger)
+	results, err := selectWorkItems(ctx, client, settings, query)
+	if err != nil {
+		logger.Error("Failed to run query", zap.Error(err))
+		return queryExitCode(err)
+	}
+	if len(results) == 0 {
+		logger.Info("No open work items to archive", zap.String("run_id", archive.runID))
+		return exitSuccess
+	}
+
+	if archive.dryRun {
+		logger.Info("Dry run, work items are not archived", zap.Int("work_items", len(results)), zap.String("state", state))
+		printBulkResults(os.Stderr, results)
+		return exitSuccess
+	}
+
+	if !archive.yes {
+		question := fmt.Sprintf("Move %d open work items of run %s to %s?", len(results), archive.runID, state)
+		if exitCode := confirmBulk(results, question, "archive", logger); exitCode != exitSuccess {
+			return exitCode
+		}
+	}
+	logger.Info("Archiving work items", zap.Int("work_items", len(results)), zap.String("run_id", archive.runID), zap.String("state", state))
+
+	types := make(map[int]string, len(results))
+	for _, result := range results {
+		types[result.Id] = result.Type
+	}
+	engineOptions := adobatch.Options{StateReasons: options.stateReasons}
+
+	return runBulk(ctx, results, "archive", models.StatusUpdated, func(ctx context.Context, id int) error {
+		if err := client.TransitionState(ctx, settings, id, types[id], state, "", engineOptions); err != nil {
+			return err
+		}
+		return client.AddComment(ctx, settings, id, comment)
+	}, options, logger)
+}
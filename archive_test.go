@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+	"go.uber.org/zap"
+)
+
+func TestArchiveAppliedRun(t *testing.T) {
+	server := adotest.NewServer()
+	t.Cleanup(server.Close)
+	transport := httpClient.Transport
+	httpClient.Transport = server.Transport()
+	t.Cleanup(func() { httpClient.Transport = transport })
+
+	itemsPath := filepath.Join(t.TempDir(), "items.json")
+	if err := os.WriteFile(itemsPath, []byte(`[{"name": "US1", "tasks": [{"name": "Task 1"}]}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	settings := models.AdoSettings{Organization: "org", Project: "project", Pat: "pat"}
+
+	// A plain run, neither chunked, scheduled nor served, is tagged with its ID
+	if code := applyItems(context.Background(), settings, applyOptions{itemsPath: itemsPath, output: outputJSON}, zap.NewNop()); code != exitSuccess {
+		t.Fatalf("apply exited with %d", code)
+	}
+	runID := ""
+	for _, item := range server.WorkItems() {
+		tags, _ := item.Fields["System.Tags"].(string)
+		for _, tag := range strings.Split(tags, ";") {
+			if id, ok := strings.CutPrefix(strings.TrimSpace(tag), "run-"); ok {
+				runID = id
+			}
+		}
+	}
+	if runID == "" {
+		t.Fatal("work items not tagged with a run ID")
+	}
+
+	if code := archiveWorkItems(context.Background(), settings, archiveOptions{runID: runID, yes: true}, applyOptions{output: outputJSON}, zap.NewNop()); code != exitSuccess {
+		t.Fatalf("archive exited with %d", code)
+	}
+	for _, item := range server.WorkItems() {
+		if item.Fields["System.State"] != defaultArchiveState {
+			t.Errorf("%v is %v, want %s", item.Fields["System.Title"], item.Fields["System.State"], defaultArchiveState)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditRecord is a single API call written to the audit log
+type auditRecord struct {
+	Time          time.Time `json:"time"`
+	Method        string    `json:"method"`
+	URL           string    `json:"url"`
+	Status        int       `json:"status,omitempty"`
+	DurationMs    float64   `json:"durationMs"`
+	CorrelationID string    `json:"correlationId,omitempty"`
+	RequestBody   any       `json:"requestBody,omitempty"`
+	ResponseBody  any       `json:"responseBody,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// auditTransport records every request and response to an audit file as JSON
+// lines. Headers are not recorded and secrets are redacted from bodies.
+type auditTransport struct {
+	next    http.RoundTripper
+	secrets []string
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// newAuditTransport opens the audit file in append mode
+func newAuditTransport(path string, next http.RoundTripper, secrets ...string) (*auditTransport, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &auditTransport{next: next, secrets: secrets, file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	record := auditRecord{Time: time.Now().UTC(), Method: req.Method, URL: req.URL.String()}
+
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			record.RequestBody = t.auditBody(data)
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	record.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		record.Error = redactSecrets(err.Error(), t.secrets)
+		t.write(record)
+		return nil, err
+	}
+
+	record.Status = resp.StatusCode
+	record.CorrelationID = resp.Header.Get("ActivityId")
+	if record.CorrelationID == "" {
+		record.CorrelationID = resp.Header.Get("X-VSS-E2EID")
+	}
+
+	// Read the body for the record and hand an identical copy to the caller
+	data, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if readErr != nil {
+		record.Error = readErr.Error()
+	}
+	record.ResponseBody = t.auditBody(data)
+
+	t.write(record)
+	return resp, nil
+}
+
+// auditBody keeps JSON bodies as JSON in the record, and anything else as text
+func (t *auditTransport) auditBody(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+
+	redacted := redactSecrets(string(data), t.secrets)
+	if json.Valid([]byte(redacted)) {
+		return json.RawMessage(redacted)
+	}
+
+	return redacted
+}
+
+func (t *auditTransport) write(record auditRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.encoder.Encode(record)
+}
+
+// Close closes the audit file
+func (t *auditTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.file.Close()
+}
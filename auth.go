@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// Authentication modes accepted in devops.auth
+const (
+	authPAT              = "pat"
+	authEntra            = "entra"
+	authManagedIdentity  = "managed_identity"
+	authServicePrincipal = "service_principal"
+	authAzureCLI         = "azure_cli"
+)
+
+// authModes lists the accepted authentication modes
+var authModes = []string{authPAT, authEntra, authManagedIdentity, authServicePrincipal, authAzureCLI}
+
+// adoScope requests a token for the Azure DevOps resource
+const adoScope = "499b84ac-1321-427f-aa17-267ca6975798/.default"
+
+// authorizer adds credentials to Azure DevOps requests
+type authorizer interface {
+	authorize(ctx context.Context, req *http.Request) error
+}
+
+// patAuthorizer authenticates with a personal access token
+type patAuthorizer struct {
+	pat string
+}
+
+func (a patAuthorizer) authorize(ctx context.Context, req *http.Request) error {
+	req.SetBasicAuth("", a.pat)
+	return nil
+}
+
+// accessToken is an OAuth access token and its expiry
+type accessToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+// tokenSource acquires access tokens for a scope
+type tokenSource interface {
+	token(ctx context.Context, scope string) (accessToken, error)
+}
+
+// bearerAuthorizer authenticates with tokens from a tokenSource, caching
+// them until shortly before they expire
+type bearerAuthorizer struct {
+	source tokenSource
+	scope  string
+
+	mu     sync.Mutex
+	cached accessToken
+}
+
+func (a *bearerAuthorizer) authorize(ctx context.Context, req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cached.value == "" || time.Until(a.cached.expiresAt) < 5*time.Minute {
+		token, err := a.source.token(ctx, a.scope)
+		if err != nil {
+			return fmt.Errorf("failed to acquire access token: %w: %w", adobatch.ErrAuth, err)
+		}
+		registerSecrets(token.value)
+		a.cached = token
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.cached.value)
+	return nil
+}
+
+// authorizers caches one authorizer per credential, so tokens are acquired
+// once and reused across requests
+var authorizers sync.Map
+
+// authorize adds the credentials configured in settings to req
+func authorize(ctx context.Context, req *http.Request, settings models.AdoSettings) error {
+	key := settings.Auth + "|" + settings.TenantId + "|" + settings.ClientId + "|" + settings.Pat
+	if cached, ok := authorizers.Load(key); ok {
+		return cached.(authorizer).authorize(ctx, req)
+	}
+
+	auth, err := newAuthorizer(settings)
+	if err != nil {
+		return err
+	}
+	cached, _ := authorizers.LoadOrStore(key, auth)
+
+	return cached.(authorizer).authorize(ctx, req)
+}
+
+// newAuthorizer builds the authorizer of the configured authentication mode
+func newAuthorizer(settings models.AdoSettings) (authorizer, error) {
+	if settings.Auth == "" || settings.Auth == authPAT {
+		return patAuthorizer{pat: settings.Pat}, nil
+	}
+
+	source, err := newTokenSource(settings.Auth, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bearerAuthorizer{source: source, scope: adoScope}, nil
+}
+
+// newTokenSource builds the token source of an Azure credential mode
+func newTokenSource(mode string, settings models.AdoSettings) (tokenSource, error) {
+	switch mode {
+	case authEntra:
+		return newEntraTokenSource(settings), nil
+	case authManagedIdentity:
+		return newManagedIdentityTokenSource(settings), nil
+	case authServicePrincipal:
+		return newServicePrincipalTokenSource(settings), nil
+	case authAzureCLI:
+		return newAzureCLITokenSource(settings), nil
+	}
+
+	return nil, fmt.Errorf("unknown authentication mode %q", mode)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// azureCLITokenSource reuses the sign-in of the Azure CLI, so developers
+// already logged in with `az login` need no extra setup
+type azureCLITokenSource struct {
+	tenantID string
+}
+
+func newAzureCLITokenSource(settings models.AdoSettings) *azureCLITokenSource {
+	return &azureCLITokenSource{tenantID: settings.TenantId}
+}
+
+func (s *azureCLITokenSource) token(ctx context.Context, scope string) (accessToken, error) {
+	args := []string{"account", "get-access-token", "--resource", strings.TrimSuffix(scope, "/.default"), "--output", "json"}
+	if s.tenantID != "" {
+		args = append(args, "--tenant", s.tenantID)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "az", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return accessToken{}, fmt.Errorf("azure CLI not found, install it or use another devops.auth mode")
+		}
+		return accessToken{}, fmt.Errorf("failed to get token from Azure CLI, run `az login`: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	var response struct {
+		AccessToken string `json:"accessToken"`
+		// ExpiresOn is in local time, ExpiresOnUnix is only set by newer versions
+		ExpiresOn     string `json:"expiresOn"`
+		ExpiresOnUnix int64  `json:"expires_on"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return accessToken{}, fmt.Errorf("failed to parse Azure CLI output: %w", err)
+	}
+
+	token := accessToken{value: response.AccessToken, expiresAt: time.Unix(response.ExpiresOnUnix, 0)}
+	if response.ExpiresOnUnix == 0 {
+		expiresAt, err := time.ParseInLocation("2006-01-02 15:04:05.999999", response.ExpiresOn, time.Local)
+		if err != nil {
+			return accessToken{}, fmt.Errorf("failed to parse token expiry %q: %w", response.ExpiresOn, err)
+		}
+		token.expiresAt = expiresAt
+	}
+
+	return token, nil
+}
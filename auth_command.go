@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// runAuthCommand runs the `auth` subcommands and returns the exit code
+func runAuthCommand(subcommand, organization string, logger *zap.Logger) int {
+	if subcommand != "login" {
+		logger.Error("Unknown auth command, expected `auth login`", zap.String("command", subcommand))
+		return exitValidation
+	}
+
+	if organization == "" {
+		logger.Error("Missing Azure DevOps organization, set devops.organization or --organization")
+		return exitValidation
+	}
+
+	fmt.Fprintf(os.Stderr, "Azure DevOps PAT for %s: ", organization)
+	pat, err := readSecret()
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		logger.Error("Failed to read PAT", zap.Error(err))
+		return exitError
+	}
+	if pat == "" {
+		logger.Error("PAT is empty")
+		return exitValidation
+	}
+
+	if err := keyringSet(organization, pat); err != nil {
+		logger.Error("Failed to store PAT in the OS keyring", zap.Error(err))
+		return exitError
+	}
+	logger.Info("PAT stored in the OS keyring", zap.String("organization", organization))
+
+	return exitSuccess
+}
+
+// readSecret reads a line from stdin, hiding the input when it is a terminal
+func readSecret() (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		hide := exec.Command("stty", "-echo")
+		hide.Stdin = os.Stdin
+		if hide.Run() == nil {
+			defer func() {
+				restore := exec.Command("stty", "echo")
+				restore.Stdin = os.Stdin
+				restore.Run()
+			}()
+		}
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+const (
+	// entraAuthority is the Microsoft Entra ID login endpoint
+	entraAuthority = "https://login.microsoftonline.com"
+	// azureCLIClientID is the public client of the Azure CLI, pre-authorized
+	// for Azure DevOps, used for the device code flow when no client is set
+	azureCLIClientID = "04b07795-8ddb-461a-bbee-02f9e1bf7b46"
+)
+
+// entraTokenSource acquires tokens from Microsoft Entra ID, with the client
+// credentials flow when a client secret is configured and the device code
+// flow otherwise
+type entraTokenSource struct {
+	tenantID     string
+	clientID     string
+	clientSecret string
+
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func newEntraTokenSource(settings models.AdoSettings) *entraTokenSource {
+	source := &entraTokenSource{
+		tenantID:     settings.TenantId,
+		clientID:     settings.ClientId,
+		clientSecret: settings.ClientSecret,
+	}
+	if source.tenantID == "" {
+		source.tenantID = "organizations"
+	}
+	if source.clientID == "" {
+		source.clientID = azureCLIClientID
+	}
+
+	return source
+}
+
+func (s *entraTokenSource) token(ctx context.Context, scope string) (accessToken, error) {
+	if s.clientSecret != "" {
+		return requestEntraToken(ctx, s.tenantID, url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {s.clientID},
+			"client_secret": {s.clientSecret},
+			"scope":         {scope},
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Refresh silently when possible, long running modes outlive the first token
+	if s.refreshToken != "" {
+		token, err := s.requestUserToken(ctx, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {s.clientID},
+			"refresh_token": {s.refreshToken},
+			"scope":         {scope + " offline_access"},
+		})
+		if err == nil {
+			return token, nil
+		}
+	}
+
+	return s.deviceCode(ctx, scope)
+}
+
+// deviceCode runs the device code flow: the user signs in on another device
+// while the token endpoint is polled
+func (s *entraTokenSource) deviceCode(ctx context.Context, scope string) (accessToken, error) {
+	form := url.Values{"client_id": {s.clientID}, "scope": {scope + " offline_access"}}
+	var code struct {
+		DeviceCode string `json:"device_code"`
+		Message    string `json:"message"`
+		ExpiresIn  int    `json:"expires_in"`
+		Interval   int    `json:"interval"`
+	}
+	if err := postEntraForm(ctx, s.tenantID, "devicecode", form, &code); err != nil {
+		return accessToken{}, fmt.Errorf("failed to start device code sign-in: %w", err)
+	}
+
+	// Sign-in instructions go to stderr so they never mix with the output
+	fmt.Fprintln(os.Stderr, code.Message)
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return accessToken{}, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		token, err := s.requestUserToken(ctx, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"client_id":   {s.clientID},
+			"device_code": {code.DeviceCode},
+		})
+		var entraErr *entraError
+		switch {
+		case err == nil:
+			return token, nil
+		case errors.As(err, &entraErr) && entraErr.Code == "authorization_pending":
+			continue
+		case errors.As(err, &entraErr) && entraErr.Code == "slow_down":
+			interval += 5 * time.Second
+			continue
+		default:
+			return accessToken{}, err
+		}
+	}
+
+	return accessToken{}, fmt.Errorf("device code sign-in expired")
+}
+
+// requestUserToken requests a delegated token and keeps its refresh token
+func (s *entraTokenSource) requestUserToken(ctx context.Context, form url.Values) (accessToken, error) {
+	var response entraTokenResponse
+	if err := postEntraForm(ctx, s.tenantID, "token", form, &response); err != nil {
+		return accessToken{}, err
+	}
+	if response.RefreshToken != "" {
+		registerSecrets(response.RefreshToken)
+		s.refreshToken = response.RefreshToken
+	}
+
+	return response.accessToken(), nil
+}
+
+// requestEntraToken requests a token from the tenant token endpoint
+func requestEntraToken(ctx context.Context, tenantID string, form url.Values) (accessToken, error) {
+	var response entraTokenResponse
+	if err := postEntraForm(ctx, tenantID, "token", form, &response); err != nil {
+		return accessToken{}, err
+	}
+
+	return response.accessToken(), nil
+}
+
+type entraTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func (r entraTokenResponse) accessToken() accessToken {
+	return accessToken{value: r.AccessToken, expiresAt: time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)}
+}
+
+// entraError is an OAuth error returned by Microsoft Entra ID
+type entraError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *entraError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// postEntraForm posts a form to an OAuth endpoint of the tenant and decodes
+// the JSON response into v
+func postEntraForm(ctx context.Context, tenantID, endpoint string, form url.Values, v any) error {
+	url := fmt.Sprintf("%s/%s/oauth2/v2.0/%s", entraAuthority, url.PathEscape(tenantID), endpoint)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := authClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		entraErr := &entraError{}
+		if err := json.NewDecoder(resp.Body).Decode(entraErr); err != nil || entraErr.Code == "" {
+			return fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+		return entraErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
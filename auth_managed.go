@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// imdsEndpoint is the Azure Instance Metadata Service token endpoint
+const imdsEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// managedIdentityTokenSource acquires tokens for the Azure identity of the
+// environment the tool runs in, without any secret in the configuration:
+//   - Azure Pipelines workload identity federation (AzureCLI@2 and friends)
+//   - AKS workload identity (AZURE_FEDERATED_TOKEN_FILE)
+//   - App Service and Functions managed identity (IDENTITY_ENDPOINT)
+//   - VM and VMSS managed identity (IMDS)
+type managedIdentityTokenSource struct {
+	tenantID string
+	// clientID selects a user-assigned identity, empty uses the system one
+	clientID string
+}
+
+func newManagedIdentityTokenSource(settings models.AdoSettings) *managedIdentityTokenSource {
+	return &managedIdentityTokenSource{tenantID: settings.TenantId, clientID: settings.ClientId}
+}
+
+func (s *managedIdentityTokenSource) token(ctx context.Context, scope string) (accessToken, error) {
+	if serviceConnection := os.Getenv("AZURESUBSCRIPTION_SERVICE_CONNECTION_ID"); serviceConnection != "" && os.Getenv("SYSTEM_OIDCREQUESTURI") != "" {
+		assertion, err := azurePipelinesOIDCToken(ctx, serviceConnection)
+		if err != nil {
+			return accessToken{}, err
+		}
+		return s.federatedToken(ctx, scope, assertion, os.Getenv("AZURESUBSCRIPTION_TENANT_ID"), os.Getenv("AZURESUBSCRIPTION_CLIENT_ID"))
+	}
+
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		// Kubernetes rotates the projected token, read it for every request
+		assertion, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return accessToken{}, fmt.Errorf("failed to read federated token: %w", err)
+		}
+		return s.federatedToken(ctx, scope, strings.TrimSpace(string(assertion)), os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"))
+	}
+
+	resource := strings.TrimSuffix(scope, "/.default")
+	if endpoint, header := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER"); endpoint != "" && header != "" {
+		query := url.Values{"api-version": {"2019-08-01"}, "resource": {resource}}
+		if s.clientID != "" {
+			query.Set("client_id", s.clientID)
+		}
+		return requestManagedIdentityToken(ctx, endpoint+"?"+query.Encode(), "X-IDENTITY-HEADER", header)
+	}
+
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {resource}}
+	if s.clientID != "" {
+		query.Set("client_id", s.clientID)
+	}
+	return requestManagedIdentityToken(ctx, imdsEndpoint+"?"+query.Encode(), "Metadata", "true")
+}
+
+// federatedToken exchanges an OIDC token issued to the workload for an
+// Entra ID token. The configured tenant and client take precedence over the
+// ones provided by the environment.
+func (s *managedIdentityTokenSource) federatedToken(ctx context.Context, scope, assertion, tenantID, clientID string) (accessToken, error) {
+	if s.tenantID != "" {
+		tenantID = s.tenantID
+	}
+	if s.clientID != "" {
+		clientID = s.clientID
+	}
+	if tenantID == "" || clientID == "" {
+		return accessToken{}, fmt.Errorf("workload identity requires a tenant and client id")
+	}
+
+	return requestEntraToken(ctx, tenantID, url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {clientID},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {assertion},
+		"scope":                 {scope},
+	})
+}
+
+// azurePipelinesOIDCToken requests an OIDC token for a service connection
+// from the Azure Pipelines job
+func azurePipelinesOIDCToken(ctx context.Context, serviceConnection string) (string, error) {
+	url := fmt.Sprintf("%s?api-version=7.1&serviceConnectionId=%s", os.Getenv("SYSTEM_OIDCREQUESTURI"), url.QueryEscape(serviceConnection))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("SYSTEM_ACCESSTOKEN"))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := authClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to request pipeline OIDC token, is SYSTEM_ACCESSTOKEN mapped? unexpected status: %s", resp.Status)
+	}
+
+	var response struct {
+		OIDCToken string `json:"oidcToken"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return response.OIDCToken, nil
+}
+
+// requestManagedIdentityToken requests a token from a managed identity
+// endpoint, which expects a header proving the call comes from the host
+func requestManagedIdentityToken(ctx context.Context, url, header, value string) (accessToken, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set(header, value)
+
+	resp, err := authClient.Do(req)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to reach managed identity endpoint, is a managed identity available? %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return accessToken{}, fmt.Errorf("managed identity endpoint returned unexpected status: %s", resp.Status)
+	}
+
+	// Both endpoints return numbers as strings
+	var response struct {
+		AccessToken string      `json:"access_token"`
+		ExpiresOn   json.Number `json:"expires_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return accessToken{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	expiresOn, err := strconv.ParseInt(response.ExpiresOn.String(), 10, 64)
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to parse token expiry %q: %w", response.ExpiresOn, err)
+	}
+
+	return accessToken{value: response.AccessToken, expiresAt: time.Unix(expiresOn, 0)}, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// servicePrincipalTokenSource acquires application tokens with the client
+// credentials flow, authenticating with a client secret or a certificate
+type servicePrincipalTokenSource struct {
+	tenantID        string
+	clientID        string
+	clientSecret    string
+	certificatePath string
+}
+
+func newServicePrincipalTokenSource(settings models.AdoSettings) *servicePrincipalTokenSource {
+	return &servicePrincipalTokenSource{
+		tenantID:        settings.TenantId,
+		clientID:        settings.ClientId,
+		clientSecret:    settings.ClientSecret,
+		certificatePath: settings.CertificatePath,
+	}
+}
+
+func (s *servicePrincipalTokenSource) token(ctx context.Context, scope string) (accessToken, error) {
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {s.clientID},
+		"scope":      {scope},
+	}
+
+	if s.certificatePath != "" {
+		assertion, err := s.clientAssertion()
+		if err != nil {
+			return accessToken{}, err
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", assertion)
+	} else {
+		form.Set("client_secret", s.clientSecret)
+	}
+
+	return requestEntraToken(ctx, s.tenantID, form)
+}
+
+// clientAssertion returns a JWT signed with the certificate key, proving
+// possession of the certificate registered on the application
+func (s *servicePrincipalTokenSource) clientAssertion() (string, error) {
+	certificate, key, err := readCertificate(s.certificatePath)
+	if err != nil {
+		return "", err
+	}
+
+	thumbprint := sha1.Sum(certificate.Raw)
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode assertion header: %w", err)
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("failed to generate assertion id: %w", err)
+	}
+
+	now := time.Now()
+	claims, err := json.Marshal(map[string]any{
+		"aud": fmt.Sprintf("%s/%s/oauth2/v2.0/token", entraAuthority, url.PathEscape(s.tenantID)),
+		"iss": s.clientID,
+		"sub": s.clientID,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode assertion claims: %w", err)
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign assertion: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// readCertificate reads a PEM file holding the certificate and its RSA
+// private key
+func readCertificate(path string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	var certificate *x509.Certificate
+	var key *rsa.PrivateKey
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			if certificate != nil {
+				continue // Keep the leaf, ignore the chain
+			}
+			if certificate, err = x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse certificate: %w", err)
+			}
+		case "RSA PRIVATE KEY":
+			if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+		case "PRIVATE KEY":
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+			rsaKey, ok := parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, fmt.Errorf("unsupported private key type %T, only RSA keys are supported", parsed)
+			}
+			key = rsaKey
+		}
+	}
+
+	if certificate == nil || key == nil {
+		return nil, nil, fmt.Errorf("%s must contain a PEM certificate and an unencrypted RSA private key", path)
+	}
+
+	return certificate, key, nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// Targets of the bench command
+const (
+	benchTargetMock = "mock"
+	benchTargetReal = "real"
+)
+
+// benchOptions configures the synthetic batch of the bench command and the
+// settings it is measured with
+type benchOptions struct {
+	items  int
+	target string
+	// concurrency are the numbers of requests sent in parallel
+	concurrency []int
+	// batchSizes are the numbers of work items updated per request, 1
+	// updating them one by one
+	batchSizes []int
+	yes        bool
+}
+
+// benchScenario is the measure of a phase of the bench with a setting
+type benchScenario struct {
+	// Phase is create or update
+	Phase          string  `json:"phase"`
+	Concurrency    int     `json:"concurrency"`
+	BatchSize      int     `json:"batchSize"`
+	Items          int     `json:"items"`
+	Requests       int     `json:"requests"`
+	Failed         int     `json:"failed"`
+	Throttled      int     `json:"throttled"`
+	DurationMs     float64 `json:"durationMs"`
+	ItemsPerSecond float64 `json:"itemsPerSecond"`
+	P50LatencyMs   float64 `json:"p50LatencyMs"`
+	P95LatencyMs   float64 `json:"p95LatencyMs"`
+	P99LatencyMs   float64 `json:"p99LatencyMs"`
+}
+
+// benchReport is the output of the bench command
+type benchReport struct {
+	Target    string          `json:"target"`
+	RunID     string          `json:"runId"`
+	Items     int             `json:"items"`
+	Scenarios []benchScenario `json:"scenarios"`
+}
+
+// runBench creates a synthetic batch of tasks with every concurrency, updates
+// them with every batch size and concurrency, reports the throughput and
+// latency of each and deletes the tasks
+func runBench(ctx context.Context, settings models.AdoSettings, bench benchOptions, options applyOptions, logger *zap.Logger) int {
+	if bench.target != benchTargetMock && bench.target != benchTargetReal {
+		logger.Error("Unknown bench target, expected mock or real", zap.String("target", bench.target))
+		return exitValidation
+	}
+	if bench.items <= 0 {
+		logger.Error("--items must be positive", zap.Int("items", bench.items))
+		return exitValidation
+	}
+	if len(bench.concurrency) == 0 || slices.Min(bench.concurrency) <= 0 {
+		logger.Error("--concurrency must be positive", zap.Ints("concurrency", bench.concurrency))
+		return exitValidation
+	}
+	if len(bench.batchSizes) == 0 || slices.Min(bench.batchSizes) <= 0 || slices.Max(bench.batchSizes) > adobatch.MaxBatchSize {
+		logger.Error(fmt.Sprintf("--batch-size must be from 1 to %d", adobatch.MaxBatchSize), zap.Ints("batch_size", bench.batchSizes))
+		return exitValidation
+	}
+
+	report := benchReport{Target: bench.target, RunID: "bench-" + newRunID(time.Now()), Items: bench.items}
+	if bench.target == benchTargetReal && !bench.yes {
+		question := fmt.Sprintf("Create, update and delete %d tasks in %s/%s?", bench.items*len(bench.concurrency), settings.Organization, settings.Project)
+		if code := confirm(question, "run the bench", logger); code != exitSuccess {
+			return code
+		}
+	}
+
+	client := newClient(settings, logger)
+	tags := adobatch.MergeTags(adobatch.AutomationTag, "run-"+report.RunID)
+	logger.Info("Starting bench", zap.String("target", bench.target), zap.String("run_id", report.RunID), zap.Int("items", bench.items), zap.Ints("concurrency", bench.concurrency), zap.Ints("batch_size", bench.batchSizes))
+
+	for _, concurrency := range bench.concurrency {
+		ids := make([]int, bench.items)
+		create := benchPhase(ctx, "create", concurrency, 1, bench.items, func(ctx context.Context, job int) (int, error) {
+			id, err := client.CreateWorkItem(ctx, settings, "Task", []map[string]any{
+				{"op": "add", "path": "/fields/System.Title", "value": fmt.Sprintf("Bench task %d", job+1)},
+				{"op": "add", "path": "/fields/System.Tags", "value": tags},
+			})
+			ids[job] = id
+			return 1, err
+		})
+		report.Scenarios = append(report.Scenarios, create)
+		logBenchScenario(create, logger)
+
+		created := slices.DeleteFunc(ids, func(id int) bool { return id == 0 })
+		for _, batchSize := range bench.batchSizes {
+			for _, updateConcurrency := range bench.concurrency {
+				update := benchUpdate(ctx, client, settings, created, updateConcurrency, batchSize)
+				report.Scenarios = append(report.Scenarios, update)
+				logBenchScenario(update, logger)
+			}
+		}
+
+		// Delete the tasks even when the bench is interrupted
+		cleanup := benchPhase(context.WithoutCancel(ctx), "delete", slices.Max(bench.concurrency), 1, len(created), func(ctx context.Context, job int) (int, error) {
+			return 1, client.DeleteWorkItem(ctx, settings, created[job])
+		})
+		if cleanup.Failed > 0 {
+			logger.Warn("Failed to delete bench tasks, delete them with the delete command", zap.Int("work_items", cleanup.Failed), zap.String("run_id", report.RunID))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err := printOutput(os.Stdout, options.output, report, func(w io.Writer) { printBenchReport(w, report) }); err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+	}
+
+	if ctx.Err() != nil {
+		return exitAborted
+	}
+	for _, scenario := range report.Scenarios {
+		if scenario.Requests > scenario.Failed {
+			return exitSuccess
+		}
+	}
+
+	return exitError
+}
+
+// benchUpdate updates a description field of the tasks, one by one with a
+// batch size of 1 or with the batch API
+func benchUpdate(ctx context.Context, client *adobatch.Client, settings models.AdoSettings, ids []int, concurrency, batchSize int) benchScenario {
+	operations := []map[string]interface{}{
+		{"op": "add", "path": "/fields/System.Description", "value": fmt.Sprintf("Updated with a batch size of %d and a concurrency of %d", batchSize, concurrency)},
+	}
+
+	if batchSize == 1 {
+		return benchPhase(ctx, "update", concurrency, 1, len(ids), func(ctx context.Context, job int) (int, error) {
+			return 1, client.UpdateWorkItem(ctx, settings, ids[job], operations)
+		})
+	}
+
+	batches := (len(ids) + batchSize - 1) / batchSize
+	return benchPhase(ctx, "update", concurrency, batchSize, batches, func(ctx context.Context, job int) (int, error) {
+		batch := ids[job*batchSize : min((job+1)*batchSize, len(ids))]
+		updates := make([]adobatch.FollowUp, 0, len(batch))
+		for _, id := range batch {
+			updates = append(updates, adobatch.FollowUp{Settings: settings, ID: id, Item: fmt.Sprintf("task %d", id), Operations: operations})
+		}
+		return len(batch), client.UpdateWorkItems(ctx, settings, updates)
+	})
+}
+
+// benchPhase sends jobs requests with concurrency workers and measures them.
+// send returns the number of work items of a request.
+func benchPhase(ctx context.Context, phase string, concurrency, batchSize, jobs int, send func(ctx context.Context, job int) (int, error)) benchScenario {
+	scenario := benchScenario{Phase: phase, Concurrency: concurrency, BatchSize: batchSize}
+	latencies := make([]time.Duration, 0, jobs)
+	succeeded := 0
+
+	var mu sync.Mutex
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range min(concurrency, max(jobs, 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				requestStart := time.Now()
+				items, err := send(ctx, job)
+				latency := time.Since(requestStart)
+
+				mu.Lock()
+				scenario.Requests++
+				scenario.Items += items
+				latencies = append(latencies, latency)
+				if err != nil {
+					scenario.Failed++
+					if errors.Is(err, adobatch.ErrThrottled) {
+						scenario.Throttled++
+					}
+				} else {
+					succeeded += items
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for job := 0; job < jobs && ctx.Err() == nil; job++ {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	duration := time.Since(start)
+	scenario.DurationMs = float64(duration.Microseconds()) / 1000
+	if duration > 0 {
+		scenario.ItemsPerSecond = float64(succeeded) / duration.Seconds()
+	}
+	slices.Sort(latencies)
+	scenario.P50LatencyMs = benchPercentile(latencies, 0.50)
+	scenario.P95LatencyMs = benchPercentile(latencies, 0.95)
+	scenario.P99LatencyMs = benchPercentile(latencies, 0.99)
+
+	return scenario
+}
+
+// benchPercentile returns the nearest-rank percentile of sorted latencies, in
+// milliseconds
+func benchPercentile(latencies []time.Duration, p float64) float64 {
+	if len(latencies) == 0 {
+		return 0
+	}
+	rank := int(p*float64(len(latencies))+0.5) - 1
+
+	return float64(latencies[min(max(rank, 0), len(latencies)-1)].Microseconds()) / 1000
+}
+
+func logBenchScenario(scenario benchScenario, logger *zap.Logger) {
+	logger.Info("Bench scenario done",
+		zap.String("phase", scenario.Phase),
+		zap.Int("concurrency", scenario.Concurrency),
+		zap.Int("batch_size", scenario.BatchSize),
+		zap.Float64("items_per_second", scenario.ItemsPerSecond),
+		zap.Int("failed", scenario.Failed),
+		zap.Int("throttled", scenario.Throttled))
+}
+
+// printBenchReport writes a table of the scenarios of the bench
+func printBenchReport(w io.Writer, report benchReport) {
+	fmt.Fprintf(w, "Bench of %d tasks against the %s target, run %s\n\n", report.Items, report.Target, report.RunID)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tCONCURRENCY\tBATCH\tREQUESTS\tFAILED\tTHROTTLED\tDURATION\tITEMS/S\tP50\tP95\tP99\t")
+	for _, s := range report.Scenarios {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%.1f\t%.0fms\t%.0fms\t%.0fms\t\n",
+			s.Phase, s.Concurrency, s.BatchSize, s.Requests, s.Failed, s.Throttled,
+			time.Duration(s.DurationMs*float64(time.Millisecond)).Round(time.Millisecond), s.ItemsPerSecond,
+			s.P50LatencyMs, s.P95LatencyMs, s.P99LatencyMs)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// bulkResult is the outcome of a bulk command on a single work item
+type bulkResult struct {
+	Id     int    `json:"id"`
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Url    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkSelection selects the work items of a bulk command by tag, run and
+// assignee
+type bulkSelection struct {
+	tag   string
+	runID string
+	owner string
+	// open leaves out the closed work items
+	open bool
+}
+
+// query returns the WIQL query selecting the work items. Work items of a run
+// are only selected when they carry the automation tag.
+func (s bulkSelection) query() (string, error) {
+	if s.tag == "" && s.runID == "" && s.owner == "" {
+		return "", fmt.Errorf("no work items selected, set a tag, a run or an assignee")
+	}
+
+	conditions := []string{"[System.TeamProject] = @project"}
+	if s.tag != "" {
+		conditions = append(conditions, "[System.Tags] CONTAINS "+adobatch.WIQLString(s.tag))
+	}
+	if s.runID != "" {
+		conditions = append(conditions,
+			"[System.Tags] CONTAINS "+adobatch.WIQLString(adobatch.AutomationTag),
+			"[System.Tags] CONTAINS "+adobatch.WIQLString("run-"+s.runID))
+	}
+	if s.owner != "" {
+		conditions = append(conditions, "[System.AssignedTo] = "+adobatch.WIQLString(s.owner))
+	}
+	if s.open {
+		conditions = append(conditions, adobatch.OpenCondition())
+	}
+
+	return "SELECT [System.Id], [System.WorkItemType], [System.Title] FROM WorkItems WHERE " + strings.Join(conditions, " AND ") + " ORDER BY [System.Id]", nil
+}
+
+// selectWorkItems runs the query of a bulk command and returns its work
+// items as skipped results, the type and title are set when the query
+// selects them
+func selectWorkItems(ctx context.Context, client *adobatch.Client, settings models.AdoSettings, query string) ([]bulkResult, error) {
+	result, err := client.RunQuery(ctx, settings, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tree queries can return a work item under several parents
+	seen := map[int]bool{}
+	results := make([]bulkResult, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		if seen[row.ID] {
+			continue
+		}
+		seen[row.ID] = true
+		results = append(results, bulkResult{
+			Id:     row.ID,
+			Type:   queryValue(row.Fields["System.WorkItemType"]),
+			Title:  queryValue(row.Fields["System.Title"]),
+			Url:    adobatch.WorkItemURL(settings.Organization, settings.Project, row.ID),
+			Status: models.StatusSkipped,
+		})
+	}
+
+	return results, nil
+}
+
+// queryExitCode returns the exit code of a bulk command whose query failed
+func queryExitCode(err error) int {
+	switch {
+	case errors.Is(err, adobatch.ErrAuth):
+		return exitAuth
+	case errors.Is(err, adobatch.ErrValidation):
+		return exitValidation
+	}
+
+	return exitError
+}
+
+// errBulkSkipped is returned by the apply function of a bulk command for the
+// work items left unchanged, which stay skipped
+var errBulkSkipped = errors.New("nothing to change")
+
+// runBulk calls apply on every work item with the failure policy of runs,
+// marking them with status, prints the results and returns the exit code.
+// Work items left when the policy aborts stay skipped.
+func runBulk(ctx context.Context, results []bulkResult, action, status string, apply func(ctx context.Context, id int) error, options applyOptions, logger *zap.Logger) int {
+	outcome := adobatch.NewOutcome(len(results), adobatch.FailurePolicy{
+		MaxFailures:    options.maxFailures,
+		MaxFailureRate: options.maxFailureRate,
+		FailFast:       options.failFast,
+	})
+	for i := range results {
+		result := &results[i]
+		if outcome.Aborted() || ctx.Err() != nil {
+			continue
+		}
+
+		if err := apply(ctx, result.Id); errors.Is(err, errBulkSkipped) {
+			logger.Debug("Work item skipped", zap.Int("id", result.Id), zap.Error(err))
+			continue
+		} else if err != nil {
+			logger.Error("Failed to "+action+" work item", zap.Int("id", result.Id), zap.Error(err))
+			result.Status = models.StatusFailed
+			result.Error = err.Error()
+			outcome.Record(err)
+			continue
+		}
+		result.Status = status
+		logger.Debug("Work item "+status, zap.Int("id", result.Id), zap.String("url", result.Url))
+	}
+
+	if err := printOutput(os.Stdout, options.output, results, func(w io.Writer) { printBulkResults(w, results) }); err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+	}
+
+	return exitCodeFor(outcome.Status())
+}
+
+// printBulkResults writes a table of the work items of a bulk command
+func printBulkResults(w io.Writer, results []bulkResult) {
+	color := useColor(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tTITLE\tSTATUS\tURL\tERROR")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", result.Id, result.Type, result.Title, colorStatus(result.Status, color), result.Url, result.Error)
+	}
+	tw.Flush()
+}
+
+// confirmBulk lists the work items of a bulk command and asks for
+// confirmation, and returns exitSuccess when confirmed. Confirmation needs a
+// terminal, --yes skips it.
+func confirmBulk(results []bulkResult, question, action string, logger *zap.Logger) int {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		logger.Error("Refusing to "+action+" without confirmation, pass --yes in non-interactive runs", zap.Int("work_items", len(results)))
+		return exitValidation
+	}
+	printBulkResults(os.Stderr, results)
+	fmt.Fprintln(os.Stderr)
+
+	return confirm(question, action, logger)
+}
+
+// confirm asks a question on the terminal and returns exitSuccess when
+// confirmed
+func confirm(question, action string, logger *zap.Logger) int {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		logger.Error("Refusing to " + action + " without confirmation, pass --yes in non-interactive runs")
+		return exitValidation
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		logger.Info(strings.ToUpper(action[:1]) + action[1:] + " cancelled")
+		return exitAborted
+	}
+
+	return exitSuccess
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// defaultCheckpointFile is where the checkpoint of a chunked run is saved
+const defaultCheckpointFile = ".ado_batch_creator/checkpoint.json"
+
+// readCheckpoint reads the results a chunked run saved after its last chunk
+func readCheckpoint(path string) (adobatch.Results, error) {
+	var results adobatch.Results
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return results, err
+	}
+	if err := json.Unmarshal(data, &results); err != nil {
+		return results, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	return results, nil
+}
+
+// writeCheckpoint replaces the checkpoint with the results of the chunks done,
+// through a temporary file so an interrupted write keeps the previous one
+func writeCheckpoint(path string, results adobatch.Results) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// runningInAzurePipelines reports whether the process runs on an Azure
+// Pipelines agent
+func runningInAzurePipelines() bool {
+	return strings.EqualFold(os.Getenv("TF_BUILD"), "true")
+}
+
+// ciRunURL returns the page of the current Azure Pipelines or GitHub
+// Actions run, where the reports are published as artifacts, or an empty
+// string outside of CI
+func ciRunURL() string {
+	if runningInAzurePipelines() && os.Getenv("BUILD_BUILDID") != "" {
+		return fmt.Sprintf("%s%s/_build/results?buildId=%s", os.Getenv("SYSTEM_COLLECTIONURI"), url.PathEscape(os.Getenv("SYSTEM_TEAMPROJECT")), os.Getenv("BUILD_BUILDID"))
+	}
+	if os.Getenv("GITHUB_RUN_ID") != "" {
+		return fmt.Sprintf("%s/%s/actions/runs/%s", os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"))
+	}
+
+	return ""
+}
+
+// writeAzurePipelinesCommands emits logging commands so the pipeline surfaces
+// the results natively: output variables for the next steps and an issue for
+// every failed work item
+func writeAzurePipelinesCommands(w io.Writer, results adobatch.Results, resultsFile string) {
+	var ids []string
+	for _, story := range results.UserStories {
+		for _, item := range append([]adobatch.ItemResult{story}, story.Tasks...) {
+			if item.Status == models.StatusCreated {
+				ids = append(ids, strconv.Itoa(item.Id))
+			}
+			if item.Error != "" {
+				fmt.Fprintf(w, "##vso[task.logissue type=error]Failed to create %s %q: %s\n", item.Type, item.Name, escapeVSO(item.Error))
+			}
+		}
+	}
+
+	setAzurePipelinesVariable(w, "createdIds", strings.Join(ids, ","))
+	setAzurePipelinesVariable(w, "createdCount", strconv.Itoa(results.Summary.Created))
+	setAzurePipelinesVariable(w, "failedCount", strconv.Itoa(results.Summary.Failed))
+	if resultsFile != "" {
+		setAzurePipelinesVariable(w, "resultsFile", resultsFile)
+	}
+
+	if results.Summary.Failed > 0 {
+		fmt.Fprintln(w, "##vso[task.complete result=SucceededWithIssues;]Some work items failed to be created")
+	}
+}
+
+// setAzurePipelinesVariable sets an output variable, readable by later jobs
+// as dependencies.<job>.outputs['<step>.<name>']
+func setAzurePipelinesVariable(w io.Writer, name, value string) {
+	fmt.Fprintf(w, "##vso[task.setvariable variable=%s;isOutput=true]%s\n", name, escapeVSO(value))
+}
+
+// escapeVSO escapes a logging command value so it cannot break the command
+func escapeVSO(value string) string {
+	return strings.NewReplacer("%", "%AZP25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+// writeGitHubActionsOutputs writes the step outputs and the step summary when
+// running in GitHub Actions, detected through GITHUB_OUTPUT and
+// GITHUB_STEP_SUMMARY
+func writeGitHubActionsOutputs(results adobatch.Results, resultsFile string) error {
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		ids := []int{}
+		for _, story := range results.UserStories {
+			for _, item := range append([]adobatch.ItemResult{story}, story.Tasks...) {
+				if item.Status == models.StatusCreated {
+					ids = append(ids, item.Id)
+				}
+			}
+		}
+		idsJSON, err := json.Marshal(ids)
+		if err != nil {
+			return fmt.Errorf("failed to marshal created IDs: %w", err)
+		}
+
+		outputs := fmt.Sprintf("created-count=%d\nfailed-count=%d\nids=%s\n", results.Summary.Created, results.Summary.Failed, idsJSON)
+		if resultsFile != "" {
+			outputs += "results-file=" + resultsFile + "\n"
+		}
+		if err := appendFile(path, outputs); err != nil {
+			return fmt.Errorf("failed to write GitHub Actions outputs: %w", err)
+		}
+	}
+
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		if err := appendFile(path, renderMarkdownReport(results)); err != nil {
+			return fmt.Errorf("failed to write GitHub Actions step summary: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func appendFile(path, content string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
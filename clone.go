@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// cloneWorkItem copies a work item and its descendants, and prints the
+// clones created
+func cloneWorkItem(ctx context.Context, settings models.AdoSettings, arg string, options adobatch.CloneOptions, output string, logger *zap.Logger) int {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		logger.Error("Missing or invalid work item ID: clone <id>", zap.String("id", arg))
+		return exitValidation
+	}
+
+	clones, err := newClient(settings, logger).Clone(ctx, settings, id, options)
+
+	if err := printOutput(os.Stdout, output, clones, func(w io.Writer) { printClones(w, clones) }); err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+	}
+
+	if err != nil {
+		logger.Error("Failed to clone work item", zap.Int("id", id), zap.Int("cloned", len(clones)), zap.Error(err))
+		switch {
+		case errors.Is(err, adobatch.ErrAuth):
+			return exitAuth
+		case len(clones) > 0:
+			return exitPartialFailure
+		}
+		return exitError
+	}
+
+	logger.Info("Work item tree cloned", zap.Int("id", id), zap.Int("cloned", len(clones)))
+
+	return exitSuccess
+}
+
+// printClones writes a table of the clones created
+func printClones(w io.Writer, clones []adobatch.Clone) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tTITLE\tORIGINAL ID\tID\tURL")
+	for _, clone := range clones {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", clone.Type, clone.Title, clone.OriginalID, clone.ID, clone.URL)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"github.com/spf13/viper"
+)
+
+// configProblem is a missing or invalid configuration key
+type configProblem struct {
+	Key      string
+	Problem  string
+	Expected string
+}
+
+// devopsKeys are the keys accepted under devops, lower case as Viper stores them
+var devopsKeys = []string{
+	"organization", "project", "pat", "auth", "tenantid", "clientid", "clientsecret",
+	"certificatepath", "patkeyvault", "patexpireson", "defaultiteration", "defaulttags", "batchsize", "organizations",
+}
+
+// validateConfig checks the whole configuration of a command and returns
+// every problem found, so they can all be fixed at once
+func validateConfig(command string) []configProblem {
+	var problems []configProblem
+	add := func(key, problem, expected string) {
+		problems = append(problems, configProblem{Key: key, Problem: problem, Expected: expected})
+	}
+
+	for key := range viper.GetStringMap("devops") {
+		if !slices.Contains(devopsKeys, key) {
+			add("devops."+key, "unknown key", "one of "+strings.Join(devopsKeys, ", "))
+		}
+	}
+
+	organization := viper.GetString("devops.organization")
+	switch {
+	case organization == "":
+		add("devops.organization", "missing", "the organization name, as in https://dev.azure.com/<organization>, or --organization")
+	case strings.ContainsAny(organization, "/:"):
+		add("devops.organization", fmt.Sprintf("%q is a URL", organization), "the organization name only, as in https://dev.azure.com/<organization>")
+	}
+
+	if viper.GetString("devops.project") == "" {
+		add("devops.project", "missing", "the project name, or --project")
+	}
+
+	validateAuthConfig("devops.", add)
+	for name := range viper.GetStringMap("devops.organizations") {
+		validateAuthConfig("devops.organizations."+name+".", add)
+	}
+
+	if vault := viper.GetString("devops.patKeyVault.vaultUrl"); vault != "" {
+		if parsed, err := url.Parse(vault); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			add("devops.patKeyVault.vaultUrl", fmt.Sprintf("invalid URL %q", vault), "a vault URL such as https://my-vault.vault.azure.net")
+		}
+		if viper.GetString("devops.patKeyVault.secretName") == "" {
+			add("devops.patKeyVault.secretName", "missing", "the name of the secret holding the PAT")
+		}
+		if credential := viper.GetString("devops.patKeyVault.credential"); credential != "" && (credential == authPAT || !slices.Contains(authModes, credential)) {
+			add("devops.patKeyVault.credential", fmt.Sprintf("invalid credential %q", credential), "one of "+strings.Join(authModes[1:], ", "))
+		}
+	}
+
+	if value := viper.GetString("devops.patExpiresOn"); value != "" {
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			add("devops.patExpiresOn", fmt.Sprintf("invalid date %q", value), "a date as YYYY-MM-DD")
+		}
+	}
+
+	if size := viper.GetInt("devops.batchSize"); size < 0 || size > adobatch.MaxBatchSize {
+		add("devops.batchSize", fmt.Sprintf("invalid batch size %d", size), fmt.Sprintf("a number of work items from 1 to %d", adobatch.MaxBatchSize))
+	}
+
+	if command == "serve" && viper.GetString("server.token") == "" {
+		add("server.token", "missing", "a bearer token required from API clients, e.g. from the SERVER_TOKEN environment variable")
+	}
+
+	if viper.GetString("notifications.email.host") != "" {
+		if from := viper.GetString("notifications.email.from"); from == "" {
+			add("notifications.email.from", "missing", "the sender address of the email summary")
+		} else if _, err := mail.ParseAddress(from); err != nil {
+			add("notifications.email.from", fmt.Sprintf("invalid address %q", from), "an email address such as ado-bot@example.com")
+		}
+		to := viper.GetStringSlice("notifications.email.to")
+		if len(to) == 0 {
+			add("notifications.email.to", "missing", "the list of recipients of the email summary")
+		}
+		for _, address := range to {
+			if _, err := mail.ParseAddress(address); err != nil {
+				add("notifications.email.to", fmt.Sprintf("invalid address %q", address), "a list of email addresses")
+			}
+		}
+	}
+
+	if script := viper.GetString("transform.script"); script != "" {
+		if _, err := os.Stat(script); err != nil {
+			add("transform.script", fmt.Sprintf("unreadable file %q", script), "the path of a Starlark script defining transform(item)")
+		}
+	}
+
+	if template := viper.GetString("hooks.template"); command == "serve" && template != "" {
+		if _, err := os.Stat(template); err != nil {
+			add("hooks.template", fmt.Sprintf("unreadable file %q", template), "the path of the items file template used for breakdowns")
+		}
+	}
+
+	if ttl := viper.GetString("metadata.cacheTTL"); ttl != "" {
+		if _, err := time.ParseDuration(ttl); err != nil {
+			add("metadata.cacheTTL", fmt.Sprintf("invalid duration %q", ttl), "a duration such as 24h or 30m")
+		}
+	}
+
+	if _, err := adobatch.ParseAssignmentStrategy(viper.GetString("assignment")); err != nil {
+		add("assignment", fmt.Sprintf("unknown strategy %q", viper.GetString("assignment")), "round-robin or least-loaded")
+	}
+
+	var rules []adobatch.AssignmentRule
+	if err := viper.UnmarshalKey("assignmentRules", &rules); err != nil {
+		add("assignmentRules", "invalid rules", "a list of rules with area, type and owner")
+	}
+	for i, rule := range rules {
+		key := fmt.Sprintf("assignmentRules[%d]", i)
+		if rule.Owner == "" {
+			add(key+".owner", "missing", `an identity or "@Team Name"`)
+		}
+		if rule.Type != "" && !strings.EqualFold(rule.Type, "User Story") && !strings.EqualFold(rule.Type, "Task") {
+			add(key+".type", fmt.Sprintf("unknown type %q", rule.Type), "User Story or Task")
+		}
+	}
+
+	if _, err := adobatch.ParseTaskNumbering(viper.GetString("titles.taskNumbering")); err != nil {
+		add("titles.taskNumbering", fmt.Sprintf("unknown numbering %q", viper.GetString("titles.taskNumbering")), "none, fraction or index")
+	}
+	if _, err := adobatch.ParseTitleOverflow(viper.GetString("titles.overflow")); err != nil {
+		add("titles.overflow", fmt.Sprintf("unknown policy %q", viper.GetString("titles.overflow")), "fail, truncate or description")
+	}
+
+	if (command == "" || command == "apply" || command == "verify" || command == "validate") && viper.GetString("itemsPath") == "" {
+		add("itemsPath", "missing", "the path of the JSON items file")
+	}
+
+	return problems
+}
+
+// validateAuthConfig checks the authentication settings under prefix
+func validateAuthConfig(prefix string, add func(key, problem, expected string)) {
+	auth := viper.GetString(prefix + "auth")
+	if auth != "" && !slices.Contains(authModes, auth) {
+		add(prefix+"auth", fmt.Sprintf("invalid mode %q", auth), "one of "+strings.Join(authModes, ", "))
+	}
+
+	if auth == authServicePrincipal {
+		for _, key := range []string{"tenantId", "clientId"} {
+			if viper.GetString(prefix+key) == "" && viper.GetString("devops."+key) == "" {
+				add(prefix+key, "missing", "the Entra ID "+strings.TrimSuffix(key, "Id")+" ID of the service principal")
+			}
+		}
+		if viper.GetString(prefix+"clientSecret") == "" && viper.GetString(prefix+"certificatePath") == "" &&
+			viper.GetString("devops.clientSecret") == "" && viper.GetString("devops.certificatePath") == "" {
+			add(prefix+"clientSecret", "missing", "a client secret, or a certificate in "+prefix+"certificatePath")
+		}
+	}
+
+	if path := viper.GetString(prefix + "certificatePath"); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			add(prefix+"certificatePath", fmt.Sprintf("cannot read %q", path), "a PEM file with the certificate and its private key")
+		}
+	}
+}
+
+// parseFailureRate parses a failure rate given either as a percentage ("10%")
+// or as a fraction ("0.1")
+func parseFailureRate(value string) (float64, error) {
+	rate, err := parseShare(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid failure rate %q: %w", value, err)
+	}
+	if rate > 1 {
+		return 0, fmt.Errorf("invalid failure rate %q: must be between 0%% and 100%%", value)
+	}
+
+	return rate, nil
+}
+
+// parseShare parses a positive share given either as a percentage ("10%") or
+// as a fraction ("0.1"), empty meaning 0
+func parseShare(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	share, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if strings.HasSuffix(value, "%") {
+		share /= 100
+	}
+	if share < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+
+	return share, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cronValues lists the values of a cron field bit set
+func cronValues(bits uint64) []int {
+	var values []int
+	for value := 0; value < 64; value++ {
+		if bits&(1<<value) != 0 {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field string
+		min   int
+		max   int
+		names []string
+		want  []int
+	}{
+		{"*", 0, 5, nil, []int{0, 1, 2, 3, 4, 5}},
+		{"7", 0, 59, nil, []int{7}},
+		{"1-4", 0, 59, nil, []int{1, 2, 3, 4}},
+		{"*/15", 0, 59, nil, []int{0, 15, 30, 45}},
+		{"10-20/5", 0, 59, nil, []int{10, 15, 20}},
+		{"50/4", 0, 59, nil, []int{50, 54, 58}},
+		{"1,5,9-11", 0, 23, nil, []int{1, 5, 9, 10, 11}},
+		{"*/10,3", 0, 23, nil, []int{0, 3, 10, 20}},
+		{"MON-FRI", 0, 7, cronDays, []int{1, 2, 3, 4, 5}},
+		{"sat,SUN", 0, 7, cronDays, []int{0, 6}},
+		{"JAN,jul-sep", 1, 12, cronMonths, []int{1, 7, 8, 9}},
+		{"*/3", 1, 12, cronMonths, []int{1, 4, 7, 10}},
+	}
+	for _, tt := range tests {
+		bits, err := parseCronField(tt.field, tt.min, tt.max, tt.names)
+		if err != nil {
+			t.Errorf("%s: %v", tt.field, err)
+			continue
+		}
+		if got := cronValues(bits); !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{"", "expected 5 fields, got 0"},
+		{"0 9 * *", "expected 5 fields, got 4"},
+		{"0 9 * * MON extra", "expected 5 fields, got 6"},
+		{"60 * * * *", "invalid cron minute: invalid value \"60\""},
+		{"* 24 * * *", "invalid cron hour"},
+		{"* * 0 * *", "invalid cron day of month"},
+		{"* * 32 * *", "invalid cron day of month"},
+		{"* * * 13 *", "invalid cron month"},
+		{"* * * FOO *", "invalid cron month"},
+		{"* * * * 8", "invalid cron day of week"},
+		{"* * * * MONDAY", "invalid cron day of week"},
+		{"5-1 * * * *", "invalid range \"5-1\""},
+		{"*/0 * * * *", "invalid step \"0\""},
+		{"*/x * * * *", "invalid step \"x\""},
+		{"1,,2 * * * *", "invalid value \"\""},
+		{"-5 * * * *", "invalid value \"\""},
+	}
+	for _, tt := range tests {
+		if _, err := parseCron(tt.expression); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error = %v, want %q", tt.expression, err, tt.err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-10-16 is a Friday
+	from := time.Date(2026, 10, 16, 10, 30, 45, 0, time.UTC)
+	tests := []struct {
+		name       string
+		expression string
+		from       time.Time
+		want       time.Time
+	}{
+		{"every minute", "* * * * *", from, time.Date(2026, 10, 16, 10, 31, 0, 0, time.UTC)},
+		{"not the current minute", "30 10 * * *", time.Date(2026, 10, 16, 10, 30, 0, 0, time.UTC), time.Date(2026, 10, 17, 10, 30, 0, 0, time.UTC)},
+		{"later today", "0 12 * * *", from, time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)},
+		{"tomorrow", "0 9 * * *", from, time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)},
+		{"steps", "*/20 * * * *", from, time.Date(2026, 10, 16, 10, 40, 0, 0, time.UTC)},
+		{"list of hours", "0 8,14,20 * * *", from, time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC)},
+		{"day of week", "0 9 * * MON", from, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"sunday as 7", "0 9 * * 7", from, time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)},
+		{"weekdays", "0 9 * * MON-FRI", time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"day of month", "0 9 1 * *", from, time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)},
+		// With both days restricted, either matches
+		{"day of month or week", "0 9 20 * MON", from, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"day of week or month", "0 9 17 * MON", from, time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)},
+		// A star with a step is still unrestricted, like Vixie cron
+		{"day of week with stepped day of month", "0 9 */2 * MON", from, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"month rollover", "0 0 1 * *", time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"year rollover", "0 0 1 JAN *", from, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"end of year", "59 23 31 12 *", time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2027, 12, 31, 23, 59, 0, 0, time.UTC)},
+		{"31st skips short months", "0 9 31 * *", from, time.Date(2026, 10, 31, 9, 0, 0, 0, time.UTC)},
+		{"31st after october", "0 9 31 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 12, 31, 9, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 30 2 *", from, time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expression)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := schedule.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%s: next(%s) of %q = %s, want %s", tt.name, tt.from, tt.expression, got, tt.want)
+		}
+	}
+}
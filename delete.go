@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// deleteOptions selects the work items the delete command removes
+type deleteOptions struct {
+	selection bulkSelection
+	// dryRun lists the work items without deleting them
+	dryRun bool
+	// yes skips the confirmation prompt
+	yes bool
+}
+
+// deleteWorkItems moves the work items with the tag or created by the run to
+// the Recycle Bin, after listing them and asking for confirmation
+func deleteWorkItems(ctx context.Context, settings models.AdoSettings, deletion deleteOptions, options applyOptions, logger *zap.Logger) int {
+	query, err := deletion.selection.query()
+	if err != nil {
+		logger.Error("Invalid delete selection", zap.Error(err))
+		return exitValidation
+	}
+
+	client := newClient(settings, logger)
+	results, err := selectWorkItems(ctx, client, settings, query)
+	if err != nil {
+		logger.Error("Failed to run query", zap.Error(err))
+		return queryExitCode(err)
+	}
+	if len(results) == 0 {
+		logger.Info("No work items to delete", zap.String("tag", deletion.selection.tag), zap.String("run_id", deletion.selection.runID))
+		return exitSuccess
+	}
+
+	if deletion.dryRun {
+		logger.Info("Dry run, work items are not deleted", zap.Int("work_items", len(results)))
+		printBulkResults(os.Stderr, results)
+		return exitSuccess
+	}
+
+	if !deletion.yes {
+		question := fmt.Sprintf("Move %d work items of %s/%s to the Recycle Bin?", len(results), settings.Organization, settings.Project)
+		if exitCode := confirmBulk(results, question, "delete", logger); exitCode != exitSuccess {
+			return exitCode
+		}
+	}
+	logger.Info("Deleting work items", zap.Int("work_items", len(results)))
+
+	return runBulk(ctx, results, "delete", models.StatusDeleted, func(ctx context.Context, id int) error {
+		return client.DeleteWorkItem(ctx, settings, id)
+	}, options, logger)
+}
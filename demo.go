@@ -0,0 +1,24 @@
+package main
+
+import "github.com/spf13/viper"
+
+// demoOrganization and demoProject are the organization and project of the
+// demo server
+const (
+	demoOrganization = "demo"
+	demoProject      = "demo"
+	// demoPAT is redacted from the logs like any PAT, so it must not appear
+	// in the names and URLs of the demo
+	demoPAT = "demo-pat"
+)
+
+// useDemo points the configuration at the demo organization and project,
+// with a placeholder PAT, and the other settings untouched
+func useDemo() {
+	viper.Set("devops.organization", demoOrganization)
+	viper.Set("devops.project", demoProject)
+	viper.Set("devops.pat", demoPAT)
+	viper.Set("devops.auth", authPAT)
+	viper.Set("devops.patKeyVault.vaultUrl", "")
+	viper.Set("devops.organizations", map[string]any{})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// duplicateAsk prompts for every user story that already exists
+const duplicateAsk = "ask"
+
+// duplicateResolver returns the resolver of the --on-duplicate policy: an
+// action applied to every duplicate, or a prompt with ask
+func duplicateResolver(policy string, logger *zap.Logger) (adobatch.DuplicateResolver, error) {
+	if strings.EqualFold(policy, duplicateAsk) {
+		if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			return nil, fmt.Errorf("--on-duplicate ask needs a terminal, use skip, create, update, merge or fail in non-interactive runs")
+		}
+		return promptDuplicates(os.Stdin, os.Stderr, logger), nil
+	}
+
+	action, err := adobatch.ParseDuplicateAction(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(context.Context, models.UserStory, adobatch.Duplicate) (adobatch.DuplicateAction, error) {
+		return action, nil
+	}, nil
+}
+
+// promptDuplicates asks what to do with every duplicate: skip, create anyway,
+// update the existing user story, add its missing tasks or open it in the
+// browser and ask again. Upper case answers apply to the remaining duplicates
+// of the process.
+func promptDuplicates(in io.Reader, out io.Writer, logger *zap.Logger) adobatch.DuplicateResolver {
+	reader := bufio.NewReader(in)
+	actions := map[string]adobatch.DuplicateAction{"s": adobatch.DuplicateSkip, "c": adobatch.DuplicateCreate, "u": adobatch.DuplicateUpdate, "m": adobatch.DuplicateMerge}
+
+	var mu sync.Mutex
+	var all adobatch.DuplicateAction
+	return func(ctx context.Context, userStory models.UserStory, duplicate adobatch.Duplicate) (adobatch.DuplicateAction, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if all != "" {
+			return all, nil
+		}
+
+		fmt.Fprintf(out, "\nUser story %q already exists: %s\n", userStory.Name, duplicate.URL)
+		for {
+			fmt.Fprint(out, "[s]kip, [c]reate anyway, [u]pdate existing, [m]erge missing tasks, [o]pen URL (S, C, U or M for all)? ")
+			answer, err := reader.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			if action, ok := actions[strings.ToLower(answer)]; ok {
+				if answer != strings.ToLower(answer) {
+					all = action
+				}
+				return action, nil
+			}
+			if err != nil {
+				return "", fmt.Errorf("failed to read answer: %w", err)
+			}
+			if strings.EqualFold(answer, "o") {
+				if err := openURL(duplicate.URL); err != nil {
+					logger.Warn("Failed to open URL", zap.String("url", duplicate.URL), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// openURL opens a URL in the default browser
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	return cmd.Start()
+}
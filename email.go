@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// emailOptions configures the SMTP server and the recipients of the email
+// summary
+type emailOptions struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// sendEmailSummary emails the summary of a run with the CSV report attached
+func sendEmailSummary(options emailOptions, results adobatch.Results, reportURL string) error {
+	message, err := emailMessage(options, results, reportURL)
+	if err != nil {
+		return err
+	}
+
+	// The envelope takes bare addresses, the headers keep the display names
+	from, err := mail.ParseAddress(options.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", options.from, err)
+	}
+	var to []string
+	for _, address := range options.to {
+		recipient, err := mail.ParseAddress(address)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", address, err)
+		}
+		to = append(to, recipient.Address)
+	}
+
+	var auth smtp.Auth
+	if options.username != "" {
+		auth = smtp.PlainAuth("", options.username, options.password, options.host)
+	}
+
+	addr := net.JoinHostPort(options.host, strconv.Itoa(options.port))
+	if options.port != 465 {
+		// Upgrades the connection with STARTTLS when the server offers it
+		if err := smtp.SendMail(addr, auth, from.Address, to, message); err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+		return nil
+	}
+
+	// Port 465 expects TLS from the start
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, &tls.Config{ServerName: options.host})
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	client, err := smtp.NewClient(conn, options.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("failed to send email to %s: %w", recipient, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// emailMessage builds a multipart message with the plain text summary and
+// the CSV report as an attachment
+func emailMessage(options emailOptions, results adobatch.Results, reportURL string) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	text, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+	quoted := quotedprintable.NewWriter(text)
+	quoted.Write([]byte(plainTextSummary(results, reportURL)))
+	quoted.Close()
+
+	var report bytes.Buffer
+	if err := renderCSVReport(&report, results); err != nil {
+		return nil, err
+	}
+	attachment, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/csv; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="report.csv"`},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(report.Bytes())
+	for len(encoded) > 76 {
+		fmt.Fprintf(attachment, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(attachment, "%s\r\n", encoded)
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", options.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(options.to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notificationTitle(results)))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", writer.Boundary())
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
+
+// plainTextSummary summarizes a run for the email body
+func plainTextSummary(results adobatch.Results, reportURL string) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s\n\n", notificationTitle(results))
+	fmt.Fprintf(&text, "Created:  %d\nSkipped:  %d\nFailed:   %d\nDuration: %.1fs\n", results.Summary.Created, results.Summary.Skipped, results.Summary.Failed, results.Summary.DurationSeconds)
+
+	created, failed := notableItems(results)
+	if len(created) > 0 {
+		text.WriteString("\nCreated user stories\n")
+		for _, item := range created {
+			fmt.Fprintf(&text, "- %s: %s\n", item.Name, item.Url)
+		}
+	}
+	if len(failed) > 0 {
+		text.WriteString("\nFailures\n")
+		for _, item := range failed {
+			fmt.Fprintf(&text, "- %s %q: %s\n", item.Type, item.Name, item.Error)
+		}
+	}
+	if reportURL != "" {
+		fmt.Fprintf(&text, "\nReport: %s\n", reportURL)
+	}
+	text.WriteString("\nEvery work item of the run is listed in the attached report.csv.\n")
+
+	return text.String()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// smtpSession is what a client sent to the fake SMTP server
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP serves one SMTP session without TLS, accepting AUTH PLAIN, and
+// returns its port and the session once the client quits
+func fakeSMTP(t *testing.T) (int, <-chan smtpSession) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		text := textproto.NewConn(conn)
+		var session smtpSession
+		text.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, argument, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				text.PrintfLine("250-fake")
+				text.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				session.auth = strings.TrimPrefix(argument, "PLAIN ")
+				text.PrintfLine("235 authenticated")
+			case "MAIL":
+				session.from = argument
+				text.PrintfLine("250 ok")
+			case "RCPT":
+				session.to = append(session.to, argument)
+				text.PrintfLine("250 ok")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				session.data = string(data)
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				sessions <- session
+				return
+			default:
+				text.PrintfLine("502 unsupported")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, sessions
+}
+
+func TestSendEmailSummary(t *testing.T) {
+	port, sessions := fakeSMTP(t)
+	options := emailOptions{
+		host:     "127.0.0.1",
+		port:     port,
+		username: "bot",
+		password: "smtp-secret",
+		from:     "Batch Bot <bot@example.com>",
+		to:       []string{"Ana <ana@example.com>", "ops@example.com"},
+	}
+	results := adobatch.NewResults("20261016-090000", []adobatch.Result{{
+		Item:   models.UserStory{Name: "US1"},
+		ID:     101,
+		URL:    "https://dev.azure.com/org/project/_workitems/edit/101",
+		Status: models.StatusCreated,
+		Tasks: []adobatch.TaskResult{
+			{Item: models.Task{Name: "Task 1"}, Status: models.StatusFailed, Err: errors.New("status: 400 Bad Request")},
+		},
+	}}, time.Second)
+
+	if err := sendEmailSummary(options, results, "https://reports.example.com/run.html"); err != nil {
+		t.Fatal(err)
+	}
+	var session smtpSession
+	select {
+	case session = <-sessions:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no SMTP session")
+	}
+
+	if auth, _ := base64.StdEncoding.DecodeString(session.auth); string(auth) != "\x00bot\x00smtp-secret" {
+		t.Errorf("AUTH PLAIN = %q, want the username and password", auth)
+	}
+	if session.from != "FROM:<bot@example.com>" || strings.Join(session.to, ",") != "TO:<ana@example.com>,TO:<ops@example.com>" {
+		t.Errorf("envelope from %s to %v, want the bare addresses", session.from, session.to)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(session.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := map[string]string{
+		"From":    "Batch Bot <bot@example.com>",
+		"To":      "Ana <ana@example.com>, ops@example.com",
+		"Subject": "Azure DevOps batch finished with failures (run 20261016-090000)",
+	}
+	for name, want := range headers {
+		got := message.Header.Get(name)
+		if name == "Subject" {
+			got = subject
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := message.Header.Date(); err != nil {
+		t.Errorf("invalid Date: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("content type = %s (%v), want multipart/mixed", mediaType, err)
+	}
+	parts := multipart.NewReader(message.Body, params["boundary"])
+
+	// Quoted-printable text is decoded by the reader
+	text, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(text)
+	for _, want := range []string{
+		"Created:  1\nSkipped:  0\nFailed:   1\n",
+		"- US1: https://dev.azure.com/org/project/_workitems/edit/101\n",
+		`- Task "Task 1": status: 400 Bad Request`,
+		"Report: https://reports.example.com/run.html\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("body has no %q:\n%s", want, body)
+		}
+	}
+
+	attachment, err := parts.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.FileName() != "report.csv" || attachment.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Errorf("attachment %q of type %q, want report.csv", attachment.FileName(), attachment.Header.Get("Content-Type"))
+	}
+	report, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, bufio.NewReader(attachment)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(report), "title,type,id,url,parent id,status,error\nUS1,User Story,101,") {
+		t.Errorf("report =\n%s", report)
+	}
+}
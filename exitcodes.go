@@ -0,0 +1,29 @@
+package main
+
+import "filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+
+// Process exit codes, documented in the README so pipelines can branch on them
+const (
+	exitSuccess        = 0
+	exitError          = 1
+	exitValidation     = 2
+	exitPartialFailure = 3
+	exitAuth           = 4
+	exitAborted        = 5
+)
+
+// exitCodeFor returns the exit code of a run with the given status
+func exitCodeFor(status adobatch.RunStatus) int {
+	switch status {
+	case adobatch.RunAuthFailed:
+		return exitAuth
+	case adobatch.RunInvalid:
+		return exitValidation
+	case adobatch.RunAborted:
+		return exitAborted
+	case adobatch.RunPartiallyFailed:
+		return exitPartialFailure
+	}
+
+	return exitSuccess
+}
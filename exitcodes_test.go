@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	tests := map[adobatch.RunStatus]int{
+		adobatch.RunSucceeded:       exitSuccess,
+		adobatch.RunPartiallyFailed: exitPartialFailure,
+		adobatch.RunAuthFailed:      exitAuth,
+		adobatch.RunAborted:         exitAborted,
+		adobatch.RunInvalid:         exitValidation,
+	}
+	for status, want := range tests {
+		if got := exitCodeFor(status); got != want {
+			t.Errorf("exitCodeFor(%s) = %d, want %d", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// exportOptions selects the work items exported
+type exportOptions struct {
+	// query is a WIQL query, it replaces area and tag
+	query string
+	area  string
+	tag   string
+}
+
+// exportItems writes the user stories matching the options, with their
+// tasks, to path as an items file, or to stdout when path is empty or "-"
+func exportItems(ctx context.Context, settings models.AdoSettings, path string, options exportOptions, logger *zap.Logger) int {
+	query, err := exportQuery(options)
+	if err != nil {
+		logger.Error("Invalid export selection", zap.Error(err))
+		return exitValidation
+	}
+	logger.Debug("Export query", zap.String("query", query))
+
+	plan, err := newClient(settings, logger).Export(ctx, settings, query)
+	if err != nil {
+		logger.Error("Failed to export work items", zap.Error(err))
+		if errors.Is(err, adobatch.ErrAuth) {
+			return exitAuth
+		}
+		return exitError
+	}
+
+	w := io.Writer(os.Stdout)
+	if path != "" && path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			logger.Error("Failed to create items file", zap.String("path", path), zap.Error(err))
+			return exitError
+		}
+		defer file.Close()
+		w = file
+	}
+
+	// An empty export is written as [], which is a valid items file
+	items := plan.Items
+	if items == nil {
+		items = []models.UserStory{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(items); err != nil {
+		logger.Error("Failed to write items file", zap.String("path", path), zap.Error(err))
+		return exitError
+	}
+
+	logger.Info("Work items exported", zap.String("path", path), zap.Int("user_stories", len(plan.Items)), zap.Int("work_items", plan.WorkItems()))
+
+	return exitSuccess
+}
+
+// exportQuery returns the WIQL query selecting the exported user stories
+func exportQuery(options exportOptions) (string, error) {
+	if options.query != "" {
+		if options.area != "" || options.tag != "" {
+			return "", fmt.Errorf("--query cannot be used with --area or --tag")
+		}
+		return options.query, nil
+	}
+
+	if options.area == "" && options.tag == "" {
+		return "", fmt.Errorf("set --query, --area or --tag")
+	}
+
+	conditions := []string{"[System.TeamProject] = @project", "[System.WorkItemType] = 'User Story'"}
+	if options.area != "" {
+		conditions = append(conditions, "[System.AreaPath] UNDER "+adobatch.WIQLString(options.area))
+	}
+	if options.tag != "" {
+		conditions = append(conditions, "[System.Tags] CONTAINS "+adobatch.WIQLString(options.tag))
+	}
+
+	return "SELECT [System.Id] FROM WorkItems WHERE " + strings.Join(conditions, " AND ") + " ORDER BY [System.Id]", nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+)
+
+// faultsEnv enables failure injection like the hidden --inject-failures flag
+const faultsEnv = "ADO_BATCH_INJECT_FAILURES"
+
+// Kinds of failures injected
+const (
+	faultThrottled = "429"
+	faultServer    = "500"
+	faultTimeout   = "timeout"
+)
+
+// faultInjection is the rate of the requests failed by a faultTransport and
+// the kinds of failures they get
+type faultInjection struct {
+	rate  float64
+	kinds []string
+}
+
+// parseFaultInjection parses "rate[:kind,kind..]", such as "10%" or
+// "0.2:429,timeout". Every kind is injected when none is given.
+func parseFaultInjection(value string) (faultInjection, error) {
+	rate, kinds, _ := strings.Cut(value, ":")
+
+	var injection faultInjection
+	var err error
+	if injection.rate, err = parseShare(strings.TrimSpace(rate)); err != nil {
+		return injection, fmt.Errorf("invalid rate %q: %w", rate, err)
+	}
+	if injection.rate > 1 {
+		return injection, fmt.Errorf("invalid rate %q: must not exceed 100%%", rate)
+	}
+
+	if kinds == "" {
+		injection.kinds = []string{faultThrottled, faultServer, faultTimeout}
+		return injection, nil
+	}
+	for _, kind := range strings.Split(kinds, ",") {
+		switch kind = strings.ToLower(strings.TrimSpace(kind)); kind {
+		case faultThrottled, faultServer, faultTimeout:
+			injection.kinds = append(injection.kinds, kind)
+		default:
+			return injection, fmt.Errorf("unknown failure %q, expected %s, %s or %s", kind, faultThrottled, faultServer, faultTimeout)
+		}
+	}
+
+	return injection, nil
+}
+
+// faultTransport fails a share of the requests creating, updating or deleting
+// work items with synthetic failures, to exercise the failure handling of
+// runs. Throttling and server errors are answered without sending the
+// request. Timeouts send it and drop the response, as when the connection is
+// lost after Azure DevOps handled it.
+type faultTransport struct {
+	next      http.RoundTripper
+	injection faultInjection
+}
+
+func (t faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !workItemWrite(req) || rand.Float64() >= t.injection.rate {
+		return t.next.RoundTrip(req)
+	}
+
+	switch kind := t.injection.kinds[rand.IntN(len(t.injection.kinds))]; kind {
+	case faultTimeout:
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return nil, faultTimeoutError{}
+	case faultThrottled:
+		resp := faultResponse(req, http.StatusTooManyRequests)
+		resp.Header.Set("Retry-After", "1")
+		return resp, nil
+	default:
+		return faultResponse(req, http.StatusInternalServerError), nil
+	}
+}
+
+// workItemWrite reports whether a request creates, updates or deletes work
+// items. Queries and reads are left alone.
+func workItemWrite(req *http.Request) bool {
+	if req.Method == http.MethodGet {
+		return false
+	}
+
+	path := strings.ToLower(req.URL.Path)
+	return strings.Contains(path, "/_apis/wit/workitems/") || strings.HasSuffix(path, "/_apis/wit/$batch")
+}
+
+func faultResponse(req *http.Request, status int) *http.Response {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	body := fmt.Sprintf(`{"message":"Injected failure: %d %s"}`, status, http.StatusText(status))
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewBufferString(body)),
+		Request:    req,
+	}
+}
+
+// faultTimeoutError is the error of an injected timeout, a net.Error
+type faultTimeoutError struct{}
+
+func (faultTimeoutError) Error() string   { return "injected failure: timeout awaiting response" }
+func (faultTimeoutError) Timeout() bool   { return true }
+func (faultTimeoutError) Temporary() bool { return true }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// The gRPC API of api/batch.proto, served over HTTP/2 without TLS with the
+// standard library. Messages are small, they are encoded by hand.
+
+// gRPC status codes
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcNotFound          = 5
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcUnauthenticated   = 16
+)
+
+// grpcService is the full name of the service in api/batch.proto
+const grpcService = "/ado_batch_creator.v1.BatchService/"
+
+// grpcError is a failed call with its gRPC status code
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+// serveGRPC serves the gRPC API of the batch server on addr until the
+// context is cancelled
+func (s *batchServer) serveGRPC(ctx context.Context, addr string) {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{Addr: addr, Handler: http.HandlerFunc(s.handleGRPC), Protocols: protocols, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	s.logger.Info("Serving gRPC batch API", zap.String("addr", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error("gRPC batch API stopped", zap.String("addr", addr), zap.Error(err))
+	}
+}
+
+func (s *batchServer) handleGRPC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Add("Trailer", "Grpc-Status")
+	w.Header().Add("Trailer", "Grpc-Message")
+
+	err := s.callGRPC(w, r)
+	var status *grpcError
+	switch {
+	case err == nil:
+		status = &grpcError{code: grpcOK}
+	case !errors.As(err, &status):
+		status = &grpcError{code: grpcInvalidArgument, message: err.Error()}
+	}
+
+	w.Header().Set("Grpc-Status", strconv.Itoa(status.code))
+	w.Header().Set("Grpc-Message", status.message)
+}
+
+func (s *batchServer) callGRPC(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+		return &grpcError{code: grpcUnimplemented, message: "gRPC requires HTTP/2 POST requests"}
+	}
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+		return &grpcError{code: grpcUnauthenticated, message: "missing or invalid bearer token"}
+	}
+
+	request, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return err
+	}
+	fields, err := decodeProto(request)
+	if err != nil {
+		return err
+	}
+
+	switch r.URL.Path {
+	case grpcService + "SubmitBatch":
+		plan, err := adobatch.LoadPlan(fields[1])
+		if err != nil {
+			return &grpcError{code: grpcInvalidArgument, message: "failed to decode items: " + err.Error()}
+		}
+		b, err := s.enqueue(plan.Items)
+		if err != nil {
+			return &grpcError{code: grpcResourceExhausted, message: err.Error()}
+		}
+		return writeGRPCMessage(w, appendProtoBytes(nil, 1, []byte(b.ID)))
+
+	case grpcService + "GetBatchStatus":
+		b, ok := s.lookup(string(fields[1]))
+		if !ok {
+			return &grpcError{code: grpcNotFound, message: "batch not found"}
+		}
+		return writeGRPCMessage(w, encodeBatchStatus(b))
+
+	case grpcService + "StreamProgress":
+		var last []byte
+		for {
+			b, ok := s.lookup(string(fields[1]))
+			if !ok {
+				return &grpcError{code: grpcNotFound, message: "batch not found"}
+			}
+			if status := encodeBatchStatus(b); string(status) != string(last) {
+				if err := writeGRPCMessage(w, status); err != nil {
+					return err
+				}
+				last = status
+			}
+			if b.Status == batchFinished {
+				return nil
+			}
+
+			select {
+			case <-r.Context().Done():
+				return r.Context().Err()
+			case <-time.After(time.Second):
+			}
+		}
+	}
+
+	return &grpcError{code: grpcUnimplemented, message: "unknown method " + r.URL.Path}
+}
+
+// encodeBatchStatus encodes a batch as a BatchStatus message
+func encodeBatchStatus(b batch) []byte {
+	message := appendProtoBytes(nil, 1, []byte(b.ID))
+	message = appendProtoBytes(message, 2, []byte(b.Status))
+	message = appendProtoVarint(message, 3, uint64(b.UserStories))
+	message = appendProtoVarint(message, 4, uint64(b.Processed))
+	if b.Results != nil {
+		message = appendProtoVarint(message, 5, uint64(b.Results.Summary.Created))
+		message = appendProtoVarint(message, 6, uint64(b.Results.Summary.Skipped))
+		message = appendProtoVarint(message, 7, uint64(b.Results.Summary.Failed))
+		if results, err := json.Marshal(b.Results); err == nil {
+			message = appendProtoBytes(message, 9, results)
+		}
+	}
+	if b.ExitCode != nil {
+		message = appendProtoVarint(message, 8, uint64(*b.ExitCode))
+	}
+	if b.Error != "" {
+		message = appendProtoBytes(message, 10, []byte(b.Error))
+	}
+
+	return message
+}
+
+// readGRPCMessage reads a length-prefixed gRPC message
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	if header[0] != 0 {
+		return nil, &grpcError{code: grpcUnimplemented, message: "compressed messages are not supported"}
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxBatchSize {
+		return nil, &grpcError{code: grpcResourceExhausted, message: "message too large"}
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	return message, nil
+}
+
+// writeGRPCMessage writes a length-prefixed gRPC message and flushes it
+func writeGRPCMessage(w http.ResponseWriter, message []byte) error {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	if _, err := w.Write(append(frame, message...)); err != nil {
+		return err
+	}
+	http.NewResponseController(w).Flush()
+
+	return nil
+}
+
+// decodeProto decodes the length-delimited fields of a protobuf message by
+// field number. Varint and fixed size fields are skipped, the requests of
+// the service have none.
+func decodeProto(message []byte) (map[int][]byte, error) {
+	fields := map[int][]byte{}
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid protobuf tag")
+		}
+		message = message[n:]
+
+		switch field, wireType := int(tag>>3), tag&7; wireType {
+		case 0:
+			_, n = binary.Uvarint(message)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid protobuf varint")
+			}
+			message = message[n:]
+		case 1, 5:
+			size := map[uint64]int{1: 8, 5: 4}[wireType]
+			if len(message) < size {
+				return nil, fmt.Errorf("truncated protobuf field")
+			}
+			message = message[size:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return nil, fmt.Errorf("truncated protobuf field")
+			}
+			fields[field] = message[n : n+int(length)]
+			message = message[n+int(length):]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", wireType)
+		}
+	}
+
+	return fields, nil
+}
+
+func appendProtoVarint(message []byte, field int, value uint64) []byte {
+	message = binary.AppendUvarint(message, uint64(field)<<3)
+	return binary.AppendUvarint(message, value)
+}
+
+func appendProtoBytes(message []byte, field int, value []byte) []byte {
+	message = binary.AppendUvarint(message, uint64(field)<<3|2)
+	message = binary.AppendUvarint(message, uint64(len(value)))
+	return append(message, value...)
+}
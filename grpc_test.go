@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// decodeProtoVarints decodes the varint fields of a protobuf message by field
+// number, which decodeProto skips
+func decodeProtoVarints(t *testing.T, message []byte) map[int]uint64 {
+	t.Helper()
+
+	varints := map[int]uint64{}
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			t.Fatalf("invalid tag in %x", message)
+		}
+		message = message[n:]
+		value, n := binary.Uvarint(message)
+		if n <= 0 {
+			t.Fatalf("invalid value in %x", message)
+		}
+		message = message[n:]
+		if tag&7 == 2 {
+			message = message[value:]
+			continue
+		}
+		varints[int(tag>>3)] = value
+	}
+
+	return varints
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 300)
+	message := appendProtoBytes(nil, 1, []byte("items"))
+	message = appendProtoVarint(message, 2, 0)
+	message = appendProtoVarint(message, 3, 300)
+	message = appendProtoVarint(message, 4, math.MaxUint64)
+	message = appendProtoBytes(message, 5, nil)
+	message = appendProtoBytes(message, 6, long)
+	message = appendProtoBytes(message, 2000, []byte("far"))
+	// Unknown fixed64 and fixed32 fields, which the varint decoder of the
+	// test does not handle
+	fixed := len(message)
+	message = append(binary.AppendUvarint(message, 7<<3|1), 1, 2, 3, 4, 5, 6, 7, 8)
+	message = append(binary.AppendUvarint(message, 8<<3|5), 1, 2, 3, 4)
+
+	fields, err := decodeProto(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int][]byte{1: []byte("items"), 5: {}, 6: long, 2000: []byte("far")}
+	if len(fields) != len(want) {
+		t.Errorf("decoded fields %v, want %v", fields, want)
+	}
+	for field, value := range want {
+		if got, ok := fields[field]; !ok || !bytes.Equal(got, value) {
+			t.Errorf("field %d = %q, want %q", field, got, value)
+		}
+	}
+
+	varints := decodeProtoVarints(t, message[:fixed])
+	if varints[2] != 0 || varints[3] != 300 || varints[4] != math.MaxUint64 {
+		t.Errorf("varints = %v, want 0, 300 and the largest", varints)
+	}
+}
+
+func TestDecodeProtoInvalid(t *testing.T) {
+	valid := appendProtoBytes(nil, 1, []byte("items"))
+	tests := []struct {
+		name    string
+		message []byte
+		err     string
+	}{
+		{"truncated tag", []byte{0x80}, "invalid protobuf tag"},
+		{"truncated varint", []byte{2 << 3, 0x80, 0x80}, "invalid protobuf varint"},
+		{"truncated length", []byte{1<<3 | 2, 0x80}, "truncated protobuf field"},
+		{"truncated bytes", valid[:len(valid)-1], "truncated protobuf field"},
+		{"truncated fixed64", []byte{1<<3 | 1, 1, 2, 3}, "truncated protobuf field"},
+		{"truncated fixed32", []byte{1<<3 | 5, 1}, "truncated protobuf field"},
+		{"group", []byte{1<<3 | 3}, "unsupported protobuf wire type 3"},
+		{"trailing byte", append(valid, 0x80), "invalid protobuf tag"},
+	}
+	for _, tt := range tests {
+		if _, err := decodeProto(tt.message); err == nil || err.Error() != tt.err {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestGRPCFrames(t *testing.T) {
+	for _, message := range [][]byte{nil, []byte("batch"), bytes.Repeat([]byte{0xff}, 70000)} {
+		recorder := httptest.NewRecorder()
+		if err := writeGRPCMessage(recorder, message); err != nil {
+			t.Fatal(err)
+		}
+		if !recorder.Flushed {
+			t.Error("message not flushed")
+		}
+		frame := recorder.Body.Bytes()
+		if frame[0] != 0 || binary.BigEndian.Uint32(frame[1:5]) != uint32(len(message)) {
+			t.Errorf("frame header = %x, want uncompressed with length %d", frame[:5], len(message))
+		}
+		got, err := readGRPCMessage(bytes.NewReader(frame))
+		if err != nil || !bytes.Equal(got, message) {
+			t.Errorf("read %d bytes (%v), want the %d written", len(got), err, len(message))
+		}
+	}
+
+	frame := func(flag byte, length uint32, message string) []byte {
+		return append(binary.BigEndian.AppendUint32([]byte{flag}, length), message...)
+	}
+	tests := []struct {
+		name  string
+		frame []byte
+		code  int
+	}{
+		{"empty", nil, -1},
+		{"truncated header", []byte{0, 0, 0}, -1},
+		{"truncated message", frame(0, 10, "short"), -1},
+		{"compressed", frame(1, 5, "batch"), grpcUnimplemented},
+		{"too large", frame(0, maxBatchSize+1, ""), grpcResourceExhausted},
+	}
+	for _, tt := range tests {
+		_, err := readGRPCMessage(bytes.NewReader(tt.frame))
+		var status *grpcError
+		switch {
+		case err == nil:
+			t.Errorf("%s: no error", tt.name)
+		case tt.code < 0 && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF):
+			t.Errorf("%s: error = %v, want a read error", tt.name, err)
+		case tt.code >= 0 && (!errors.As(err, &status) || status.code != tt.code):
+			t.Errorf("%s: error = %v, want gRPC status %d", tt.name, err, tt.code)
+		}
+	}
+}
+
+func TestEncodeBatchStatus(t *testing.T) {
+	exitCode := exitPartialFailure
+	results := adobatch.Results{RunID: "run-1", Summary: adobatch.Summary{Created: 3, Skipped: 1, Failed: 2}}
+	b := batch{ID: "batch-1", Status: batchFinished, UserStories: 4, Processed: 4, ExitCode: &exitCode, Results: &results, Error: "partial"}
+
+	message := encodeBatchStatus(b)
+	fields, err := decodeProto(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fields[1]) != "batch-1" || string(fields[2]) != batchFinished || string(fields[10]) != "partial" {
+		t.Errorf("id, status, error = %q, %q, %q", fields[1], fields[2], fields[10])
+	}
+	var decoded adobatch.Results
+	if err := json.Unmarshal(fields[9], &decoded); err != nil || decoded.RunID != "run-1" {
+		t.Errorf("results = %s (%v)", fields[9], err)
+	}
+
+	want := map[int]uint64{3: 4, 4: 4, 5: 3, 6: 1, 7: 2, 8: uint64(exitPartialFailure)}
+	varints := decodeProtoVarints(t, message)
+	for field, value := range want {
+		if varints[field] != value {
+			t.Errorf("field %d = %d, want %d", field, varints[field], value)
+		}
+	}
+
+	// A queued batch has no counts nor exit code
+	varints = decodeProtoVarints(t, encodeBatchStatus(batch{ID: "batch-2", Status: batchQueued, UserStories: 2}))
+	if len(varints) != 2 || varints[3] != 2 || varints[4] != 0 {
+		t.Errorf("queued batch varints = %v, want the user stories and nothing processed", varints)
+	}
+}
+
+func TestGRPCGetBatchStatus(t *testing.T) {
+	s := &batchServer{token: "grpc-token", logger: zap.NewNop(), batches: map[string]*batch{
+		"batch-1": {ID: "batch-1", Status: batchQueued, UserStories: 2},
+	}}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(s.handleGRPC))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	tests := []struct {
+		name  string
+		token string
+		id    string
+		code  int
+	}{
+		{"found", "grpc-token", "batch-1", grpcOK},
+		{"not found", "grpc-token", "batch-2", grpcNotFound},
+		{"unauthenticated", "other", "batch-1", grpcUnauthenticated},
+	}
+	for _, tt := range tests {
+		var body bytes.Buffer
+		request := appendProtoBytes(nil, 1, []byte(tt.id))
+		body.Write(binary.BigEndian.AppendUint32([]byte{0}, uint32(len(request))))
+		body.Write(request)
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, server.URL+grpcService+"GetBatchStatus", &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.ProtoMajor != 2 || resp.Trailer.Get("Grpc-Status") != strconv.Itoa(tt.code) {
+			t.Errorf("%s: HTTP/%d with status %q (%s), want %d", tt.name, resp.ProtoMajor, resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message"), tt.code)
+			continue
+		}
+		if tt.code != grpcOK {
+			continue
+		}
+		message, err := readGRPCMessage(bytes.NewReader(response))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields, err := decodeProto(message)
+		if err != nil || string(fields[1]) != "batch-1" || string(fields[2]) != batchQueued {
+			t.Errorf("%s: status = %q %q (%v)", tt.name, fields[1], fields[2], err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// defaultHookTag is the tag that triggers a breakdown
+const defaultHookTag = "auto-breakdown"
+
+// hookOptions controls the service hook receiver of the serve command
+type hookOptions struct {
+	// template is an items file, rendered with the triggering work item
+	template string
+	tag      string
+	// workItemType, when set, only breaks down work items of this type
+	workItemType string
+}
+
+// hookEvent is the part of an Azure DevOps work item service hook event
+// the receiver reads. Fields holds the field values on workitem.created
+// and the changed fields on workitem.updated.
+type hookEvent struct {
+	EventType string `json:"eventType"`
+	Resource  struct {
+		ID         int                        `json:"id"`
+		WorkItemID int                        `json:"workItemId"`
+		Fields     map[string]json.RawMessage `json:"fields"`
+		Revision   struct {
+			Fields map[string]json.RawMessage `json:"fields"`
+		} `json:"revision"`
+	} `json:"resource"`
+}
+
+// hookWorkItem is the triggering work item, available to the template
+type hookWorkItem struct {
+	ID      int
+	Title   string
+	Type    string
+	Project string
+	Area    string
+	Tags    []string
+}
+
+// hook receives work item service hook events and queues the breakdown of
+// the template under the work items tagged with the hook tag
+func (s *batchServer) hook(w http.ResponseWriter, r *http.Request) {
+	var event hookEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchSize)).Decode(&event); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "failed to decode event: "+err.Error())
+		return
+	}
+
+	workItem, reason := s.hooks.match(event)
+	if reason != "" {
+		s.logger.Debug("Ignoring service hook event", zap.String("event_type", event.EventType), zap.String("reason", reason))
+		writeJSON(w, http.StatusOK, map[string]string{"ignored": reason})
+		return
+	}
+
+	userStories, err := s.hooks.breakdown(workItem)
+	if err != nil {
+		s.logger.Error("Failed to render breakdown template", zap.String("path", s.hooks.template), zap.Error(err))
+		writeJSONError(w, http.StatusInternalServerError, "failed to render breakdown template")
+		return
+	}
+
+	b, err := s.enqueue(userStories)
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	s.logger.Info("Queued breakdown", zap.Int("work_item_id", workItem.ID), zap.String("batch_id", b.ID))
+
+	w.Header().Set("Location", "/batches/"+b.ID)
+	writeJSON(w, http.StatusAccepted, b)
+}
+
+// match returns the work item of an event that should be broken down, or
+// why the event is ignored. Updates only trigger when they add the tag, so
+// later edits of the work item do not create the breakdown again.
+func (o hookOptions) match(event hookEvent) (hookWorkItem, string) {
+	var fields map[string]json.RawMessage
+	workItem := hookWorkItem{ID: event.Resource.ID}
+	switch event.EventType {
+	case "workitem.created":
+		fields = event.Resource.Fields
+	case "workitem.updated":
+		fields = event.Resource.Revision.Fields
+		workItem.ID = event.Resource.WorkItemID
+
+		var change struct {
+			OldValue string `json:"oldValue"`
+			NewValue string `json:"newValue"`
+		}
+		json.Unmarshal(event.Resource.Fields["System.Tags"], &change)
+		if !hasTag(change.NewValue, o.tag) || hasTag(change.OldValue, o.tag) {
+			return workItem, fmt.Sprintf("tag %q was not added", o.tag)
+		}
+	default:
+		return workItem, fmt.Sprintf("unsupported event type %q", event.EventType)
+	}
+
+	field := func(name string) string {
+		var value string
+		json.Unmarshal(fields[name], &value)
+		return value
+	}
+	workItem.Title = field("System.Title")
+	workItem.Type = field("System.WorkItemType")
+	workItem.Project = field("System.TeamProject")
+	workItem.Area = field("System.AreaPath")
+	for _, tag := range strings.Split(field("System.Tags"), ";") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			workItem.Tags = append(workItem.Tags, tag)
+		}
+	}
+
+	switch {
+	case workItem.ID == 0:
+		return workItem, "missing work item ID"
+	case !hasTag(field("System.Tags"), o.tag):
+		return workItem, fmt.Sprintf("work item is not tagged %q", o.tag)
+	case o.workItemType != "" && !strings.EqualFold(workItem.Type, o.workItemType):
+		return workItem, fmt.Sprintf("work item is a %s, not a %s", workItem.Type, o.workItemType)
+	}
+
+	return workItem, ""
+}
+
+// breakdown renders the template with the work item and returns its user
+// stories, linked under the work item
+func (o hookOptions) breakdown(workItem hookWorkItem) ([]models.UserStory, error) {
+	data, err := os.ReadFile(o.template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(o.template).Funcs(template.FuncMap{"json": jsonString}).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, workItem); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	plan, err := adobatch.LoadPlan(rendered.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rendered template: %w", err)
+	}
+	userStories := plan.Items
+
+	for i := range userStories {
+		userStories[i].Parent = workItem.ID
+		if userStories[i].Project == "" {
+			userStories[i].Project = workItem.Project
+		}
+		if userStories[i].Area == "" {
+			userStories[i].Area = workItem.Area
+		}
+	}
+
+	return userStories, nil
+}
+
+// hasTag reports whether the semicolon separated tags contain tag
+func hasTag(tags, tag string) bool {
+	for _, t := range strings.Split(tags, ";") {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonString quotes a value for the JSON template, so titles with quotes
+// do not break it
+func jsonString(value any) (string, error) {
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
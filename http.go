@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// httpClient is shared by every call to Azure DevOps, so transports such as
+// the audit log apply to all of them
+var httpClient = &http.Client{}
+
+// authClient is used for identity provider calls. It is kept out of the audit
+// log since token responses carry secrets.
+var authClient = &http.Client{Timeout: time.Minute}
+
+// outboundClient sends results, metrics and traces to other services than
+// Azure DevOps, such as webhooks. Its timeout keeps an endpoint that never
+// answers from hanging the end of a run, or a serve worker.
+var outboundClient = &http.Client{Timeout: 30 * time.Second}
@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// keyringService names the entries the tool stores in the OS keyring
+const keyringService = "ado_batch_creator"
+
+// errKeyringNotFound is returned when the keyring has no entry for an account
+var errKeyringNotFound = errors.New("no PAT stored in the OS keyring")
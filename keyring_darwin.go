@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keyringSet stores a secret in the macOS Keychain. The secret is written to
+// `security` through stdin, so it never shows up in the process list.
+func keyringSet(account, secret string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -X %s\n", keyringService, account, hex.EncodeToString([]byte(secret))))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to store secret in Keychain: %s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// keyringGet reads a secret from the macOS Keychain
+func keyringGet(account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return "", errKeyringNotFound
+		}
+		return "", fmt.Errorf("failed to read secret from Keychain: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
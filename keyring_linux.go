@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keyringSet stores a secret with the freedesktop Secret Service (GNOME
+// Keyring, KWallet) through `secret-tool`
+func keyringSet(account, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", keyringService+" ("+account+")", "service", keyringService, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to store secret with secret-tool: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// keyringGet reads a secret from the Secret Service
+func keyringGet(account string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", keyringService, "account", account)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// secret-tool exits with 1 and no output when nothing matches
+		if stderr.Len() == 0 {
+			return "", errKeyringNotFound
+		}
+		return "", fmt.Errorf("failed to read secret with secret-tool: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+import "fmt"
+
+func keyringSet(account, secret string) error {
+	return fmt.Errorf("the OS keyring is not supported on this platform")
+}
+
+func keyringGet(account string) (string, error) {
+	return "", errKeyringNotFound
+}
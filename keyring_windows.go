@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Windows Credential Manager, which protects secrets with DPAPI
+var (
+	advapi32  = syscall.NewLazyDLL("advapi32.dll")
+	credWrite = advapi32.NewProc("CredWriteW")
+	credRead  = advapi32.NewProc("CredReadW")
+	credFree  = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// credential mirrors the Win32 CREDENTIALW structure
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keyringSet stores a secret in the Windows Credential Manager
+func keyringSet(account, secret string) error {
+	target, err := syscall.UTF16PtrFromString(keyringService + ":" + account)
+	if err != nil {
+		return fmt.Errorf("failed to encode credential name: %w", err)
+	}
+	userName, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return fmt.Errorf("failed to encode credential name: %w", err)
+	}
+	if secret == "" {
+		return fmt.Errorf("secret is empty")
+	}
+
+	blob := []byte(secret)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(blob)),
+		CredentialBlob:     &blob[0],
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	if ret, _, err := credWrite.Call(uintptr(unsafe.Pointer(&cred)), 0); ret == 0 {
+		return fmt.Errorf("failed to store secret in Credential Manager: %w", err)
+	}
+
+	return nil
+}
+
+// keyringGet reads a secret from the Windows Credential Manager
+func keyringGet(account string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(keyringService + ":" + account)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode credential name: %w", err)
+	}
+
+	var cred *credential
+	if ret, _, err := credRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred))); ret == 0 {
+		if err == errorNotFound {
+			return "", errKeyringNotFound
+		}
+		return "", fmt.Errorf("failed to read secret from Credential Manager: %w", err)
+	}
+	defer credFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
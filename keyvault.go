@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// keyVaultScope requests a token for Azure Key Vault
+const keyVaultScope = "https://vault.azure.net/.default"
+
+// keyVaultSecret locates a secret in Azure Key Vault and the Azure
+// credential used to read it
+type keyVaultSecret struct {
+	VaultURL   string
+	SecretName string
+	Credential string
+}
+
+// getKeyVaultSecret reads the current version of a secret from Azure Key
+// Vault
+func getKeyVaultSecret(ctx context.Context, settings models.AdoSettings, secret keyVaultSecret) (string, error) {
+	source, err := newTokenSource(secret.Credential, settings)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := source.token(ctx, keyVaultScope)
+	if err != nil {
+		return "", fmt.Errorf("failed to acquire Key Vault token: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/secrets/%s?api-version=7.4", strings.TrimSuffix(secret.VaultURL, "/"), url.PathEscape(secret.SecretName))
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.value)
+
+	resp, err := authClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read secret %q from %s: unexpected status: %s", secret.SecretName, secret.VaultURL, resp.Status)
+	}
+
+	var response struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return response.Value, nil
+}
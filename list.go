@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// listKinds are the metadata the list command prints
+var listKinds = []string{"areas", "iterations", "teams", "types", "fields"}
+
+// listMetadata prints the areas, iterations, teams, work item types or
+// fields of the project, with the exact strings items files use
+func listMetadata(ctx context.Context, settings models.AdoSettings, kind, output string, logger *zap.Logger) int {
+	client := newClient(settings, logger)
+
+	var v any
+	var text func(io.Writer)
+	var err error
+	switch kind {
+	case "areas", "iterations":
+		var nodes []adobatch.ClassificationNode
+		if kind == "areas" {
+			nodes, err = client.Areas(ctx, settings)
+		} else {
+			nodes, err = client.Iterations(ctx, settings)
+		}
+		v, text = nodes, func(w io.Writer) { printClassificationNodes(w, nodes) }
+	case "teams":
+		var teams []adobatch.Team
+		teams, err = client.Teams(ctx, settings)
+		v, text = teams, func(w io.Writer) {
+			printTable(w, []string{"NAME", "DESCRIPTION"}, len(teams), func(i int) []string {
+				return []string{teams[i].Name, teams[i].Description}
+			})
+		}
+	case "types":
+		var types []adobatch.WorkItemType
+		types, err = client.WorkItemTypes(ctx, settings)
+		v, text = types, func(w io.Writer) {
+			printTable(w, []string{"NAME", "REFERENCE NAME", "CUSTOMIZATION", "STATES"}, len(types), func(i int) []string {
+				customization := types[i].Customization
+				if types[i].Disabled {
+					customization += " (disabled)"
+				}
+				return []string{types[i].Name, types[i].ReferenceName, customization, strings.Join(types[i].States, ", ")}
+			})
+		}
+	case "fields":
+		var fields []adobatch.Field
+		fields, err = client.Fields(ctx, settings)
+		v, text = fields, func(w io.Writer) {
+			printTable(w, []string{"REFERENCE NAME", "NAME", "TYPE", "READ ONLY"}, len(fields), func(i int) []string {
+				readOnly := ""
+				if fields[i].ReadOnly {
+					readOnly = "yes"
+				}
+				return []string{fields[i].ReferenceName, fields[i].Name, fields[i].Type, readOnly}
+			})
+		}
+	default:
+		logger.Error("Unknown list, expected list "+strings.Join(listKinds, "|"), zap.String("list", kind))
+		return exitValidation
+	}
+	if err != nil {
+		logger.Error("Failed to list "+kind, zap.Error(err))
+		return queryExitCode(err)
+	}
+
+	if err := printOutput(os.Stdout, output, v, text); err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+		return exitError
+	}
+
+	return exitSuccess
+}
+
+// printClassificationNodes writes the paths of areas or iterations, with the
+// dates of scheduled iterations
+func printClassificationNodes(w io.Writer, nodes []adobatch.ClassificationNode) {
+	printTable(w, []string{"PATH", "START", "FINISH"}, len(nodes), func(i int) []string {
+		return []string{nodes[i].Path, formatDate(nodes[i].StartDate), formatDate(nodes[i].FinishDate)}
+	})
+}
+
+// printTable writes a table of n rows with the header
+func printTable(w io.Writer, header []string, n int, row func(i int) []string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for i := 0; i < n; i++ {
+		fmt.Fprintln(tw, strings.Join(row(i), "\t"))
+	}
+	tw.Flush()
+}
+
+func formatDate(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+
+	return date.Format(time.DateOnly)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newLogger builds the application logger from the --log-level, --quiet and
+// --verbose flags. --quiet and --verbose take precedence over --log-level.
+func newLogger(flags *pflag.FlagSet) (*zap.Logger, error) {
+	level, _ := flags.GetString("log-level")
+	quiet, _ := flags.GetBool("quiet")
+	verbose, _ := flags.GetBool("verbose")
+
+	switch {
+	case quiet && verbose:
+		return nil, fmt.Errorf("--quiet and --verbose cannot be used together")
+	case quiet:
+		level = "error"
+	case verbose:
+		level = "debug"
+	}
+
+	zapLevel, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(zapLevel)
+	if zapLevel == zapcore.DebugLevel {
+		// Keep every debug line, payload dumps are useless when sampled
+		config.Sampling = nil
+	}
+
+	return config.Build()
+}
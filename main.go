@@ -3,49 +3,324 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"github.com/subosito/gotenv"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run executes the batch and returns the process exit code
+func run() (code int) {
+	// Print panics without the secrets that may be in the values of the trace
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintln(os.Stderr, redactSecrets(fmt.Sprintf("panic: %v\n\n%s", r, debug.Stack()), nil))
+			code = exitError
+		}
+	}()
+
+	// Parse command line flags
+	pflag.String("profile", "", "Configuration profile from profiles.<name> applied over the config file")
+	pflag.String("organization", "", "Azure DevOps organization, overrides devops.organization")
+	pflag.String("project", "", "Azure DevOps project, overrides devops.project")
+	pflag.Bool("demo", false, "Run against an in-memory fake of Azure DevOps, without an organization or a PAT")
+	pflag.String("env-file", ".env", "Load environment variables from this file when it exists")
+	pflag.StringP("output", "o", outputText, "Output format written to stdout (text, json, csv for query)")
+	pflag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	pflag.BoolP("quiet", "q", false, "Only log errors")
+	pflag.BoolP("verbose", "v", false, "Log debug output, including request payloads")
+	pflag.String("results-file", "", "Write the JSON results of the run to this file")
+	pflag.String("csv-report", "", "Write a CSV report of the run to this file")
+	pflag.String("markdown-report", "", "Write a Markdown report of the run to this file")
+	pflag.String("html-report", "", "Write a standalone HTML report with run statistics to this file")
+	pflag.String("junit-report", "", "Write the results as JUnit XML to this file")
+	pflag.String("errors-file", "errors.json", "Write the failed work items to this file when the run has failures (empty disables)")
+	pflag.String("audit-log", "", "Append every Azure DevOps API call to this file as JSON lines")
+	pflag.String("record-cassette", "", "Record the Azure DevOps API calls of the run in this cassette file, secrets redacted")
+	pflag.String("replay-cassette", "", "Answer the Azure DevOps API calls with the responses of this cassette file instead of sending them")
+	pflag.String("metrics-addr", "", "Serve Prometheus metrics and health probes on this address (e.g. :9090)")
+	pflag.String("pprof-addr", "", "Serve net/http/pprof on this localhost address in --watch and --schedule modes (e.g. :6060)")
+	pflag.String("pushgateway-url", "", "Push metrics to this Prometheus Pushgateway after every run")
+	pflag.String("otlp-endpoint", "", "Export OpenTelemetry traces to this OTLP/HTTP endpoint (defaults to OTEL_EXPORTER_OTLP_ENDPOINT)")
+	pflag.Bool("fail-fast", false, "Stop the run at the first failed work item instead of continuing")
+	pflag.Int("max-failures", 0, "Abort the run after N failed work items (0 disables)")
+	pflag.String("max-failure-rate", "", "Abort the run once failed work items exceed this share of the batch (e.g. 10%)")
+	pflag.Int("task-concurrency", 4, "Number of tasks of a user story created in parallel")
+	pflag.Bool("two-phase", false, "Create all the user stories, or those of every chunk, with the batch API, then all their tasks")
+	pflag.Int("retries", 0, "Retry creating a work item up to N times after a timeout or server error, looking it up by its client request ID first (0 disables)")
+	pflag.Int("chunk-size", 0, "Process the items in chunks of N user stories, saving a checkpoint and the reports after each (0 disables)")
+	pflag.String("checkpoint-file", defaultCheckpointFile, "Checkpoint file saved after every chunk with --chunk-size and read by --resume")
+	pflag.Bool("resume", false, "Resume the run interrupted at the checkpoint of --checkpoint-file, reusing the work items it created")
+	pflag.Duration("request-timeout", 0, "Fail Azure DevOps requests that take longer than this (e.g. 30s, 0 disables)")
+	pflag.String("inject-failures", "", "Fail this share of the work item writes with synthetic 429, 500 and timeout failures, for resilience testing (e.g. 10% or 20%:429,timeout)")
+	pflag.CommandLine.MarkHidden("inject-failures")
+	pflag.Bool("skip-preflight", false, "Skip checking the credentials, their scopes and the states of the items before the run")
+	pflag.Int("pat-expiry-warning", 14, "Warn when devops.patExpiresOn is within this many days")
+	pflag.Bool("verify", false, "Re-read the created work items after the run and log the fields that differ from the items file")
+	pflag.Bool("resolve-owners", false, "Resolve owners given as display name, email or unique name through the identities API before the run")
+	pflag.Bool("fuzzy-owners", false, "Use the closest identity of an owner that is not found when there is only one, with --resolve-owners and validate")
+	pflag.Bool("enforce-capacity", false, "Abort the run before creating anything when the task estimates of an owner exceed their sprint capacity")
+	pflag.String("capacity-tolerance", "", "Share of their capacity the task estimates of an owner can exceed it by with --enforce-capacity (e.g. 10%), overrides capacity.tolerance")
+	pflag.String("assignment", "", "Strategy assigning the work items of \"@Team Name\" owners to team members: round-robin (default) or least-loaded")
+	pflag.String("title-prefix", "", "Prefix added to the title of every work item of the run, e.g. \"[Q3-Rollout] \", overrides titles.prefix")
+	pflag.Bool("transition-states", false, "Create work items in the initial state of their type and move them to their state after, for processes that forbid creating them in other states")
+	pflag.String("order-field", "", "Field set to 1, 2, 3.. on the work items created, by rank and then in the order of the items file, e.g. Microsoft.VSTS.Common.StackRank")
+	pflag.Bool("reorder", false, "Move the user stories created to the top of the backlog of their team, by rank and then in the order of the items file, and their tasks under them")
+	pflag.Bool("provenance-comment", false, "Add a comment recording who ran the tool, the items file, its git commit and the run ID to every work item created")
+	pflag.Bool("skip-existing", false, "Skip user stories that were already created by a previous run")
+	pflag.String("on-duplicate", "", "What to do with user stories already created by a previous run: skip, create, update, merge, fail or ask, implies --skip-existing")
+	pflag.String("listen", ":8080", "Address the serve command listens on")
+	pflag.String("grpc-listen", "", "Address the serve command serves its gRPC API on, disabled when empty")
+	pflag.Bool("watch", false, "Re-apply the items file every time it changes")
+	pflag.String("schedule", "", "Keep running and apply the items file on a cron schedule (e.g. \"0 9 * * MON\")")
+	pflag.String("query", "", "WIQL query run by the query command, selecting the work items of the update, reassign, move and tags commands, or the user stories the export command exports")
+	pflag.String("area", "", "Area path the export command exports the user stories under, or the clone and move commands move the work items to")
+	pflag.StringArray("set", nil, "Field=Value set by the update command on every work item of --query, repeatable")
+	pflag.Bool("offline", false, "Validate against the cached project metadata without contacting Azure DevOps")
+	pflag.Bool("refresh-metadata", false, "Fetch the project metadata even when the cache is fresh")
+	pflag.String("lane", "", "Swimlane of the board of their team set on the user stories that do not set one")
+	pflag.String("iteration", "", "Iteration path of the items that do not set one, overrides devops.defaultIteration (\"@current\" for the sprint in progress), or the clone and move commands move the work items to")
+	pflag.Bool("attachments", false, "Link the attachments of the originals to the clones of the clone command")
+	pflag.String("tag", "", "Tag of the user stories the export command exports, or of the work items the delete, reassign and move commands select")
+	pflag.String("run", "", "Run ID whose work items the delete, reassign, move, tags and archive commands select")
+	pflag.String("from", "", "Current owner of the work items the reassign and move commands select, or the tag the tags command renames or removes")
+	pflag.String("to", "", "New owner the reassign command assigns the work items to, or the new name of the tag of tags rename")
+	pflag.String("target-project", "", "Project of the organization the move command moves the work items to")
+	pflag.String("team", "", "Team whose sprint the rollover command carries over, the default team of the project when unset")
+	pflag.Bool("reset-remaining", false, "Set the remaining work of the tasks the rollover command carries over to 0")
+	pflag.String("archive-state", defaultArchiveState, "State the archive command moves the open work items of the run to")
+	pflag.String("comment", "", "Comment the archive command adds to every work item it archives, naming the run by default")
+	pflag.Bool("dry-run", false, "List the work items the delete, move, archive and rollover commands would change without changing them")
+	pflag.Int("items", 100, "Number of synthetic tasks the bench command creates")
+	pflag.String("target", benchTargetMock, "Target of the bench command: mock, an in-memory fake of Azure DevOps, or real, the configured project")
+	pflag.IntSlice("concurrency", []int{1, 4, 8}, "Numbers of requests the bench command sends in parallel, compared")
+	pflag.IntSlice("batch-size", []int{1, 50, adobatch.MaxBatchSize}, "Numbers of work items the bench command updates per request, compared")
+	pflag.Duration("mock-latency", 50*time.Millisecond, "Latency the mock target of the bench command adds to every request")
+	pflag.BoolP("yes", "y", false, "Delete, archive or run the bench against a real project without asking for confirmation")
+	pflag.Parse()
+
 	// Initialize the logger
-	logger, err := zap.NewProduction(
-	// zap.Option
-	)
+	logger, err := newLogger(pflag.CommandLine)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitValidation
 	}
 	defer logger.Sync() // Flushes buffer, if any
 
+	// Load the .env file before Viper reads the environment, variables
+	// already set in the environment take precedence
+	if envFile, _ := pflag.CommandLine.GetString("env-file"); envFile != "" {
+		if _, err := os.Stat(envFile); err == nil {
+			if err := gotenv.Load(envFile); err != nil {
+				logger.Error("Failed to load env file", zap.String("path", envFile), zap.Error(err))
+				return exitValidation
+			}
+			logger.Debug("Env file loaded", zap.String("path", envFile))
+		}
+	}
+
 	// Initialize Viper
 	viper.SetConfigName("config")   // Name of the config file (without extension)
 	viper.SetConfigType("yaml")     // Config file format
 	viper.AddConfigPath("./config") // Path to look for the config file in the current directory
 	viper.AutomaticEnv()            // Automatically read environment variables
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.BindEnv("devops.organization", "DEVOPS_ORGANIZATION", "ADO_ORGANIZATION")
+	viper.BindEnv("devops.project", "DEVOPS_PROJECT", "ADO_PROJECT")
+	viper.BindEnv("devops.pat", "DEVOPS_PAT", "ADO_PAT")
+	viper.BindEnv("notifications.teams.webhookUrl", "TEAMS_WEBHOOK_URL")
+	viper.BindEnv("notifications.slack.webhookUrl", "SLACK_WEBHOOK_URL")
+	viper.BindEnv("notifications.email.password", "SMTP_PASSWORD")
+	viper.BindEnv("notifications.webhook.secret", "WEBHOOK_SECRET")
 	viper.SetDefault("env", "prd")
+	viper.SetDefault("hooks.tag", defaultHookTag)
+	viper.SetDefault("notifications.email.port", 587)
+	viper.SetDefault("metadata.cacheFile", ".ado_batch_creator/metadata.json")
+	viper.SetDefault("metadata.cacheTTL", defaultMetadataTTL.String())
+	viper.BindPFlags(pflag.CommandLine)
+	viper.BindPFlag("devops.organization", pflag.Lookup("organization"))
+	viper.BindPFlag("devops.project", pflag.Lookup("project"))
 
 	// Read the config file
 	if err := viper.ReadInConfig(); err != nil {
-		logger.Warn("Failed to read config file", zap.Error(err))
-		panic("Error reading config file")
-	} else {
-		logger.Info("Config file loaded successfully")
+		logger.Error("Failed to read config file", zap.Error(err))
+		return exitValidation
+	}
+	if config, err := os.ReadFile(viper.ConfigFileUsed()); err == nil && isSOPSConfig(config) {
+		decrypted, err := sopsDecrypt(viper.ConfigFileUsed(), "yaml", "yaml")
+		if err != nil {
+			logger.Error("Failed to decrypt config file", zap.Error(err))
+			return exitValidation
+		}
+		if err := viper.ReadConfig(bytes.NewReader(decrypted)); err != nil {
+			logger.Error("Failed to read decrypted config file", zap.Error(err))
+			return exitValidation
+		}
+	}
+	logger.Info("Config file loaded successfully")
+
+	// Apply the selected profile over the top level settings
+	if profile := viper.GetString("profile"); profile != "" {
+		settings := viper.GetStringMap("profiles." + profile)
+		if len(settings) == 0 {
+			logger.Error("Unknown configuration profile", zap.String("profile", profile))
+			return exitValidation
+		}
+		if err := viper.MergeConfigMap(settings); err != nil {
+			logger.Error("Failed to apply configuration profile", zap.String("profile", profile), zap.Error(err))
+			return exitValidation
+		}
+		logger.Info("Configuration profile applied", zap.String("profile", profile))
 	}
 
-	var userStories []models.UserStory
-	file, err := os.ReadFile(viper.GetString("itemsPath"))
+	// The mock target of bench is the demo server
+	if pflag.Arg(0) == "bench" && viper.GetString("target") == benchTargetMock {
+		viper.Set("demo", true)
+	}
+	if viper.GetBool("demo") {
+		useDemo()
+	}
+
+	// Write JSON logs to a rotated file as well as the console
+	if path := viper.GetString("log.file.path"); path != "" {
+		file, err := openRotatingFile(path, viper.GetInt("log.file.maxSizeMB"), viper.GetInt("log.file.maxAgeDays"), viper.GetInt("log.file.maxBackups"))
+		if err != nil {
+			logger.Error("Failed to open log file", zap.String("path", path), zap.Error(err))
+			return exitValidation
+		}
+		defer file.Close()
+
+		fileCore := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), file, logger.Level())
+		logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, fileCore)
+		}))
+		defer logger.Sync()
+	}
+	// Redact secrets on every output, they are registered once resolved
+	logger = logger.WithOptions(zap.WrapCore(newRedactingCore))
+
+	// auth runs before the settings are validated, it provides the PAT
+	if pflag.Arg(0) == "auth" {
+		return runAuthCommand(pflag.Arg(1), viper.GetString("devops.organization"), logger)
+	}
+
+	if problems := validateConfig(pflag.Arg(0)); len(problems) > 0 {
+		for _, problem := range problems {
+			logger.Error("Invalid configuration", zap.String("key", problem.Key), zap.String("problem", problem.Problem), zap.String("expected", problem.Expected))
+		}
+		return exitValidation
+	}
+
+	settings, err := GetAdoSettings()
 	if err != nil {
-		logger.Sugar().Fatalf("Failed to read items file in location %s", viper.GetString("itemsPath"))
+		logger.Error("Invalid Azure DevOps configuration", zap.Error(err))
+		return exitValidation
+	}
+	registerSecrets(settings.Pat, settings.ClientSecret)
+	for _, orgSettings := range settings.Organizations {
+		registerSecrets(orgSettings.Pat, orgSettings.ClientSecret)
 	}
 
-	if err := json.Unmarshal(file, &userStories); err != nil {
-		logger.Sugar().Panicf("failed to decode file with error: %w", err)
+	if viper.GetBool("demo") {
+		demo := adotest.NewServer()
+		defer demo.Close()
+		httpClient.Transport = demo.Transport()
+		if pflag.Arg(0) == "bench" {
+			demo.SetLatency(viper.GetDuration("mock-latency"))
+		}
+		logger.Info("Demo mode, requests are sent to an in-memory fake of Azure DevOps", zap.String("organization", demoOrganization), zap.String("project", demoProject))
+	}
+	if path := viper.GetString("replay-cassette"); path != "" {
+		player, err := adobatch.LoadCassette(path)
+		if err != nil {
+			logger.Error("Failed to load cassette", zap.String("path", path), zap.Error(err))
+			return exitValidation
+		}
+		httpClient.Transport = player
+		defer func() {
+			if unplayed := player.Unplayed(); len(unplayed) > 0 {
+				logger.Warn("Interactions of the cassette not replayed", zap.String("path", path), zap.Int("interactions", len(unplayed)), zap.String("first", unplayed[0].Method+" "+unplayed[0].URL))
+			}
+		}()
+	}
+	if path := viper.GetString("record-cassette"); path != "" {
+		next := httpClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		recorder := adobatch.NewRecorder(next, settings.Pat, settings.ClientSecret)
+		httpClient.Transport = recorder
+		defer func() {
+			if err := recorder.Save(path); err != nil {
+				logger.Error("Failed to save cassette", zap.String("path", path), zap.Error(err))
+			}
+		}()
+	}
+	if path := viper.GetString("audit-log"); path != "" {
+		next := httpClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		audit, err := newAuditTransport(path, next, settings.Pat, settings.ClientSecret)
+		if err != nil {
+			logger.Error("Failed to open audit log", zap.String("path", path), zap.Error(err))
+			return exitValidation
+		}
+		defer audit.Close()
+		httpClient.Transport = audit
+	}
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	injectFailures := viper.GetString("inject-failures")
+	if injectFailures == "" {
+		injectFailures = os.Getenv(faultsEnv)
+	}
+	if injectFailures != "" {
+		injection, err := parseFaultInjection(injectFailures)
+		if err != nil {
+			logger.Error("Invalid failure injection", zap.String("inject_failures", injectFailures), zap.Error(err))
+			return exitValidation
+		}
+		transport = faultTransport{next: transport, injection: injection}
+		logger.Warn("Injecting synthetic failures into work item writes", zap.Float64("rate", injection.rate), zap.Strings("kinds", injection.kinds))
+	}
+	httpClient.Transport = tracingTransport{next: metricsTransport{next: transport}}
+	httpClient.Timeout = viper.GetDuration("request-timeout")
+
+	endpoint := viper.GetString("otlp-endpoint")
+	for _, env := range []string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT"} {
+		if endpoint == "" {
+			endpoint = os.Getenv(env)
+		}
+	}
+	if endpoint != "" {
+		appTracer = newTracer(endpoint)
+		defer func() {
+			if err := appTracer.flush(context.Background()); err != nil {
+				logger.Error("Failed to export traces", zap.Error(err))
+			}
+		}()
 	}
 
 	// Example: Reading a value from the config or environment
@@ -55,223 +330,328 @@ func main() {
 	}
 	logger.Info("Application Name", zap.String("app_name", appName))
 
-	ctx := context.Background()
-	// Create user stories in Azure DevOps
-	for _, userStory := range userStories {
-		err := createUserStory(ctx, userStory, logger)
-		if err != nil {
-			logger.Error("Failed to create user story", zap.String("name", userStory.Name), zap.Error(err))
-		}
+	if err := validateOutput(pflag.Arg(0), viper.GetString("output")); err != nil {
+		logger.Error("Invalid --output", zap.Error(err))
+		return exitValidation
 	}
 
-	logger.Sugar().Infof("Finish Job. Created: %d US and %d Tasks", len(userStories), 0)
-}
-
-// createUserStory creates a user story in Azure DevOps
-func createUserStory(ctx context.Context, userStory models.UserStory, logger *zap.Logger) error {
-	organization := viper.GetString("devops.organization")
-	project := viper.GetString("devops.project")
-	pat := viper.GetString("devops.pat")
+	maxFailureRate, err := parseFailureRate(viper.GetString("max-failure-rate"))
+	if err != nil {
+		logger.Error("Invalid --max-failure-rate", zap.Error(err))
+		return exitValidation
+	}
 
-	// Validate required configuration
-	if organization == "" || project == "" || pat == "" {
-		return fmt.Errorf("missing Azure DevOps configuration: organization, project, or PAT")
+	assignment, err := adobatch.ParseAssignmentStrategy(viper.GetString("assignment"))
+	if err != nil {
+		logger.Error("Invalid --assignment", zap.Error(err))
+		return exitValidation
 	}
 
-	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workitems/$User%%20Story?api-version=7.0", organization, project)
-	logger.Debug("Azure DevOps API URL", zap.String("url", url))
+	var assignmentRules []adobatch.AssignmentRule
+	if err := viper.UnmarshalKey("assignmentRules", &assignmentRules); err != nil {
+		logger.Error("Invalid assignmentRules", zap.Error(err))
+		return exitValidation
+	}
 
-	payload := []map[string]interface{}{
-		{
-			"op":    "add",
-			"path":  "/fields/System.Title",
-			"value": userStory.Name,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.Description",
-			"value": userStory.Description,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.AssignedTo",
-			"value": userStory.Owner,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/Microsoft.VSTS.Common.Priority",
-			"value": userStory.Priority,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.State",
-			"value": userStory.State,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.Tags",
-			"value": "system_automated", // Add the "system_automated" tag
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.AreaPath",
-			"value": userStory.Area, // Add the "system_automated" tag
-		},
-		// {
-		// 	"op":    "add",
-		// 	"path":  "/fields/System.Iteraction",
-		// 	"value": userStory.Path, // Add the "system_automated" tag
-		// },
+	// --iteration points a generic items file at a sprint for this run only
+	iteration := viper.GetString("iteration")
+	if iteration == "" {
+		iteration = viper.GetString("devops.defaultIteration")
 	}
 
-	// Marshal the payload to JSON
-	payloadBytes, err := json.Marshal(payload)
+	taskNumbering, err := adobatch.ParseTaskNumbering(viper.GetString("titles.taskNumbering"))
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		logger.Error("Invalid titles.taskNumbering", zap.Error(err))
+		return exitValidation
 	}
-
-	// Create the HTTP request for the user story
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
+	titleOverflow, err := adobatch.ParseTitleOverflow(viper.GetString("titles.overflow"))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		logger.Error("Invalid titles.overflow", zap.Error(err))
+		return exitValidation
+	}
+	titlePrefix := viper.GetString("title-prefix")
+	if titlePrefix == "" {
+		titlePrefix = viper.GetString("titles.prefix")
 	}
 
-	// Set headers and authentication
-	req.Header.Set("Content-Type", "application/json-patch+json")
-	req.SetBasicAuth("", pat)
-
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	capacityTolerance := viper.GetString("capacity-tolerance")
+	if capacityTolerance == "" {
+		capacityTolerance = viper.GetString("capacity.tolerance")
+	}
+	capacityShare, err := parseShare(capacityTolerance)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		logger.Error("Invalid capacity tolerance", zap.String("tolerance", capacityTolerance), zap.Error(err))
+		return exitValidation
 	}
-	defer resp.Body.Close()
 
-	// Check the response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		var errResponseBody map[string]interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&errResponseBody); err != nil {
-			return fmt.Errorf("failed to parse response: %w", err)
-		}
+	onDuplicate := viper.GetString("on-duplicate")
+	resolveDuplicate, err := duplicateResolver(onDuplicate, logger)
+	if err != nil {
+		logger.Error("Invalid --on-duplicate", zap.Error(err))
+		return exitValidation
+	}
 
-		return fmt.Errorf("failed to create user story, status: %s with message: %s", resp.Status, string(errResponseBody["message"].(string)))
+	options := applyOptions{
+		itemsPath:        viper.GetString("itemsPath"),
+		skipExisting:     viper.GetBool("skip-existing") || viper.GetBool("watch") || onDuplicate != "",
+		resolveDuplicate: resolveDuplicate,
+		maxFailures:      viper.GetInt("max-failures"),
+		maxFailureRate:   maxFailureRate,
+		failFast:         viper.GetBool("fail-fast"),
+		retries:          viper.GetInt("retries"),
+		taskConcurrency:  viper.GetInt("task-concurrency"),
+		twoPhase:         viper.GetBool("two-phase"),
+		batchSize:        viper.GetInt("devops.batchSize"),
+		chunkSize:        viper.GetInt("chunk-size"),
+		checkpointFile:   viper.GetString("checkpoint-file"),
+		resume:           viper.GetBool("resume"),
+		verify:           viper.GetBool("verify"),
+		checkStates:      !viper.GetBool("skip-preflight"),
+		stateReasons:     viper.GetStringMapString("stateReasons"),
+		transitionStates: viper.GetBool("transition-states"),
+		iteration:        iteration,
+		lane:             viper.GetString("lane"),
+		tags:             viper.GetStringSlice("devops.defaultTags"),
+		titles: adobatch.TitleFormat{
+			Prefix:        titlePrefix,
+			Suffix:        viper.GetString("titles.suffix"),
+			TaskNumbering: taskNumbering,
+			Overflow:      titleOverflow,
+		},
+		assignment:        assignment,
+		assignmentRules:   assignmentRules,
+		resolveOwners:     viper.GetBool("resolve-owners"),
+		fuzzyOwners:       viper.GetBool("fuzzy-owners"),
+		enforceCapacity:   viper.GetBool("enforce-capacity"),
+		capacityTolerance: capacityShare,
+		orderField:        viper.GetString("order-field"),
+		reorder:           viper.GetBool("reorder"),
+		provenance:        viper.GetBool("provenance-comment"),
+		output:            viper.GetString("output"),
+		errorsFile:        viper.GetString("errors-file"),
+		pushgateway:       viper.GetString("pushgateway-url"),
+		reports: reportOptions{
+			resultsFile:    viper.GetString("results-file"),
+			csvReport:      viper.GetString("csv-report"),
+			markdownReport: viper.GetString("markdown-report"),
+			htmlReport:     viper.GetString("html-report"),
+			junitReport:    viper.GetString("junit-report"),
+		},
+		plugins: viper.GetStringSlice("plugins"),
+		script:  viper.GetString("transform.script"),
+		hooks: runHooks{
+			preRun:   viper.GetString("hooks.preRun"),
+			postItem: viper.GetString("hooks.postItem"),
+			postRun:  viper.GetString("hooks.postRun"),
+		},
+		notifications: notifyOptions{
+			teamsWebhook:  viper.GetString("notifications.teams.webhookUrl"),
+			slackWebhook:  viper.GetString("notifications.slack.webhookUrl"),
+			reportURL:     viper.GetString("notifications.reportUrl"),
+			webhook:       viper.GetString("notifications.webhook.url"),
+			webhookSecret: viper.GetString("notifications.webhook.secret"),
+			email: emailOptions{
+				host:     viper.GetString("notifications.email.host"),
+				port:     viper.GetInt("notifications.email.port"),
+				username: viper.GetString("notifications.email.username"),
+				password: viper.GetString("notifications.email.password"),
+				from:     viper.GetString("notifications.email.from"),
+				to:       viper.GetStringSlice("notifications.email.to"),
+			},
+		},
 	}
+	if options.notifications.reportURL == "" {
+		options.notifications.reportURL = ciRunURL()
+	}
+	// Webhook URLs embed their credentials
+	registerSecrets(options.notifications.teamsWebhook, options.notifications.slackWebhook, options.notifications.email.password, options.notifications.webhookSecret)
 
-	logger.Info("User story created successfully", zap.String("name", userStory.Name))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Parse the response to get the user story ID
-	var responseBody map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+	if addr := viper.GetString("metrics-addr"); addr != "" {
+		ready := &readinessCheck{settings: settings, ttl: 30 * time.Second}
+		go serveOps(ctx, addr, opsHandler(ready.check), logger)
 	}
-	userStoryID := int(responseBody["id"].(float64))
 
-	// Create tasks for the user story
-	for _, task := range userStory.Tasks {
-		if err := createTask(ctx, userStoryID, task, logger, userStory); err != nil {
-			logger.Error("Failed to create task", zap.String("task_name", task.Name), zap.Error(err))
+	if addr := viper.GetString("pprof-addr"); addr != "" {
+		if !viper.GetBool("watch") && viper.GetString("schedule") == "" && pflag.Arg(0) != "serve" {
+			logger.Warn("--pprof-addr is only served by serve and in --watch and --schedule modes")
+		} else {
+			addr, err := loopbackAddr(addr)
+			if err != nil {
+				logger.Error("Invalid --pprof-addr", zap.Error(err))
+				return exitValidation
+			}
+			go serveOps(ctx, addr, pprofHandler(), logger)
 		}
 	}
 
-	return nil
-}
-
-// createTask creates a task in Azure DevOps and links it to a user story
-func createTask(ctx context.Context, parentID int, task models.Task, logger *zap.Logger, userStory models.UserStory) error {
-	organization := viper.GetString("devops.organization")
-	project := viper.GetString("devops.project")
-	pat := viper.GetString("devops.pat")
+	// validate reports credential problems itself, and can run offline
+	if !viper.GetBool("skip-preflight") && pflag.Arg(0) != "validate" {
+		var patExpiresOn time.Time
+		if value := viper.GetString("devops.patExpiresOn"); value != "" {
+			if patExpiresOn, err = time.Parse(time.DateOnly, value); err != nil {
+				logger.Error("Invalid devops.patExpiresOn, expected YYYY-MM-DD", zap.Error(err))
+				return exitValidation
+			}
+		}
 
-	// Validate required configuration
-	if organization == "" || project == "" || pat == "" {
-		return fmt.Errorf("missing Azure DevOps configuration: organization, project, or PAT")
+		err = preflight(ctx, settings, patExpiresOn, viper.GetInt("pat-expiry-warning"), logger)
+		// Only the commands creating items target the other organizations
+		if err == nil && slices.Contains([]string{"", "apply", "replay", "serve"}, pflag.Arg(0)) {
+			err = preflightOrganizations(ctx, settings, logger)
+		}
+		if err != nil {
+			logger.Error("Preflight check failed", zap.Error(err))
+			if errors.Is(err, adobatch.ErrAuth) {
+				return exitAuth
+			}
+			return exitError
+		}
 	}
 
-	// Azure DevOps REST API URL for creating tasks
-	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workitems/$Task?api-version=7.0", organization, project)
-
-	// Payload for the task
-	payload := []map[string]interface{}{
-		{
-			"op":    "add",
-			"path":  "/fields/System.Title",
-			"value": task.Name,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.Description",
-			"value": task.Description,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.AssignedTo",
-			"value": task.Owner,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/Microsoft.VSTS.Common.Priority",
-			"value": task.Priority,
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.State",
-			"value": task.State,
-		},
-		{
-			"op":   "add",
-			"path": "/relations/-",
-			"value": map[string]interface{}{
-				"rel": "System.LinkTypes.Hierarchy-Reverse",
-				"url": fmt.Sprintf("https://dev.azure.com/%s/_apis/wit/workItems/%d", organization, parentID),
-				"attributes": map[string]string{
-					"comment": "Linking task to user story",
-				},
+	switch command := pflag.Arg(0); command {
+	case "", "apply":
+	case "replay":
+		return replayAuditLog(ctx, settings, pflag.Arg(1), options, logger)
+	case "export":
+		return exportItems(ctx, settings, pflag.Arg(1), exportOptions{
+			query: viper.GetString("query"),
+			area:  viper.GetString("area"),
+			tag:   viper.GetString("tag"),
+		}, logger)
+	case "verify":
+		path := pflag.Arg(1)
+		if path == "" {
+			path = viper.GetString("results-file")
+		}
+		return verifyResultsFile(ctx, settings, path, options, logger)
+	case "update":
+		sets, _ := pflag.CommandLine.GetStringArray("set")
+		return updateWorkItems(ctx, settings, viper.GetString("query"), sets, options, logger)
+	case "delete":
+		return deleteWorkItems(ctx, settings, deleteOptions{
+			selection: bulkSelection{tag: viper.GetString("tag"), runID: viper.GetString("run")},
+			dryRun:    viper.GetBool("dry-run"),
+			yes:       viper.GetBool("yes"),
+		}, options, logger)
+	case "reassign":
+		return reassignWorkItems(ctx, settings, viper.GetString("query"), bulkSelection{
+			tag:   viper.GetString("tag"),
+			runID: viper.GetString("run"),
+			owner: viper.GetString("from"),
+		}, viper.GetString("to"), options, logger)
+	case "move":
+		return moveWorkItems(ctx, settings, moveOptions{
+			query: viper.GetString("query"),
+			selection: bulkSelection{
+				tag:   viper.GetString("tag"),
+				runID: viper.GetString("run"),
+				owner: viper.GetString("from"),
 			},
-		},
-		{
-			"op":    "add",
-			"path":  "/fields/System.AreaPath",
-			"value": userStory.Area, // Add the "system_automated" tag
-		},
-		// {
-		// 	"op":    "add",
-		// 	"path":  "/fields/System.Iteraction",
-		// 	"value": userStory.Path, // Add the "system_automated" tag
-		// },
-	}
-
-	// Marshal the payload to JSON
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+			area:      viper.GetString("area"),
+			iteration: viper.GetString("iteration"),
+			project:   viper.GetString("target-project"),
+			dryRun:    viper.GetBool("dry-run"),
+		}, options, logger)
+	case "archive":
+		return archiveWorkItems(ctx, settings, archiveOptions{
+			runID:   viper.GetString("run"),
+			state:   viper.GetString("archive-state"),
+			comment: viper.GetString("comment"),
+			dryRun:  viper.GetBool("dry-run"),
+			yes:     viper.GetBool("yes"),
+		}, options, logger)
+	case "rollover":
+		return rolloverSprint(ctx, settings, rolloverOptions{
+			team:           viper.GetString("team"),
+			resetRemaining: viper.GetBool("reset-remaining"),
+			dryRun:         viper.GetBool("dry-run"),
+		}, options, logger)
+	case "tags":
+		return manageTags(ctx, settings, pflag.Arg(1), tagsOptions{
+			query: viper.GetString("query"),
+			runID: viper.GetString("run"),
+			from:  viper.GetString("from"),
+			to:    viper.GetString("to"),
+		}, options, logger)
+	case "bench":
+		concurrency, _ := pflag.CommandLine.GetIntSlice("concurrency")
+		batchSizes, _ := pflag.CommandLine.GetIntSlice("batch-size")
+		return runBench(ctx, settings, benchOptions{
+			items:       viper.GetInt("items"),
+			target:      viper.GetString("target"),
+			concurrency: concurrency,
+			batchSizes:  batchSizes,
+			yes:         viper.GetBool("yes"),
+		}, options, logger)
+	case "validate":
+		return validateItems(ctx, settings, options, metadataCache{
+			path:    viper.GetString("metadata.cacheFile"),
+			ttl:     viper.GetDuration("metadata.cacheTTL"),
+			refresh: viper.GetBool("refresh-metadata"),
+			offline: viper.GetBool("offline"),
+		}, logger)
+	case "list":
+		return listMetadata(ctx, settings, pflag.Arg(1), viper.GetString("output"), logger)
+	case "query":
+		query := pflag.Arg(1)
+		if query == "" {
+			query = viper.GetString("query")
+		}
+		return runQuery(ctx, settings, query, viper.GetString("output"), logger)
+	case "clone":
+		return cloneWorkItem(ctx, settings, pflag.Arg(1), adobatch.CloneOptions{
+			Area:        viper.GetString("area"),
+			Iteration:   viper.GetString("iteration"),
+			Attachments: viper.GetBool("attachments"),
+		}, viper.GetString("output"), logger)
+	case "serve":
+		if strings.EqualFold(onDuplicate, duplicateAsk) {
+			logger.Error("--on-duplicate ask cannot be used with serve, batches run unattended")
+			return exitValidation
+		}
+		registerSecrets(viper.GetString("server.token"))
+		return serveBatches(ctx, settings, options, serverOptions{
+			addr:     viper.GetString("listen"),
+			grpcAddr: viper.GetString("grpc-listen"),
+			token:    viper.GetString("server.token"),
+			hooks: hookOptions{
+				template:     viper.GetString("hooks.template"),
+				tag:          viper.GetString("hooks.tag"),
+				workItemType: viper.GetString("hooks.workItemType"),
+			},
+		}, logger)
+	default:
+		logger.Error("Unknown command", zap.String("command", command))
+		return exitValidation
 	}
 
-	// Create the HTTP request for the task
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
+	if expression := viper.GetString("schedule"); expression != "" {
+		if viper.GetBool("watch") {
+			logger.Error("--schedule and --watch cannot be used together")
+			return exitValidation
+		}
+		if strings.EqualFold(onDuplicate, duplicateAsk) {
+			logger.Error("--on-duplicate ask cannot be used with --schedule, runs are unattended")
+			return exitValidation
+		}
 
-	// Set headers and authentication
-	req.Header.Set("Content-Type", "application/json-patch+json")
-	req.SetBasicAuth("", pat)
+		schedule, err := parseCron(expression)
+		if err != nil {
+			logger.Error("Invalid --schedule", zap.Error(err))
+			return exitValidation
+		}
 
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return scheduleItems(ctx, settings, options, schedule, logger)
 	}
-	defer resp.Body.Close()
 
-	// Check the response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to create task, status: %s", resp.Status)
+	if viper.GetBool("watch") {
+		return watchItems(ctx, settings, options, logger)
 	}
 
-	logger.Info("Task created successfully", zap.String("name", task.Name))
-	return nil
+	return applyItems(ctx, settings, options, logger)
 }
 
 // Finds the next iteraction based on dates for that team
@@ -285,22 +665,73 @@ func FindIteraction(ctx context.Context, iteraction string) *string {
 	return nil
 }
 
-func GetAdoSettings(logger *zap.Logger) models.AdoSettings {
-	adosettings := &models.AdoSettings{}
-
-	organization := viper.GetString("devops.organization")
-	project := viper.GetString("devops.project")
-	pat := viper.GetString("devops.pat")
+// GetAdoSettings reads and validates the Azure DevOps connection settings
+func GetAdoSettings() (models.AdoSettings, error) {
+	adosettings := models.AdoSettings{
+		Organization:    viper.GetString("devops.organization"),
+		Project:         viper.GetString("devops.project"),
+		Pat:             viper.GetString("devops.pat"),
+		Auth:            viper.GetString("devops.auth"),
+		TenantId:        viper.GetString("devops.tenantId"),
+		ClientId:        viper.GetString("devops.clientId"),
+		ClientSecret:    viper.GetString("devops.clientSecret"),
+		CertificatePath: viper.GetString("devops.certificatePath"),
+	}
 
-	// Validate required configuration
-	if organization == "" || project == "" || pat == "" {
-		logger.Sugar().Panicf("missing Azure DevOps configuration: organization: %s, project: %s, or PAT: %d", organization, project, len(pat))
-		return *adosettings
+	// The structure is checked by validateConfig, only the PAT is resolved here
+	if adosettings.Auth == "" || adosettings.Auth == authPAT {
+		if vault := viper.GetString("devops.patKeyVault.vaultUrl"); adosettings.Pat == "" && vault != "" {
+			secret := keyVaultSecret{
+				VaultURL:   vault,
+				SecretName: viper.GetString("devops.patKeyVault.secretName"),
+				Credential: viper.GetString("devops.patKeyVault.credential"),
+			}
+			if secret.Credential == "" {
+				secret.Credential = authManagedIdentity
+			}
+
+			pat, err := getKeyVaultSecret(context.Background(), adosettings, secret)
+			if err != nil {
+				return adosettings, fmt.Errorf("failed to read PAT from Key Vault: %w", err)
+			}
+			adosettings.Pat = pat
+		}
+		if adosettings.Pat == "" {
+			// Stored by `auth login` on developer machines
+			if pat, err := keyringGet(adosettings.Organization); err == nil {
+				adosettings.Pat = pat
+			}
+		}
+		if adosettings.Pat == "" {
+			return adosettings, fmt.Errorf("missing Azure DevOps configuration: PAT, set devops.pat or run `auth login`")
+		}
 	}
 
-	adosettings.Organization = organization
-	adosettings.Project = project
-	adosettings.Pat = pat
+	// Other organizations items can target, settings they leave empty are
+	// inherited from the default organization
+	for name := range viper.GetStringMap("devops.organizations") {
+		key := "devops.organizations." + name + "."
+		orgSettings := adosettings
+		orgSettings.Organization = name
+		for field, value := range map[string]*string{
+			"project":         &orgSettings.Project,
+			"pat":             &orgSettings.Pat,
+			"auth":            &orgSettings.Auth,
+			"tenantId":        &orgSettings.TenantId,
+			"clientId":        &orgSettings.ClientId,
+			"clientSecret":    &orgSettings.ClientSecret,
+			"certificatePath": &orgSettings.CertificatePath,
+		} {
+			if configured := viper.GetString(key + field); configured != "" {
+				*value = configured
+			}
+		}
+
+		if adosettings.Organizations == nil {
+			adosettings.Organizations = map[string]models.AdoSettings{}
+		}
+		adosettings.Organizations[strings.ToLower(name)] = orgSettings
+	}
 
-	return *adosettings
+	return adosettings, nil
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// defaultMetadataTTL is how long cached project metadata is used before it
+// is fetched again
+const defaultMetadataTTL = 24 * time.Hour
+
+// metadataCache stores the project metadata in a local file
+type metadataCache struct {
+	path string
+	ttl  time.Duration
+	// refresh fetches the metadata even when the cache is fresh
+	refresh bool
+	// offline only reads the cache, even when it is stale
+	offline bool
+}
+
+// loadMetadata returns the metadata of the project from the cache when it is
+// fresh, and fetches and caches it otherwise. A stale cache is used when the
+// metadata cannot be fetched.
+func loadMetadata(ctx context.Context, settings models.AdoSettings, cache metadataCache, logger *zap.Logger) (*adobatch.Metadata, error) {
+	cached, err := readMetadataCache(cache.path, settings)
+	if err != nil {
+		logger.Warn("Ignoring metadata cache", zap.String("path", cache.path), zap.Error(err))
+	}
+	if cached != nil {
+		age := time.Since(cached.FetchedAt)
+		if cache.offline {
+			if age > cache.ttl {
+				logger.Warn("Using stale metadata cache offline", zap.String("path", cache.path), zap.Duration("age", age.Round(time.Second)))
+			}
+			return cached, nil
+		}
+		if !cache.refresh && age <= cache.ttl {
+			logger.Debug("Using metadata cache", zap.String("path", cache.path), zap.Duration("age", age.Round(time.Second)))
+			return cached, nil
+		}
+	}
+	if cache.offline {
+		return nil, fmt.Errorf("no metadata cached in %s for %s/%s, run once without --offline", cache.path, settings.Organization, settings.Project)
+	}
+
+	metadata, err := newClient(settings, logger).FetchMetadata(ctx, settings)
+	if err != nil {
+		if cached != nil && !errors.Is(err, adobatch.ErrAuth) {
+			logger.Warn("Failed to refresh metadata, using stale cache", zap.String("path", cache.path), zap.Error(err))
+			return cached, nil
+		}
+		return nil, fmt.Errorf("failed to fetch project metadata: %w", err)
+	}
+
+	if err := writeMetadataCache(cache.path, metadata); err != nil {
+		logger.Warn("Failed to write metadata cache", zap.String("path", cache.path), zap.Error(err))
+	} else {
+		logger.Info("Project metadata cached", zap.String("path", cache.path), zap.Int("areas", len(metadata.Areas)),
+			zap.Int("iterations", len(metadata.Iterations)), zap.Int("types", len(metadata.Types)), zap.Int("fields", len(metadata.Fields)), zap.Int("teams", len(metadata.Teams)), zap.Int("users", len(metadata.Users)))
+	}
+
+	return metadata, nil
+}
+
+// readMetadataCache returns the cached metadata of the project, or nil when
+// the file does not exist or holds another project
+func readMetadataCache(path string, settings models.AdoSettings) (*adobatch.Metadata, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata adobatch.Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata cache: %w", err)
+	}
+	if !strings.EqualFold(metadata.Organization, settings.Organization) || !strings.EqualFold(metadata.Project, settings.Project) {
+		return nil, nil
+	}
+
+	return &metadata, nil
+}
+
+// writeMetadataCache replaces the cache file atomically, so concurrent runs
+// never read a partial file
+func writeMetadataCache(path string, metadata *adobatch.Metadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
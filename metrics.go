@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the API latency histogram
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// histogram is a Prometheus histogram with cumulative buckets
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range latencyBuckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// metrics holds the process metrics, exposed in the Prometheus text format
+type metrics struct {
+	mu sync.Mutex
+	// workItems counts work items by type and status
+	workItems map[[2]string]float64
+	// requests counts API requests by method and status code
+	requests  map[[2]string]float64
+	latency   map[string]*histogram
+	throttled float64
+	// runs counts runs by exit code
+	runs    map[int]float64
+	lastRun time.Time
+}
+
+// appMetrics collects the metrics of the process
+var appMetrics = newMetrics()
+
+func newMetrics() *metrics {
+	return &metrics{
+		workItems: map[[2]string]float64{},
+		requests:  map[[2]string]float64{},
+		latency:   map[string]*histogram{},
+		runs:      map[int]float64{},
+	}
+}
+
+// observeRequest records an Azure DevOps API call, code is 0 when the
+// request did not get a response
+func (m *metrics) observeRequest(method string, code int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := "error"
+	if code != 0 {
+		status = strconv.Itoa(code)
+	}
+	m.requests[[2]string{method, status}]++
+	if code == http.StatusTooManyRequests {
+		m.throttled++
+	}
+
+	h, ok := m.latency[method]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[method] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// observeRun records the work items of a finished run, by the type they
+// were created as
+func (m *metrics) observeRun(items []adobatch.Result, exitCode int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, item := range items {
+		m.workItems[[2]string{adobatch.UserStoryType(item.Item), item.Status}]++
+		for _, task := range item.Tasks {
+			m.workItems[[2]string{adobatch.TaskType(task.Item), task.Status}]++
+		}
+	}
+	m.runs[exitCode]++
+	m.lastRun = time.Now()
+}
+
+// write writes the metrics in the Prometheus text exposition format
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP ado_batch_creator_work_items_total Work items processed, by type and status.")
+	fmt.Fprintln(w, "# TYPE ado_batch_creator_work_items_total counter")
+	for _, key := range sortedKeys(m.workItems) {
+		fmt.Fprintf(w, "ado_batch_creator_work_items_total{type=%q,status=%q} %v\n", key[0], key[1], m.workItems[key])
+	}
+
+	fmt.Fprintln(w, "# HELP ado_batch_creator_api_requests_total Azure DevOps API requests, by method and status code.")
+	fmt.Fprintln(w, "# TYPE ado_batch_creator_api_requests_total counter")
+	for _, key := range sortedKeys(m.requests) {
+		fmt.Fprintf(w, "ado_batch_creator_api_requests_total{method=%q,code=%q} %v\n", key[0], key[1], m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP ado_batch_creator_api_request_duration_seconds Azure DevOps API latency.")
+	fmt.Fprintln(w, "# TYPE ado_batch_creator_api_request_duration_seconds histogram")
+	methods := make([]string, 0, len(m.latency))
+	for method := range m.latency {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	for _, method := range methods {
+		h := m.latency[method]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "ado_batch_creator_api_request_duration_seconds_bucket{method=%q,le=%q} %d\n", method, strconv.FormatFloat(bound, 'f', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "ado_batch_creator_api_request_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", method, h.count)
+		fmt.Fprintf(w, "ado_batch_creator_api_request_duration_seconds_sum{method=%q} %v\n", method, h.sum)
+		fmt.Fprintf(w, "ado_batch_creator_api_request_duration_seconds_count{method=%q} %d\n", method, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP ado_batch_creator_throttled_requests_total Requests throttled by Azure DevOps (HTTP 429).")
+	fmt.Fprintln(w, "# TYPE ado_batch_creator_throttled_requests_total counter")
+	fmt.Fprintf(w, "ado_batch_creator_throttled_requests_total %v\n", m.throttled)
+
+	fmt.Fprintln(w, "# HELP ado_batch_creator_runs_total Finished runs, by exit code.")
+	fmt.Fprintln(w, "# TYPE ado_batch_creator_runs_total counter")
+	codes := make([]int, 0, len(m.runs))
+	for code := range m.runs {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "ado_batch_creator_runs_total{exit_code=\"%d\"} %v\n", code, m.runs[code])
+	}
+
+	if !m.lastRun.IsZero() {
+		fmt.Fprintln(w, "# HELP ado_batch_creator_last_run_timestamp_seconds Time the last run finished.")
+		fmt.Fprintln(w, "# TYPE ado_batch_creator_last_run_timestamp_seconds gauge")
+		fmt.Fprintf(w, "ado_batch_creator_last_run_timestamp_seconds %d\n", m.lastRun.Unix())
+	}
+}
+
+// ServeHTTP exposes the metrics to Prometheus
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// push replaces the metrics of the job on a Prometheus Pushgateway
+func (m *metrics) push(ctx context.Context, gateway string) error {
+	var body bytes.Buffer
+	m.write(&body)
+
+	url := fmt.Sprintf("%s/metrics/job/%s", strings.TrimSuffix(gateway, "/"), url.PathEscape("ado_batch_creator"))
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway returned unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// sortedKeys returns the label pairs of a counter in a stable order
+func sortedKeys(counter map[[2]string]float64) [][2]string {
+	keys := make([][2]string, 0, len(counter))
+	for key := range counter {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	return keys
+}
+
+// metricsTransport records the latency and status of every API call
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	code := 0
+	if err == nil {
+		code = resp.StatusCode
+	}
+	appMetrics.observeRequest(req.Method, code, time.Since(start))
+
+	return resp, err
+}
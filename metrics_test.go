@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+const metricsGolden = `# HELP ado_batch_creator_work_items_total Work items processed, by type and status.
+# TYPE ado_batch_creator_work_items_total counter
+ado_batch_creator_work_items_total{type="Bug",status="skipped"} 1
+ado_batch_creator_work_items_total{type="Product Backlog Item",status="created"} 1
+ado_batch_creator_work_items_total{type="Task",status="created"} 1
+ado_batch_creator_work_items_total{type="Task",status="failed"} 1
+# HELP ado_batch_creator_api_requests_total Azure DevOps API requests, by method and status code.
+# TYPE ado_batch_creator_api_requests_total counter
+ado_batch_creator_api_requests_total{method="GET",code="200"} 1
+ado_batch_creator_api_requests_total{method="POST",code="200"} 1
+ado_batch_creator_api_requests_total{method="POST",code="429"} 1
+ado_batch_creator_api_requests_total{method="POST",code="error"} 1
+# HELP ado_batch_creator_api_request_duration_seconds Azure DevOps API latency.
+# TYPE ado_batch_creator_api_request_duration_seconds histogram
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="0.05"} 0
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="0.1"} 0
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="0.25"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="0.5"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="1"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="2.5"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="5"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="10"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="30"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="GET",le="+Inf"} 1
+ado_batch_creator_api_request_duration_seconds_sum{method="GET"} 0.25
+ado_batch_creator_api_request_duration_seconds_count{method="GET"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="0.05"} 0
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="0.1"} 0
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="0.25"} 0
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="0.5"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="1"} 1
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="2.5"} 2
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="5"} 2
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="10"} 2
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="30"} 2
+ado_batch_creator_api_request_duration_seconds_bucket{method="POST",le="+Inf"} 3
+ado_batch_creator_api_request_duration_seconds_sum{method="POST"} 62.5
+ado_batch_creator_api_request_duration_seconds_count{method="POST"} 3
+# HELP ado_batch_creator_throttled_requests_total Requests throttled by Azure DevOps (HTTP 429).
+# TYPE ado_batch_creator_throttled_requests_total counter
+ado_batch_creator_throttled_requests_total 1
+# HELP ado_batch_creator_runs_total Finished runs, by exit code.
+# TYPE ado_batch_creator_runs_total counter
+ado_batch_creator_runs_total{exit_code="0"} 1
+ado_batch_creator_runs_total{exit_code="3"} 1
+# HELP ado_batch_creator_last_run_timestamp_seconds Time the last run finished.
+# TYPE ado_batch_creator_last_run_timestamp_seconds gauge
+ado_batch_creator_last_run_timestamp_seconds 1791104400
+`
+
+// newTestMetrics returns the metrics of two runs in a Scrum project
+func newTestMetrics() *metrics {
+	m := newMetrics()
+	m.observeRequest(http.MethodGet, http.StatusOK, 250*time.Millisecond)
+	m.observeRequest(http.MethodPost, http.StatusOK, 500*time.Millisecond)
+	m.observeRequest(http.MethodPost, http.StatusTooManyRequests, 2*time.Second)
+	m.observeRequest(http.MethodPost, 0, time.Minute)
+
+	m.observeRun([]adobatch.Result{{
+		Item:   models.UserStory{Name: "PBI 1", Type: "Product Backlog Item"},
+		Status: models.StatusCreated,
+		Tasks: []adobatch.TaskResult{
+			{Item: models.Task{Name: "Task 1"}, Status: models.StatusCreated},
+			{Item: models.Task{Name: "Task 2"}, Status: models.StatusFailed},
+		},
+	}}, exitSuccess)
+	m.observeRun([]adobatch.Result{{Item: models.UserStory{Name: "Bug 1", Type: "Bug"}, Status: models.StatusSkipped}}, exitPartialFailure)
+	m.lastRun = time.Date(2026, 10, 4, 9, 0, 0, 0, time.UTC)
+
+	return m
+}
+
+func TestMetricsWrite(t *testing.T) {
+	var out bytes.Buffer
+	newTestMetrics().write(&out)
+	if out.String() != metricsGolden {
+		t.Errorf("metrics =\n%s\nwant\n%s", out.String(), metricsGolden)
+	}
+}
+
+func TestMetricsPush(t *testing.T) {
+	var method, path, contentType, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, contentType, body = r.Method, r.URL.Path, r.Header.Get("Content-Type"), string(data)
+	}))
+	t.Cleanup(gateway.Close)
+
+	if err := newTestMetrics().push(context.Background(), gateway.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/ado_batch_creator" {
+		t.Errorf("pushed with %s %s, want PUT /metrics/job/ado_batch_creator", method, path)
+	}
+	if contentType != "text/plain; version=0.0.4" {
+		t.Errorf("content type = %q", contentType)
+	}
+	if body != metricsGolden {
+		t.Errorf("pushed metrics =\n%s\nwant\n%s", body, metricsGolden)
+	}
+
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(rejecting.Close)
+	if err := newTestMetrics().push(context.Background(), rejecting.URL); err == nil {
+		t.Error("push rejected by the gateway did not fail")
+	}
+}
@@ -4,4 +4,16 @@ type AdoSettings struct {
 	Organization string
 	Project      string
 	Pat          string
+	// Auth is the authentication mode: pat (default), entra, managed_identity,
+	// service_principal or azure_cli
+	Auth         string
+	TenantId     string
+	ClientId     string
+	ClientSecret string
+	// CertificatePath is a PEM file with the certificate and private key of
+	// a service principal
+	CertificatePath string
+	// Organizations holds the settings of the other organizations items can
+	// target, keyed by lower case organization name
+	Organizations map[string]AdoSettings
 }
@@ -0,0 +1,13 @@
+package models
+
+// ItemsFile is the object form of the items file, with defaults applied to
+// every user story that does not set its own value
+type ItemsFile struct {
+	Defaults ItemDefaults `yaml:"defaults" json:"defaults"`
+	Items    []UserStory  `yaml:"items" json:"items"`
+}
+
+type ItemDefaults struct {
+	Organization string `yaml:"organization" json:"organization"`
+	Project      string `yaml:"project" json:"project"`
+}
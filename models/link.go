@@ -0,0 +1,11 @@
+package models
+
+// Link relates a work item to another item of the items file, by its key, or
+// to an existing work item, by its ID
+type Link struct {
+	// Type is related, predecessor or successor, or the reference name of a
+	// link type such as System.LinkTypes.Duplicate-Forward
+	Type string `yaml:"type" json:"type"`
+	Key  string `yaml:"key" json:"key,omitempty"`
+	ID   int    `yaml:"id" json:"id,omitempty"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Priority is the priority of a work item, from 1 (highest) to 4. Items files
+// can also set it as a number in a string or as a symbolic priority.
+type Priority int
+
+// Priority range of the Agile, Scrum and CMMI processes, 0 leaves it unset
+const (
+	MinPriority Priority = 1
+	MaxPriority Priority = 4
+)
+
+// symbolicPriorities map the names accepted in items files to priorities
+var symbolicPriorities = map[string]Priority{
+	"critical": 1,
+	"high":     2,
+	"medium":   3,
+	"low":      4,
+}
+
+// ParsePriority parses a priority given as a number or a symbolic priority,
+// critical, high, medium or low
+func ParsePriority(value string) (Priority, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if priority, ok := symbolicPriorities[value]; ok {
+		return priority, nil
+	}
+	priority, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q, expected %d-%d or critical, high, medium or low", value, MinPriority, MaxPriority)
+	}
+
+	return Priority(priority), nil
+}
+
+// Valid reports whether the priority is unset or within the process range
+func (p Priority) Valid() bool {
+	return p == 0 || (p >= MinPriority && p <= MaxPriority)
+}
+
+func (p *Priority) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case nil:
+		*p = 0
+	case float64:
+		if value != float64(int(value)) {
+			return fmt.Errorf("invalid priority %v, expected a whole number", value)
+		}
+		*p = Priority(value)
+	case string:
+		priority, err := ParsePriority(value)
+		if err != nil {
+			return err
+		}
+		*p = priority
+	default:
+		return fmt.Errorf("invalid priority %s", data)
+	}
+
+	return nil
+}
@@ -1,11 +1,23 @@
 package models
 
 type Task struct {
-	Name        string `yaml:"name" json:"name"`
-	Type        string `yaml:"type" json:"type"`
-	Description string `yaml:"description" json:"description"`
-	Owner       string `yaml:"owner" json:"owner"`
-	State       string `yaml:"state" json:"state"`
-	Priority    int    `yaml:"priority" json:"priority"`
-	Estimate    int    `yaml:"estimate" json:"estimate"`
+	Name        string   `yaml:"name" json:"name"`
+	Type        string   `yaml:"type" json:"type,omitempty"`
+	Description string   `yaml:"description" json:"description"`
+	Owner       string   `yaml:"owner" json:"owner"`
+	State       string   `yaml:"state" json:"state"`
+	Priority    Priority `yaml:"priority" json:"priority"`
+	Estimate    int      `yaml:"estimate" json:"estimate"`
+	// Fields sets other fields of the task, like UserStory.Fields
+	Fields map[string]any `yaml:"fields" json:"fields,omitempty"`
+	// Reason explains the state, overriding the reason configured for it
+	Reason string `yaml:"reason" json:"reason,omitempty"`
+	// Rank orders the item in the backlog, or among the tasks of its user
+	// story, before the items without one, lowest first
+	Rank int `yaml:"rank" json:"rank,omitempty"`
+	// Key identifies the task in the links of the items file
+	Key   string `yaml:"key" json:"key,omitempty"`
+	Links []Link `yaml:"links" json:"links,omitempty"`
+	// Tags are added to the tags of the run, see adobatch.TagSeparator
+	Tags []string `yaml:"tags" json:"tags,omitempty"`
 }
@@ -1,7 +1,11 @@
 package models
 
-type UserStoryResponse struct {
-	UserStory UserStory
-	Status string
-	Id string
-}
\ No newline at end of file
+// Item statuses reported at the end of a run
+const (
+	StatusCreated = "created"
+	StatusSkipped = "skipped"
+	StatusFailed  = "failed"
+	// StatusUpdated and StatusDeleted are reported by the bulk commands
+	StatusUpdated = "updated"
+	StatusDeleted = "deleted"
+)
@@ -1,15 +1,42 @@
 package models
 
 type UserStory struct {
-	Name        string  `yaml:"name" json:"name"`
-	Type        string  `yaml:"type" json:"type"`
-	Description string  `yaml:"description" json:"description"`
-	Owner       string  `yaml:"owner" json:"owner"`
-	State       string  `yaml:"state" json:"state"`
-	Priority    int     `yaml:"priority" json:"priority"`
-	Area        string  `yaml:"area" json:"area"`
-	Path        string  `yaml:"path" json:"path"`
-	Tasks       []Task  `yaml:"tasks" json:"tasks"`
-	Iteraction  *string `yaml:"iteraction" json:"iteraction"`
-	Team        string  `yaml:"team" json:"team"`
+	Name        string   `yaml:"name" json:"name"`
+	Type        string   `yaml:"type" json:"type,omitempty"`
+	Description string   `yaml:"description" json:"description"`
+	Owner       string   `yaml:"owner" json:"owner"`
+	State       string   `yaml:"state" json:"state"`
+	Priority    Priority `yaml:"priority" json:"priority"`
+	Area        string   `yaml:"area" json:"area"`
+	Path        string   `yaml:"path" json:"path"`
+	Tasks       []Task   `yaml:"tasks" json:"tasks"`
+	Iteraction  *string  `yaml:"iteraction" json:"iteraction"`
+	Team        string   `yaml:"team" json:"team"`
+	// Points are the story points of the user story
+	Points float64 `yaml:"points" json:"points,omitempty"`
+	// Reason explains the state, overriding the reason configured for it
+	Reason string `yaml:"reason" json:"reason,omitempty"`
+	// Column is the board column of the user story on the board of its team
+	Column string `yaml:"column" json:"column,omitempty"`
+	// Fields sets other fields of the user story, by reference name, such
+	// as Custom.CostCenter, or by name, such as "Cost Center"
+	Fields map[string]any `yaml:"fields" json:"fields,omitempty"`
+	// Lane is the swimlane of the user story on the board of its team
+	Lane string `yaml:"lane" json:"lane,omitempty"`
+	// Rank orders the item in the backlog, or among the tasks of its user
+	// story, before the items without one, lowest first
+	Rank int `yaml:"rank" json:"rank,omitempty"`
+	// Key identifies the user story in the links of the items file
+	Key   string `yaml:"key" json:"key,omitempty"`
+	Links []Link `yaml:"links" json:"links,omitempty"`
+	// Tags are added to the tags of the run, see adobatch.TagSeparator
+	Tags []string `yaml:"tags" json:"tags,omitempty"`
+	// Organization creates the user story in another organization, with
+	// the credentials configured for it
+	Organization string `yaml:"organization" json:"organization"`
+	// Project creates the user story in another project of the organization
+	Project string `yaml:"project" json:"project"`
+	// Parent links the user story under an existing work item, such as a
+	// feature
+	Parent int `yaml:"parent" json:"parent"`
 }
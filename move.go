@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// moveOptions selects the work items the move command moves and where to
+type moveOptions struct {
+	query     string
+	selection bulkSelection
+	// area and iteration are paths of the target project, "@current" being
+	// the iteration in progress of its default team
+	area      string
+	iteration string
+	// project moves the work items to another project of the organization
+	project string
+	// dryRun lists the work items without moving them
+	dryRun bool
+}
+
+// moveWorkItems moves every work item of a query, or of the selection, to an
+// area path or iteration, in the project or in another project
+func moveWorkItems(ctx context.Context, settings models.AdoSettings, move moveOptions, options applyOptions, logger *zap.Logger) int {
+	if move.area == "" && move.iteration == "" && move.project == "" {
+		logger.Error("Nothing to move to: move --area, --iteration or --target-project")
+		return exitValidation
+	}
+
+	query := move.query
+	if query == "" {
+		var err error
+		if query, err = move.selection.query(); err != nil {
+			logger.Error("Invalid move selection, set --query, --tag, --run or --from", zap.Error(err))
+			return exitValidation
+		}
+	} else if move.selection != (bulkSelection{}) {
+		logger.Error("--query cannot be used with --tag, --run or --from")
+		return exitValidation
+	}
+
+	client := newClient(settings, logger)
+	target := settings
+	if move.project != "" {
+		target.Project = move.project
+	}
+	payload, err := movePayload(ctx, client, target, move, move.project != "" && !strings.EqualFold(move.project, settings.Project))
+	if err != nil {
+		logger.Error("Invalid move target", zap.String("project", target.Project), zap.Error(err))
+		return queryExitCode(err)
+	}
+
+	results, err := selectWorkItems(ctx, client, settings, query)
+	if err != nil {
+		logger.Error("Failed to run query", zap.Error(err))
+		return queryExitCode(err)
+	}
+	if move.dryRun {
+		logger.Info("Dry run, work items are not moved", zap.Int("work_items", len(results)))
+		printBulkResults(os.Stderr, results)
+		return exitSuccess
+	}
+	logger.Info("Moving work items", zap.Int("work_items", len(results)), zap.String("project", target.Project), zap.String("area", move.area), zap.String("iteration", move.iteration))
+
+	return runBulk(ctx, results, "move", models.StatusUpdated, func(ctx context.Context, id int) error {
+		return client.UpdateWorkItem(ctx, settings, id, payload)
+	}, options, logger)
+}
+
+// movePayload checks the area and iteration against the target project and
+// returns the JSON patch document moving a work item there. Work items moved
+// to another project get its root area and iteration unless set.
+func movePayload(ctx context.Context, client *adobatch.Client, target models.AdoSettings, move moveOptions, otherProject bool) ([]map[string]interface{}, error) {
+	area, iteration := move.area, move.iteration
+	if otherProject {
+		area, iteration = valueOr(area, target.Project), valueOr(iteration, target.Project)
+	}
+	if strings.EqualFold(iteration, adobatch.CurrentIteration) {
+		current, err := client.CurrentIteration(ctx, target, "")
+		if err != nil {
+			return nil, err
+		}
+		iteration = current.Path
+	}
+
+	var payload []map[string]interface{}
+	add := func(field, value string) {
+		payload = append(payload, map[string]interface{}{"op": "add", "path": "/fields/" + field, "value": value})
+	}
+	if otherProject {
+		add("System.TeamProject", target.Project)
+	}
+	if area != "" {
+		areas, err := client.Areas(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		if !hasClassificationPath(areas, area) {
+			return nil, fmt.Errorf("area %q not found in %s, see `list areas`: %w", area, target.Project, adobatch.ErrValidation)
+		}
+		add("System.AreaPath", area)
+	}
+	if iteration != "" {
+		iterations, err := client.Iterations(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		if !hasClassificationPath(iterations, iteration) {
+			return nil, fmt.Errorf("iteration %q not found in %s, see `list iterations`: %w", iteration, target.Project, adobatch.ErrValidation)
+		}
+		add("System.IterationPath", iteration)
+	}
+
+	return payload, nil
+}
+
+func hasClassificationPath(nodes []adobatch.ClassificationNode, path string) bool {
+	for _, node := range nodes {
+		if strings.EqualFold(node.Path, path) {
+			return true
+		}
+	}
+
+	return false
+}
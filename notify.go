@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// notifyItems is the number of created and failed work items listed in a
+// notification, the reports hold the rest
+const notifyItems = 10
+
+// notifyOptions lists where the summary of a run is sent
+type notifyOptions struct {
+	// teamsWebhook is a Microsoft Teams incoming webhook URL
+	teamsWebhook string
+	// slackWebhook is a Slack incoming webhook URL
+	slackWebhook string
+	// email, when it has a host, receives the summary with the CSV report
+	email emailOptions
+	// webhook receives the results of the run, in the results file format
+	webhook string
+	// webhookSecret signs the webhook payload with HMAC-SHA256 when set
+	webhookSecret string
+	// reportURL links the notifications to the reports of the run
+	reportURL string
+}
+
+// notifyRun sends the summary of a run to every configured destination.
+// Failures are logged, they do not change the outcome of the run.
+func notifyRun(ctx context.Context, options notifyOptions, results adobatch.Results, logger *zap.Logger) {
+	// Notify even when the run was interrupted
+	ctx = context.WithoutCancel(ctx)
+
+	if options.teamsWebhook != "" {
+		if err := postJSON(ctx, options.teamsWebhook, teamsMessage(results, options.reportURL), ""); err != nil {
+			logger.Error("Failed to send Teams notification", zap.Error(err))
+		}
+	}
+
+	if options.slackWebhook != "" {
+		if err := postJSON(ctx, options.slackWebhook, slackMessage(results, options.reportURL), ""); err != nil {
+			logger.Error("Failed to send Slack notification", zap.Error(err))
+		}
+	}
+
+	if options.email.host != "" {
+		if err := sendEmailSummary(options.email, results, options.reportURL); err != nil {
+			logger.Error("Failed to send email summary", zap.String("host", options.email.host), zap.Error(err))
+		}
+	}
+
+	if options.webhook != "" {
+		if err := postJSON(ctx, options.webhook, results, options.webhookSecret); err != nil {
+			logger.Error("Failed to send results webhook", zap.Error(err))
+		}
+	}
+}
+
+// postJSON posts a JSON payload to a webhook. With a secret, the
+// X-Signature-256 header holds the hex HMAC-SHA256 of the body, prefixed
+// with "sha256=", so receivers can verify the sender.
+func postJSON(ctx context.Context, url string, payload any, secret string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// notableItems returns the created user stories and the failed work items
+// of a run, at most notifyItems of each
+func notableItems(results adobatch.Results) (created, failed []adobatch.ItemResult) {
+	for _, story := range results.UserStories {
+		if story.Status == models.StatusCreated && len(created) < notifyItems {
+			created = append(created, story)
+		}
+		for _, item := range append([]adobatch.ItemResult{story}, story.Tasks...) {
+			if item.Status == models.StatusFailed && len(failed) < notifyItems {
+				failed = append(failed, item)
+			}
+		}
+	}
+
+	return created, failed
+}
+
+// notificationTitle summarizes the outcome of a run in one line
+func notificationTitle(results adobatch.Results) string {
+	title := "Azure DevOps batch finished"
+	if results.Summary.Failed > 0 {
+		title = "Azure DevOps batch finished with failures"
+	}
+	if results.RunID != "" {
+		title += " (run " + results.RunID + ")"
+	}
+
+	return title
+}
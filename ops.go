@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// opsHandler serves the operational endpoints: /metrics, the /healthz
+// liveness probe and the /readyz readiness probe, which runs ready
+func opsHandler(ready func(context.Context) error) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", appMetrics)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(r.Context()); err != nil {
+			http.Error(w, redactSecrets(err.Error(), nil), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+
+	return mux
+}
+
+// readinessCheck checks that Azure DevOps is reachable with the configured
+// credentials. Results are cached for a while so frequent probes do not
+// consume the API rate limit.
+type readinessCheck struct {
+	settings models.AdoSettings
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+func (c *readinessCheck) check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.ttl {
+		return c.err
+	}
+
+	url := fmt.Sprintf("https://dev.azure.com/%s/_apis/connectionData", c.settings.Organization)
+	c.err = preflightRequest(ctx, c.settings, "GET", url, nil, nil)
+	if c.err != nil {
+		c.err = fmt.Errorf("failed to reach Azure DevOps: %w", c.err)
+	}
+	c.checkedAt = time.Now()
+
+	return c.err
+}
+
+// pprofHandler serves the net/http/pprof profiles under /debug/pprof/
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
+
+// loopbackAddr binds addr to localhost when it has no host, and rejects
+// other hosts, profiles must not be reachable from the network
+func loopbackAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	switch ip := net.ParseIP(host); {
+	case host == "":
+		return net.JoinHostPort("localhost", port), nil
+	case host == "localhost", ip != nil && ip.IsLoopback():
+		return addr, nil
+	}
+
+	return "", fmt.Errorf("%q is not a loopback address", host)
+}
+
+// serveOps serves handler on addr until ctx is cancelled
+func serveOps(ctx context.Context, addr string, handler http.Handler, logger *zap.Logger) {
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	logger.Info("Serving operational endpoints", zap.String("addr", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Operational endpoints stopped", zap.String("addr", addr), zap.Error(err))
+	}
+}
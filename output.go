@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Output formats accepted by --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+	// outputCSV is only supported by the query command
+	outputCSV = "csv"
+)
+
+// validateOutput checks the --output flag value for a command
+func validateOutput(command, format string) error {
+	if format == outputCSV && command == "query" {
+		return nil
+	}
+	if format != outputText && format != outputJSON {
+		return fmt.Errorf("invalid output format %q: must be %q or %q", format, outputText, outputJSON)
+	}
+
+	return nil
+}
+
+// printOutput writes the result of a command to w. With --output json, v is
+// written as JSON so the tool composes with jq, otherwise text renders the
+// human readable form. Logs always go to stderr and never mix with it.
+func printOutput(w io.Writer, format string, v any, text func(io.Writer)) error {
+	if format != outputJSON {
+		text(w)
+		return nil
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON output: %w", err)
+	}
+
+	return nil
+}
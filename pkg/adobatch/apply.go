@@ -0,0 +1,730 @@
+package adobatch
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// Options controls how a plan is applied
+type Options struct {
+	// RunID, when set, is added as a "run-<id>" tag to every work item
+	RunID string
+	// SkipExisting skips the user stories created by a previous run, with
+	// the same title and the automation tag
+	SkipExisting bool
+	// ResolveDuplicate decides what to do with the user stories found by
+	// SkipExisting. Nil skips them. The run is aborted when it fails.
+	ResolveDuplicate DuplicateResolver
+	FailurePolicy
+	// BeforeRun is called before the first work item is created. The run
+	// is aborted, with every work item skipped, when it fails.
+	BeforeRun func(ctx context.Context, plan *Plan) error
+	// CheckStates verifies the states of the items against their work item
+	// types before the run, see Client.CheckStates. The run is aborted when
+	// a state is invalid.
+	CheckStates bool
+	// StateReasons are the System.Reason set with each state, by state
+	// name, for the items that do not set a reason. Some process rules
+	// reject a state without a valid reason.
+	StateReasons map[string]string
+	// TransitionStates creates the work items in the initial state of their
+	// type and then moves them to their state, for processes that forbid
+	// creating work items in other states, see Client.TransitionState
+	TransitionStates bool
+	// AssignmentRules set the owners of the work items without one before
+	// the run, see Plan.ApplyAssignmentRules
+	AssignmentRules []AssignmentRule
+	// Iteration is set on the user stories without one, see
+	// Client.ResolveIterations. "@current" is the iteration in progress.
+	Iteration string
+	// Lane is the swimlane set on the user stories without one, on the
+	// board of their team
+	Lane string
+	// Assignment picks the member of the team of "@Team Name" owners, see
+	// Client.AssignTeamOwners. Empty means round-robin.
+	Assignment AssignmentStrategy
+	// ResolveOwners replaces the owners with the unique names of their
+	// identities before the run, see Client.ResolveOwners. The run is
+	// aborted when an owner cannot be resolved.
+	ResolveOwners bool
+	// FuzzyOwners resolves an owner that is not found to its closest
+	// identity when there is only one
+	FuzzyOwners bool
+	// EnforceCapacity aborts the run when the estimates of the tasks of an
+	// owner exceed their capacity in the iteration by more than
+	// CapacityTolerance, a fraction of it, see Client.CheckCapacity
+	EnforceCapacity   bool
+	CapacityTolerance float64
+	// Tags are added to every work item of the run, before the tags of the
+	// items
+	Tags []string
+	// Titles transforms the titles of the work items, see Plan.FormatTitles
+	Titles TitleFormat
+	// OrderField, when set, is set to 1, 2, 3.. on the work items created, in
+	// the order of the plan, such as Microsoft.VSTS.Common.StackRank to order
+	// the backlog. It is set with the links and board columns of the items
+	// once every work item is created, see Client.FollowUps.
+	OrderField string
+	// Reorder moves the user stories created to the top of the backlog of
+	// their team once every work item is created, by rank and then in the
+	// order of the plan, and their tasks the same way under them
+	Reorder bool
+	// Comment, when set, is added to the discussion of every work item
+	// created, see Client.AddComment
+	Comment string
+	// Progress, when set, is called after every user story of the run
+	Progress func(Result)
+	// ChunkSize, when set, processes the user stories in chunks of that many,
+	// calling Checkpoint after each chunk
+	ChunkSize int
+	// Checkpoint is called with the results of the user stories processed so
+	// far after every chunk and after the last user story, before the
+	// follow-up updates. The run is aborted when it fails, so it never gets
+	// further ahead of what was saved than a chunk.
+	Checkpoint func(ctx context.Context, items []Result) error
+	// Resume are the results of the first user stories of the plan recorded
+	// by the checkpoint of an interrupted run. The work items they created
+	// are reused, the user stories and tasks without one are created again.
+	Resume []ItemResult
+	// Tracer, when set, records a span for every user story and task
+	Tracer Tracer
+	// TaskConcurrency is the number of tasks of a user story created in
+	// parallel, one at a time when 0
+	TaskConcurrency int
+	// TwoPhase creates the user stories of every chunk, or of the plan
+	// without ChunkSize, with the batch API, then all their tasks, instead
+	// of every user story followed by its tasks. TaskConcurrency is ignored.
+	TwoPhase bool
+	// Retries is the number of times the creation of a work item is retried
+	// after an ambiguous failure, see Ambiguous. Work items are then tagged
+	// with a client request ID, looked up before every retry so the work
+	// item is not created twice.
+	Retries int
+
+	// transitions holds the states read for TransitionStates during a run
+	transitions *stateTransitions
+	// requestKey is the key of the client request IDs of a run with Retries
+	requestKey string
+}
+
+// tags returns the tags of a work item of the run: AutomationTag, the run ID
+// tag, the default tags and the tags of the item, in this order and without
+// duplicates
+func (o Options) tags(itemTags []string) string {
+	tags := []string{AutomationTag}
+	if o.RunID != "" {
+		tags = append(tags, "run-"+o.RunID)
+	}
+	tags = append(tags, o.Tags...)
+
+	return MergeTags(append(tags, itemTags...)...)
+}
+
+// reason returns the reason of a work item: its own, or the reason
+// configured for its state, compared ignoring case
+func (o Options) reason(state, itemReason string) string {
+	if itemReason != "" || state == "" {
+		return itemReason
+	}
+	for name, reason := range o.StateReasons {
+		if strings.EqualFold(name, state) {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+// createState returns the state and reason a work item is created with: its
+// own, or none with TransitionStates, for the initial state of its type
+func (o Options) createState(state, itemReason string) (string, string) {
+	if o.transitions != nil {
+		return "", ""
+	}
+
+	return state, o.reason(state, itemReason)
+}
+
+// reasonField appends the patch operation setting System.Reason to payload
+// when the work item has a reason
+func reasonField(payload []map[string]interface{}, reason string) []map[string]interface{} {
+	if reason == "" {
+		return payload
+	}
+
+	return append(payload, map[string]interface{}{
+		"op":    "add",
+		"path":  "/fields/System.Reason",
+		"value": reason,
+	})
+}
+
+func (o Options) tracer() Tracer {
+	if o.Tracer == nil {
+		return noopTracer{}
+	}
+
+	return o.Tracer
+}
+
+// Tracer starts spans around the creation of work items
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, attributes map[string]any) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer
+type Span interface {
+	SetAttribute(key string, value any)
+	End(err error)
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, name string, attributes map[string]any) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value any) {}
+
+func (noopSpan) End(err error) {}
+
+// Apply creates the user stories of the plan with their tasks. Failures
+// are recorded in the results rather than returned, so every work item is
+// accounted for.
+func (c *Client) Apply(ctx context.Context, plan *Plan, options Options) Results {
+	start := time.Now()
+	outcome := NewOutcome(plan.WorkItems(), options.FailurePolicy)
+	if options.TransitionStates {
+		options.transitions = newStateTransitions()
+	}
+	if options.Retries > 0 {
+		options.requestKey = requestKey(options.RunID)
+	}
+
+	if options.BeforeRun != nil {
+		if err := options.BeforeRun(ctx, plan); err != nil {
+			outcome.Abort(err.Error(), err)
+		}
+	}
+	if !outcome.Aborted() {
+		if err := c.ResolveWorkItemTypes(ctx, plan); err != nil {
+			c.Logger.Error("Failed to resolve work item types", zap.Error(err))
+			outcome.Abort("unresolved work item types: "+strings.ReplaceAll(err.Error(), "\n", "; "), err)
+		}
+	}
+	if options.CheckStates && !outcome.Aborted() {
+		if err := c.CheckStates(ctx, plan); err != nil {
+			c.Logger.Error("Failed to check states", zap.Error(err))
+			outcome.Abort("invalid states: "+strings.ReplaceAll(err.Error(), "\n", "; "), err)
+		}
+	}
+	if !outcome.Aborted() {
+		if err := c.ResolveIterations(ctx, plan, options.Iteration); err != nil {
+			c.Logger.Error("Failed to resolve iterations", zap.Error(err))
+			outcome.Abort("unresolved iteration: "+err.Error(), err)
+		}
+	}
+	if !outcome.Aborted() {
+		if err := c.ResolveFields(ctx, plan); err != nil {
+			c.Logger.Error("Failed to resolve fields", zap.Error(err))
+			outcome.Abort("unresolved fields: "+strings.ReplaceAll(err.Error(), "\n", "; "), err)
+		}
+	}
+	if len(options.AssignmentRules) > 0 && !outcome.Aborted() {
+		c.Logger.Info("Applied assignment rules", zap.Int("work_items", plan.ApplyAssignmentRules(options.AssignmentRules)))
+	}
+	if !outcome.Aborted() {
+		if err := c.AssignTeamOwners(ctx, plan, options.Assignment); err != nil {
+			c.Logger.Error("Failed to assign team owners", zap.Error(err))
+			outcome.Abort("unassigned team owners: "+err.Error(), err)
+		}
+	}
+	if options.ResolveOwners && !outcome.Aborted() {
+		if err := c.ResolveOwners(ctx, plan, options.FuzzyOwners); err != nil {
+			c.Logger.Error("Failed to resolve owners", zap.Error(err))
+			outcome.Abort("unresolved owners: "+strings.ReplaceAll(err.Error(), "\n", "; "), err)
+		}
+	}
+	if options.EnforceCapacity && !outcome.Aborted() {
+		if err := c.CheckCapacity(ctx, plan, options.CapacityTolerance); err != nil {
+			c.Logger.Error("Capacity exceeded", zap.Error(err))
+			outcome.Abort("capacity exceeded: "+strings.ReplaceAll(err.Error(), "\n", "; "), err)
+		}
+	}
+	if !outcome.Aborted() {
+		if err := plan.CheckLinks(); err != nil {
+			c.Logger.Error("Invalid links", zap.Error(err))
+			outcome.Abort(strings.ReplaceAll(err.Error(), "\n", "; "), err)
+		}
+	}
+	// Descriptions are rendered last, with the iterations and owners resolved
+	if !outcome.Aborted() {
+		if err := plan.RenderDescriptions(options.RunID); err != nil {
+			c.Logger.Error("Failed to render descriptions", zap.Error(err))
+			outcome.Abort(strings.ReplaceAll(err.Error(), "\n", "; "), err)
+		}
+	}
+	// Titles are formatted after the descriptions, which use the names of
+	// the items, and before existing user stories are matched by title
+	plan.FormatTitles(options.Titles)
+	if !outcome.Aborted() {
+		if err := plan.FitTitles(options.Titles.Overflow); err != nil {
+			c.Logger.Error("Titles too long", zap.Error(err))
+			outcome.Abort(strings.ReplaceAll(err.Error(), "\n", "; "), err)
+		}
+	}
+	if changed := plan.SanitizeDescriptions(); changed > 0 {
+		c.Logger.Info("Sanitized the HTML of descriptions", zap.Int("descriptions", changed))
+	}
+	// Recorded user stories are matched with the formatted titles
+	if !outcome.Aborted() {
+		if err := plan.checkResume(options.Resume); err != nil {
+			c.Logger.Error("Checkpoint does not match the items", zap.Error(err))
+			outcome.Abort(err.Error(), err)
+		}
+	}
+
+	// Create user stories in Azure DevOps
+	items := make([]Result, 0, len(plan.Items))
+	report := func(result Result) {
+		items = append(items, result)
+		if options.Progress != nil {
+			options.Progress(result)
+		}
+	}
+	// With TwoPhase, the results of a chunk are staged until its work items
+	// are created, to be reported in the order of the plan
+	var stage []stagedStory
+	addResult := func(result Result) {
+		if options.TwoPhase {
+			stage = append(stage, stagedStory{result: result})
+			return
+		}
+		report(result)
+	}
+	createTasks := func(index int, settings models.AdoSettings, result Result, existing map[string]int) {
+		if options.TwoPhase {
+			stage = append(stage, stagedStory{result: result, index: index, settings: settings, tasks: true, existing: existing})
+			return
+		}
+		c.createTasks(ctx, settings, index, result.Item, options, outcome, &result, existing)
+		report(result)
+	}
+	flush := func() {
+		c.createStaged(ctx, stage, options, outcome)
+		for _, staged := range stage {
+			if staged.resumed {
+				items = append(items, staged.result)
+			} else {
+				report(staged.result)
+			}
+		}
+		stage = nil
+	}
+	checkpoint := func() {
+		if options.Checkpoint == nil {
+			return
+		}
+		if err := options.Checkpoint(ctx, items); err != nil {
+			c.Logger.Error("Failed to save checkpoint", zap.Error(err))
+			if !outcome.Aborted() {
+				outcome.Abort("checkpoint failed: "+err.Error(), err)
+			}
+		}
+	}
+	for index, userStory := range plan.Items {
+		if options.ChunkSize > 0 && index > 0 && index%options.ChunkSize == 0 {
+			flush()
+			if !outcome.Aborted() {
+				checkpoint()
+				c.Logger.Info("Chunk done", zap.Int("chunk", index/options.ChunkSize), zap.Int("user_stories", index))
+			}
+		}
+		if outcome.Aborted() || ctx.Err() != nil {
+			addResult(newResult(userStory, models.StatusSkipped))
+			continue
+		}
+
+		itemSettings := c.SettingsFor(userStory)
+
+		if index < len(options.Resume) && options.Resume[index].Id != 0 {
+			result, existing := resumedResult(userStory, options.Resume[index])
+			if len(existing) == len(userStory.Tasks) {
+				// Already reported by the interrupted run
+				if options.TwoPhase {
+					stage = append(stage, stagedStory{result: result, resumed: true})
+				} else {
+					items = append(items, result)
+				}
+				continue
+			}
+			c.Logger.Info("Resuming user story, creating its missing tasks", zap.String("name", userStory.Name), zap.Int("id", result.ID))
+			createTasks(index, itemSettings, result, existing)
+			continue
+		}
+
+		if options.SkipExisting {
+			existingID, err := c.FindExistingUserStory(ctx, itemSettings, UserStoryType(userStory), userStory.Name)
+			if err != nil {
+				c.Logger.Error("Failed to look up existing user story", zap.String("name", userStory.Name), zap.Error(err))
+				result := newResult(userStory, models.StatusFailed)
+				result.Err = err
+				outcome.Record(err)
+				addResult(result)
+				continue
+			}
+			if existingID != 0 {
+				duplicate := Duplicate{ID: existingID, URL: WorkItemURL(itemSettings.Organization, itemSettings.Project, existingID)}
+				action := DuplicateSkip
+				if options.ResolveDuplicate != nil {
+					if action, err = options.ResolveDuplicate(ctx, userStory, duplicate); err != nil {
+						c.Logger.Error("Failed to resolve duplicate user story", zap.String("name", userStory.Name), zap.Error(err))
+						outcome.Abort("unresolved duplicate: "+err.Error(), err)
+						addResult(newResult(userStory, models.StatusSkipped))
+						continue
+					}
+				}
+
+				result := newResult(userStory, models.StatusSkipped)
+				result.ID = duplicate.ID
+				result.URL = duplicate.URL
+				switch action {
+				case DuplicateCreate:
+					c.Logger.Info("User story already exists, creating it anyway", zap.String("name", userStory.Name), zap.Int("id", existingID), zap.String("url", duplicate.URL))
+				case DuplicateUpdate:
+					if err := c.updateUserStory(ctx, itemSettings, existingID, userStory, options); err != nil {
+						c.Logger.Error("Failed to update existing user story", zap.String("name", userStory.Name), zap.Int("id", existingID), zap.Error(err))
+						result.Status = models.StatusFailed
+						result.Err = err
+						outcome.Record(err)
+					} else {
+						c.Logger.Info("User story already exists, updated it", zap.String("name", userStory.Name), zap.Int("id", existingID), zap.String("url", duplicate.URL))
+						result.Status = models.StatusUpdated
+					}
+					addResult(result)
+					continue
+				case DuplicateMerge:
+					existing, err := c.childTasks(ctx, itemSettings, existingID, userStory)
+					if err != nil {
+						c.Logger.Error("Failed to read the tasks of existing user story", zap.String("name", userStory.Name), zap.Int("id", existingID), zap.Error(err))
+						result.Status = models.StatusFailed
+						result.Err = err
+						outcome.Record(err)
+						addResult(result)
+						continue
+					}
+					c.Logger.Info("User story already exists, adding its missing tasks", zap.String("name", userStory.Name), zap.Int("id", existingID), zap.String("url", duplicate.URL))
+					createTasks(index, itemSettings, result, existing)
+					continue
+				case DuplicateFail:
+					err := &DuplicateError{Name: userStory.Name, Duplicate: duplicate}
+					c.Logger.Error("User story already exists", zap.String("name", userStory.Name), zap.Int("id", existingID), zap.String("url", duplicate.URL))
+					result.Status = models.StatusFailed
+					result.Err = err
+					outcome.Record(err)
+					addResult(result)
+					continue
+				default:
+					c.Logger.Info("User story already exists, skipping", zap.String("name", userStory.Name), zap.Int("id", existingID), zap.String("url", result.URL))
+					addResult(result)
+					continue
+				}
+			}
+		}
+
+		if options.TwoPhase {
+			stage = append(stage, stagedStory{result: newResult(userStory, models.StatusSkipped), index: index, settings: itemSettings, create: true, tasks: true})
+			continue
+		}
+
+		storyCtx, storySpan := options.tracer().StartSpan(ctx, "user_story", map[string]any{
+			"work_item.name":   userStory.Name,
+			"ado.organization": itemSettings.Organization,
+			"ado.project":      itemSettings.Project,
+		})
+		result, err := c.createUserStory(storyCtx, itemSettings, index, userStory, options, outcome)
+		if err != nil {
+			c.Logger.Error("Failed to create user story", zap.String("name", userStory.Name), zap.Error(err))
+			result.Err = err
+			outcome.Record(err)
+		}
+		storySpan.SetAttribute("work_item.id", result.ID)
+		storySpan.End(err)
+		addResult(result)
+	}
+
+	flush()
+	if options.ChunkSize > 0 {
+		checkpoint()
+	}
+
+	if outcome.Aborted() {
+		c.Logger.Error("Run aborted, remaining work items were skipped", zap.String("reason", outcome.AbortReason))
+	} else if ctx.Err() == nil {
+		c.applyFollowUps(ctx, items, options, outcome)
+		if options.Reorder {
+			c.reorderBacklog(ctx, items, outcome)
+		}
+	}
+
+	results := NewResults(options.RunID, items, time.Since(start))
+	results.Status = outcome.Status()
+	results.AbortReason = outcome.AbortReason
+
+	return results
+}
+
+// createUserStory creates the user story at index in the plan in Azure DevOps
+// along with its tasks. Tasks are reported as skipped when the user story
+// itself fails or the run is aborted.
+func (c *Client) createUserStory(ctx context.Context, settings models.AdoSettings, index int, userStory models.UserStory, options Options, outcome *Outcome) (Result, error) {
+	result := newResult(userStory, models.StatusFailed)
+	requestID := options.requestID(index)
+	payload := userStoryPayload(settings, userStory, requestID, options)
+
+	start := time.Now()
+	userStoryID, err := c.createWorkItem(ctx, settings, UserStoryType(userStory), payload, requestID, options.Retries)
+	result.Latency = time.Since(start)
+	if err != nil {
+		return result, err
+	}
+	result.Status = models.StatusCreated
+	result.ID = userStoryID
+	result.URL = WorkItemURL(settings.Organization, settings.Project, userStoryID)
+
+	c.Logger.Info("User story created successfully", zap.String("name", userStory.Name), zap.Int("id", userStoryID), zap.String("url", result.URL))
+	c.transitionState(ctx, settings, userStoryID, UserStoryType(userStory), userStory.State, userStory.Reason, options)
+	c.addComment(ctx, settings, userStoryID, options)
+
+	c.createTasks(ctx, settings, index, userStory, options, outcome, &result, nil)
+
+	return result, nil
+}
+
+// createTasks creates the tasks of the user story at index in the plan under
+// the work item of the result, skipping the tasks whose title is in existing.
+// Up to TaskConcurrency tasks are created at a time.
+func (c *Client) createTasks(ctx context.Context, settings models.AdoSettings, index int, userStory models.UserStory, options Options, outcome *Outcome, result *Result, existing map[string]int) {
+	// A slot is taken by every task being created
+	slots := make(chan struct{}, max(options.TaskConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, task := range userStory.Tasks {
+		taskResult := &result.Tasks[i]
+		if id, ok := existing[strings.ToLower(task.Name)]; ok {
+			taskResult.ID = id
+			taskResult.URL = WorkItemURL(settings.Organization, settings.Project, id)
+			c.Logger.Info("Task already exists, skipping", zap.String("name", task.Name), zap.Int("id", id))
+			continue
+		}
+
+		slots <- struct{}{}
+		if outcome.Aborted() {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			c.createTaskResult(ctx, settings, result.ID, task, options.requestID(index, i), options, outcome, userStory, taskResult)
+		}()
+	}
+	wg.Wait()
+}
+
+// createTaskResult creates a task of a user story and records it in its
+// result
+func (c *Client) createTaskResult(ctx context.Context, settings models.AdoSettings, userStoryID int, task models.Task, requestID string, options Options, outcome *Outcome, userStory models.UserStory, taskResult *TaskResult) {
+	taskCtx, taskSpan := options.tracer().StartSpan(ctx, "task", map[string]any{"work_item.name": task.Name, "work_item.parent_id": userStoryID})
+	start := time.Now()
+	taskID, err := c.createTask(taskCtx, settings, userStoryID, task, requestID, options, userStory)
+	taskResult.Latency = time.Since(start)
+	taskSpan.SetAttribute("work_item.id", taskID)
+	taskSpan.End(err)
+	if err != nil {
+		c.Logger.Error("Failed to create task", zap.String("task_name", task.Name), zap.Error(err))
+		taskResult.Status = models.StatusFailed
+		taskResult.Err = err
+		outcome.Record(err)
+		return
+	}
+	taskResult.Status = models.StatusCreated
+	taskResult.ID = taskID
+	c.addComment(ctx, settings, taskID, options)
+	taskResult.URL = WorkItemURL(settings.Organization, settings.Project, taskID)
+}
+
+// createTask creates a task in Azure DevOps and links it to a user story
+func (c *Client) createTask(ctx context.Context, settings models.AdoSettings, parentID int, task models.Task, requestID string, options Options, userStory models.UserStory) (int, error) {
+	payload := taskPayload(settings, parentID, task, requestID, options, userStory)
+
+	taskID, err := c.createWorkItem(ctx, settings, TaskType(task), payload, requestID, options.Retries)
+	if err != nil {
+		return 0, err
+	}
+
+	c.Logger.Info("Task created successfully", zap.String("name", task.Name), zap.Int("id", taskID), zap.String("url", WorkItemURL(settings.Organization, settings.Project, taskID)))
+	c.transitionState(ctx, settings, taskID, TaskType(task), task.State, task.Reason, options)
+
+	return taskID, nil
+}
+
+// userStoryPayload returns the JSON patch document creating a user story
+func userStoryPayload(settings models.AdoSettings, userStory models.UserStory, requestID string, options Options) []map[string]interface{} {
+	state, reason := options.createState(userStory.State, userStory.Reason)
+
+	payload := []map[string]interface{}{
+		{
+			"op":    "add",
+			"path":  "/fields/System.Title",
+			"value": userStory.Name,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.Description",
+			"value": userStory.Description,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.AssignedTo",
+			"value": userStory.Owner,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/Microsoft.VSTS.Common.Priority",
+			"value": userStory.Priority,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.State",
+			"value": state,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.Tags",
+			"value": requestTags(options.tags(userStory.Tags), requestID), // Add the "system_automated" tag
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.AreaPath",
+			"value": userStory.Area, // Add the "system_automated" tag
+		},
+	}
+	if userStory.Iteraction != nil && *userStory.Iteraction != "" {
+		payload = append(payload, map[string]interface{}{
+			"op":    "add",
+			"path":  "/fields/System.IterationPath",
+			"value": *userStory.Iteraction,
+		})
+	}
+	if userStory.Points != 0 {
+		payload = append(payload, map[string]interface{}{
+			"op":    "add",
+			"path":  "/fields/Microsoft.VSTS.Scheduling.StoryPoints",
+			"value": userStory.Points,
+		})
+	}
+	payload = reasonField(payload, reason)
+	payload = append(payload, fieldOperations(userStory.Fields)...)
+	if userStory.Parent != 0 {
+		payload = append(payload, map[string]interface{}{
+			"op":   "add",
+			"path": "/relations/-",
+			"value": map[string]interface{}{
+				"rel": "System.LinkTypes.Hierarchy-Reverse",
+				"url": WorkItemAPIURL(settings.Organization, userStory.Parent),
+				"attributes": map[string]string{
+					"comment": "Linking user story to parent",
+				},
+			},
+		})
+	}
+
+	return payload
+}
+
+// taskPayload returns the JSON patch document creating a task of a user
+// story, linked to it
+func taskPayload(settings models.AdoSettings, parentID int, task models.Task, requestID string, options Options, userStory models.UserStory) []map[string]interface{} {
+	state, reason := options.createState(task.State, task.Reason)
+
+	// Payload for the task
+	payload := []map[string]interface{}{
+		{
+			"op":    "add",
+			"path":  "/fields/System.Title",
+			"value": task.Name,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.Description",
+			"value": task.Description,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.AssignedTo",
+			"value": task.Owner,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/Microsoft.VSTS.Common.Priority",
+			"value": task.Priority,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.State",
+			"value": state,
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.Tags",
+			"value": requestTags(options.tags(task.Tags), requestID),
+		},
+		{
+			"op":   "add",
+			"path": "/relations/-",
+			"value": map[string]interface{}{
+				"rel": "System.LinkTypes.Hierarchy-Reverse",
+				"url": WorkItemAPIURL(settings.Organization, parentID),
+				"attributes": map[string]string{
+					"comment": "Linking task to user story",
+				},
+			},
+		},
+		{
+			"op":    "add",
+			"path":  "/fields/System.AreaPath",
+			"value": userStory.Area, // Add the "system_automated" tag
+		},
+	}
+	if userStory.Iteraction != nil && *userStory.Iteraction != "" {
+		payload = append(payload, map[string]interface{}{
+			"op":    "add",
+			"path":  "/fields/System.IterationPath",
+			"value": *userStory.Iteraction,
+		})
+	}
+	// The estimate is the planned and the remaining hours of the new task
+	if task.Estimate > 0 {
+		for _, field := range []string{"Microsoft.VSTS.Scheduling.OriginalEstimate", remainingWorkField} {
+			payload = append(payload, map[string]interface{}{
+				"op":    "add",
+				"path":  "/fields/" + field,
+				"value": task.Estimate,
+			})
+		}
+	}
+
+	payload = reasonField(payload, reason)
+	payload = append(payload, fieldOperations(task.Fields)...)
+
+	return payload
+}
@@ -0,0 +1,231 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+)
+
+// parentOf returns the ID of the parent of a work item of the fake, 0 when
+// it has none
+func parentOf(t *testing.T, item adotest.WorkItem) int {
+	t.Helper()
+	for _, relation := range item.Relations {
+		if relation["rel"] != "System.LinkTypes.Hierarchy-Reverse" {
+			continue
+		}
+		url, _ := relation["url"].(string)
+		var id int
+		if _, err := fmt.Sscanf(url[strings.LastIndex(url, "/")+1:], "%d", &id); err != nil {
+			t.Fatalf("parent URL %q: %v", url, err)
+		}
+		return id
+	}
+
+	return 0
+}
+
+func TestApplyCreates(t *testing.T) {
+	client, server := newTestClient(t)
+
+	plan := &Plan{Items: []models.UserStory{
+		{Name: "US1", Priority: 1, Tasks: []models.Task{{Name: "Task 1", Estimate: 6}, {Name: "Task 2"}}},
+		{Name: "US2", Tags: []string{"backend"}},
+	}}
+	results := client.Apply(context.Background(), plan, Options{Tags: []string{"sprint-1"}})
+	if results.Status != RunSucceeded {
+		t.Fatalf("status = %s (%s)", results.Status, results.AbortReason)
+	}
+	if len(server.WorkItems()) != 4 {
+		t.Fatalf("%d work items created, want 4", len(server.WorkItems()))
+	}
+
+	userStory, ok := server.WorkItem(results.Items[0].ID)
+	if !ok {
+		t.Fatalf("user story %d not created", results.Items[0].ID)
+	}
+	if userStory.Fields["System.Title"] != "US1" || userStory.Fields["System.WorkItemType"] != DefaultUserStoryType {
+		t.Errorf("user story = %v %v", userStory.Fields["System.WorkItemType"], userStory.Fields["System.Title"])
+	}
+	if fmt.Sprint(userStory.Fields["Microsoft.VSTS.Common.Priority"]) != "1" {
+		t.Errorf("priority = %v, want 1", userStory.Fields["Microsoft.VSTS.Common.Priority"])
+	}
+	if tags, _ := userStory.Fields["System.Tags"].(string); !strings.Contains(tags, AutomationTag) || !strings.Contains(tags, "sprint-1") {
+		t.Errorf("tags = %q, want %s and sprint-1", tags, AutomationTag)
+	}
+
+	for _, taskResult := range results.Items[0].Tasks {
+		task, ok := server.WorkItem(taskResult.ID)
+		if !ok {
+			t.Fatalf("task %q not created", taskResult.Item.Name)
+		}
+		if task.Fields["System.WorkItemType"] != DefaultTaskType {
+			t.Errorf("%s created as %v", taskResult.Item.Name, task.Fields["System.WorkItemType"])
+		}
+		if parent := parentOf(t, task); parent != userStory.ID {
+			t.Errorf("parent of %s = %d, want %d", taskResult.Item.Name, parent, userStory.ID)
+		}
+		for _, field := range []string{"Microsoft.VSTS.Scheduling.OriginalEstimate", "Microsoft.VSTS.Scheduling.RemainingWork"} {
+			if got, ok := task.Fields[field]; ok != (taskResult.Item.Estimate > 0) || ok && fmt.Sprint(got) != fmt.Sprint(taskResult.Item.Estimate) {
+				t.Errorf("%s of %s = %v, want the estimate %d", field, taskResult.Item.Name, got, taskResult.Item.Estimate)
+			}
+		}
+	}
+}
+
+func TestApplyRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		retries int
+		want    RunStatus
+		// created is the number of work items of the fake after the run
+		created int
+	}{
+		{"throttled", http.StatusTooManyRequests, 1, RunAborted, 1},
+		{"unavailable", http.StatusServiceUnavailable, 0, RunPartiallyFailed, 1},
+		{"unavailable retried", http.StatusServiceUnavailable, 1, RunSucceeded, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newTestClient(t)
+			server.AddRule(adotest.Rule{
+				Method:  http.MethodPost,
+				Path:    "/_apis/wit/workitems/$Task",
+				Times:   1,
+				Status:  tt.status,
+				Headers: map[string]string{"Retry-After": "1"},
+			})
+
+			plan := &Plan{Items: []models.UserStory{{Name: "US1", Tasks: []models.Task{{Name: "Task 1"}}}}}
+			results := client.Apply(context.Background(), plan, Options{Retries: tt.retries})
+			if results.Status != tt.want {
+				t.Errorf("status = %s, want %s (%s)", results.Status, tt.want, results.AbortReason)
+			}
+			if len(server.WorkItems()) != tt.created {
+				t.Errorf("%d work items created, want %d", len(server.WorkItems()), tt.created)
+			}
+
+			err := results.Items[0].Tasks[0].Err
+			if tt.status == http.StatusTooManyRequests && !errors.Is(err, ErrThrottled) {
+				t.Errorf("task error = %v, want a throttling error", err)
+			}
+			if tt.want == RunSucceeded && err != nil {
+				t.Errorf("task error = %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyFollowUps(t *testing.T) {
+	client, server := newTestClient(t)
+
+	plan := &Plan{Items: []models.UserStory{
+		{Name: "US1", Key: "first", Tasks: []models.Task{{Name: "Task 1", Key: "task", Links: []models.Link{{Type: "successor", Key: "second"}}}}},
+		{Name: "US2", Key: "second", Links: []models.Link{{Type: "related", Key: "first"}}},
+	}}
+	results := client.Apply(context.Background(), plan, Options{OrderField: "Microsoft.VSTS.Common.StackRank"})
+	if results.Status != RunSucceeded {
+		t.Fatalf("status = %s (%s)", results.Status, results.AbortReason)
+	}
+
+	first, second, task := results.Items[0].ID, results.Items[1].ID, results.Items[0].Tasks[0].ID
+	links := map[int]map[string]bool{}
+	for i, id := range []int{first, task, second} {
+		item, ok := server.WorkItem(id)
+		if !ok {
+			t.Fatalf("work item %d not created", id)
+		}
+		if got := fmt.Sprint(item.Fields["Microsoft.VSTS.Common.StackRank"]); got != fmt.Sprint(i+1) {
+			t.Errorf("order of %v = %s, want %d", item.Fields["System.Title"], got, i+1)
+		}
+
+		links[id] = map[string]bool{}
+		for _, relation := range item.Relations {
+			url, _ := relation["url"].(string)
+			links[id][fmt.Sprintf("%v %s", relation["rel"], url[strings.LastIndex(url, "/")+1:])] = true
+		}
+	}
+
+	want := []struct {
+		id   int
+		link string
+	}{
+		{task, fmt.Sprintf("System.LinkTypes.Dependency-Forward %d", second)},
+		{second, fmt.Sprintf("System.LinkTypes.Related %d", first)},
+	}
+	for _, tt := range want {
+		if !links[tt.id][tt.link] {
+			t.Errorf("work item %d has no %s link, has %v", tt.id, tt.link, links[tt.id])
+		}
+	}
+}
+
+func TestApplyConcurrentTransitions(t *testing.T) {
+	client, server := newTestClient(t)
+
+	userStory := models.UserStory{Name: "US1", State: "Active"}
+	for i := range 8 {
+		userStory.Tasks = append(userStory.Tasks, models.Task{Name: fmt.Sprintf("Task %d", i+1), State: "Active"})
+	}
+	results := client.Apply(context.Background(), &Plan{Items: []models.UserStory{userStory}}, Options{TransitionStates: true, TaskConcurrency: 4})
+	if results.Status != RunSucceeded {
+		t.Fatalf("status = %s (%s)", results.Status, results.AbortReason)
+	}
+
+	for _, item := range server.WorkItems() {
+		if item.Fields["System.State"] != "Active" {
+			t.Errorf("%v is %v, want Active", item.Fields["System.Title"], item.Fields["System.State"])
+		}
+	}
+}
+
+func TestApplyAborts(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		reason  string
+		status  RunStatus
+		// created is the number of work items created before the abort
+		created int
+	}{
+		{
+			name: "unresolved duplicate",
+			options: Options{SkipExisting: true, ResolveDuplicate: func(context.Context, models.UserStory, Duplicate) (DuplicateAction, error) {
+				return DuplicateSkip, fmt.Errorf("%w: no answer", ErrValidation)
+			}},
+			reason: "unresolved duplicate: validation",
+			status: RunInvalid,
+		},
+		{
+			name: "checkpoint failed",
+			options: Options{ChunkSize: 1, Checkpoint: func(context.Context, []Result) error {
+				return errors.New("disk full")
+			}},
+			reason:  "checkpoint failed: disk full",
+			status:  RunAborted,
+			created: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newTestClient(t)
+			server.AddWorkItem(DefaultUserStoryType, map[string]any{"System.Title": "US1", "System.TeamProject": "project", "System.Tags": AutomationTag})
+
+			plan := &Plan{Items: []models.UserStory{{Name: "US1"}, {Name: "US2"}}}
+			results := client.Apply(context.Background(), plan, tt.options)
+			if results.Status != tt.status || !strings.HasPrefix(results.AbortReason, tt.reason) {
+				t.Errorf("status = %s (%s), want %s (%s...)", results.Status, results.AbortReason, tt.status, tt.reason)
+			}
+			if created := len(server.WorkItems()) - 1; created != tt.created {
+				t.Errorf("%d work items created, want %d", created, tt.created)
+			}
+		})
+	}
+}
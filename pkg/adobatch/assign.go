@@ -0,0 +1,166 @@
+package adobatch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// TeamOwnerPrefix marks an owner naming a team, "@Team Name", whose work
+// items are assigned to its members
+const TeamOwnerPrefix = "@"
+
+// AssignmentStrategy picks the member of a team a work item is assigned to
+type AssignmentStrategy string
+
+const (
+	// AssignRoundRobin assigns the work items of a team to its members in
+	// turn, in the order of their unique names
+	AssignRoundRobin AssignmentStrategy = "round-robin"
+	// AssignLeastLoaded assigns every work item to the member with the
+	// fewest open work items, counting those assigned by the run
+	AssignLeastLoaded AssignmentStrategy = "least-loaded"
+)
+
+// ParseAssignmentStrategy parses a strategy name, empty meaning round-robin
+func ParseAssignmentStrategy(name string) (AssignmentStrategy, error) {
+	switch strategy := AssignmentStrategy(strings.ToLower(name)); strategy {
+	case "", AssignRoundRobin:
+		return AssignRoundRobin, nil
+	case AssignLeastLoaded:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown assignment strategy %q, expected %s or %s", name, AssignRoundRobin, AssignLeastLoaded)
+	}
+}
+
+// closedStates are the states closing a work item in the Agile, Scrum, CMMI
+// and Basic processes, work items in other states count as load
+var closedStates = []string{"Closed", "Done", "Removed", "Resolved"}
+
+// OpenCondition returns the WIQL condition selecting the work items that are
+// not closed
+func OpenCondition() string {
+	states := make([]string, 0, len(closedStates))
+	for _, state := range closedStates {
+		states = append(states, WIQLString(state))
+	}
+
+	return "[System.State] NOT IN (" + strings.Join(states, ", ") + ")"
+}
+
+// teamAssignment holds the members of a team and the work items assigned to
+// each of them
+type teamAssignment struct {
+	members []Identity
+	load    []int
+	next    int
+}
+
+// pick returns the unique name of the member the next work item is assigned
+// to and counts the work item
+func (t *teamAssignment) pick(strategy AssignmentStrategy) string {
+	i := t.next % len(t.members)
+	if strategy == AssignLeastLoaded {
+		for j := range t.load {
+			if t.load[j] < t.load[i] {
+				i = j
+			}
+		}
+	}
+	t.next = i + 1
+	t.load[i]++
+
+	return t.members[i].UniqueName
+}
+
+// AssignTeamOwners replaces the owners naming a team, "@Team Name", with a
+// member of the team in the project of the user story, picked with the
+// strategy. Owners are only replaced when every team is found with members.
+func (c *Client) AssignTeamOwners(ctx context.Context, plan *Plan, strategy AssignmentStrategy) error {
+	if strategy == "" {
+		strategy = AssignRoundRobin
+	}
+	teams := map[[3]string]*teamAssignment{}
+	team := func(settings models.AdoSettings, owner string) (*teamAssignment, error) {
+		name := strings.TrimSpace(strings.TrimPrefix(owner, TeamOwnerPrefix))
+		key := [3]string{strings.ToLower(settings.Organization), strings.ToLower(settings.Project), strings.ToLower(name)}
+		if assignment, ok := teams[key]; ok {
+			return assignment, nil
+		}
+
+		members, err := c.TeamMembers(ctx, settings, name)
+		if err != nil {
+			return nil, &WorkItemError{Op: "read members of", Type: "team " + name, Err: err}
+		}
+		if len(members) == 0 {
+			return nil, &WorkItemError{Op: "assign to", Type: "team " + name, Err: fmt.Errorf("team has no members: %w", ErrValidation)}
+		}
+		sort.Slice(members, func(i, j int) bool {
+			return strings.ToLower(members[i].UniqueName) < strings.ToLower(members[j].UniqueName)
+		})
+
+		assignment := &teamAssignment{members: members, load: make([]int, len(members))}
+		if strategy == AssignLeastLoaded {
+			for i, member := range members {
+				if assignment.load[i], err = c.openWorkItems(ctx, settings, member.UniqueName); err != nil {
+					return nil, err
+				}
+			}
+		}
+		teams[key] = assignment
+		return assignment, nil
+	}
+
+	// Owners are picked into a copy, the plan is left unchanged on failure
+	items := make([]models.UserStory, len(plan.Items))
+	for i, userStory := range plan.Items {
+		settings := c.SettingsFor(userStory)
+		userStory.Tasks = append([]models.Task(nil), userStory.Tasks...)
+		if strings.HasPrefix(userStory.Owner, TeamOwnerPrefix) {
+			assignment, err := team(settings, userStory.Owner)
+			if err != nil {
+				return err
+			}
+			userStory.Owner = assignment.pick(strategy)
+		}
+		for j, task := range userStory.Tasks {
+			if !strings.HasPrefix(task.Owner, TeamOwnerPrefix) {
+				continue
+			}
+			assignment, err := team(settings, task.Owner)
+			if err != nil {
+				return err
+			}
+			userStory.Tasks[j].Owner = assignment.pick(strategy)
+		}
+		items[i] = userStory
+	}
+
+	if len(teams) > 0 {
+		c.Logger.Info("Assigned work items to team members", zap.Int("teams", len(teams)), zap.String("strategy", string(strategy)))
+	}
+	plan.Items = items
+
+	return nil
+}
+
+// openWorkItems returns the number of work items of the project assigned to
+// a user that are not closed
+func (c *Client) openWorkItems(ctx context.Context, settings models.AdoSettings, uniqueName string) (int, error) {
+	query := fmt.Sprintf(
+		"SELECT [System.Id] FROM WorkItems WHERE [System.TeamProject] = @project AND [System.AssignedTo] = %s AND %s",
+		WIQLString(uniqueName), OpenCondition(),
+	)
+
+	ids, err := c.QueryWorkItems(ctx, settings, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(ids), nil
+}
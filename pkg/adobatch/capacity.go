@@ -0,0 +1,232 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// remainingWorkField is the field of the hours of work left on a task,
+// checked against the capacity of its owner
+const remainingWorkField = "Microsoft.VSTS.Scheduling.RemainingWork"
+
+// CapacityError is returned when the tasks planned for an owner in an
+// iteration exceed their capacity
+type CapacityError struct {
+	Owner     string
+	Iteration string
+	// Planned and Capacity are in hours
+	Planned  float64
+	Capacity float64
+}
+
+func (e *CapacityError) Error() string {
+	if e.Capacity == 0 {
+		return fmt.Sprintf("%s: %g hours planned in %s, without capacity in the team", e.Owner, e.Planned, e.Iteration)
+	}
+	return fmt.Sprintf("%s: %g hours planned in %s, over a capacity of %g hours", e.Owner, e.Planned, e.Iteration, e.Capacity)
+}
+
+// Unwrap matches ErrValidation
+func (e *CapacityError) Unwrap() error {
+	return ErrValidation
+}
+
+// dateRange is a range of days off, both days included
+type dateRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (r dateRange) contains(day time.Time) bool {
+	return !day.Before(r.Start.Truncate(24*time.Hour)) && !day.After(r.End)
+}
+
+// Capacities returns the capacity in hours of every member of a team, or of
+// the default team when team is empty, in an iteration of the team, by lower
+// case unique and display name. The capacity of a member is their capacity
+// per day over the working days of the iteration, without the days off of the
+// team and their own.
+func (c *Client) Capacities(ctx context.Context, settings models.AdoSettings, team, iterationPath string) (map[string]float64, error) {
+	teamSegment := ""
+	if team != "" {
+		teamSegment = "/" + url.PathEscape(team)
+	}
+	baseURL := fmt.Sprintf("https://dev.azure.com/%s/%s%s/_apis/work/teamsettings", settings.Organization, url.PathEscape(settings.Project), teamSegment)
+
+	iterations, err := c.teamIterations(ctx, settings, team, "")
+	if err != nil {
+		return nil, &WorkItemError{Op: "read", Type: "team iterations", Err: err}
+	}
+	var iteration *ClassificationNode
+	for i := range iterations {
+		if strings.EqualFold(iterations[i].Path, iterationPath) {
+			iteration = &iterations[i]
+		}
+	}
+	if iteration == nil {
+		return nil, fmt.Errorf("iteration %q is not an iteration of the team: %w", iterationPath, ErrValidation)
+	}
+	if iteration.StartDate == nil || iteration.FinishDate == nil {
+		return nil, fmt.Errorf("iteration %q has no dates: %w", iterationPath, ErrValidation)
+	}
+
+	var teamSettings struct {
+		WorkingDays []string `json:"workingDays"`
+	}
+	if err := c.get(ctx, settings, baseURL+"?api-version=7.0", &teamSettings); err != nil {
+		return nil, &WorkItemError{Op: "read", Type: "team settings", Err: err}
+	}
+	var teamDaysOff struct {
+		DaysOff []dateRange `json:"daysOff"`
+	}
+	if err := c.get(ctx, settings, fmt.Sprintf("%s/iterations/%s/teamdaysoff?api-version=7.0", baseURL, iteration.ID), &teamDaysOff); err != nil {
+		return nil, &WorkItemError{Op: "read", Type: "team days off", Err: err}
+	}
+
+	type memberCapacity struct {
+		TeamMember struct {
+			DisplayName string `json:"displayName"`
+			UniqueName  string `json:"uniqueName"`
+		} `json:"teamMember"`
+		Activities []struct {
+			CapacityPerDay float64 `json:"capacityPerDay"`
+		} `json:"activities"`
+		DaysOff []dateRange `json:"daysOff"`
+	}
+	// Older API versions return the members in value
+	var response struct {
+		TeamMembers []memberCapacity `json:"teamMembers"`
+		Value       []memberCapacity `json:"value"`
+	}
+	if err := c.get(ctx, settings, fmt.Sprintf("%s/iterations/%s/capacities?api-version=7.0", baseURL, iteration.ID), &response); err != nil {
+		return nil, &WorkItemError{Op: "read", Type: "capacities", Err: err}
+	}
+
+	workingDays := map[time.Weekday]bool{}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		for _, name := range teamSettings.WorkingDays {
+			if strings.EqualFold(name, day.String()) {
+				workingDays[day] = true
+			}
+		}
+	}
+	var days []time.Time
+	for day := iteration.StartDate.UTC().Truncate(24 * time.Hour); !day.After(*iteration.FinishDate); day = day.AddDate(0, 0, 1) {
+		if workingDays[day.Weekday()] && !containsDay(teamDaysOff.DaysOff, day) {
+			days = append(days, day)
+		}
+	}
+
+	capacities := map[string]float64{}
+	for _, member := range append(response.TeamMembers, response.Value...) {
+		perDay := 0.0
+		for _, activity := range member.Activities {
+			perDay += activity.CapacityPerDay
+		}
+		capacity := 0.0
+		for _, day := range days {
+			if !containsDay(member.DaysOff, day) {
+				capacity += perDay
+			}
+		}
+		capacities[strings.ToLower(member.TeamMember.UniqueName)] = capacity
+		capacities[strings.ToLower(member.TeamMember.DisplayName)] = capacity
+	}
+
+	return capacities, nil
+}
+
+// remainingWork returns the remaining work a task is created with, in hours:
+// its RemainingWork field when set, or else its estimate
+func remainingWork(task models.Task) float64 {
+	switch hours := task.Fields[remainingWorkField].(type) {
+	case int:
+		return float64(hours)
+	case float64:
+		return hours
+	case string:
+		if value, err := strconv.ParseFloat(hours, 64); err == nil {
+			return value
+		}
+	}
+
+	return float64(task.Estimate)
+}
+
+func containsDay(ranges []dateRange, day time.Time) bool {
+	for _, r := range ranges {
+		if r.contains(day) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckCapacity checks the remaining work of the tasks of the plan against
+// the capacity of their owners in the iteration of their user story, read
+// from the team of the user story, or the default team of its project. The
+// planned hours of an owner can exceed their capacity by tolerance, a
+// fraction of it. Tasks without owner, iteration or remaining work are not
+// checked.
+func (c *Client) CheckCapacity(ctx context.Context, plan *Plan, tolerance float64) error {
+	type sprint struct {
+		settings  models.AdoSettings
+		team      string
+		iteration string
+		planned   map[string]float64
+		owners    []string
+	}
+	var sprints []*sprint
+	byKey := map[[4]string]*sprint{}
+	for _, userStory := range plan.Items {
+		if userStory.Iteraction == nil || *userStory.Iteraction == "" {
+			continue
+		}
+		settings := c.SettingsFor(userStory)
+		key := [4]string{strings.ToLower(settings.Organization), strings.ToLower(settings.Project), strings.ToLower(userStory.Team), strings.ToLower(*userStory.Iteraction)}
+		for _, task := range userStory.Tasks {
+			hours := remainingWork(task)
+			if task.Owner == "" || hours == 0 {
+				continue
+			}
+			if byKey[key] == nil {
+				byKey[key] = &sprint{settings: settings, team: userStory.Team, iteration: *userStory.Iteraction, planned: map[string]float64{}}
+				sprints = append(sprints, byKey[key])
+			}
+			s := byKey[key]
+			owner := strings.ToLower(task.Owner)
+			if _, ok := s.planned[owner]; !ok {
+				s.owners = append(s.owners, task.Owner)
+			}
+			s.planned[owner] += hours
+		}
+	}
+
+	var errs []error
+	for _, s := range sprints {
+		capacities, err := c.Capacities(ctx, s.settings, s.team, s.iteration)
+		if err != nil {
+			return err
+		}
+		sort.Strings(s.owners)
+		for _, owner := range s.owners {
+			planned, capacity := s.planned[strings.ToLower(owner)], capacities[strings.ToLower(owner)]
+			c.Logger.Debug("Planned capacity", zap.String("owner", owner), zap.String("iteration", s.iteration), zap.Float64("planned_hours", planned), zap.Float64("capacity_hours", capacity))
+			if planned > capacity*(1+tolerance) {
+				errs = append(errs, &CapacityError{Owner: owner, Iteration: s.iteration, Planned: planned, Capacity: capacity})
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
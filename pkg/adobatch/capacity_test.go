@@ -0,0 +1,56 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+)
+
+func TestCheckCapacity(t *testing.T) {
+	tests := []struct {
+		name   string
+		task   models.Task
+		exceed bool
+	}{
+		{"estimate within capacity", models.Task{Estimate: 16}, false},
+		{"estimate over capacity", models.Task{Estimate: 24}, true},
+		{"remaining work over capacity", models.Task{Estimate: 8, Fields: map[string]any{remainingWorkField: 24.0}}, true},
+		{"remaining work within capacity", models.Task{Estimate: 30, Fields: map[string]any{remainingWorkField: 10}}, false},
+		{"no remaining work", models.Task{Estimate: 30, Fields: map[string]any{remainingWorkField: "0"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := newTestClient(t)
+			// Five working days of 4 hours, 20 hours
+			server.AddRule(adotest.Rule{Status: http.StatusOK, Path: "/_apis/work/teamsettings", Body: map[string]any{
+				"workingDays": []string{"monday", "tuesday", "wednesday", "thursday", "friday"},
+			}})
+			server.AddRule(adotest.Rule{Status: http.StatusOK, Path: "/_apis/work/teamsettings/iterations", Body: map[string]any{"value": []map[string]any{{
+				"id":         "sprint-1",
+				"path":       `project\Sprint 1`,
+				"attributes": map[string]any{"startDate": "2026-10-05T00:00:00Z", "finishDate": "2026-10-11T00:00:00Z"},
+			}}}})
+			server.AddRule(adotest.Rule{Status: http.StatusOK, Path: "/iterations/sprint-1/teamdaysoff", Body: map[string]any{"daysOff": []any{}}})
+			server.AddRule(adotest.Rule{Status: http.StatusOK, Path: "/iterations/sprint-1/capacities", Body: map[string]any{"teamMembers": []map[string]any{{
+				"teamMember": map[string]any{"displayName": "Ana", "uniqueName": "ana@example.com"},
+				"activities": []map[string]any{{"capacityPerDay": 4}},
+			}}}})
+
+			iteration := `project\Sprint 1`
+			tt.task.Name, tt.task.Owner = "Task 1", "ana@example.com"
+			plan := &Plan{Items: []models.UserStory{{Name: "US1", Iteraction: &iteration, Tasks: []models.Task{tt.task}}}}
+			err := client.CheckCapacity(context.Background(), plan, 0)
+			var capacityErr *CapacityError
+			if errors.As(err, &capacityErr) != tt.exceed {
+				t.Errorf("error = %v, want exceeded %t", err, tt.exceed)
+			}
+			if capacityErr != nil && capacityErr.Capacity != 20 {
+				t.Errorf("capacity = %g hours, want 20", capacityErr.Capacity)
+			}
+		})
+	}
+}
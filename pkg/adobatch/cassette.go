@@ -0,0 +1,252 @@
+package adobatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// cassetteHeaders are the response headers recorded, those the client reads
+var cassetteHeaders = []string{"Content-Type", "Retry-After", "X-RateLimit-Remaining", "X-RateLimit-Reset", "ActivityId", "X-VSS-E2EID"}
+
+// Cassette holds the API calls of a run, recorded by a Recorder to be
+// replayed by a Player, such as in tests
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a request and the response Azure DevOps returned. Bodies
+// are kept as JSON when they are.
+type Interaction struct {
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestBody     any               `json:"requestBody,omitempty"`
+	Status          int               `json:"status"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"`
+	ResponseBody    any               `json:"responseBody,omitempty"`
+}
+
+// Recorder is a transport recording the requests it sends and their
+// responses in a cassette. Request headers are not recorded, and secrets are
+// redacted from the URLs and bodies.
+type Recorder struct {
+	next    http.RoundTripper
+	secrets []string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a recorder sending the requests with next, redacting
+// the secrets
+func NewRecorder(next http.RoundTripper, secrets ...string) *Recorder {
+	return &Recorder{next: next, secrets: secrets}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	interaction := Interaction{Method: req.Method, URL: r.redact(req.URL.String())}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			body.Close()
+			interaction.RequestBody = r.body(data)
+		}
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the body for the cassette and hand an identical copy to the caller
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	interaction.Status = resp.StatusCode
+	interaction.ResponseBody = r.body(data)
+	for _, header := range cassetteHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			if interaction.ResponseHeaders == nil {
+				interaction.ResponseHeaders = map[string]string{}
+			}
+			interaction.ResponseHeaders[header] = value
+		}
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+func (r *Recorder) redact(value string) string {
+	for _, secret := range r.secrets {
+		if secret != "" {
+			value = strings.ReplaceAll(value, secret, "[REDACTED]")
+		}
+	}
+
+	return value
+}
+
+// body keeps JSON bodies as JSON in the cassette, and anything else as text
+func (r *Recorder) body(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+
+	redacted := r.redact(string(data))
+	if json.Valid([]byte(redacted)) {
+		return json.RawMessage(redacted)
+	}
+
+	return redacted
+}
+
+// Save writes the interactions recorded so far to a cassette file
+func (r *Recorder) Save(path string) error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+
+	return nil
+}
+
+// Player is a transport answering requests with the responses of a cassette,
+// without sending them. Every request is matched to the first interaction
+// not replayed yet with the same method and URL, and fails when there is
+// none or when its body differs from the recorded one.
+type Player struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// LoadCassette reads a cassette file for replay
+func LoadCassette(path string) (*Player, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+	}
+
+	return NewPlayer(cassette), nil
+}
+
+// NewPlayer returns a player replaying the interactions of a cassette
+func NewPlayer(cassette Cassette) *Player {
+	return &Player{interactions: cassette.Interactions, replayed: make([]bool, len(cassette.Interactions))}
+}
+
+func (p *Player) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		body, _ = io.ReadAll(reader)
+		reader.Close()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	url := req.URL.String()
+	for i, interaction := range p.interactions {
+		if p.replayed[i] || interaction.Method != req.Method || interaction.URL != url {
+			continue
+		}
+		if !sameBody(body, interaction.RequestBody) {
+			recorded, _ := json.Marshal(interaction.RequestBody)
+			return nil, fmt.Errorf("request body of %s %s differs from the cassette:\n  sent:     %s\n  recorded: %s", req.Method, url, body, recorded)
+		}
+		p.replayed[i] = true
+
+		resp := &http.Response{
+			Status:     fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+			StatusCode: interaction.Status,
+			Header:     http.Header{},
+			Body:       io.NopCloser(bytes.NewReader(responseBody(interaction.ResponseBody))),
+			Request:    req,
+		}
+		for header, value := range interaction.ResponseHeaders {
+			resp.Header.Set(header, value)
+		}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("no interaction of the cassette left for %s %s", req.Method, url)
+}
+
+// Unplayed returns the interactions of the cassette that were not replayed,
+// such as requests a change stopped sending
+func (p *Player) Unplayed() []Interaction {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var unplayed []Interaction
+	for i, interaction := range p.interactions {
+		if !p.replayed[i] {
+			unplayed = append(unplayed, interaction)
+		}
+	}
+
+	return unplayed
+}
+
+// sameBody compares a request body with a recorded one, as JSON when both
+// are
+func sameBody(sent []byte, recorded any) bool {
+	if recorded == nil {
+		return len(sent) == 0
+	}
+	if text, ok := recorded.(string); ok {
+		return string(sent) == text
+	}
+
+	var value any
+	if err := json.Unmarshal(sent, &value); err != nil {
+		return false
+	}
+	// Recorded bodies are decoded the same way
+	recordedData, _ := json.Marshal(recorded)
+	var recordedValue any
+	json.Unmarshal(recordedData, &recordedValue)
+
+	return reflect.DeepEqual(value, recordedValue)
+}
+
+func responseBody(recorded any) []byte {
+	switch body := recorded.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(body)
+	default:
+		data, _ := json.Marshal(body)
+		return data
+	}
+}
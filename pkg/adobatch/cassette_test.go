@@ -0,0 +1,74 @@
+package adobatch
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+func TestCassetteRoundTrip(t *testing.T) {
+	plan := func() *Plan {
+		return &Plan{Items: []models.UserStory{
+			{Name: "US1", Key: "first", Tasks: []models.Task{{Name: "Task 1"}, {Name: "Task 2"}}},
+			{Name: "US2", Links: []models.Link{{Type: "related", Key: "first"}}},
+		}}
+	}
+	options := Options{OrderField: "Microsoft.VSTS.Common.StackRank"}
+
+	client, server := newTestClient(t)
+	client.Settings.Pat = "cassette-pat"
+	recorder := NewRecorder(server.Transport(), client.Settings.Pat)
+	client.HTTPClient = &http.Client{Transport: recorder}
+	recorded := client.Apply(context.Background(), plan(), options)
+	if recorded.Status != RunSucceeded {
+		t.Fatalf("recorded run status = %s (%s)", recorded.Status, recorded.AbortReason)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	player, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replayed offline: the fake is closed and its requests are not counted
+	requests := len(server.Requests())
+	server.Close()
+	client.HTTPClient = &http.Client{Transport: player}
+	replayed := client.Apply(context.Background(), plan(), options)
+	if replayed.Status != RunSucceeded {
+		t.Fatalf("replayed run status = %s (%s)", replayed.Status, replayed.AbortReason)
+	}
+	if unplayed := player.Unplayed(); len(unplayed) > 0 {
+		t.Errorf("%d interactions not replayed, first %s %s", len(unplayed), unplayed[0].Method, unplayed[0].URL)
+	}
+	if got := len(server.Requests()); got != requests {
+		t.Errorf("replay sent %d requests to the fake", got-requests)
+	}
+
+	if !reflect.DeepEqual(withoutLatency(replayed.UserStories), withoutLatency(recorded.UserStories)) {
+		t.Errorf("replayed results differ:\n  recorded: %+v\n  replayed: %+v", recorded.UserStories, replayed.UserStories)
+	}
+	if replayed.Summary.Created != recorded.Summary.Created || replayed.Summary.Updated != recorded.Summary.Updated {
+		t.Errorf("replayed %d created and %d updated, recorded %d and %d", replayed.Summary.Created, replayed.Summary.Updated, recorded.Summary.Created, recorded.Summary.Updated)
+	}
+}
+
+// withoutLatency returns a copy of results without their latencies, which
+// differ between runs
+func withoutLatency(results []ItemResult) []ItemResult {
+	copied := make([]ItemResult, 0, len(results))
+	for _, result := range results {
+		result.LatencyMs = 0
+		result.Tasks = withoutLatency(result.Tasks)
+		copied = append(copied, result)
+	}
+
+	return copied
+}
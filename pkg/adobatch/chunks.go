@@ -0,0 +1,49 @@
+package adobatch
+
+import (
+	"fmt"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// checkResume returns a *PlanError when the user stories recorded by a
+// checkpoint are not the first user stories of the plan
+func (p *Plan) checkResume(recorded []ItemResult) error {
+	if len(recorded) > len(p.Items) {
+		return &PlanError{Err: fmt.Errorf("the checkpoint has %d user stories, the items file %d", len(recorded), len(p.Items))}
+	}
+	for i, userStory := range recorded {
+		if userStory.Name != p.Items[i].Name {
+			return &PlanError{Err: fmt.Errorf("items[%d] is %q in the items file and %q in the checkpoint", i, p.Items[i].Name, userStory.Name)}
+		}
+	}
+
+	return nil
+}
+
+// resumedResult returns the result of a user story whose work item was
+// created by the run a checkpoint recorded, with the IDs of its tasks created
+// by lower case title, as createTasks skips them
+func resumedResult(userStory models.UserStory, recorded ItemResult) (Result, map[string]int) {
+	result := newResult(userStory, recorded.Status)
+	result.ID = recorded.Id
+	result.URL = recorded.Url
+
+	existing := map[string]int{}
+	for i := range result.Tasks {
+		if i >= len(recorded.Tasks) {
+			break
+		}
+		task := recorded.Tasks[i]
+		if task.Id == 0 || task.Name != result.Tasks[i].Item.Name {
+			continue
+		}
+		result.Tasks[i].ID = task.Id
+		result.Tasks[i].URL = task.Url
+		result.Tasks[i].Status = task.Status
+		existing[strings.ToLower(task.Name)] = task.Id
+	}
+
+	return result, existing
+}
@@ -0,0 +1,148 @@
+package adobatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// AuthorizeFunc adds credentials to a request sent to the organization of
+// settings
+type AuthorizeFunc func(ctx context.Context, req *http.Request, settings models.AdoSettings) error
+
+// PATAuthorizer authenticates with the personal access token of the
+// settings
+func PATAuthorizer(ctx context.Context, req *http.Request, settings models.AdoSettings) error {
+	req.SetBasicAuth("", settings.Pat)
+	return nil
+}
+
+// Client creates work items in Azure DevOps
+type Client struct {
+	// Settings are the default organization and project, and the settings
+	// of the other organizations items can target
+	Settings models.AdoSettings
+	// Authorize adds credentials to every request
+	Authorize  AuthorizeFunc
+	HTTPClient *http.Client
+	Logger     *zap.Logger
+	// BatchSize is the number of work items updated by a request of
+	// UpdateWorkItems, MaxBatchSize when 0
+	BatchSize int
+}
+
+// NewClient returns a client authenticating with the PAT of the settings
+func NewClient(settings models.AdoSettings) *Client {
+	return &Client{
+		Settings:   settings,
+		Authorize:  PATAuthorizer,
+		HTTPClient: http.DefaultClient,
+		Logger:     zap.NewNop(),
+	}
+}
+
+// do sends an authorized JSON request and fails unless Azure DevOps answers
+// with one of the expected statuses
+func (c *Client) do(ctx context.Context, settings models.AdoSettings, method, url, contentType string, payload []byte, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers and authentication
+	req.Header.Set("Content-Type", contentType)
+	if err := c.Authorize(ctx, req, settings); err != nil {
+		return nil, err
+	}
+
+	// Send the request
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+
+	return nil, NewAPIError(resp, payload)
+}
+
+// CreateWorkItem creates a work item of the given type from a JSON patch
+// document and returns its ID
+func (c *Client) CreateWorkItem(ctx context.Context, settings models.AdoSettings, workItemType string, payload any) (int, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workitems/$%s?api-version=7.0", settings.Organization, settings.Project, url.PathEscape(workItemType))
+	c.Logger.Debug("Azure DevOps API URL", zap.String("url", url))
+
+	// Marshal the payload to JSON
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	c.Logger.Debug("Work item payload", zap.String("type", workItemType), zap.ByteString("payload", payloadBytes))
+
+	resp, err := c.do(ctx, settings, "POST", url, "application/json-patch+json", payloadBytes, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return 0, &WorkItemError{Op: "create", Type: workItemType, Err: err}
+	}
+	defer resp.Body.Close()
+
+	// Parse the response to get the work item ID
+	var responseBody struct {
+		Id int `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return responseBody.Id, nil
+}
+
+// SettingsFor returns the settings used to create a user story and its
+// tasks, in the organization and project it targets
+func (c *Client) SettingsFor(userStory models.UserStory) models.AdoSettings {
+	settings := organizationSettings(c.Settings, userStory.Organization)
+	if userStory.Project != "" {
+		settings.Project = userStory.Project
+	}
+
+	return settings
+}
+
+// organizationSettings returns the settings used to create work items in an
+// organization. Organizations without their own configuration reuse the
+// credentials of the default one.
+func organizationSettings(settings models.AdoSettings, organization string) models.AdoSettings {
+	if organization == "" || strings.EqualFold(organization, settings.Organization) {
+		return settings
+	}
+
+	if orgSettings, ok := settings.Organizations[strings.ToLower(organization)]; ok {
+		return orgSettings
+	}
+
+	settings.Organization = organization
+	return settings
+}
+
+// WorkItemURL returns the web URL of a work item
+func WorkItemURL(organization, project string, id int) string {
+	return fmt.Sprintf("https://dev.azure.com/%s/%s/_workitems/edit/%d", organization, url.PathEscape(project), id)
+}
+
+// WorkItemAPIURL returns the REST URL of a work item, used to link work
+// items
+func WorkItemAPIURL(organization string, id int) string {
+	return fmt.Sprintf("https://dev.azure.com/%s/_apis/wit/workItems/%d", organization, id)
+}
@@ -0,0 +1,22 @@
+package adobatch
+
+import (
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+)
+
+// newTestClient returns a client of the org organization and project
+// project, sending its requests to a fake closed at the end of the test
+func newTestClient(t *testing.T) (*Client, *adotest.Server) {
+	t.Helper()
+
+	server := adotest.NewServer()
+	t.Cleanup(server.Close)
+
+	client := NewClient(models.AdoSettings{Organization: "org", Project: "project", Pat: "pat"})
+	client.HTTPClient = server.Client()
+
+	return client, server
+}
@@ -0,0 +1,187 @@
+package adobatch
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// cloneSkippedFields are the fields not copied to clones: they are read-only,
+// computed, or describe the history of the original rather than its content
+var cloneSkippedFields = map[string]bool{
+	"System.Id":                             true,
+	"System.Rev":                            true,
+	"System.TeamProject":                    true,
+	"System.State":                          true,
+	"System.Reason":                         true,
+	"System.Parent":                         true,
+	"System.Watermark":                      true,
+	"System.CreatedDate":                    true,
+	"System.CreatedBy":                      true,
+	"System.ChangedDate":                    true,
+	"System.ChangedBy":                      true,
+	"System.AuthorizedDate":                 true,
+	"System.AuthorizedAs":                   true,
+	"System.RevisedDate":                    true,
+	"System.PersonId":                       true,
+	"System.CommentCount":                   true,
+	"System.BoardColumn":                    true,
+	"System.BoardColumnDone":                true,
+	"System.BoardLane":                      true,
+	"Microsoft.VSTS.Common.StateChangeDate": true,
+	"Microsoft.VSTS.Common.ActivatedDate":   true,
+	"Microsoft.VSTS.Common.ActivatedBy":     true,
+	"Microsoft.VSTS.Common.ResolvedDate":    true,
+	"Microsoft.VSTS.Common.ResolvedBy":      true,
+	"Microsoft.VSTS.Common.ClosedDate":      true,
+	"Microsoft.VSTS.Common.ClosedBy":        true,
+}
+
+// cloneField reports whether a field is copied to clones
+func cloneField(name string) bool {
+	switch {
+	case cloneSkippedFields[name], name == "System.WorkItemType", name == "System.Tags":
+		return false
+	// Derived from the area and iteration paths
+	case strings.HasPrefix(name, "System.AreaLevel"), strings.HasPrefix(name, "System.IterationLevel"),
+		name == "System.AreaId", name == "System.IterationId", name == "System.NodeName":
+		return false
+	// Kanban board columns of each team
+	case strings.HasPrefix(name, "WEF_"):
+		return false
+	}
+
+	return true
+}
+
+// CloneOptions controls where a work item tree is cloned
+type CloneOptions struct {
+	// Area and Iteration, when set, replace the area and iteration paths of
+	// every clone
+	Area      string
+	Iteration string
+	// Attachments links the attachments of the originals to the clones
+	Attachments bool
+}
+
+// Clone is a work item created by Clone
+type Clone struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	OriginalID int    `json:"originalId"`
+	ID         int    `json:"id"`
+	URL        string `json:"url"`
+}
+
+// Clone copies a work item and all of its descendants, parents first. The
+// root clone is linked to the parent of the original, and every other clone
+// to the clone of its parent. Clones start in the initial state of their
+// type and are tagged with AutomationTag. When a creation fails, the clones
+// created so far are returned with the error.
+func (c *Client) Clone(ctx context.Context, settings models.AdoSettings, id int, options CloneOptions) ([]Clone, error) {
+	roots, err := c.getWorkItems(ctx, settings, []int{id}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("work item %d not found", id)
+	}
+
+	var parentID int
+	if parents := roots[0].linked("System.LinkTypes.Hierarchy-Reverse"); len(parents) > 0 {
+		parentID = parents[0]
+	}
+
+	var clones []Clone
+	err = c.cloneTree(ctx, settings, roots[0], parentID, options, &clones)
+
+	return clones, err
+}
+
+// cloneTree clones a work item under parentID, then its children under the
+// clone
+func (c *Client) cloneTree(ctx context.Context, settings models.AdoSettings, original workItem, parentID int, options CloneOptions, clones *[]Clone) error {
+	workItemType := original.field("System.WorkItemType")
+	id, err := c.CreateWorkItem(ctx, settings, workItemType, clonePayload(settings, original, parentID, options))
+	if err != nil {
+		return err
+	}
+
+	clone := Clone{
+		Type:       workItemType,
+		Title:      original.field("System.Title"),
+		OriginalID: original.ID,
+		ID:         id,
+		URL:        WorkItemURL(settings.Organization, settings.Project, id),
+	}
+	*clones = append(*clones, clone)
+	c.Logger.Info("Work item cloned", zap.String("type", clone.Type), zap.String("title", clone.Title), zap.Int("original_id", clone.OriginalID), zap.Int("id", id), zap.String("url", clone.URL))
+
+	children, err := c.getWorkItems(ctx, settings, original.linked("System.LinkTypes.Hierarchy-Forward"), nil)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := c.cloneTree(ctx, settings, child, id, options, clones); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clonePayload returns the JSON patch document creating a copy of a work
+// item under parentID
+func clonePayload(settings models.AdoSettings, original workItem, parentID int, options CloneOptions) []map[string]interface{} {
+	var payload []map[string]interface{}
+	add := func(path string, value any) {
+		payload = append(payload, map[string]interface{}{"op": "add", "path": path, "value": value})
+	}
+
+	// Sorted, so the payloads of the audit log are stable
+	for _, name := range slices.Sorted(maps.Keys(original.Fields)) {
+		if !cloneField(name) {
+			continue
+		}
+		value := original.Fields[name]
+		// Identities are read as objects and written as their unique name
+		if identity, ok := value.(map[string]any); ok {
+			if value, ok = identity["uniqueName"].(string); !ok {
+				continue
+			}
+		}
+		switch {
+		case name == "System.AreaPath" && options.Area != "":
+			value = options.Area
+		case name == "System.IterationPath" && options.Iteration != "":
+			value = options.Iteration
+		}
+		add("/fields/"+name, value)
+	}
+
+	add("/fields/System.Tags", MergeTags(original.field("System.Tags"), AutomationTag))
+
+	if parentID != 0 {
+		add("/relations/-", map[string]interface{}{
+			"rel": "System.LinkTypes.Hierarchy-Reverse",
+			"url": WorkItemAPIURL(settings.Organization, parentID),
+			"attributes": map[string]string{
+				"comment": "Linking clone to parent",
+			},
+		})
+	}
+	if options.Attachments {
+		for _, relation := range original.Relations {
+			if relation.Rel == "AttachedFile" {
+				add("/relations/-", map[string]interface{}{"rel": "AttachedFile", "url": relation.URL})
+			}
+		}
+	}
+
+	return payload
+}
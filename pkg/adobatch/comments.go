@@ -0,0 +1,41 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// AddComment adds a comment to the discussion of a work item. The text is
+// rich text, as descriptions.
+func (c *Client) AddComment(ctx context.Context, settings models.AdoSettings, id int, text string) error {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workItems/%d/comments?api-version=7.0-preview.3", settings.Organization, settings.Project, id)
+
+	payloadBytes, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	resp, err := c.do(ctx, settings, "POST", url, "application/json", payloadBytes, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return &WorkItemError{Op: "comment on", Type: fmt.Sprintf("work item %d", id), Err: err}
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// addComment adds the comment of the run to a work item just created. A
+// failure is logged: the work item is created all the same.
+func (c *Client) addComment(ctx context.Context, settings models.AdoSettings, id int, options Options) {
+	if options.Comment == "" {
+		return
+	}
+	if err := c.AddComment(ctx, settings, id, options.Comment); err != nil {
+		c.Logger.Warn("Failed to add comment", zap.Int("id", id), zap.Error(err))
+	}
+}
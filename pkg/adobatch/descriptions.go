@@ -0,0 +1,76 @@
+package adobatch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// DescriptionData is available to the templates of descriptions, such as
+// "Part of {{.Parent.Name}} for {{.Sprint}}"
+type DescriptionData struct {
+	// Parent is the user story of a task, empty for user stories
+	Parent models.UserStory
+	// Name is the name of the user story or task
+	Name  string
+	RunID string
+	// Iteration is the iteration path of the user story, Sprint its last
+	// segment, "Sprint 43"
+	Iteration string
+	Sprint    string
+	// Index is the position of the user story in the plan, or of the task in
+	// its user story, from 1
+	Index int
+}
+
+// RenderDescriptions renders the descriptions of the user stories and tasks
+// of the plan as templates. Descriptions without "{{" are left unchanged.
+// Every template that fails is reported, joined in a *PlanError, and the plan
+// is left unchanged.
+func (p *Plan) RenderDescriptions(runID string) error {
+	var errs []error
+	render := func(item, description string, data DescriptionData) string {
+		if !strings.Contains(description, "{{") {
+			return description
+		}
+		tmpl, err := template.New(item).Option("missingkey=error").Parse(description)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to parse description: %w", item, err))
+			return description
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to render description: %w", item, err))
+			return description
+		}
+		return b.String()
+	}
+
+	items := make([]models.UserStory, len(p.Items))
+	for i, userStory := range p.Items {
+		data := DescriptionData{Name: userStory.Name, RunID: runID, Index: i + 1}
+		if userStory.Iteraction != nil {
+			data.Iteration = *userStory.Iteraction
+			data.Sprint = data.Iteration[strings.LastIndex(data.Iteration, `\`)+1:]
+		}
+
+		rendered := userStory
+		rendered.Description = render(fmt.Sprintf("items[%d]", i), userStory.Description, data)
+		rendered.Tasks = append([]models.Task(nil), userStory.Tasks...)
+		for j, task := range userStory.Tasks {
+			taskData := data
+			taskData.Parent, taskData.Name, taskData.Index = userStory, task.Name, j+1
+			rendered.Tasks[j].Description = render(fmt.Sprintf("items[%d].tasks[%d]", i, j), task.Description, taskData)
+		}
+		items[i] = rendered
+	}
+	if len(errs) > 0 {
+		return &PlanError{Err: errors.Join(errs...)}
+	}
+	p.Items = items
+
+	return nil
+}
@@ -0,0 +1,31 @@
+// Package adobatch creates batches of Azure DevOps user stories and their
+// tasks. It is the engine of the ado_batch_creator command, exposed so Go
+// services can embed batch creation instead of running the binary.
+//
+// A batch is loaded into a Plan, then applied with a Client:
+//
+//	plan, err := adobatch.LoadPlan(data)
+//	if err != nil {
+//		return err
+//	}
+//
+//	client := adobatch.NewClient(models.AdoSettings{
+//		Organization: "my-org",
+//		Project:      "my-project",
+//		Pat:          os.Getenv("ADO_PAT"),
+//	})
+//	results := client.Apply(ctx, plan, adobatch.Options{SkipExisting: true})
+//	if results.Status != adobatch.RunSucceeded {
+//		log.Printf("%d work items failed", results.Summary.Failed)
+//	}
+//
+// Results.Items holds a Result for every user story and its tasks. Failures
+// wrap ErrAuth, ErrThrottled or ErrValidation, so they can be classified
+// with errors.Is:
+//
+//	for _, item := range results.Items {
+//		if errors.Is(item.Err, adobatch.ErrThrottled) {
+//			retry = append(retry, item.Item)
+//		}
+//	}
+package adobatch
@@ -0,0 +1,132 @@
+package adobatch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// DuplicateAction is what a run does with a user story whose title matches a
+// user story created by a previous run
+type DuplicateAction string
+
+const (
+	// DuplicateSkip skips the user story and its tasks
+	DuplicateSkip DuplicateAction = "skip"
+	// DuplicateCreate creates the user story anyway
+	DuplicateCreate DuplicateAction = "create"
+	// DuplicateUpdate sets the fields of the user story on the existing one,
+	// its tasks are skipped
+	DuplicateUpdate DuplicateAction = "update"
+	// DuplicateFail fails the user story
+	DuplicateFail DuplicateAction = "fail"
+	// DuplicateMerge creates the tasks of the user story missing under the
+	// existing one, matched by title
+	DuplicateMerge DuplicateAction = "merge"
+)
+
+// ParseDuplicateAction parses a duplicate action, empty meaning skip
+func ParseDuplicateAction(name string) (DuplicateAction, error) {
+	switch action := DuplicateAction(strings.ToLower(name)); action {
+	case "", DuplicateSkip:
+		return DuplicateSkip, nil
+	case DuplicateCreate, DuplicateUpdate, DuplicateFail, DuplicateMerge:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown duplicate action %q, expected %s, %s, %s, %s or %s", name, DuplicateSkip, DuplicateCreate, DuplicateUpdate, DuplicateMerge, DuplicateFail)
+	}
+}
+
+// Duplicate is the existing user story matching a user story of the plan
+type Duplicate struct {
+	ID  int
+	URL string
+}
+
+// DuplicateResolver decides what to do with a user story of the plan that
+// already exists, such as by asking the user
+type DuplicateResolver func(ctx context.Context, userStory models.UserStory, duplicate Duplicate) (DuplicateAction, error)
+
+// DuplicateError is returned for the user stories that already exist with
+// DuplicateFail
+type DuplicateError struct {
+	Name string
+	Duplicate
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("user story %q already exists: %s", e.Name, e.URL)
+}
+
+// Unwrap matches ErrValidation
+func (e *DuplicateError) Unwrap() error {
+	return ErrValidation
+}
+
+// updateUserStory sets the fields of a user story of the plan on an existing
+// user story. Owner, priority, points, state, area and iteration are only set
+// when the user story sets them.
+func (c *Client) updateUserStory(ctx context.Context, settings models.AdoSettings, id int, userStory models.UserStory, options Options) error {
+	var payload []map[string]interface{}
+	add := func(field string, value any) {
+		payload = append(payload, map[string]interface{}{"op": "add", "path": "/fields/" + field, "value": value})
+	}
+	add("System.Title", userStory.Name)
+	add("System.Description", userStory.Description)
+	add("System.Tags", options.tags(userStory.Tags))
+	if userStory.Owner != "" {
+		add("System.AssignedTo", userStory.Owner)
+	}
+	if userStory.Priority != 0 {
+		add("Microsoft.VSTS.Common.Priority", userStory.Priority)
+	}
+	if userStory.Points != 0 {
+		add("Microsoft.VSTS.Scheduling.StoryPoints", userStory.Points)
+	}
+	if userStory.State != "" {
+		add("System.State", userStory.State)
+		if reason := options.reason(userStory.State, userStory.Reason); reason != "" {
+			add("System.Reason", reason)
+		}
+	}
+	if userStory.Area != "" {
+		add("System.AreaPath", userStory.Area)
+	}
+	if userStory.Iteraction != nil && *userStory.Iteraction != "" {
+		add("System.IterationPath", *userStory.Iteraction)
+	}
+	payload = append(payload, fieldOperations(userStory.Fields)...)
+
+	return c.UpdateWorkItem(ctx, settings, id, payload)
+}
+
+// childTasks returns the IDs of the children of a work item of the task types
+// of a user story, by lower case title
+func (c *Client) childTasks(ctx context.Context, settings models.AdoSettings, id int, userStory models.UserStory) (map[string]int, error) {
+	parents, err := c.getWorkItems(ctx, settings, []int{id}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(parents) == 0 {
+		return nil, &WorkItemError{Op: "read", Type: fmt.Sprintf("work item %d", id), Err: fmt.Errorf("not found: %w", ErrValidation)}
+	}
+
+	children, err := c.getWorkItems(ctx, settings, parents[0].linked("System.LinkTypes.Hierarchy-Forward"), []string{"System.Title", "System.WorkItemType"})
+	if err != nil {
+		return nil, err
+	}
+	types := map[string]bool{}
+	for _, task := range userStory.Tasks {
+		types[strings.ToLower(TaskType(task))] = true
+	}
+	tasks := make(map[string]int, len(children))
+	for _, child := range children {
+		if types[strings.ToLower(child.field("System.WorkItemType"))] {
+			tasks[strings.ToLower(child.field("System.Title"))] = child.ID
+		}
+	}
+
+	return tasks, nil
+}
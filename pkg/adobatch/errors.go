@@ -0,0 +1,97 @@
+package adobatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrAuth marks failures caused by an invalid or unauthorized credential
+	ErrAuth = errors.New("authentication failed")
+	// ErrThrottled marks failures caused by Azure DevOps rate limiting
+	ErrThrottled = errors.New("request throttled")
+	// ErrValidation marks invalid plans and work items rejected by Azure
+	// DevOps, such as unknown fields or area paths
+	ErrValidation = errors.New("validation failed")
+)
+
+// PlanError is returned when an items file cannot be loaded as a plan
+type PlanError struct {
+	Err error
+}
+
+func (e *PlanError) Error() string {
+	return fmt.Sprintf("invalid plan: %v", e.Err)
+}
+
+// Unwrap matches ErrValidation and the decoding error
+func (e *PlanError) Unwrap() []error {
+	return []error{ErrValidation, e.Err}
+}
+
+// WorkItemError is returned when a request for a work item fails
+type WorkItemError struct {
+	// Op is the failed operation, such as "create", "update" or "query"
+	Op string
+	// Type is the work item type, such as "User Story" or "Task", or what
+	// the operation was on
+	Type string
+	Err  error
+}
+
+func (e *WorkItemError) Error() string {
+	return fmt.Sprintf("failed to %s %s: %v", e.Op, e.Type, e.Err)
+}
+
+func (e *WorkItemError) Unwrap() error {
+	return e.Err
+}
+
+// APIError is returned when Azure DevOps answers with an unexpected status
+type APIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	// Payload is the request body that was rejected
+	Payload []byte
+}
+
+// NewAPIError builds an APIError from a failed Azure DevOps response to the
+// given payload
+func NewAPIError(resp *http.Response, payload []byte) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Payload: payload}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		apiErr.Message = body.Message
+	}
+
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("status: %s", e.Status)
+	}
+
+	return fmt.Sprintf("status: %s with message: %s", e.Status, e.Message)
+}
+
+// Unwrap classifies the failure so callers can use errors.Is
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	// Azure DevOps answers 203 with a sign-in page when the PAT is rejected
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNonAuthoritativeInfo:
+		return ErrAuth
+	case http.StatusTooManyRequests:
+		return ErrThrottled
+	case http.StatusBadRequest:
+		return ErrValidation
+	}
+
+	return nil
+}
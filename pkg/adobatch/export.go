@@ -0,0 +1,195 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// workItemsBatchSize is the maximum number of work items Azure DevOps
+// returns in a batch request
+const workItemsBatchSize = 200
+
+// workItem is a work item read from Azure DevOps with its links
+type workItem struct {
+	ID        int            `json:"id"`
+	Fields    map[string]any `json:"fields"`
+	Relations []struct {
+		Rel string `json:"rel"`
+		URL string `json:"url"`
+	} `json:"relations"`
+}
+
+// Export reads the user stories matching a WIQL query, and their child
+// tasks, as a plan that can be edited and applied again. Work items of other
+// types, such as a custom "Spike", are exported with their type; tasks
+// returned by the query are ignored.
+func (c *Client) Export(ctx context.Context, settings models.AdoSettings, query string) (*Plan, error) {
+	ids, err := c.QueryWorkItems(ctx, settings, query)
+	if err != nil {
+		return nil, err
+	}
+
+	stories, err := c.getWorkItems(ctx, settings, ids, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var taskIDs []int
+	for _, story := range stories {
+		if story.field("System.WorkItemType") != DefaultTaskType {
+			taskIDs = append(taskIDs, story.linked("System.LinkTypes.Hierarchy-Forward")...)
+		}
+	}
+	children, err := c.getWorkItems(ctx, settings, taskIDs, nil)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make(map[int]workItem, len(children))
+	for _, child := range children {
+		tasks[child.ID] = child
+	}
+
+	plan := &Plan{}
+	for _, story := range stories {
+		if story.field("System.WorkItemType") == DefaultTaskType {
+			continue
+		}
+
+		userStory := models.UserStory{
+			Name:        story.field("System.Title"),
+			Type:        exportType(story.field("System.WorkItemType"), DefaultUserStoryType),
+			Description: story.field("System.Description"),
+			Owner:       story.owner(),
+			State:       story.field("System.State"),
+			Priority:    story.priority(),
+			Area:        story.field("System.AreaPath"),
+			Tags:        exportTags(story.field("System.Tags")),
+		}
+		if iteration := story.field("System.IterationPath"); iteration != "" {
+			userStory.Iteraction = &iteration
+		}
+		if parents := story.linked("System.LinkTypes.Hierarchy-Reverse"); len(parents) > 0 {
+			userStory.Parent = parents[0]
+		}
+		for _, id := range story.linked("System.LinkTypes.Hierarchy-Forward") {
+			task, ok := tasks[id]
+			if !ok {
+				continue
+			}
+			userStory.Tasks = append(userStory.Tasks, models.Task{
+				Name:        task.field("System.Title"),
+				Type:        exportType(task.field("System.WorkItemType"), DefaultTaskType),
+				Description: task.field("System.Description"),
+				Owner:       task.owner(),
+				State:       task.field("System.State"),
+				Priority:    task.priority(),
+				Tags:        exportTags(task.field("System.Tags")),
+			})
+		}
+
+		plan.Items = append(plan.Items, userStory)
+	}
+
+	return plan, nil
+}
+
+// exportType returns the type of an exported work item, or none for the
+// default type of its level
+func exportType(workItemType, defaultType string) string {
+	if workItemType == defaultType {
+		return ""
+	}
+
+	return workItemType
+}
+
+// getWorkItems reads work items in the order of ids, with the given fields
+// or, when fields is nil, with all fields and links. Deleted work items are
+// left out.
+func (c *Client) getWorkItems(ctx context.Context, settings models.AdoSettings, ids []int, fields []string) ([]workItem, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workitemsbatch?api-version=7.0", settings.Organization, settings.Project)
+
+	workItems := make([]workItem, 0, len(ids))
+	for start := 0; start < len(ids); start += workItemsBatchSize {
+		batch := ids[start:min(start+workItemsBatchSize, len(ids))]
+
+		request := map[string]any{
+			"ids":         batch,
+			"errorPolicy": "omit",
+		}
+		// Azure DevOps rejects fields combined with $expand
+		if fields != nil {
+			request["fields"] = fields
+		} else {
+			request["$expand"] = "relations"
+		}
+		payloadBytes, err := json.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+
+		resp, err := c.do(ctx, settings, "POST", url, "application/json", payloadBytes, http.StatusOK)
+		if err != nil {
+			return nil, &WorkItemError{Op: "read", Type: "work items", Err: err}
+		}
+
+		var responseBody struct {
+			Value []*workItem `json:"value"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&responseBody)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		// Omitted work items are returned as null
+		for _, item := range responseBody.Value {
+			if item != nil {
+				workItems = append(workItems, *item)
+			}
+		}
+	}
+
+	return workItems, nil
+}
+
+// field returns a string field of the work item, or "" when it is not set
+func (w workItem) field(name string) string {
+	value, _ := w.Fields[name].(string)
+	return value
+}
+
+// owner returns the unique name of the identity the work item is assigned to
+func (w workItem) owner() string {
+	identity, _ := w.Fields["System.AssignedTo"].(map[string]any)
+	owner, _ := identity["uniqueName"].(string)
+	return owner
+}
+
+// priority returns the priority of the work item, JSON numbers are decoded
+// as float64
+func (w workItem) priority() models.Priority {
+	priority, _ := w.Fields["Microsoft.VSTS.Common.Priority"].(float64)
+	return models.Priority(priority)
+}
+
+// linked returns the IDs of the work items linked with the given relation
+func (w workItem) linked(rel string) []int {
+	var ids []int
+	for _, relation := range w.Relations {
+		if relation.Rel != rel {
+			continue
+		}
+		if id, err := strconv.Atoi(relation.URL[strings.LastIndex(relation.URL, "/")+1:]); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
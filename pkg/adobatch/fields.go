@@ -0,0 +1,177 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// FieldError is returned when a field name does not match exactly one field
+// of the project
+type FieldError struct {
+	Name string
+	// Candidates are the fields matching an ambiguous name
+	Candidates []Field
+	// Suggestions are the fields closest to a name that is not found,
+	// closest first
+	Suggestions []Field
+}
+
+func (e *FieldError) Error() string {
+	if len(e.Candidates) == 0 {
+		if len(e.Suggestions) > 0 {
+			return fmt.Sprintf("field %q not found, did you mean %s?", e.Name, fieldNames(e.Suggestions, " or "))
+		}
+		return fmt.Sprintf("field %q not found, see `list fields`", e.Name)
+	}
+
+	return fmt.Sprintf("field %q is ambiguous, matches %s", e.Name, fieldNames(e.Candidates, ", "))
+}
+
+func fieldNames(fields []Field, sep string) string {
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, fmt.Sprintf("%q (%s)", field.Name, field.ReferenceName))
+	}
+
+	return strings.Join(names, sep)
+}
+
+// Unwrap matches ErrValidation
+func (e *FieldError) Unwrap() error {
+	return ErrValidation
+}
+
+// ResolveField returns the reference name of a field of the project from its
+// reference name, such as Custom.CostCenter, or its name, such as
+// "Cost Center", ignoring case. Read-only fields are rejected.
+func ResolveField(fields []Field, name string) (string, error) {
+	trimmed := strings.TrimSpace(name)
+	var candidates []Field
+	for _, field := range fields {
+		if strings.EqualFold(field.ReferenceName, trimmed) {
+			candidates = []Field{field}
+			break
+		}
+		if strings.EqualFold(field.Name, trimmed) {
+			candidates = append(candidates, field)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", &FieldError{Name: name, Suggestions: SuggestFields(name, fields)}
+	case 1:
+		if candidates[0].ReadOnly {
+			return "", fmt.Errorf("field %q (%s) is read-only: %w", name, candidates[0].ReferenceName, ErrValidation)
+		}
+		return candidates[0].ReferenceName, nil
+	}
+
+	return "", &FieldError{Name: name, Candidates: candidates}
+}
+
+// SuggestFields returns the fields whose name or reference name is closest to
+// a name, like SuggestIdentities
+func SuggestFields(name string, fields []Field) []Field {
+	return closest(name, fields, func(field Field) []string {
+		return []string{field.Name, field.ReferenceName}
+	})
+}
+
+// ResolveFields replaces the names of the fields set by the user stories and
+// tasks with their reference names. The fields are read once per project,
+// and only for the projects of items that set fields. Every name that matches
+// no field, or several, is joined in the error.
+func (c *Client) ResolveFields(ctx context.Context, plan *Plan) error {
+	projects := map[[2]string][]Field{}
+	var errs []error
+	for i := range plan.Items {
+		userStory := &plan.Items[i]
+		if !setsFields(*userStory) {
+			continue
+		}
+
+		settings := c.SettingsFor(*userStory)
+		key := [2]string{strings.ToLower(settings.Organization), strings.ToLower(settings.Project)}
+		fields, ok := projects[key]
+		if !ok {
+			var err error
+			if fields, err = c.Fields(ctx, settings); err != nil {
+				return &WorkItemError{Op: "read", Type: "fields", Err: err}
+			}
+			projects[key] = fields
+		}
+
+		var itemErrs []error
+		userStory.Fields, itemErrs = resolveFields(fields, userStory.Name, userStory.Fields)
+		errs = append(errs, itemErrs...)
+		for j := range userStory.Tasks {
+			task := &userStory.Tasks[j]
+			task.Fields, itemErrs = resolveFields(fields, task.Name, task.Fields)
+			errs = append(errs, itemErrs...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setsFields reports whether a user story or one of its tasks sets fields
+func setsFields(userStory models.UserStory) bool {
+	if len(userStory.Fields) > 0 {
+		return true
+	}
+	for _, task := range userStory.Tasks {
+		if len(task.Fields) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveFields returns the values of the fields of an item by reference name
+func resolveFields(fields []Field, item string, values map[string]any) (map[string]any, []error) {
+	if len(values) == 0 {
+		return values, nil
+	}
+
+	resolved := make(map[string]any, len(values))
+	names := map[string]string{}
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		referenceName, err := ResolveField(fields, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%q: %w", item, err))
+			continue
+		}
+		if previous, ok := names[referenceName]; ok {
+			errs = append(errs, fmt.Errorf("%q: fields %q and %q are both %s: %w", item, previous, name, referenceName, ErrValidation))
+			continue
+		}
+		names[referenceName] = name
+		resolved[referenceName] = values[name]
+	}
+
+	return resolved, errs
+}
+
+// fieldOperations returns the JSON patch operations setting fields, by
+// reference name
+func fieldOperations(values map[string]any) []map[string]interface{} {
+	operations := make([]map[string]interface{}, 0, len(values))
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		operations = append(operations, map[string]interface{}{
+			"op":    "add",
+			"path":  "/fields/" + name,
+			"value": values[name],
+		})
+	}
+
+	return operations
+}
@@ -0,0 +1,419 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// linkTypes map the link types of items files to their reference names
+var linkTypes = map[string]string{
+	"related":     "System.LinkTypes.Related",
+	"predecessor": "System.LinkTypes.Dependency-Reverse",
+	"successor":   "System.LinkTypes.Dependency-Forward",
+}
+
+// linkType returns the reference name of a link type, the reference names of
+// other link types being used as is
+func linkType(name string) (string, bool) {
+	if rel, ok := linkTypes[strings.ToLower(name)]; ok {
+		return rel, true
+	}
+
+	return name, strings.Contains(name, ".")
+}
+
+// CheckLinks returns a *PlanError when keys are repeated, or a link has an
+// unknown type or does not target exactly one key of the plan or work item ID
+func (p *Plan) CheckLinks() error {
+	var errs []error
+	keys := map[string]string{}
+	addKey := func(item, key string) {
+		if key == "" {
+			return
+		}
+		if previous, ok := keys[key]; ok {
+			errs = append(errs, fmt.Errorf("%s: key %q already used by %s", item, key, previous))
+			return
+		}
+		keys[key] = item
+	}
+	for i, userStory := range p.Items {
+		addKey(fmt.Sprintf("items[%d]", i), userStory.Key)
+		for j, task := range userStory.Tasks {
+			addKey(fmt.Sprintf("items[%d].tasks[%d]", i, j), task.Key)
+		}
+	}
+
+	check := func(item string, links []models.Link) {
+		for k, link := range links {
+			item := fmt.Sprintf("%s.links[%d]", item, k)
+			if _, ok := linkType(link.Type); !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown link type %q, expected related, predecessor, successor or a reference name", item, link.Type))
+			}
+			switch {
+			case (link.Key == "") == (link.ID == 0):
+				errs = append(errs, fmt.Errorf("%s: set either key or id", item))
+			case link.Key != "" && keys[link.Key] == "":
+				errs = append(errs, fmt.Errorf("%s: unknown key %q", item, link.Key))
+			}
+		}
+	}
+	for i, userStory := range p.Items {
+		check(fmt.Sprintf("items[%d]", i), userStory.Links)
+		for j, task := range userStory.Tasks {
+			check(fmt.Sprintf("items[%d].tasks[%d]", i, j), task.Links)
+		}
+	}
+	if len(errs) > 0 {
+		return &PlanError{Err: errors.Join(errs...)}
+	}
+
+	return nil
+}
+
+// FollowUp is an update of a work item of the run, applied once every work
+// item is created
+type FollowUp struct {
+	Settings models.AdoSettings
+	ID       int
+	// Item is the name of the user story or task, for errors
+	Item       string
+	Operations []map[string]interface{}
+}
+
+// MaxBatchSize is the maximum number of work items updated by a request
+const MaxBatchSize = 200
+
+// UpdateWorkItems applies updates to work items of an organization, in
+// batches of BatchSize. Every update that fails is reported, joined in the
+// error.
+func (c *Client) UpdateWorkItems(ctx context.Context, settings models.AdoSettings, updates []FollowUp) error {
+	// The batch endpoint is only documented in version 4.1
+	url := fmt.Sprintf("https://dev.azure.com/%s/_apis/wit/$batch?api-version=4.1", settings.Organization)
+
+	size := c.BatchSize
+	if size <= 0 || size > MaxBatchSize {
+		size = MaxBatchSize
+	}
+
+	var errs []error
+	for start := 0; start < len(updates); start += size {
+		batch := updates[start:min(start+size, len(updates))]
+
+		requests := make([]map[string]any, 0, len(batch))
+		for _, update := range batch {
+			requests = append(requests, map[string]any{
+				"method":  "PATCH",
+				"uri":     fmt.Sprintf("/_apis/wit/workitems/%d?api-version=4.1", update.ID),
+				"headers": map[string]string{"Content-Type": "application/json-patch+json"},
+				"body":    update.Operations,
+			})
+		}
+		payloadBytes, err := json.Marshal(requests)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+
+		c.Logger.Debug("Work item batch payload", zap.Int("updates", len(batch)), zap.ByteString("payload", payloadBytes))
+
+		resp, err := c.do(ctx, settings, "POST", url, "application/json", payloadBytes, http.StatusOK)
+		if err != nil {
+			return &WorkItemError{Op: "update", Type: "work items", Err: err}
+		}
+		var response struct {
+			Value []struct {
+				Code int    `json:"code"`
+				Body string `json:"body"`
+			} `json:"value"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		for i, update := range batch {
+			if i < len(response.Value) && response.Value[i].Code == http.StatusOK {
+				continue
+			}
+			// Only the operations of the failed work item, not the whole batch
+			operations, _ := json.Marshal(update.Operations)
+			apiErr := &APIError{Status: "no response", Payload: operations}
+			if i < len(response.Value) {
+				apiErr.StatusCode = response.Value[i].Code
+				apiErr.Status = fmt.Sprintf("%d %s", apiErr.StatusCode, http.StatusText(apiErr.StatusCode))
+				var body struct {
+					Message string `json:"message"`
+				}
+				if json.Unmarshal([]byte(response.Value[i].Body), &body) == nil {
+					apiErr.Message = body.Message
+				}
+			}
+			errs = append(errs, &WorkItemError{Op: "update", Type: fmt.Sprintf("%q (%d)", update.Item, update.ID), Err: apiErr})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Board is the board of a team showing a work item type
+type Board struct {
+	// ColumnField holds the board column of the work items
+	ColumnField string
+	Columns     []string
+	// RowField holds the swimlane of the work items
+	RowField string
+	// Rows are the swimlanes of the board, but the default one
+	Rows []string
+}
+
+// TeamBoard returns the board of a team, or of the default team when team is
+// empty, showing a work item type
+func (c *Client) TeamBoard(ctx context.Context, settings models.AdoSettings, team, workItemType string) (Board, error) {
+	teamSegment := ""
+	if team != "" {
+		teamSegment = "/" + url.PathEscape(team)
+	}
+	boardsURL := fmt.Sprintf("https://dev.azure.com/%s/%s%s/_apis/work/boards?api-version=7.0", settings.Organization, url.PathEscape(settings.Project), teamSegment)
+	var boards struct {
+		Value []struct {
+			ID string `json:"id"`
+		} `json:"value"`
+	}
+	if err := c.get(ctx, settings, boardsURL, &boards); err != nil {
+		return Board{}, &WorkItemError{Op: "read", Type: "boards", Err: err}
+	}
+
+	for _, board := range boards.Value {
+		boardURL := fmt.Sprintf("https://dev.azure.com/%s/%s%s/_apis/work/boards/%s?api-version=7.0", settings.Organization, url.PathEscape(settings.Project), teamSegment, board.ID)
+		var response struct {
+			Columns []struct {
+				Name          string            `json:"name"`
+				StateMappings map[string]string `json:"stateMappings"`
+			} `json:"columns"`
+			// The default swimlane has no name
+			Rows []struct {
+				Name string `json:"name"`
+			} `json:"rows"`
+			Fields struct {
+				ColumnField struct {
+					ReferenceName string `json:"referenceName"`
+				} `json:"columnField"`
+				RowField struct {
+					ReferenceName string `json:"referenceName"`
+				} `json:"rowField"`
+			} `json:"fields"`
+		}
+		if err := c.get(ctx, settings, boardURL, &response); err != nil {
+			return Board{}, &WorkItemError{Op: "read", Type: "board", Err: err}
+		}
+
+		board := Board{ColumnField: response.Fields.ColumnField.ReferenceName, RowField: response.Fields.RowField.ReferenceName}
+		found := false
+		for _, column := range response.Columns {
+			board.Columns = append(board.Columns, column.Name)
+			if _, ok := column.StateMappings[workItemType]; ok {
+				found = true
+			}
+		}
+		for _, row := range response.Rows {
+			if row.Name != "" {
+				board.Rows = append(board.Rows, row.Name)
+			}
+		}
+		if found {
+			return board, nil
+		}
+	}
+
+	if team == "" {
+		team = "the default team"
+	}
+	return Board{}, fmt.Errorf("no board of %s shows %s: %w", team, workItemType, ErrValidation)
+}
+
+// FollowUps returns the updates of the work items created by a run that need
+// every work item created: the order field, the board columns and swimlanes
+// of the user stories and the links between items. Updates of the same work item are
+// merged. Failures, such as a link to an item that was not created, are
+// joined in the error, the other updates being returned.
+func (c *Client) FollowUps(ctx context.Context, items []Result, options Options) ([]FollowUp, error) {
+	type target struct {
+		settings models.AdoSettings
+		id       int
+	}
+	keys := map[string]target{}
+	for _, result := range items {
+		settings := c.SettingsFor(result.Item)
+		if result.Item.Key != "" && result.ID != 0 {
+			keys[result.Item.Key] = target{settings, result.ID}
+		}
+		for _, task := range result.Tasks {
+			if task.Item.Key != "" && task.ID != 0 {
+				keys[task.Item.Key] = target{settings, task.ID}
+			}
+		}
+	}
+
+	// Work item IDs are only unique in their organization, and a plan can
+	// span several
+	type workItem struct {
+		organization, project string
+		id                    int
+	}
+	var followUps []FollowUp
+	index := map[workItem]int{}
+	add := func(settings models.AdoSettings, id int, item string, operation map[string]interface{}) {
+		key := workItem{strings.ToLower(settings.Organization), strings.ToLower(settings.Project), id}
+		if i, ok := index[key]; ok {
+			followUps[i].Operations = append(followUps[i].Operations, operation)
+			return
+		}
+		index[key] = len(followUps)
+		followUps = append(followUps, FollowUp{Settings: settings, ID: id, Item: item, Operations: []map[string]interface{}{operation}})
+	}
+	field := func(name string, value any) map[string]interface{} {
+		return map[string]interface{}{"op": "add", "path": "/fields/" + name, "value": value}
+	}
+
+	var errs []error
+	links := func(settings models.AdoSettings, id int, item string, itemLinks []models.Link) {
+		for _, link := range itemLinks {
+			rel, _ := linkType(link.Type)
+			organization, targetID := settings.Organization, link.ID
+			if link.Key != "" {
+				linked, ok := keys[link.Key]
+				if !ok {
+					errs = append(errs, fmt.Errorf("failed to link %q to %q: it was not created", item, link.Key))
+					continue
+				}
+				organization, targetID = linked.settings.Organization, linked.id
+			}
+			add(settings, id, item, map[string]interface{}{
+				"op":    "add",
+				"path":  "/relations/-",
+				"value": map[string]interface{}{"rel": rel, "url": WorkItemAPIURL(organization, targetID)},
+			})
+		}
+	}
+
+	// Boards are read once per project, team and work item type
+	type board struct {
+		Board
+		err error
+	}
+	boards := map[[3]string]board{}
+	// The order field follows the ranks, then the order of the plan
+	order := map[int]int{}
+	if options.OrderField != "" {
+		ranked, tasks := rankedResults(items)
+		for _, result := range ranked {
+			order[result.ID] = len(order) + 1
+			for _, id := range tasks[result.ID] {
+				order[id] = len(order) + 1
+			}
+		}
+	}
+	for _, result := range items {
+		if result.Status != models.StatusCreated {
+			continue
+		}
+		userStory := result.Item
+		settings := c.SettingsFor(userStory)
+
+		if order[result.ID] != 0 {
+			add(settings, result.ID, userStory.Name, field(options.OrderField, order[result.ID]))
+		}
+		lane := userStory.Lane
+		if lane == "" {
+			lane = options.Lane
+		}
+		if userStory.Column != "" || lane != "" {
+			key := [3]string{strings.ToLower(settings.Organization + "/" + settings.Project), strings.ToLower(userStory.Team), strings.ToLower(UserStoryType(userStory))}
+			b, ok := boards[key]
+			if !ok {
+				b.Board, b.err = c.TeamBoard(ctx, settings, userStory.Team, UserStoryType(userStory))
+				boards[key] = b
+			}
+			switch {
+			case b.err != nil:
+				errs = append(errs, fmt.Errorf("failed to move %q on the board: %w", userStory.Name, b.err))
+			case userStory.Column != "" && !containsFold(b.Columns, userStory.Column):
+				errs = append(errs, fmt.Errorf("failed to move %q to its column: %q is not a column of the board, expected one of %s: %w", userStory.Name, userStory.Column, strings.Join(b.Columns, ", "), ErrValidation))
+			case lane != "" && !containsFold(b.Rows, lane):
+				errs = append(errs, fmt.Errorf("failed to move %q to its swimlane: %q is not a swimlane of the board, expected one of %s: %w", userStory.Name, lane, strings.Join(b.Rows, ", "), ErrValidation))
+			default:
+				if userStory.Column != "" {
+					add(settings, result.ID, userStory.Name, field(b.ColumnField, userStory.Column))
+				}
+				if lane != "" {
+					add(settings, result.ID, userStory.Name, field(b.RowField, lane))
+				}
+			}
+		}
+		links(settings, result.ID, userStory.Name, userStory.Links)
+
+		for _, task := range result.Tasks {
+			if task.Status != models.StatusCreated {
+				continue
+			}
+			if order[task.ID] != 0 {
+				add(settings, task.ID, task.Item.Name, field(options.OrderField, order[task.ID]))
+			}
+			links(settings, task.ID, task.Item.Name, task.Item.Links)
+		}
+	}
+
+	return followUps, errors.Join(errs...)
+}
+
+// applyFollowUps updates the work items created by a run once every work
+// item is created, batching the updates of every organization. Failures are
+// recorded in the outcome of the run, the work items staying created.
+func (c *Client) applyFollowUps(ctx context.Context, items []Result, options Options, outcome *Outcome) {
+	followUps, err := c.FollowUps(ctx, items, options)
+	if err != nil {
+		c.Logger.Error("Failed to prepare follow-up updates", zap.Error(err))
+		outcome.Record(err)
+	}
+	if len(followUps) == 0 {
+		return
+	}
+
+	var organizations []string
+	byOrganization := map[string][]FollowUp{}
+	for _, followUp := range followUps {
+		organization := strings.ToLower(followUp.Settings.Organization)
+		if _, ok := byOrganization[organization]; !ok {
+			organizations = append(organizations, organization)
+		}
+		byOrganization[organization] = append(byOrganization[organization], followUp)
+	}
+	for _, organization := range organizations {
+		updates := byOrganization[organization]
+		if err := c.UpdateWorkItems(ctx, updates[0].Settings, updates); err != nil {
+			c.Logger.Error("Failed to apply follow-up updates", zap.String("organization", organization), zap.Error(err))
+			outcome.Record(err)
+			continue
+		}
+		c.Logger.Info("Applied follow-up updates", zap.String("organization", organization), zap.Int("work_items", len(updates)))
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,64 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+)
+
+func TestFollowUpsOrganizations(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	items := []Result{
+		{Item: models.UserStory{Name: "US1"}, ID: 1, Status: models.StatusCreated},
+		{Item: models.UserStory{Name: "US2", Organization: "other"}, ID: 1, Status: models.StatusCreated},
+	}
+	followUps, err := client.FollowUps(context.Background(), items, Options{OrderField: "Microsoft.VSTS.Common.StackRank"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followUps) != 2 {
+		t.Fatalf("%d follow-ups, want one per organization", len(followUps))
+	}
+	for i, followUp := range followUps {
+		if followUp.Item != items[i].Item.Name || len(followUp.Operations) != 1 {
+			t.Errorf("follow-up %d = %s with %d operations, want %s with 1", i, followUp.Item, len(followUp.Operations), items[i].Item.Name)
+		}
+	}
+}
+
+func TestUpdateWorkItemsErrors(t *testing.T) {
+	client, server := newTestClient(t)
+	server.AddRule(adotest.Rule{Path: "/_apis/wit/$batch", Status: http.StatusOK, Body: map[string]any{
+		"value": []map[string]any{
+			{"code": http.StatusOK, "body": "{}"},
+			{"code": http.StatusBadRequest, "body": `{"message":"invalid field"}`},
+		},
+	}})
+
+	operation := func(value int) []map[string]interface{} {
+		return []map[string]interface{}{{"op": "add", "path": "/fields/Microsoft.VSTS.Common.StackRank", "value": value}}
+	}
+	updates := []FollowUp{
+		{Settings: client.Settings, ID: 1, Item: "US1", Operations: operation(1)},
+		{Settings: client.Settings, ID: 2, Item: "US2", Operations: operation(2)},
+	}
+	err := client.UpdateWorkItems(context.Background(), client.Settings, updates)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want an API error", err)
+	}
+	if !errors.Is(err, ErrValidation) || apiErr.Message != "invalid field" {
+		t.Errorf("error = %v, want the invalid field", err)
+	}
+	want, _ := json.Marshal(updates[1].Operations)
+	if string(apiErr.Payload) != string(want) {
+		t.Errorf("payload = %s, want the operations of US2 %s", apiErr.Payload, want)
+	}
+}
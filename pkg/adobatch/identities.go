@@ -0,0 +1,254 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// OwnerError is returned when an owner does not match exactly one identity
+// of the organization
+type OwnerError struct {
+	Owner string
+	// Candidates are the identities matching an ambiguous owner
+	Candidates []Identity
+	// Suggestions are the identities closest to an owner that is not found,
+	// closest first
+	Suggestions []Identity
+}
+
+func (e *OwnerError) Error() string {
+	if len(e.Candidates) == 0 {
+		if len(e.Suggestions) > 0 {
+			return fmt.Sprintf("owner %q not found, did you mean %s?", e.Owner, uniqueNames(e.Suggestions, " or "))
+		}
+		return fmt.Sprintf("owner %q not found", e.Owner)
+	}
+
+	return fmt.Sprintf("owner %q is ambiguous, matches %s", e.Owner, uniqueNames(e.Candidates, ", "))
+}
+
+func uniqueNames(identities []Identity, sep string) string {
+	names := make([]string, 0, len(identities))
+	for _, identity := range identities {
+		names = append(names, identity.UniqueName)
+	}
+
+	return strings.Join(names, sep)
+}
+
+// Unwrap matches ErrValidation
+func (e *OwnerError) Unwrap() error {
+	return ErrValidation
+}
+
+// SearchIdentities returns the active identities of the organization whose
+// display name, email or unique name match name
+func (c *Client) SearchIdentities(ctx context.Context, settings models.AdoSettings, name string) ([]Identity, error) {
+	url := fmt.Sprintf("https://vssps.dev.azure.com/%s/_apis/identities?searchFilter=General&filterValue=%s&queryMembership=None&api-version=7.0", settings.Organization, url.QueryEscape(name))
+	var response struct {
+		Value []struct {
+			ProviderDisplayName string `json:"providerDisplayName"`
+			IsActive            bool   `json:"isActive"`
+			Properties          map[string]struct {
+				Value any `json:"$value"`
+			} `json:"properties"`
+		} `json:"value"`
+	}
+	if err := c.get(ctx, settings, url, &response); err != nil {
+		return nil, &WorkItemError{Op: "resolve", Type: "owner " + name, Err: err}
+	}
+
+	identities := make([]Identity, 0, len(response.Value))
+	for _, value := range response.Value {
+		account, _ := value.Properties["Account"].Value.(string)
+		if !value.IsActive || account == "" {
+			continue
+		}
+		identities = append(identities, Identity{DisplayName: value.ProviderDisplayName, UniqueName: account})
+	}
+
+	return identities, nil
+}
+
+// ResolveIdentity returns the identity an owner refers to, given as display
+// name, email or unique name. An owner matching several identities resolves
+// to the one matching it exactly. An owner that is not found is searched
+// again by its first name, and the closest identities are suggested in the
+// OwnerError; with fuzzy, a single suggestion is returned instead.
+func (c *Client) ResolveIdentity(ctx context.Context, settings models.AdoSettings, owner string, fuzzy bool) (Identity, error) {
+	identities, err := c.SearchIdentities(ctx, settings, owner)
+	if err != nil {
+		return Identity{}, err
+	}
+	if len(identities) == 1 {
+		return identities[0], nil
+	}
+	if len(identities) == 0 {
+		return c.suggestIdentity(ctx, settings, owner, fuzzy)
+	}
+
+	var exact []Identity
+	for _, identity := range identities {
+		if strings.EqualFold(identity.UniqueName, owner) || strings.EqualFold(identity.DisplayName, owner) {
+			exact = append(exact, identity)
+		}
+	}
+	if len(exact) == 1 {
+		return exact[0], nil
+	}
+
+	return Identity{}, &OwnerError{Owner: owner, Candidates: identities}
+}
+
+// suggestIdentity searches the identities sharing the first name of an owner
+// that is not found, for typos further in the name
+func (c *Client) suggestIdentity(ctx context.Context, settings models.AdoSettings, owner string, fuzzy bool) (Identity, error) {
+	ownerErr := &OwnerError{Owner: owner}
+	prefix := strings.FieldsFunc(owner, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	if len(prefix) == 0 || prefix[0] == owner {
+		return Identity{}, ownerErr
+	}
+
+	identities, err := c.SearchIdentities(ctx, settings, prefix[0])
+	if err != nil {
+		return Identity{}, err
+	}
+	ownerErr.Suggestions = SuggestIdentities(owner, identities)
+	if fuzzy && len(ownerErr.Suggestions) == 1 {
+		c.Logger.Warn("Owner not found, using the closest identity", zap.String("owner", owner), zap.String("identity", ownerErr.Suggestions[0].UniqueName))
+		return ownerErr.Suggestions[0], nil
+	}
+
+	return Identity{}, ownerErr
+}
+
+// maxSuggestions is the number of identities suggested for an owner
+const maxSuggestions = 3
+
+// SuggestIdentities returns the identities closest to an owner that matches
+// none exactly, closest first. An identity is suggested when its unique name,
+// the user part of it, or its display name is within a few typos of the
+// owner; only the identities at the smallest distance are returned.
+func SuggestIdentities(owner string, identities []Identity) []Identity {
+	return closest(owner, identities, func(identity Identity) []string {
+		user, _, _ := strings.Cut(identity.UniqueName, "@")
+		return []string{identity.UniqueName, user, identity.DisplayName}
+	})
+}
+
+// closest returns the values with a key closest to name, ignoring case,
+// closest first. Only the values at the smallest distance are returned.
+func closest[T any](name string, values []T, keys func(T) []string) []T {
+	name = strings.ToLower(strings.TrimSpace(name))
+	// A third of the name may be mistyped, but not a short name entirely
+	maxDistance := max(1, len([]rune(name))/3)
+
+	type suggestion struct {
+		value    T
+		distance int
+	}
+	var suggestions []suggestion
+	for _, value := range values {
+		distance := -1
+		for _, key := range keys(value) {
+			if d := editDistance(name, strings.ToLower(key)); distance < 0 || d < distance {
+				distance = d
+			}
+		}
+		if distance >= 0 && distance <= maxDistance {
+			suggestions = append(suggestions, suggestion{value, distance})
+		}
+	}
+	if len(suggestions) == 0 {
+		return nil
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].distance < suggestions[j].distance })
+
+	nearest := []T{}
+	for _, s := range suggestions {
+		if s.distance > suggestions[0].distance || len(nearest) == maxSuggestions {
+			break
+		}
+		nearest = append(nearest, s.value)
+	}
+
+	return nearest
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+// ResolveOwners replaces the owners of the user stories and tasks of the plan
+// with the unique names of their identities, see ResolveIdentity. Every owner
+// that cannot be resolved is reported, joined in the error, and the plan is
+// left unchanged.
+func (c *Client) ResolveOwners(ctx context.Context, plan *Plan, fuzzy bool) error {
+	// Owners are resolved once per organization
+	resolved := map[[2]string]string{}
+	var errs []error
+	resolve := func(settings models.AdoSettings, owner string) {
+		key := [2]string{strings.ToLower(settings.Organization), owner}
+		if _, ok := resolved[key]; owner == "" || ok {
+			return
+		}
+		identity, err := c.ResolveIdentity(ctx, settings, owner, fuzzy)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		resolved[key] = identity.UniqueName
+	}
+
+	for _, userStory := range plan.Items {
+		settings := c.SettingsFor(userStory)
+		resolve(settings, userStory.Owner)
+		for _, task := range userStory.Tasks {
+			resolve(settings, task.Owner)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for i := range plan.Items {
+		userStory := &plan.Items[i]
+		organization := strings.ToLower(c.SettingsFor(*userStory).Organization)
+		if userStory.Owner != "" {
+			userStory.Owner = resolved[[2]string{organization, userStory.Owner}]
+		}
+		for j := range userStory.Tasks {
+			if task := &userStory.Tasks[j]; task.Owner != "" {
+				task.Owner = resolved[[2]string{organization, task.Owner}]
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package adobatch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// CurrentIteration is the iteration value resolved to the iteration of the
+// team in progress at the time of the run
+const CurrentIteration = "@current"
+
+// CurrentIteration returns the iteration in progress of a team of the project,
+// or of its default team when team is empty
+func (c *Client) CurrentIteration(ctx context.Context, settings models.AdoSettings, team string) (ClassificationNode, error) {
+	iterations, err := c.teamIterations(ctx, settings, team, "current")
+	if err != nil {
+		return ClassificationNode{}, &WorkItemError{Op: "read", Type: "current iteration", Err: err}
+	}
+	if len(iterations) == 0 {
+		return ClassificationNode{}, fmt.Errorf("no current iteration in %s, set the dates of its iterations: %w", settings.Project, ErrValidation)
+	}
+
+	return iterations[0], nil
+}
+
+// NextIteration returns the iteration of a team of the project, or of its
+// default team when team is empty, starting first after the iteration in
+// progress
+func (c *Client) NextIteration(ctx context.Context, settings models.AdoSettings, team string) (ClassificationNode, error) {
+	iterations, err := c.teamIterations(ctx, settings, team, "future")
+	if err != nil {
+		return ClassificationNode{}, &WorkItemError{Op: "read", Type: "next iteration", Err: err}
+	}
+	if len(iterations) == 0 {
+		return ClassificationNode{}, fmt.Errorf("no iteration after the current one in %s, add it to the iterations of the team: %w", settings.Project, ErrValidation)
+	}
+	sort.SliceStable(iterations, func(i, j int) bool {
+		a, b := iterations[i].StartDate, iterations[j].StartDate
+		return a != nil && (b == nil || a.Before(*b))
+	})
+
+	return iterations[0], nil
+}
+
+// teamIterations returns the iterations of a team in a timeframe, past,
+// current or future, or every iteration of the team when timeframe is empty
+func (c *Client) teamIterations(ctx context.Context, settings models.AdoSettings, team, timeframe string) ([]ClassificationNode, error) {
+	teamSegment := ""
+	if team != "" {
+		teamSegment = "/" + url.PathEscape(team)
+	}
+	query := "api-version=7.0"
+	if timeframe != "" {
+		query = "$timeframe=" + timeframe + "&" + query
+	}
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s%s/_apis/work/teamsettings/iterations?%s", settings.Organization, url.PathEscape(settings.Project), teamSegment, query)
+	var response struct {
+		Value []struct {
+			ID         string `json:"id"`
+			Name       string `json:"name"`
+			Path       string `json:"path"`
+			Attributes struct {
+				StartDate  *time.Time `json:"startDate"`
+				FinishDate *time.Time `json:"finishDate"`
+			} `json:"attributes"`
+		} `json:"value"`
+	}
+	if err := c.get(ctx, settings, url, &response); err != nil {
+		return nil, err
+	}
+
+	iterations := make([]ClassificationNode, 0, len(response.Value))
+	for _, iteration := range response.Value {
+		iterations = append(iterations, ClassificationNode{
+			ID:         iteration.ID,
+			Name:       iteration.Name,
+			Path:       iteration.Path,
+			StartDate:  iteration.Attributes.StartDate,
+			FinishDate: iteration.Attributes.FinishDate,
+		})
+	}
+
+	return iterations, nil
+}
+
+// TeamArea is an area path of the work items of a team
+type TeamArea struct {
+	Path string `json:"value"`
+	// IncludeChildren includes the work items of the areas under Path
+	IncludeChildren bool `json:"includeChildren"`
+}
+
+// TeamAreas returns the area paths of a team of the project, or of its default
+// team when team is empty
+func (c *Client) TeamAreas(ctx context.Context, settings models.AdoSettings, team string) ([]TeamArea, error) {
+	teamSegment := ""
+	if team != "" {
+		teamSegment = "/" + url.PathEscape(team)
+	}
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s%s/_apis/work/teamsettings/teamfieldvalues?api-version=7.0", settings.Organization, url.PathEscape(settings.Project), teamSegment)
+	var response struct {
+		Field struct {
+			ReferenceName string `json:"referenceName"`
+		} `json:"field"`
+		Values []TeamArea `json:"values"`
+	}
+	if err := c.get(ctx, settings, url, &response); err != nil {
+		return nil, &WorkItemError{Op: "read", Type: "team areas", Err: err}
+	}
+	if response.Field.ReferenceName != "" && response.Field.ReferenceName != "System.AreaPath" {
+		return nil, fmt.Errorf("the team field of the project is %s, not the area path: %w", response.Field.ReferenceName, ErrValidation)
+	}
+
+	return response.Values, nil
+}
+
+// ResolveIterations sets the iteration of the user stories without one to
+// iteration, when set, and replaces "@current" with the iteration in progress
+// of the team of the user story, or the default team of its project
+func (c *Client) ResolveIterations(ctx context.Context, plan *Plan, iteration string) error {
+	// Current iterations are read once per project and team
+	current := map[[3]string]string{}
+	for i := range plan.Items {
+		userStory := &plan.Items[i]
+		if userStory.Iteraction == nil && iteration != "" {
+			userStory.Iteraction = &iteration
+		}
+		if userStory.Iteraction == nil || !strings.EqualFold(*userStory.Iteraction, CurrentIteration) {
+			continue
+		}
+
+		settings := c.SettingsFor(*userStory)
+		key := [3]string{strings.ToLower(settings.Organization), strings.ToLower(settings.Project), strings.ToLower(userStory.Team)}
+		if _, ok := current[key]; !ok {
+			node, err := c.CurrentIteration(ctx, settings, userStory.Team)
+			if err != nil {
+				return err
+			}
+			current[key] = node.Path
+		}
+		path := current[key]
+		userStory.Iteraction = &path
+	}
+
+	return nil
+}
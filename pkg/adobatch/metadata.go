@@ -0,0 +1,293 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// teamsPageSize is the number of teams requested per page
+const teamsPageSize = 100
+
+// ClassificationNode is an area or iteration of a project
+type ClassificationNode struct {
+	// ID is only set on the iterations of a team
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	// Path is written as in items files, "project\area\child"
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+	// StartDate and FinishDate are only set on scheduled iterations
+	StartDate  *time.Time `json:"startDate,omitempty"`
+	FinishDate *time.Time `json:"finishDate,omitempty"`
+}
+
+// Team is a team of a project
+type Team struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// WorkItemType is a work item type of a project with its states
+type WorkItemType struct {
+	Name          string   `json:"name"`
+	ReferenceName string   `json:"referenceName"`
+	Description   string   `json:"description,omitempty"`
+	States        []string `json:"states"`
+	// Customization is "system", "inherited" or "custom" for the types of
+	// an inherited process, empty for other processes
+	Customization string `json:"customization,omitempty"`
+	Disabled      bool   `json:"disabled,omitempty"`
+}
+
+// Field is a work item field of a project
+type Field struct {
+	Name          string `json:"name"`
+	ReferenceName string `json:"referenceName"`
+	Type          string `json:"type"`
+	ReadOnly      bool   `json:"readOnly"`
+}
+
+// Areas returns the area tree of the project, depth first
+func (c *Client) Areas(ctx context.Context, settings models.AdoSettings) ([]ClassificationNode, error) {
+	return c.classificationNodes(ctx, settings, "areas")
+}
+
+// Iterations returns the iteration tree of the project, depth first
+func (c *Client) Iterations(ctx context.Context, settings models.AdoSettings) ([]ClassificationNode, error) {
+	return c.classificationNodes(ctx, settings, "iterations")
+}
+
+func (c *Client) classificationNodes(ctx context.Context, settings models.AdoSettings, group string) ([]ClassificationNode, error) {
+	type node struct {
+		Name       string `json:"name"`
+		Path       string `json:"path"`
+		Attributes struct {
+			StartDate  *time.Time `json:"startDate"`
+			FinishDate *time.Time `json:"finishDate"`
+		} `json:"attributes"`
+		Children []json.RawMessage `json:"children"`
+	}
+
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/classificationnodes/%s?$depth=100&api-version=7.0", settings.Organization, url.PathEscape(settings.Project), group)
+	var root json.RawMessage
+	if err := c.get(ctx, settings, url, &root); err != nil {
+		return nil, err
+	}
+
+	var nodes []ClassificationNode
+	var walk func(data json.RawMessage, depth int) error
+	walk = func(data json.RawMessage, depth int) error {
+		var n node
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		nodes = append(nodes, ClassificationNode{
+			Name:       n.Name,
+			Path:       classificationPath(n.Path),
+			Depth:      depth,
+			StartDate:  n.Attributes.StartDate,
+			FinishDate: n.Attributes.FinishDate,
+		})
+		for _, child := range n.Children {
+			if err := walk(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return nodes, walk(root, 0)
+}
+
+// classificationPath converts a node path, "\project\Area\child", to the
+// path used by work items, "project\child"
+func classificationPath(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, `\`), `\`)
+	if len(parts) > 1 {
+		parts = append(parts[:1], parts[2:]...)
+	}
+
+	return strings.Join(parts, `\`)
+}
+
+// Teams returns the teams of the project
+func (c *Client) Teams(ctx context.Context, settings models.AdoSettings) ([]Team, error) {
+	var teams []Team
+	for skip := 0; ; skip += teamsPageSize {
+		url := fmt.Sprintf("https://dev.azure.com/%s/_apis/projects/%s/teams?$top=%d&$skip=%d&api-version=7.0", settings.Organization, url.PathEscape(settings.Project), teamsPageSize, skip)
+		var page struct {
+			Value []Team `json:"value"`
+		}
+		if err := c.get(ctx, settings, url, &page); err != nil {
+			return nil, err
+		}
+		teams = append(teams, page.Value...)
+		if len(page.Value) < teamsPageSize {
+			return teams, nil
+		}
+	}
+}
+
+// WorkItemTypes returns the work item types of the project. The types of
+// an inherited process, such as a custom "Enabler", are completed with their
+// customization from the process, when it can be read.
+func (c *Client) WorkItemTypes(ctx context.Context, settings models.AdoSettings) ([]WorkItemType, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workitemtypes?api-version=7.0", settings.Organization, url.PathEscape(settings.Project))
+	var response struct {
+		Value []struct {
+			WorkItemType
+			States []struct {
+				Name string `json:"name"`
+			} `json:"states"`
+		} `json:"value"`
+	}
+	if err := c.get(ctx, settings, url, &response); err != nil {
+		return nil, err
+	}
+
+	types := make([]WorkItemType, 0, len(response.Value))
+	for _, value := range response.Value {
+		workItemType := value.WorkItemType
+		workItemType.States = make([]string, 0, len(value.States))
+		for _, state := range value.States {
+			workItemType.States = append(workItemType.States, state.Name)
+		}
+		types = append(types, workItemType)
+	}
+
+	processTypes, err := c.processWorkItemTypes(ctx, settings)
+	if err != nil {
+		c.Logger.Debug("Failed to read the work item types of the process", zap.String("project", settings.Project), zap.Error(err))
+		return types, nil
+	}
+	for _, processType := range processTypes {
+		i := slices.IndexFunc(types, func(workItemType WorkItemType) bool {
+			return strings.EqualFold(workItemType.ReferenceName, processType.ReferenceName) || strings.EqualFold(workItemType.Name, processType.Name)
+		})
+		if i < 0 {
+			types = append(types, processType)
+			continue
+		}
+		types[i].Customization = processType.Customization
+		types[i].Disabled = processType.Disabled
+	}
+
+	return types, nil
+}
+
+// Fields returns the work item fields of the project
+func (c *Client) Fields(ctx context.Context, settings models.AdoSettings) ([]Field, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/fields?api-version=7.0", settings.Organization, url.PathEscape(settings.Project))
+	var response struct {
+		Value []Field `json:"value"`
+	}
+	if err := c.get(ctx, settings, url, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Value, nil
+}
+
+// Identity is a user of a project
+type Identity struct {
+	DisplayName string `json:"displayName"`
+	UniqueName  string `json:"uniqueName"`
+}
+
+// TeamMembers returns the members of a team of the project
+func (c *Client) TeamMembers(ctx context.Context, settings models.AdoSettings, team string) ([]Identity, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/_apis/projects/%s/teams/%s/members?api-version=7.0", settings.Organization, url.PathEscape(settings.Project), url.PathEscape(team))
+	var response struct {
+		Value []struct {
+			Identity Identity `json:"identity"`
+		} `json:"value"`
+	}
+	if err := c.get(ctx, settings, url, &response); err != nil {
+		return nil, err
+	}
+
+	members := make([]Identity, 0, len(response.Value))
+	for _, value := range response.Value {
+		members = append(members, value.Identity)
+	}
+
+	return members, nil
+}
+
+// Metadata is the project metadata items are validated against
+type Metadata struct {
+	Organization string               `json:"organization"`
+	Project      string               `json:"project"`
+	FetchedAt    time.Time            `json:"fetchedAt"`
+	Areas        []ClassificationNode `json:"areas"`
+	Iterations   []ClassificationNode `json:"iterations"`
+	Types        []WorkItemType       `json:"types"`
+	Teams        []Team               `json:"teams"`
+	Fields       []Field              `json:"fields"`
+	// Users are the members of the teams of the project
+	Users []Identity `json:"users"`
+}
+
+// FetchMetadata reads the areas, iterations, work item types, fields, teams
+// and users of the project
+func (c *Client) FetchMetadata(ctx context.Context, settings models.AdoSettings) (*Metadata, error) {
+	metadata := &Metadata{Organization: settings.Organization, Project: settings.Project, FetchedAt: time.Now().UTC()}
+
+	var err error
+	if metadata.Areas, err = c.Areas(ctx, settings); err != nil {
+		return nil, err
+	}
+	if metadata.Iterations, err = c.Iterations(ctx, settings); err != nil {
+		return nil, err
+	}
+	if metadata.Types, err = c.WorkItemTypes(ctx, settings); err != nil {
+		return nil, err
+	}
+
+	if metadata.Fields, err = c.Fields(ctx, settings); err != nil {
+		return nil, err
+	}
+	if metadata.Teams, err = c.Teams(ctx, settings); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, team := range metadata.Teams {
+		members, err := c.TeamMembers(ctx, settings, team.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if key := strings.ToLower(member.UniqueName); !seen[key] {
+				seen[key] = true
+				metadata.Users = append(metadata.Users, member)
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+// get sends an authorized GET request and decodes the JSON response into v
+func (c *Client) get(ctx context.Context, settings models.AdoSettings, url string, v any) error {
+	resp, err := c.do(ctx, settings, "GET", url, "application/json", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return nil
+}
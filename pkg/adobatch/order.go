@@ -0,0 +1,134 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// byRank returns the indexes of n items sorted by rank, lowest first, the
+// items without a rank after them, in the order of the plan
+func byRank(n int, rank func(int) int) []int {
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		ra, rb := rank(indexes[a]), rank(indexes[b])
+		if ra == 0 || rb == 0 {
+			return ra != 0 && rb == 0
+		}
+		return ra < rb
+	})
+
+	return indexes
+}
+
+// rankedResults returns the created work items of a run in backlog order: the
+// IDs of the user stories by rank, and the IDs of the tasks of each user story
+// by rank
+func rankedResults(items []Result) ([]Result, map[int][]int) {
+	var userStories []Result
+	for _, result := range items {
+		if result.Status == models.StatusCreated {
+			userStories = append(userStories, result)
+		}
+	}
+	ranked := make([]Result, 0, len(userStories))
+	for _, i := range byRank(len(userStories), func(i int) int { return userStories[i].Item.Rank }) {
+		ranked = append(ranked, userStories[i])
+	}
+
+	tasks := map[int][]int{}
+	for _, result := range ranked {
+		for _, j := range byRank(len(result.Tasks), func(j int) int { return result.Tasks[j].Item.Rank }) {
+			if task := result.Tasks[j]; task.Status == models.StatusCreated {
+				tasks[result.ID] = append(tasks[result.ID], task.ID)
+			}
+		}
+	}
+
+	return ranked, tasks
+}
+
+// ReorderWorkItems moves work items of the backlog of a team, or of the default
+// team when team is empty, in the order of ids. With a parent, the work items
+// are its children, ordered under it.
+func (c *Client) ReorderWorkItems(ctx context.Context, settings models.AdoSettings, team string, parentID int, ids []int) error {
+	teamSegment := ""
+	if team != "" {
+		teamSegment = "/" + url.PathEscape(team)
+	}
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s%s/_apis/work/workitemsorder?api-version=7.0", settings.Organization, url.PathEscape(settings.Project), teamSegment)
+
+	payloadBytes, err := json.Marshal(map[string]any{
+		"ids":        ids,
+		"parentId":   parentID,
+		"previousId": 0,
+		"nextId":     0,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	c.Logger.Debug("Work item order payload", zap.ByteString("payload", payloadBytes))
+
+	resp, err := c.do(ctx, settings, "PATCH", url, "application/json", payloadBytes, http.StatusOK)
+	if err != nil {
+		return &WorkItemError{Op: "reorder", Type: "work items", Err: err}
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// reorderBacklog moves the user stories created by a run to the top of the
+// backlog of their team, by rank and then in the order of the plan, and their
+// tasks under them the same way. Failures are recorded in the outcome of the
+// run, the work items staying created.
+func (c *Client) reorderBacklog(ctx context.Context, items []Result, outcome *Outcome) {
+	ranked, tasks := rankedResults(items)
+
+	// User stories are reordered once per project and team
+	type backlog struct {
+		settings models.AdoSettings
+		team     string
+		ids      []int
+	}
+	var backlogs []*backlog
+	byTeam := map[[2]string]*backlog{}
+	for _, result := range ranked {
+		settings := c.SettingsFor(result.Item)
+		key := [2]string{strings.ToLower(settings.Organization + "/" + settings.Project), strings.ToLower(result.Item.Team)}
+		if byTeam[key] == nil {
+			byTeam[key] = &backlog{settings: settings, team: result.Item.Team}
+			backlogs = append(backlogs, byTeam[key])
+		}
+		byTeam[key].ids = append(byTeam[key].ids, result.ID)
+	}
+
+	for _, b := range backlogs {
+		if err := c.ReorderWorkItems(ctx, b.settings, b.team, 0, b.ids); err != nil {
+			c.Logger.Error("Failed to reorder the backlog", zap.String("project", b.settings.Project), zap.String("team", b.team), zap.Error(err))
+			outcome.Record(err)
+			continue
+		}
+		c.Logger.Info("Reordered the backlog", zap.String("project", b.settings.Project), zap.String("team", b.team), zap.Int("work_items", len(b.ids)))
+	}
+	for _, result := range ranked {
+		if len(tasks[result.ID]) < 2 {
+			continue
+		}
+		if err := c.ReorderWorkItems(ctx, c.SettingsFor(result.Item), result.Item.Team, result.ID, tasks[result.ID]); err != nil {
+			c.Logger.Error("Failed to reorder tasks", zap.Int("parent_id", result.ID), zap.Error(err))
+			outcome.Record(err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package adobatch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// RunStatus classifies the outcome of a run by its most severe failure
+type RunStatus string
+
+const (
+	RunSucceeded       RunStatus = "succeeded"
+	RunPartiallyFailed RunStatus = "partially_failed"
+	// RunAborted runs stopped early, on a failure threshold or throttling
+	RunAborted RunStatus = "aborted"
+	// RunInvalid runs were aborted before anything was created, for an
+	// invalid plan, such as an unknown state or owner
+	RunInvalid RunStatus = "invalid"
+	// RunAuthFailed runs had work items rejected for their credentials
+	RunAuthFailed RunStatus = "auth_failed"
+)
+
+// FailurePolicy decides when a run is aborted
+type FailurePolicy struct {
+	// MaxFailures aborts the run after this many failed work items, 0
+	// disables the limit
+	MaxFailures int
+	// MaxFailureRate aborts the run once failed work items exceed this
+	// fraction of the batch, 0 disables the limit
+	MaxFailureRate float64
+	// FailFast aborts the run at the first failed work item
+	FailFast bool
+}
+
+// Outcome accumulates the failures of a run to classify it and decide when
+// the run must be aborted. Record, Aborted and Status are safe to call from
+// the goroutines creating tasks.
+type Outcome struct {
+	mu         sync.Mutex
+	policy     FailurePolicy
+	total      int
+	failures   int
+	authFailed bool
+	throttled  bool
+	invalid    bool
+	// AbortReason explains why the run was aborted, it is empty otherwise
+	AbortReason string
+}
+
+// NewOutcome returns the outcome of a run of total work items
+func NewOutcome(total int, policy FailurePolicy) *Outcome {
+	return &Outcome{policy: policy, total: total}
+}
+
+// Record registers a failed work item and aborts the run once a failure
+// threshold is crossed
+func (o *Outcome) Record(err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.failures++
+
+	switch {
+	case errors.Is(err, ErrAuth):
+		o.authFailed = true
+	case errors.Is(err, ErrThrottled):
+		o.throttled = true
+	}
+
+	if o.AbortReason != "" {
+		return
+	}
+
+	if o.policy.FailFast {
+		o.AbortReason = "fail fast stops the run at the first failure"
+	} else if o.policy.MaxFailures > 0 && o.failures >= o.policy.MaxFailures {
+		o.AbortReason = fmt.Sprintf("%d failures reached the maximum of %d", o.failures, o.policy.MaxFailures)
+	} else if o.policy.MaxFailureRate > 0 && o.total > 0 && float64(o.failures)/float64(o.total) > o.policy.MaxFailureRate {
+		o.AbortReason = fmt.Sprintf("%d failures out of %d work items exceed the maximum failure rate of %g%%", o.failures, o.total, o.policy.MaxFailureRate*100)
+	}
+}
+
+// Abort aborts the run for err, with reason. The run is invalid when err
+// matches ErrValidation.
+func (o *Outcome) Abort(reason string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.AbortReason = reason
+	o.invalid = errors.Is(err, ErrValidation)
+}
+
+// Aborted reports whether the run must stop creating work items
+func (o *Outcome) Aborted() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.AbortReason != ""
+}
+
+// Status returns the status matching the most severe failure recorded
+func (o *Outcome) Status() RunStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	switch {
+	case o.authFailed:
+		return RunAuthFailed
+	case o.invalid:
+		return RunInvalid
+	case o.throttled, o.AbortReason != "":
+		return RunAborted
+	case o.failures > 0:
+		return RunPartiallyFailed
+	}
+
+	return RunSucceeded
+}
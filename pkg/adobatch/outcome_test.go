@@ -0,0 +1,70 @@
+package adobatch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+)
+
+func TestApplyInvalidPlan(t *testing.T) {
+	client, server := newTestClient(t)
+
+	plan := &Plan{Items: []models.UserStory{{Name: "US1", Owner: "nobody@example.com"}}}
+	results := client.Apply(context.Background(), plan, Options{ResolveOwners: true})
+	if results.Status != RunInvalid {
+		t.Errorf("status = %s, want %s (%s)", results.Status, RunInvalid, results.AbortReason)
+	}
+	if len(server.WorkItems()) != 0 {
+		t.Errorf("%d work items created", len(server.WorkItems()))
+	}
+}
+
+func TestApplyInvalidState(t *testing.T) {
+	client, server := newTestClient(t)
+
+	plan := &Plan{Items: []models.UserStory{{Name: "US1", State: "Doing"}}}
+	results := client.Apply(context.Background(), plan, Options{CheckStates: true})
+	if results.Status != RunInvalid {
+		t.Errorf("status = %s, want %s (%s)", results.Status, RunInvalid, results.AbortReason)
+	}
+	if len(server.WorkItems()) != 0 {
+		t.Errorf("%d work items created", len(server.WorkItems()))
+	}
+}
+
+func TestApplyAbortedBeforeRun(t *testing.T) {
+	client, server := newTestClient(t)
+	// Reading the identities fails, the owners are not invalid
+	server.AddRule(adotest.Rule{Path: "/_apis/identities", Status: http.StatusInternalServerError})
+
+	plan := &Plan{Items: []models.UserStory{{Name: "US1", Owner: "user@example.com"}}}
+	results := client.Apply(context.Background(), plan, Options{ResolveOwners: true})
+	if results.Status != RunAborted {
+		t.Errorf("status = %s, want %s (%s)", results.Status, RunAborted, results.AbortReason)
+	}
+}
+
+func TestOutcomeStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(o *Outcome)
+		want   RunStatus
+	}{
+		{"no failures", func(o *Outcome) {}, RunSucceeded},
+		{"failure", func(o *Outcome) { o.Record(ErrValidation) }, RunPartiallyFailed},
+		{"throttled", func(o *Outcome) { o.Record(ErrThrottled) }, RunAborted},
+		{"auth", func(o *Outcome) { o.Record(ErrAuth) }, RunAuthFailed},
+		{"invalid plan", func(o *Outcome) { o.Abort("invalid", &StateError{}) }, RunInvalid},
+		{"failed read", func(o *Outcome) { o.Abort("failed", &WorkItemError{Op: "read", Err: ErrThrottled}) }, RunAborted},
+	}
+	for _, tt := range tests {
+		outcome := NewOutcome(10, FailurePolicy{})
+		tt.record(outcome)
+		if got := outcome.Status(); got != tt.want {
+			t.Errorf("%s: status = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package adobatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// Plan is a batch of user stories, with their tasks, to create
+type Plan struct {
+	Items []models.UserStory
+}
+
+// LoadPlan decodes an items file, either a plain array of user stories or
+// an object with defaults and items. Invalid files, and priorities out of
+// the process range, return a *PlanError.
+func LoadPlan(data []byte) (*Plan, error) {
+	return DecodePlan(bytes.NewReader(data))
+}
+
+// DecodePlan decodes an items file from r like LoadPlan, collecting the
+// user stories of DecodeItems
+func DecodePlan(r io.Reader) (*Plan, error) {
+	plan := &Plan{Items: []models.UserStory{}}
+	err := DecodeItems(r, func(userStory models.UserStory) error {
+		plan.Items = append(plan.Items, userStory)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// DecodeItems decodes an items file from r one user story at a time, and
+// calls fn with every user story as soon as it is decoded and checked, with
+// the defaults of the file applied, so that the items are never all held in
+// memory. The defaults must come before the items.
+//
+// Invalid files, and priorities out of the process range, return a
+// *PlanError. Every priority out of range is reported, and fn is not called
+// anymore after the first. The error of fn stops the decoding and is
+// returned as is.
+func DecodeItems(r io.Reader, fn func(models.UserStory) error) error {
+	d := &itemsDecoder{decoder: json.NewDecoder(r), fn: fn}
+	token, err := d.decoder.Token()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return &PlanError{Err: err}
+	}
+
+	switch token {
+	case json.Delim('['):
+		err = d.decodeUserStories()
+	case json.Delim('{'):
+		err = d.decodeItemsFile()
+	case nil:
+	default:
+		err = errors.New("items file is not an array or an object")
+	}
+	if d.fnErr != nil {
+		return d.fnErr
+	}
+	if err != nil {
+		return &PlanError{Err: err}
+	}
+	if _, err := d.decoder.Token(); !errors.Is(err, io.EOF) {
+		return &PlanError{Err: errors.New("unexpected data after the items")}
+	}
+	if len(d.invalid) > 0 {
+		return &PlanError{Err: errors.Join(d.invalid...)}
+	}
+
+	return nil
+}
+
+// itemsDecoder holds the state of DecodeItems
+type itemsDecoder struct {
+	decoder  *json.Decoder
+	fn       func(models.UserStory) error
+	defaults models.ItemDefaults
+	// count is the number of user stories decoded
+	count int
+	// invalid are the priorities out of range
+	invalid []error
+	// fnErr is the error of fn that stopped the decoding
+	fnErr error
+}
+
+// decodeUserStories decodes the user stories of an array whose opening
+// bracket was read, and passes them to fn
+func (d *itemsDecoder) decodeUserStories() error {
+	for d.decoder.More() {
+		var userStory models.UserStory
+		if err := d.decoder.Decode(&userStory); err != nil {
+			return fmt.Errorf("items[%d]: %w", d.count, err)
+		}
+
+		if userStory.Organization == "" {
+			userStory.Organization = d.defaults.Organization
+		}
+		if userStory.Project == "" {
+			userStory.Project = d.defaults.Project
+		}
+
+		item := fmt.Sprintf("items[%d]", d.count)
+		d.count++
+		if errs := checkPriorities(item, userStory); len(errs) > 0 || len(d.invalid) > 0 {
+			d.invalid = append(d.invalid, errs...)
+			continue
+		}
+		if err := d.fn(userStory); err != nil {
+			d.fnErr = err
+			return err
+		}
+	}
+
+	// The closing bracket
+	_, err := d.decoder.Token()
+	return err
+}
+
+// decodeItemsFile decodes the object form of an items file whose opening
+// brace was read. Keys are matched ignoring case and unknown ones are
+// ignored, as json.Unmarshal does.
+func (d *itemsDecoder) decodeItemsFile() error {
+	items := false
+	for d.decoder.More() {
+		token, err := d.decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch key, _ := token.(string); {
+		case strings.EqualFold(key, "items"):
+			token, err := d.decoder.Token()
+			if err != nil {
+				return err
+			}
+			switch token {
+			case json.Delim('['):
+				items = true
+				if err := d.decodeUserStories(); err != nil {
+					return err
+				}
+			case nil:
+			default:
+				return errors.New("items is not an array")
+			}
+		case strings.EqualFold(key, "defaults"):
+			// The items already passed to fn would miss them
+			if items {
+				return errors.New("defaults must come before the items")
+			}
+			if err := d.decoder.Decode(&d.defaults); err != nil {
+				return fmt.Errorf("defaults: %w", err)
+			}
+		default:
+			var value json.RawMessage
+			if err := d.decoder.Decode(&value); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The closing brace
+	if _, err := d.decoder.Token(); err != nil {
+		return err
+	}
+	if !items {
+		return errors.New("items file has no items")
+	}
+
+	return nil
+}
+
+// CheckPriorities returns a *PlanError when a user story or task sets a
+// priority out of the process range
+func (p *Plan) CheckPriorities() error {
+	var errs []error
+	for i, userStory := range p.Items {
+		errs = append(errs, checkPriorities(fmt.Sprintf("items[%d]", i), userStory)...)
+	}
+	if len(errs) > 0 {
+		return &PlanError{Err: errors.Join(errs...)}
+	}
+
+	return nil
+}
+
+// checkPriorities returns an error for every priority out of the process
+// range of a user story, located at item, and of its tasks
+func checkPriorities(item string, userStory models.UserStory) []error {
+	var errs []error
+	check := func(item string, priority models.Priority) {
+		if !priority.Valid() {
+			errs = append(errs, fmt.Errorf("%s: priority %d out of range %d-%d", item, priority, models.MinPriority, models.MaxPriority))
+		}
+	}
+	check(item, userStory.Priority)
+	for j, task := range userStory.Tasks {
+		check(fmt.Sprintf("%s.tasks[%d]", item, j), task.Priority)
+	}
+
+	return errs
+}
+
+// WorkItems returns the number of user stories and tasks in the plan
+func (p *Plan) WorkItems() int {
+	total := len(p.Items)
+	for _, userStory := range p.Items {
+		total += len(userStory.Tasks)
+	}
+
+	return total
+}
@@ -0,0 +1,85 @@
+package adobatch
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+func TestDecodeItems(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		// want are the names, organizations and projects of the user stories
+		want []string
+		err  string
+	}{
+		{"array", `[{"name": "US1"}, {"name": "US2", "project": "other"}]`, []string{"US1//", "US2//other"}, ""},
+		{"object", `{"defaults": {"organization": "org", "project": "project"}, "items": [{"name": "US1"}, {"name": "US2", "organization": "pmo"}]}`, []string{"US1/org/project", "US2/pmo/project"}, ""},
+		{"defaults after items", `{"items": [{"name": "US1"}], "defaults": {"organization": "org"}}`, []string{"US1//"}, "defaults must come before the items"},
+		{"no items", `{"defaults": {}}`, nil, "items file has no items"},
+		{"invalid item", `[{"name": "US1"}, {"name": 2}]`, []string{"US1//"}, "items[1]: json: cannot unmarshal"},
+		{"priorities", `[{"name": "US1", "priority": 9}, {"name": "US2"}, {"name": "US3", "tasks": [{"name": "T1", "priority": 0}, {"name": "T2", "priority": 5}]}]`, nil, "items[2].tasks[1]: priority 5 out of range"},
+		{"trailing data", `[{"name": "US1"}] []`, []string{"US1//"}, "unexpected data after the items"},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := DecodeItems(strings.NewReader(tt.file), func(userStory models.UserStory) error {
+			got = append(got, userStory.Name+"/"+userStory.Organization+"/"+userStory.Project)
+			return nil
+		})
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: user stories = %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+		if tt.err != "" && (!errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: error = %v, want a validation error with %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDecodeItemsStreams(t *testing.T) {
+	reader, writer := io.Pipe()
+	decoded := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- DecodeItems(reader, func(userStory models.UserStory) error {
+			decoded <- userStory.Name
+			return nil
+		})
+	}()
+
+	// Every user story is passed on before the next one is written
+	io.WriteString(writer, `{"items": [`)
+	for i, name := range []string{"US1", "US2"} {
+		if i > 0 {
+			io.WriteString(writer, ",")
+		}
+		go io.WriteString(writer, `{"name": "`+name+`"}`)
+		if got := <-decoded; got != name {
+			t.Fatalf("decoded %s, want %s", got, name)
+		}
+	}
+	io.WriteString(writer, "]}")
+	writer.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeItemsStops(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := DecodeItems(strings.NewReader(`[{"name": "US1"}, {"name": "US2"}]`), func(models.UserStory) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("error = %v after %d calls, want the error of fn after 1", err, calls)
+	}
+}
@@ -0,0 +1,119 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// QueryColumn is a field selected by a WIQL query
+type QueryColumn struct {
+	ReferenceName string `json:"referenceName"`
+	Name          string `json:"name"`
+}
+
+// QueryRow is a work item returned by a WIQL query
+type QueryRow struct {
+	ID int `json:"id"`
+	// Depth is the level of the work item in a tree query, 0 for roots and
+	// for every row of a flat query
+	Depth int `json:"depth"`
+	// Fields holds the values of the columns, identities are objects with a
+	// displayName and a uniqueName
+	Fields map[string]any `json:"fields"`
+}
+
+// QueryResult is the outcome of a WIQL query
+type QueryResult struct {
+	// QueryType is flat, tree or oneHop
+	QueryType string        `json:"queryType"`
+	Columns   []QueryColumn `json:"columns"`
+	Rows      []QueryRow    `json:"rows"`
+}
+
+// RunQuery runs a flat or tree WIQL query and reads the columns it selects
+// for every work item returned. Tree and one hop queries return their rows
+// depth first, with the level of every work item.
+func (c *Client) RunQuery(ctx context.Context, settings models.AdoSettings, query string) (*QueryResult, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/wiql?api-version=7.0", settings.Organization, settings.Project)
+
+	payloadBytes, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	resp, err := c.do(ctx, settings, "POST", url, "application/json", payloadBytes, http.StatusOK)
+	if err != nil {
+		return nil, &WorkItemError{Op: "query", Type: "work items", Err: err}
+	}
+	defer resp.Body.Close()
+
+	type reference struct {
+		Id int `json:"id"`
+	}
+	var responseBody struct {
+		QueryType         string        `json:"queryType"`
+		Columns           []QueryColumn `json:"columns"`
+		WorkItems         []reference   `json:"workItems"`
+		WorkItemRelations []struct {
+			Source *reference `json:"source"`
+			Target reference  `json:"target"`
+		} `json:"workItemRelations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	result := &QueryResult{QueryType: responseBody.QueryType, Columns: responseBody.Columns}
+	for _, workItem := range responseBody.WorkItems {
+		result.Rows = append(result.Rows, QueryRow{ID: workItem.Id})
+	}
+	// Relations are listed depth first, every source before its targets
+	depths := map[int]int{}
+	for _, relation := range responseBody.WorkItemRelations {
+		depth := 0
+		if relation.Source != nil {
+			depth = depths[relation.Source.Id] + 1
+		}
+		depths[relation.Target.Id] = depth
+		result.Rows = append(result.Rows, QueryRow{ID: relation.Target.Id, Depth: depth})
+	}
+
+	ids := make([]int, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		ids = append(ids, row.ID)
+	}
+	fields := make([]string, 0, len(result.Columns))
+	for _, column := range result.Columns {
+		fields = append(fields, column.ReferenceName)
+	}
+	workItems, err := c.getWorkItems(ctx, settings, ids, fields)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[int]map[string]any, len(workItems))
+	for _, workItem := range workItems {
+		values[workItem.ID] = workItem.Fields
+	}
+
+	// Work items deleted since the query ran are left out
+	rows := make([]QueryRow, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		fields, ok := values[row.ID]
+		if !ok {
+			continue
+		}
+		// Empty fields are left out of the response
+		if fields == nil {
+			fields = map[string]any{}
+		}
+		row.Fields = fields
+		rows = append(rows, row)
+	}
+	result.Rows = rows
+
+	return result, nil
+}
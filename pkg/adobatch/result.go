@@ -0,0 +1,42 @@
+package adobatch
+
+import (
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// Result is the outcome of a user story and its tasks
+type Result struct {
+	Item models.UserStory
+	// ID and URL identify the work item created, or found by SkipExisting
+	ID     int
+	URL    string
+	Status string
+	// Err is why the user story failed, it wraps ErrAuth, ErrThrottled or
+	// ErrValidation when Azure DevOps rejected it for that reason
+	Err     error
+	Latency time.Duration
+	Tasks   []TaskResult
+}
+
+// TaskResult is the outcome of a task
+type TaskResult struct {
+	Item    models.Task
+	ID      int
+	URL     string
+	Status  string
+	Err     error
+	Latency time.Duration
+}
+
+// newResult returns the result of a user story that was not created, with
+// all of its tasks skipped
+func newResult(userStory models.UserStory, status string) Result {
+	result := Result{Item: userStory, Status: status}
+	for _, task := range userStory.Tasks {
+		result.Tasks = append(result.Tasks, TaskResult{Item: task, Status: models.StatusSkipped})
+	}
+
+	return result
+}
@@ -0,0 +1,237 @@
+package adobatch
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// Results is the machine-readable outcome of a run, mapping every input
+// item to the work item created for it
+type Results struct {
+	RunID       string       `json:"runId,omitempty"`
+	Summary     Summary      `json:"summary"`
+	UserStories []ItemResult `json:"userStories"`
+	// Items are the user stories and tasks of the run with their errors
+	Items []Result `json:"-"`
+	// Status classifies the run, AbortReason explains why it was aborted
+	Status      RunStatus `json:"-"`
+	AbortReason string    `json:"-"`
+}
+
+// ItemResult is the outcome of a single user story or task
+type ItemResult struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Owner    string `json:"owner,omitempty"`
+	State    string `json:"state,omitempty"`
+	Estimate int    `json:"estimate,omitempty"`
+	Id       int    `json:"id,omitempty"`
+	Url      string `json:"url,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	// LatencyMs is the time the create request took
+	LatencyMs float64      `json:"latencyMs,omitempty"`
+	Tasks     []ItemResult `json:"tasks,omitempty"`
+}
+
+// NewResults converts the item results of a run that took duration into
+// its results
+func NewResults(runID string, items []Result, duration time.Duration) Results {
+	results := Results{
+		RunID:       runID,
+		Summary:     newSummary(items, duration),
+		UserStories: make([]ItemResult, 0, len(items)),
+		Items:       items,
+	}
+	for _, story := range items {
+		storyResult := ItemResult{
+			Type:      UserStoryType(story.Item),
+			Name:      story.Item.Name,
+			Owner:     story.Item.Owner,
+			State:     story.Item.State,
+			Id:        story.ID,
+			Url:       story.URL,
+			Status:    story.Status,
+			Error:     errorString(story.Err),
+			LatencyMs: milliseconds(story.Latency),
+		}
+		for _, task := range story.Tasks {
+			storyResult.Tasks = append(storyResult.Tasks, ItemResult{
+				Type:      TaskType(task.Item),
+				Name:      task.Item.Name,
+				Owner:     task.Item.Owner,
+				State:     task.Item.State,
+				Estimate:  task.Item.Estimate,
+				Id:        task.ID,
+				Url:       task.URL,
+				Status:    task.Status,
+				Error:     errorString(task.Err),
+				LatencyMs: milliseconds(task.Latency),
+			})
+		}
+		results.UserStories = append(results.UserStories, storyResult)
+	}
+
+	return results
+}
+
+// errorString returns the message of err, or an empty string when it is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+// Summary holds the counters of a run
+type Summary struct {
+	Created          int                     `json:"created"`
+	Skipped          int                     `json:"skipped"`
+	Failed           int                     `json:"failed"`
+	Updated          int                     `json:"updated,omitempty"`
+	ByType           map[string]StatusCounts `json:"byType"`
+	DurationSeconds  float64                 `json:"durationSeconds"`
+	AverageLatencyMs float64                 `json:"averageLatencyMs"`
+	P50LatencyMs     float64                 `json:"p50LatencyMs"`
+	P95LatencyMs     float64                 `json:"p95LatencyMs"`
+	Slowest          []SlowItem              `json:"slowest,omitempty"`
+	// ByIteration and ByOwner aggregate the estimates of the work items
+	// created, by iteration path and assignee, empty when unset
+	ByIteration map[string]Estimate `json:"byIteration,omitempty"`
+	ByOwner     map[string]Estimate `json:"byOwner,omitempty"`
+}
+
+// Estimate sums the task hours and the user story points of work items
+type Estimate struct {
+	Hours  int     `json:"hours"`
+	Points float64 `json:"points"`
+}
+
+// addEstimate adds hours and points to the estimate of key, when set
+func addEstimate(estimates map[string]Estimate, key string, hours int, points float64) {
+	if hours == 0 && points == 0 {
+		return
+	}
+	estimate := estimates[key]
+	estimate.Hours += hours
+	estimate.Points += points
+	estimates[key] = estimate
+}
+
+// SlowItem is one of the work items that took the longest to create
+type SlowItem struct {
+	Type      string  `json:"type"`
+	Name      string  `json:"name"`
+	Id        int     `json:"id,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+// slowestItems is the number of slowest work items listed in the summary
+const slowestItems = 5
+
+// StatusCounts counts the work items of a type by status
+type StatusCounts struct {
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+	// Updated counts the existing user stories updated, see DuplicateUpdate
+	Updated int `json:"updated,omitempty"`
+}
+
+// add counts a work item with the given status
+func (c *StatusCounts) add(status string) {
+	switch status {
+	case models.StatusCreated:
+		c.Created++
+	case models.StatusSkipped:
+		c.Skipped++
+	case models.StatusUpdated:
+		c.Updated++
+	default:
+		c.Failed++
+	}
+}
+
+// newSummary counts the work items of a run by resolved type and status, and
+// sums the estimates of those created. The latency statistics only cover the
+// requests that were actually sent.
+func newSummary(items []Result, duration time.Duration) Summary {
+	var total StatusCounts
+	byType := map[string]StatusCounts{}
+	count := func(workItemType, status string) {
+		counts := byType[workItemType]
+		counts.add(status)
+		byType[workItemType] = counts
+		total.add(status)
+	}
+	var latency time.Duration
+	var timed []SlowItem
+
+	byIteration, byOwner := map[string]Estimate{}, map[string]Estimate{}
+
+	for _, story := range items {
+		iteration := ""
+		if story.Item.Iteraction != nil {
+			iteration = *story.Item.Iteraction
+		}
+		if story.Status == models.StatusCreated {
+			addEstimate(byIteration, iteration, 0, story.Item.Points)
+			addEstimate(byOwner, story.Item.Owner, 0, story.Item.Points)
+		}
+		count(UserStoryType(story.Item), story.Status)
+		if story.Latency > 0 {
+			latency += story.Latency
+			timed = append(timed, SlowItem{Type: UserStoryType(story.Item), Name: story.Item.Name, Id: story.ID, LatencyMs: milliseconds(story.Latency)})
+		}
+
+		for _, task := range story.Tasks {
+			count(TaskType(task.Item), task.Status)
+			if task.Status == models.StatusCreated {
+				addEstimate(byIteration, iteration, task.Item.Estimate, 0)
+				addEstimate(byOwner, task.Item.Owner, task.Item.Estimate, 0)
+			}
+			if task.Latency > 0 {
+				latency += task.Latency
+				timed = append(timed, SlowItem{Type: TaskType(task.Item), Name: task.Item.Name, Id: task.ID, LatencyMs: milliseconds(task.Latency)})
+			}
+		}
+	}
+
+	summary := Summary{
+		Created:         total.Created,
+		Skipped:         total.Skipped,
+		Failed:          total.Failed,
+		Updated:         total.Updated,
+		ByType:          byType,
+		DurationSeconds: duration.Seconds(),
+	}
+	if len(byIteration) > 0 {
+		summary.ByIteration, summary.ByOwner = byIteration, byOwner
+	}
+	if len(timed) > 0 {
+		summary.AverageLatencyMs = float64(latency.Milliseconds()) / float64(len(timed))
+
+		sort.SliceStable(timed, func(i, j int) bool { return timed[i].LatencyMs > timed[j].LatencyMs })
+		summary.P50LatencyMs = percentile(timed, 0.50)
+		summary.P95LatencyMs = percentile(timed, 0.95)
+		summary.Slowest = timed[:min(slowestItems, len(timed))]
+	}
+
+	return summary
+}
+
+// percentile returns the nearest-rank percentile of latencies sorted from
+// the slowest
+func percentile(sorted []SlowItem, p float64) float64 {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[len(sorted)-max(rank, 1)].LatencyMs
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
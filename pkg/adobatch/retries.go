@@ -0,0 +1,142 @@
+package adobatch
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// RequestTagPrefix prefixes the tag carrying the client request ID of the
+// work items created with retries, "req-<id>"
+const RequestTagPrefix = "req-"
+
+// retryDelay is the wait before the first retry of a create, and grows by
+// as much with every retry
+const retryDelay = time.Second
+
+// requestKey returns the key the client request IDs of a run derive from: its
+// run ID, so a run resumed with the same ID finds its work items, or a random
+// key unique to the run
+func requestKey(runID string) string {
+	if runID != "" {
+		return runID
+	}
+
+	key := make([]byte, 8)
+	rand.Read(key)
+
+	return hex.EncodeToString(key)
+}
+
+// requestID returns the client request ID of a work item from the key of the
+// run and the position of the item in the plan: the index of its user story,
+// and of the task under it
+func requestID(key string, position ...int) string {
+	hash := sha256.New()
+	hash.Write([]byte(key))
+	for _, index := range position {
+		fmt.Fprintf(hash, "/%d", index)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// requestTags adds the tag of a client request ID, when there is one, to a
+// System.Tags value
+func requestTags(tags, requestID string) string {
+	if requestID == "" {
+		return tags
+	}
+
+	return MergeTags(tags, RequestTagPrefix+requestID)
+}
+
+// Ambiguous reports whether a failed request may have been carried out by
+// Azure DevOps anyway: the response was lost, such as on a timeout or a
+// dropped connection, or the server failed while handling it
+func Ambiguous(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// createWorkItem creates a work item like CreateWorkItem. With a client
+// request ID, tagged on the work item by the caller, it retries up to retries
+// times after ambiguous failures, and looks up the work item with the tag
+// before every retry so a create that succeeded without its response is not
+// repeated.
+func (c *Client) createWorkItem(ctx context.Context, settings models.AdoSettings, workItemType string, payload any, requestID string, retries int) (int, error) {
+	id, err := c.CreateWorkItem(ctx, settings, workItemType, payload)
+	if requestID == "" {
+		return id, err
+	}
+
+	return c.retryCreate(ctx, settings, workItemType, payload, requestID, retries, id, err)
+}
+
+// retryCreate retries the create of a work item with a client request ID that
+// returned id and err, like createWorkItem
+func (c *Client) retryCreate(ctx context.Context, settings models.AdoSettings, workItemType string, payload any, requestID string, retries int, id int, err error) (int, error) {
+	for attempt := 1; err != nil && attempt <= retries && Ambiguous(err) && ctx.Err() == nil; attempt++ {
+		c.Logger.Warn("Work item may have been created, retrying", zap.String("type", workItemType), zap.String("request_id", requestID), zap.Int("attempt", attempt), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return 0, err
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		}
+
+		var existing int
+		if existing, err = c.findByRequestID(ctx, settings, requestID); err != nil {
+			continue
+		}
+		if existing != 0 {
+			c.Logger.Info("Work item was created by the failed request", zap.String("type", workItemType), zap.String("request_id", requestID), zap.Int("id", existing))
+			return existing, nil
+		}
+
+		id, err = c.CreateWorkItem(ctx, settings, workItemType, payload)
+	}
+
+	return id, err
+}
+
+// findByRequestID returns the ID of the work item tagged with a client
+// request ID, or 0 when there is none
+func (c *Client) findByRequestID(ctx context.Context, settings models.AdoSettings, requestID string) (int, error) {
+	query := "SELECT [System.Id] FROM WorkItems WHERE [System.TeamProject] = @project AND [System.Tags] CONTAINS " + WIQLString(RequestTagPrefix+requestID)
+
+	ids, err := c.QueryWorkItems(ctx, settings, query)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	return ids[0], nil
+}
+
+// requestID returns the client request ID of an item of the plan, or none
+// without Retries
+func (o Options) requestID(position ...int) string {
+	if o.requestKey == "" {
+		return ""
+	}
+
+	return requestID(o.requestKey, position...)
+}
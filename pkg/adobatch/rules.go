@@ -0,0 +1,74 @@
+package adobatch
+
+import "strings"
+
+// AssignmentRule assigns the work items without an owner that match its area
+// and work item type to an owner, such as the Networking area to "@NetOps"
+type AssignmentRule struct {
+	// Area matches the area path and the areas under it, with or without
+	// the project, empty matches every area
+	Area string `json:"area"`
+	// Type is the work item type, "User Story" or "Task", empty matches both
+	Type string `json:"type"`
+	// Owner is assigned to the matching work items, an identity or a
+	// "@Team Name" assigned to a member of the team
+	Owner string `json:"owner"`
+}
+
+// matches reports whether the rule applies to a work item of the type in the
+// area
+func (r AssignmentRule) matches(area, workItemType string) bool {
+	if r.Type != "" && !strings.EqualFold(r.Type, workItemType) {
+		return false
+	}
+	if r.Area == "" {
+		return true
+	}
+
+	rule, area := normalizeAreaPath(r.Area), normalizeAreaPath(area)
+	_, underProject, _ := strings.Cut(area, `\`)
+	return underArea(area, rule) || underArea(underProject, rule)
+}
+
+func underArea(area, parent string) bool {
+	return area == parent || strings.HasPrefix(area, parent+`\`)
+}
+
+// normalizeAreaPath compares area paths written with either separator and in
+// any case
+func normalizeAreaPath(path string) string {
+	return strings.ToLower(strings.Trim(strings.ReplaceAll(path, "/", `\`), `\`))
+}
+
+// ApplyAssignmentRules sets the owner of the user stories and tasks that have
+// none from the first matching rule, and returns the number of work items
+// assigned. Tasks match on the area of their user story.
+func (p *Plan) ApplyAssignmentRules(rules []AssignmentRule) int {
+	owner := func(area, workItemType string) string {
+		for _, rule := range rules {
+			if rule.matches(area, workItemType) {
+				return rule.Owner
+			}
+		}
+		return ""
+	}
+
+	assigned := 0
+	for i := range p.Items {
+		userStory := &p.Items[i]
+		if userStory.Owner == "" {
+			if userStory.Owner = owner(userStory.Area, "User Story"); userStory.Owner != "" {
+				assigned++
+			}
+		}
+		for j := range userStory.Tasks {
+			if task := &userStory.Tasks[j]; task.Owner == "" {
+				if task.Owner = owner(userStory.Area, "Task"); task.Owner != "" {
+					assigned++
+				}
+			}
+		}
+	}
+
+	return assigned
+}
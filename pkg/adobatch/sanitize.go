@@ -0,0 +1,263 @@
+package adobatch
+
+import (
+	"html"
+	"slices"
+	"strings"
+)
+
+// allowedTags are the rich text tags kept in descriptions, with the
+// attributes kept on them
+var allowedTags = map[string][]string{
+	"a": {"href", "title"}, "b": nil, "blockquote": nil, "br": nil, "code": nil,
+	"del": nil, "div": nil, "em": nil, "h1": nil, "h2": nil, "h3": nil, "h4": nil,
+	"h5": nil, "h6": nil, "hr": nil, "i": nil, "img": {"src", "alt", "title", "width", "height"},
+	"li": nil, "ol": nil, "p": nil, "pre": nil, "s": nil, "span": nil, "strike": nil,
+	"strong": nil, "sub": nil, "sup": nil, "table": nil, "tbody": nil,
+	"td": {"colspan", "rowspan"}, "th": {"colspan", "rowspan"}, "thead": nil,
+	"tr": nil, "u": nil, "ul": nil,
+}
+
+// droppedTags are removed with their content
+var droppedTags = map[string]bool{
+	"embed": true, "iframe": true, "noscript": true, "object": true,
+	"script": true, "style": true, "template": true,
+}
+
+// implicitlyClosed groups the tags that close an open tag of the same group,
+// as "<li>one<li>two" is two list items
+var implicitlyClosed = map[string]string{"li": "li", "p": "p", "tr": "tr", "td": "cell", "th": "cell"}
+
+// implicitScopes are the tags a group does not close open tags beyond, as a
+// list item of a nested list does not end the item of the outer list
+var implicitScopes = map[string][]string{
+	"li":   {"ol", "ul"},
+	"p":    {"blockquote", "div", "li", "td", "th"},
+	"tr":   {"table", "tbody", "thead"},
+	"cell": {"table", "tr"},
+}
+
+// voidTags have no closing tag
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true}
+
+// SanitizeHTML returns rich text that is safe to render: scripts, styles and
+// embedded content are removed with their content, unknown tags are removed
+// keeping their text, attributes are limited to links, images and table
+// spans, links only keep http, https and mailto URLs, and tags left open are
+// closed.
+func SanitizeHTML(s string) string {
+	var b strings.Builder
+	var open []string
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				break
+			}
+			s = s[end+len("-->"):]
+			continue
+		}
+
+		end := strings.IndexByte(s, '>')
+		closing := strings.HasPrefix(s, "</")
+		name, attrs := parseTag(s, end)
+		if end < 0 || name == "" {
+			// A lone "<" is text
+			b.WriteString("&lt;")
+			s = s[1:]
+			continue
+		}
+		s = s[end+1:]
+
+		switch {
+		case droppedTags[name]:
+			if !closing {
+				s = skipElement(s, name)
+			}
+		case !allowedTag(name):
+			// Unknown tags are removed, their content kept
+		case closing:
+			for k := len(open) - 1; k >= 0; k-- {
+				if open[k] == name {
+					// Close the tags opened inside it too
+					for len(open) > k {
+						b.WriteString("</" + open[len(open)-1] + ">")
+						open = open[:len(open)-1]
+					}
+					break
+				}
+			}
+		default:
+			// A list item, row, paragraph or cell ends the one open before
+			// it, with the tags opened inside it
+			if k := implicitlyOpen(open, name); k >= 0 {
+				for len(open) > k {
+					b.WriteString("</" + open[len(open)-1] + ">")
+					open = open[:len(open)-1]
+				}
+			}
+			b.WriteString("<" + name + sanitizeAttributes(name, attrs) + ">")
+			if !voidTags[name] {
+				open = append(open, name)
+			}
+		}
+	}
+
+	for k := len(open) - 1; k >= 0; k-- {
+		b.WriteString("</" + open[k] + ">")
+	}
+
+	return b.String()
+}
+
+// implicitlyOpen returns the index in open of the tag the tag name closes
+// implicitly, or -1
+func implicitlyOpen(open []string, name string) int {
+	group := implicitlyClosed[name]
+	if group == "" {
+		return -1
+	}
+	for k := len(open) - 1; k >= 0; k-- {
+		if implicitlyClosed[open[k]] == group {
+			return k
+		}
+		if slices.Contains(implicitScopes[group], open[k]) {
+			return -1
+		}
+	}
+
+	return -1
+}
+
+func allowedTag(name string) bool {
+	_, ok := allowedTags[name]
+	return ok
+}
+
+// parseTag returns the lower case name and the attributes of the tag starting
+// s and ending at end, or no name when s does not start a tag
+func parseTag(s string, end int) (string, map[string]string) {
+	if end < 0 {
+		return "", nil
+	}
+	tag := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(s[:end], "<"), "/"), "/")
+	if tag == "" || !isLetter(tag[0]) {
+		return "", nil
+	}
+
+	i := 0
+	for i < len(tag) && (isLetter(tag[i]) || (tag[i] >= '0' && tag[i] <= '9')) {
+		i++
+	}
+	name := strings.ToLower(tag[:i])
+
+	attrs := map[string]string{}
+	rest := tag[i:]
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n/")
+		if rest == "" {
+			return name, attrs
+		}
+		j := strings.IndexAny(rest, "= \t\r\n")
+		if j < 0 {
+			attrs[strings.ToLower(rest)] = ""
+			return name, attrs
+		}
+		key := strings.ToLower(rest[:j])
+		rest = strings.TrimLeft(rest[j:], " \t\r\n")
+		if !strings.HasPrefix(rest, "=") {
+			attrs[key] = ""
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+
+		var value string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			if k := strings.IndexByte(rest[1:], rest[0]); k >= 0 {
+				value, rest = rest[1:k+1], rest[k+2:]
+			} else {
+				value, rest = rest[1:], ""
+			}
+		} else if k := strings.IndexAny(rest, " \t\r\n"); k >= 0 {
+			value, rest = rest[:k], rest[k:]
+		} else {
+			value, rest = rest, ""
+		}
+		attrs[key] = html.UnescapeString(value)
+	}
+}
+
+// sanitizeAttributes returns the allowed attributes of a tag, in the order
+// they are allowed
+func sanitizeAttributes(name string, attrs map[string]string) string {
+	var b strings.Builder
+	for _, key := range allowedTags[name] {
+		value, ok := attrs[key]
+		if !ok || ((key == "href" || key == "src") && !safeURL(value)) {
+			continue
+		}
+		b.WriteString(" " + key + `="` + html.EscapeString(value) + `"`)
+	}
+
+	return b.String()
+}
+
+// safeURL reports whether a link or image URL cannot run script
+func safeURL(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	scheme, _, found := strings.Cut(value, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		// Relative URLs
+		return true
+	}
+
+	return scheme == "http" || scheme == "https" || scheme == "mailto"
+}
+
+// skipElement returns s after the closing tag of the element, or nothing
+// when it is not closed
+func skipElement(s, name string) string {
+	lower := strings.ToLower(s)
+	i := strings.Index(lower, "</"+name)
+	if i < 0 {
+		return ""
+	}
+	if end := strings.IndexByte(s[i:], '>'); end >= 0 {
+		return s[i+end+1:]
+	}
+
+	return ""
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// SanitizeDescriptions sanitizes the descriptions of the user stories and
+// tasks of the plan with SanitizeHTML, and returns the number of
+// descriptions changed
+func (p *Plan) SanitizeDescriptions() int {
+	changed := 0
+	sanitize := func(description *string) {
+		if sanitized := SanitizeHTML(*description); sanitized != *description {
+			*description = sanitized
+			changed++
+		}
+	}
+	for i := range p.Items {
+		sanitize(&p.Items[i].Description)
+		for j := range p.Items[i].Tasks {
+			sanitize(&p.Items[i].Tasks[j].Description)
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,77 @@
+package adobatch
+
+import (
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text", "Deploy the API", "Deploy the API"},
+		{"allowed tags", "<p>Run <b>migrations</b> then <code>make</code></p>", "<p>Run <b>migrations</b> then <code>make</code></p>"},
+		{"upper case tags", "<P>Title<BR></P>", "<p>Title<br></p>"},
+
+		{"script", `<p>Hi</p><script>alert("x")</script><p>there</p>`, "<p>Hi</p><p>there</p>"},
+		{"script with attributes", `<script type="text/javascript" src="x.js"></script>ok`, "ok"},
+		{"upper case script", "<SCRIPT>alert(1)</SCRIPT>ok", "ok"},
+		{"unclosed script", "before<script>alert(1)", "before"},
+		{"style", "<style>p { color: red }</style><p>Styled</p>", "<p>Styled</p>"},
+		{"iframe", `<iframe src="https://evil.example.com"></iframe>text`, "text"},
+		{"stray closing script", "text</script>", "text"},
+
+		{"event handler", `<img src="a.png" onerror="alert(1)">`, `<img src="a.png">`},
+		{"event handler on allowed tag", `<p onclick="steal()">Click</p>`, "<p>Click</p>"},
+		{"event handler without quotes", `<a href="https://example.com" onmouseover=alert(1)>link</a>`, `<a href="https://example.com">link</a>`},
+		{"style attribute", `<span style="background:url(javascript:alert(1))">x</span>`, "<span>x</span>"},
+
+		{"javascript URL", `<a href="javascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"upper case javascript URL", `<a href="JavaScript:alert(1)">x</a>`, "<a>x</a>"},
+		{"padded javascript URL", `<a href="  javascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"encoded javascript URL", `<a href="&#106;avascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"tab in javascript URL", "<a href=\"java\tscript:alert(1)\">x</a>", "<a>x</a>"},
+		{"data URL", `<img src="data:text/html;base64,PHNjcmlwdD4=">`, "<img>"},
+		{"vbscript URL", `<a href="vbscript:msgbox(1)">x</a>`, "<a>x</a>"},
+		{"safe URLs", `<a href="https://example.com/a?b=1&amp;c=2" title="Docs">docs</a> <a href="mailto:ana@example.com">mail</a> <a href="/wiki/page">wiki</a>`, `<a href="https://example.com/a?b=1&amp;c=2" title="Docs">docs</a> <a href="mailto:ana@example.com">mail</a> <a href="/wiki/page">wiki</a>`},
+
+		{"unclosed tags", "<p><b>bold", "<p><b>bold</b></p>"},
+		{"misnested tags", "<b><i>text</b></i>", "<b><i>text</i></b>"},
+		{"implicit list items", "<ul><li>one<li>two</ul>", "<ul><li>one</li><li>two</li></ul>"},
+		{"implicit cells", "<table><tr><td>a<td>b<tr><td>c</table>", "<table><tr><td>a</td><td>b</td></tr><tr><td>c</td></tr></table>"},
+		{"implicit paragraphs", "<p>one<p>two", "<p>one</p><p>two</p>"},
+		{"implicit list item with open tags", "<ul><li><b>one<li>two</ul>", "<ul><li><b>one</b></li><li>two</li></ul>"},
+		{"nested lists", "<ul><li>one<ul><li>inner</ul></ul>", "<ul><li>one<ul><li>inner</li></ul></li></ul>"},
+		{"unknown tags", "<custom-tag>text</custom-tag><font color=red>red</font>", "textred"},
+		{"lone less than", "a < b and 1<2", "a &lt; b and 1&lt;2"},
+		{"unterminated tag", "text <b", "text &lt;b"},
+		{"comment", "a<!-- hidden -->b", "ab"},
+		{"unterminated comment", "a<!-- hidden", "a"},
+		{"self closing", "line<br/>next<hr />", "line<br>next<hr>"},
+
+		{"entities", "Fish &amp; chips &lt;3 &copy;", "Fish &amp; chips &lt;3 &copy;"},
+		{"attribute entities", `<a href="https://example.com" title="&quot;Q&quot; &amp; A">x</a>`, `<a href="https://example.com" title="&#34;Q&#34; &amp; A">x</a>`},
+		{"attribute quotes", `<img alt='say "hi"' src=a.png>`, `<img src="a.png" alt="say &#34;hi&#34;">`},
+	}
+	for _, tt := range tests {
+		if got := SanitizeHTML(tt.in); got != tt.want {
+			t.Errorf("%s: SanitizeHTML(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeDescriptions(t *testing.T) {
+	plan := &Plan{Items: []models.UserStory{{
+		Description: "<p>Safe</p>",
+		Tasks:       []models.Task{{Description: "<script>x</script>Run"}, {Description: "<b>open"}},
+	}}}
+	if changed := plan.SanitizeDescriptions(); changed != 2 {
+		t.Errorf("%d descriptions changed, want 2", changed)
+	}
+	if got := plan.Items[0].Tasks[0].Description; got != "Run" {
+		t.Errorf("task description = %q, want Run", got)
+	}
+}
@@ -0,0 +1,106 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// StateError is returned when an item sets a state its work item type does
+// not have in the process of the project
+type StateError struct {
+	// Item is the name of the user story or task
+	Item  string
+	Type  string
+	State string
+	// States are the states of the work item type
+	States []string
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("%s %q: state %q is not a state of %s, expected one of %s", strings.ToLower(e.Type), e.Item, e.State, e.Type, strings.Join(e.States, ", "))
+}
+
+// Unwrap matches ErrValidation
+func (e *StateError) Unwrap() error {
+	return ErrValidation
+}
+
+// WorkItemTypeStates returns the states of a work item type of the project,
+// as defined by its process
+func (c *Client) WorkItemTypeStates(ctx context.Context, settings models.AdoSettings, workItemType string) ([]string, error) {
+	typeStates, err := c.workItemTypeStates(ctx, settings, workItemType)
+	if err != nil {
+		return nil, err
+	}
+
+	return stateNames(typeStates), nil
+}
+
+// workItemState is a state of a work item type, with its category such as
+// Proposed, InProgress, Completed or Removed
+type workItemState struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// workItemTypeStates returns the states of a work item type in the order of
+// its process, the initial state first
+func (c *Client) workItemTypeStates(ctx context.Context, settings models.AdoSettings, workItemType string) ([]workItemState, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workitemtypes/%s/states?api-version=7.0", settings.Organization, url.PathEscape(settings.Project), url.PathEscape(workItemType))
+	var response struct {
+		Value []workItemState `json:"value"`
+	}
+	if err := c.get(ctx, settings, url, &response); err != nil {
+		return nil, &WorkItemError{Op: "read states of", Type: workItemType, Err: err}
+	}
+
+	return response.Value, nil
+}
+
+// CheckStates verifies the states of the user stories and tasks of the plan
+// against the state model of their work item type, in the project each user
+// story targets. Every invalid state is reported, joined in the error.
+func (c *Client) CheckStates(ctx context.Context, plan *Plan) error {
+	// States are read once per project and work item type
+	states := map[[3]string][]string{}
+	var errs []error
+	check := func(settings models.AdoSettings, workItemType, item, state string) error {
+		if state == "" {
+			return nil
+		}
+		key := [3]string{strings.ToLower(settings.Organization), strings.ToLower(settings.Project), workItemType}
+		if _, ok := states[key]; !ok {
+			typeStates, err := c.WorkItemTypeStates(ctx, settings, workItemType)
+			if err != nil {
+				return err
+			}
+			states[key] = typeStates
+		}
+		for _, typeState := range states[key] {
+			if strings.EqualFold(typeState, state) {
+				return nil
+			}
+		}
+		errs = append(errs, &StateError{Item: item, Type: workItemType, State: state, States: states[key]})
+		return nil
+	}
+
+	for _, userStory := range plan.Items {
+		settings := c.SettingsFor(userStory)
+		if err := check(settings, UserStoryType(userStory), userStory.Name, userStory.State); err != nil {
+			return err
+		}
+		for _, task := range userStory.Tasks {
+			if err := check(settings, TaskType(task), task.Name, task.State); err != nil {
+				return err
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
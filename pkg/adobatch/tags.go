@@ -0,0 +1,96 @@
+package adobatch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// TagSeparator separates the tags of the System.Tags field. A tag containing
+// it is split into several tags.
+const TagSeparator = ";"
+
+// MergeTags joins tags into a System.Tags value. Tags are trimmed, empty ones
+// dropped and duplicates, compared ignoring case as Azure DevOps does, keep
+// their first position.
+func MergeTags(tags ...string) string {
+	seen := map[string]bool{}
+	merged := make([]string, 0, len(tags))
+	for _, value := range tags {
+		for _, tag := range splitTags(value) {
+			if key := strings.ToLower(tag); !seen[key] {
+				seen[key] = true
+				merged = append(merged, tag)
+			}
+		}
+	}
+
+	return strings.Join(merged, TagSeparator+" ")
+}
+
+// splitTags returns the trimmed, non-empty tags of a System.Tags value
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, TagSeparator) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// exportTags returns the tags of a System.Tags value set in items files,
+// without the tags every run adds
+func exportTags(value string) []string {
+	var tags []string
+	for _, tag := range splitTags(value) {
+		if strings.EqualFold(tag, AutomationTag) || strings.HasPrefix(tag, "run-") {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// RenameTag replaces a tag of a work item, compared ignoring case, with
+// another, or removes it when to is empty. It reports whether the work item
+// had the tag. The update fails if the work item changed since its tags were
+// read.
+func (c *Client) RenameTag(ctx context.Context, settings models.AdoSettings, id int, from, to string) (bool, error) {
+	workItems, err := c.getWorkItems(ctx, settings, []int{id}, []string{"System.Tags", "System.Rev"})
+	if err != nil {
+		return false, err
+	}
+	if len(workItems) == 0 {
+		return false, &WorkItemError{Op: "read", Type: fmt.Sprintf("work item %d", id), Err: fmt.Errorf("not found: %w", ErrValidation)}
+	}
+	workItem := workItems[0]
+
+	found := false
+	var tags []string
+	for _, tag := range splitTags(workItem.field("System.Tags")) {
+		if strings.EqualFold(tag, from) {
+			found = true
+			tag = to
+		}
+		tags = append(tags, tag)
+	}
+	if !found {
+		return false, nil
+	}
+
+	rev, _ := workItem.Fields["System.Rev"].(float64)
+	payload := []map[string]interface{}{
+		{"op": "test", "path": "/rev", "value": int(rev)},
+		{"op": "add", "path": "/fields/System.Tags", "value": MergeTags(tags...)},
+	}
+	if err := c.UpdateWorkItem(ctx, settings, id, payload); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,130 @@
+package adobatch
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// TaskNumbering numbers the titles of the tasks of a user story
+type TaskNumbering string
+
+const (
+	// NumberNone leaves task titles unnumbered
+	NumberNone TaskNumbering = ""
+	// NumberFraction prefixes task titles with "1/5 ".."5/5 "
+	NumberFraction TaskNumbering = "fraction"
+	// NumberIndex prefixes task titles with "1. ".."5. "
+	NumberIndex TaskNumbering = "index"
+)
+
+// ParseTaskNumbering parses a numbering scheme, empty or none meaning none
+func ParseTaskNumbering(name string) (TaskNumbering, error) {
+	switch numbering := TaskNumbering(strings.ToLower(name)); numbering {
+	case NumberNone, "none":
+		return NumberNone, nil
+	case NumberFraction, NumberIndex:
+		return numbering, nil
+	default:
+		return "", fmt.Errorf("unknown task numbering %q, expected none, %s or %s", name, NumberFraction, NumberIndex)
+	}
+}
+
+// TitleFormat transforms the titles of the work items of a run, so they can
+// be told apart and ordered on the board
+type TitleFormat struct {
+	// Prefix and Suffix are added to every title, spaces included
+	Prefix string
+	Suffix string
+	// TaskNumbering numbers the tasks of every user story
+	TaskNumbering TaskNumbering
+	// Overflow applies to the formatted titles too long, see Plan.FitTitles.
+	// Empty means fail.
+	Overflow TitleOverflow
+}
+
+// FormatTitles applies the title format to the names of the user stories and
+// tasks of the plan
+func (p *Plan) FormatTitles(format TitleFormat) {
+	for i := range p.Items {
+		userStory := &p.Items[i]
+		userStory.Name = format.Prefix + userStory.Name + format.Suffix
+
+		tasks := len(userStory.Tasks)
+		for j := range userStory.Tasks {
+			task := &userStory.Tasks[j]
+			switch format.TaskNumbering {
+			case NumberFraction:
+				task.Name = fmt.Sprintf("%d/%d %s", j+1, tasks, task.Name)
+			case NumberIndex:
+				task.Name = fmt.Sprintf("%d. %s", j+1, task.Name)
+			}
+			task.Name = format.Prefix + task.Name + format.Suffix
+		}
+	}
+}
+
+// MaxTitleLength is the maximum length of a work item title, in characters
+const MaxTitleLength = 255
+
+// TitleOverflow is the policy for titles longer than MaxTitleLength
+type TitleOverflow string
+
+const (
+	// OverflowFail rejects the plan, listing every title too long
+	OverflowFail TitleOverflow = "fail"
+	// OverflowTruncate cuts titles, ending them with an ellipsis
+	OverflowTruncate TitleOverflow = "truncate"
+	// OverflowDescription cuts titles like OverflowTruncate and adds the
+	// rest of the title at the top of the description
+	OverflowDescription TitleOverflow = "description"
+)
+
+// ParseTitleOverflow parses an overflow policy, empty meaning fail
+func ParseTitleOverflow(name string) (TitleOverflow, error) {
+	switch overflow := TitleOverflow(strings.ToLower(name)); overflow {
+	case "", OverflowFail:
+		return OverflowFail, nil
+	case OverflowTruncate, OverflowDescription:
+		return overflow, nil
+	default:
+		return "", fmt.Errorf("unknown title overflow %q, expected %s, %s or %s", name, OverflowFail, OverflowTruncate, OverflowDescription)
+	}
+}
+
+// FitTitles applies the overflow policy to the titles of the user stories and
+// tasks of the plan longer than MaxTitleLength. With OverflowFail, a
+// *PlanError lists them and the plan is left unchanged.
+func (p *Plan) FitTitles(overflow TitleOverflow) error {
+	var errs []error
+	fit := func(item string, name, description *string) {
+		runes := []rune(*name)
+		if len(runes) <= MaxTitleLength {
+			return
+		}
+		switch overflow {
+		case OverflowTruncate, OverflowDescription:
+			*name = string(runes[:MaxTitleLength-1]) + "…"
+			if overflow == OverflowDescription {
+				*description = "<p>…" + html.EscapeString(string(runes[MaxTitleLength-1:])) + "</p>" + *description
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: title of %d characters exceeds %d", item, len(runes), MaxTitleLength))
+		}
+	}
+
+	for i := range p.Items {
+		userStory := &p.Items[i]
+		fit(fmt.Sprintf("items[%d]", i), &userStory.Name, &userStory.Description)
+		for j := range userStory.Tasks {
+			task := &userStory.Tasks[j]
+			fit(fmt.Sprintf("items[%d].tasks[%d]", i, j), &task.Name, &task.Description)
+		}
+	}
+	if len(errs) > 0 {
+		return &PlanError{Err: errors.Join(errs...)}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// stateTransitions moves the work items created in the initial state of their
+// type to the state of their item, reading the states once per project and
+// work item type. It is shared by the tasks created in parallel.
+type stateTransitions struct {
+	mu     sync.Mutex
+	states map[[3]string][]workItemState
+}
+
+// typeStates returns the states of a work item type, read on first use
+func (t *stateTransitions) typeStates(ctx context.Context, c *Client, settings models.AdoSettings, workItemType string) ([]workItemState, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := [3]string{strings.ToLower(settings.Organization), strings.ToLower(settings.Project), workItemType}
+	if typeStates, ok := t.states[key]; ok {
+		return typeStates, nil
+	}
+	typeStates, err := c.workItemTypeStates(ctx, settings, workItemType)
+	if err != nil {
+		return nil, err
+	}
+	t.states[key] = typeStates
+
+	return typeStates, nil
+}
+
+func newStateTransitions() *stateTransitions {
+	return &stateTransitions{states: map[[3]string][]workItemState{}}
+}
+
+// TransitionState moves a work item to state with an update. When the
+// process rejects the direct transition, the work item is moved through the
+// states between its initial state and state in turn, in the order of the
+// process, skipping the Removed states. Intermediate states are set with the
+// reason configured for them, the last one with reason.
+func (c *Client) TransitionState(ctx context.Context, settings models.AdoSettings, id int, workItemType, state, reason string, options Options) error {
+	transitions := options.transitions
+	if transitions == nil {
+		transitions = newStateTransitions()
+	}
+
+	typeStates, err := transitions.typeStates(ctx, c, settings, workItemType)
+	if err != nil {
+		return err
+	}
+
+	target := -1
+	for i, typeState := range typeStates {
+		if strings.EqualFold(typeState.Name, state) {
+			target = i
+		}
+	}
+	if target < 0 {
+		return &StateError{Item: fmt.Sprintf("%d", id), Type: workItemType, State: state, States: stateNames(typeStates)}
+	}
+	if target == 0 {
+		// Created in it
+		return nil
+	}
+
+	err = c.UpdateWorkItem(ctx, settings, id, stateFields(typeStates[target].Name, options.reason(state, reason)))
+	if err == nil || !errors.Is(err, ErrValidation) {
+		return err
+	}
+	c.Logger.Debug("Direct transition rejected, moving through the intermediate states", zap.Int("id", id), zap.String("state", state), zap.Error(err))
+
+	for i := 1; i <= target; i++ {
+		typeState := typeStates[i]
+		stateReason := options.reason(typeState.Name, "")
+		if i == target {
+			stateReason = options.reason(state, reason)
+		} else if strings.EqualFold(typeState.Category, "Removed") {
+			continue
+		}
+		if err := c.UpdateWorkItem(ctx, settings, id, stateFields(typeState.Name, stateReason)); err != nil {
+			return fmt.Errorf("failed to move work item %d to %s: %w", id, typeState.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// stateFields returns the patch setting the state of a work item and its
+// reason, when set
+func stateFields(state, reason string) []map[string]interface{} {
+	return reasonField([]map[string]interface{}{{
+		"op":    "add",
+		"path":  "/fields/System.State",
+		"value": state,
+	}}, reason)
+}
+
+func stateNames(states []workItemState) []string {
+	names := make([]string, 0, len(states))
+	for _, state := range states {
+		names = append(names, state.Name)
+	}
+
+	return names
+}
+
+// transitionState moves a work item just created to its state with
+// Options.TransitionStates. A failure is logged: the work item is created all
+// the same, in its initial state.
+func (c *Client) transitionState(ctx context.Context, settings models.AdoSettings, id int, workItemType, state, reason string, options Options) {
+	if options.transitions == nil || state == "" {
+		return
+	}
+	if err := c.TransitionState(ctx, settings, id, workItemType, state, reason, options); err != nil {
+		c.Logger.Error("Failed to move work item to its state", zap.Int("id", id), zap.String("state", state), zap.Error(err))
+	}
+}
@@ -0,0 +1,261 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// WorkItemCreate is a work item created by CreateWorkItems
+type WorkItemCreate struct {
+	Project string
+	Type    string
+	// Payload is the JSON patch document of the work item
+	Payload any
+}
+
+// CreateWorkItems creates work items of an organization with a single request
+// to the batch API, of up to MaxBatchSize work items. It returns the ID of
+// every work item, or the error creating it.
+func (c *Client) CreateWorkItems(ctx context.Context, settings models.AdoSettings, creates []WorkItemCreate) ([]int, []error) {
+	// The batch endpoint is only documented in version 4.1
+	batchURL := fmt.Sprintf("https://dev.azure.com/%s/_apis/wit/$batch?api-version=4.1", settings.Organization)
+	ids := make([]int, len(creates))
+	errs := make([]error, len(creates))
+	fail := func(err error) ([]int, []error) {
+		for i, create := range creates {
+			errs[i] = &WorkItemError{Op: "create", Type: create.Type, Err: err}
+		}
+		return ids, errs
+	}
+
+	requests := make([]map[string]any, 0, len(creates))
+	for _, create := range creates {
+		requests = append(requests, map[string]any{
+			"method":  "PATCH",
+			"uri":     fmt.Sprintf("/%s/_apis/wit/workitems/$%s?api-version=4.1", url.PathEscape(create.Project), url.PathEscape(create.Type)),
+			"headers": map[string]string{"Content-Type": "application/json-patch+json"},
+			"body":    create.Payload,
+		})
+	}
+	payloadBytes, err := json.Marshal(requests)
+	if err != nil {
+		return fail(fmt.Errorf("failed to marshal payload: %w", err))
+	}
+
+	c.Logger.Debug("Work item batch payload", zap.Int("creates", len(creates)), zap.ByteString("payload", payloadBytes))
+
+	resp, err := c.do(ctx, settings, "POST", batchURL, "application/json", payloadBytes, http.StatusOK)
+	if err != nil {
+		return fail(err)
+	}
+	var response struct {
+		Value []struct {
+			Code int    `json:"code"`
+			Body string `json:"body"`
+		} `json:"value"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	resp.Body.Close()
+	if err != nil {
+		return fail(fmt.Errorf("failed to parse response: %w", err))
+	}
+
+	for i, create := range creates {
+		var body struct {
+			ID      int    `json:"id"`
+			Message string `json:"message"`
+		}
+		if i < len(response.Value) {
+			json.Unmarshal([]byte(response.Value[i].Body), &body)
+			if response.Value[i].Code == http.StatusOK && body.ID != 0 {
+				ids[i] = body.ID
+				continue
+			}
+		}
+
+		payload, _ := json.Marshal(create.Payload)
+		apiErr := &APIError{Status: "no response", Payload: payload}
+		if i < len(response.Value) {
+			apiErr.StatusCode = response.Value[i].Code
+			apiErr.Status = fmt.Sprintf("%d %s", apiErr.StatusCode, http.StatusText(apiErr.StatusCode))
+			apiErr.Message = body.Message
+		}
+		errs[i] = &WorkItemError{Op: "create", Type: create.Type, Err: apiErr}
+	}
+
+	return ids, errs
+}
+
+// stagedStory is a user story of a two-phase run whose result is held until
+// the work items of its chunk are created
+type stagedStory struct {
+	result   Result
+	index    int
+	settings models.AdoSettings
+	// create is set when the user story remains to be created
+	create bool
+	// tasks is set when its tasks remain to be created, but those whose
+	// lower case title is in existing
+	tasks    bool
+	existing map[string]int
+	// resumed user stories were reported by the interrupted run
+	resumed bool
+}
+
+// stagedCreate is a work item created by a batch of a two-phase run
+type stagedCreate struct {
+	settings     models.AdoSettings
+	workItemType string
+	payload      []map[string]interface{}
+	requestID    string
+	// created is called with the ID of the work item, or the error that
+	// failed it, and the duration of its batch
+	created func(id int, err error, latency time.Duration)
+}
+
+// createStaged creates the user stories staged by a two-phase run with the
+// batch API, then the tasks of all of them. Work items left when the run is
+// aborted are reported as skipped.
+func (c *Client) createStaged(ctx context.Context, stage []stagedStory, options Options, outcome *Outcome) {
+	var userStories []stagedCreate
+	for i := range stage {
+		staged := &stage[i]
+		if !staged.create {
+			continue
+		}
+		userStory := staged.result.Item
+		requestID := options.requestID(staged.index)
+		userStories = append(userStories, stagedCreate{
+			settings:     staged.settings,
+			workItemType: UserStoryType(userStory),
+			payload:      userStoryPayload(staged.settings, userStory, requestID, options),
+			requestID:    requestID,
+			created: func(id int, err error, latency time.Duration) {
+				staged.result.Latency = latency
+				if err != nil {
+					c.Logger.Error("Failed to create user story", zap.String("name", userStory.Name), zap.Error(err))
+					staged.result.Status = models.StatusFailed
+					staged.result.Err = err
+					outcome.Record(err)
+					return
+				}
+				staged.result.Status = models.StatusCreated
+				staged.result.ID = id
+				staged.result.URL = WorkItemURL(staged.settings.Organization, staged.settings.Project, id)
+
+				c.Logger.Info("User story created successfully", zap.String("name", userStory.Name), zap.Int("id", id), zap.String("url", staged.result.URL))
+				c.transitionState(ctx, staged.settings, id, UserStoryType(userStory), userStory.State, userStory.Reason, options)
+				c.addComment(ctx, staged.settings, id, options)
+			},
+		})
+	}
+	c.createBatches(ctx, userStories, options, outcome)
+
+	var tasks []stagedCreate
+	for i := range stage {
+		staged := &stage[i]
+		if !staged.tasks || staged.result.ID == 0 {
+			continue
+		}
+		userStory := staged.result.Item
+		for j, task := range userStory.Tasks {
+			taskResult := &staged.result.Tasks[j]
+			if id, ok := staged.existing[strings.ToLower(task.Name)]; ok {
+				taskResult.ID = id
+				taskResult.URL = WorkItemURL(staged.settings.Organization, staged.settings.Project, id)
+				c.Logger.Info("Task already exists, skipping", zap.String("name", task.Name), zap.Int("id", id))
+				continue
+			}
+
+			requestID := options.requestID(staged.index, j)
+			tasks = append(tasks, stagedCreate{
+				settings:     staged.settings,
+				workItemType: TaskType(task),
+				payload:      taskPayload(staged.settings, staged.result.ID, task, requestID, options, userStory),
+				requestID:    requestID,
+				created: func(id int, err error, latency time.Duration) {
+					taskResult.Latency = latency
+					if err != nil {
+						c.Logger.Error("Failed to create task", zap.String("task_name", task.Name), zap.Error(err))
+						taskResult.Status = models.StatusFailed
+						taskResult.Err = err
+						outcome.Record(err)
+						return
+					}
+					taskResult.Status = models.StatusCreated
+					taskResult.ID = id
+					taskResult.URL = WorkItemURL(staged.settings.Organization, staged.settings.Project, id)
+
+					c.Logger.Info("Task created successfully", zap.String("name", task.Name), zap.Int("id", id), zap.String("url", taskResult.URL))
+					c.transitionState(ctx, staged.settings, id, TaskType(task), task.State, task.Reason, options)
+					c.addComment(ctx, staged.settings, id, options)
+				},
+			})
+		}
+	}
+	c.createBatches(ctx, tasks, options, outcome)
+}
+
+// createBatches creates work items with the batch API, in batches of
+// BatchSize work items of an organization. Work items whose create failed
+// ambiguously are retried one by one with their client request ID.
+func (c *Client) createBatches(ctx context.Context, creates []stagedCreate, options Options, outcome *Outcome) {
+	size := c.BatchSize
+	if size <= 0 || size > MaxBatchSize {
+		size = MaxBatchSize
+	}
+
+	// Batches are sent to an organization, in the order of its first work item
+	var organizations []string
+	byOrganization := map[string][]stagedCreate{}
+	for _, create := range creates {
+		organization := strings.ToLower(create.settings.Organization)
+		if _, ok := byOrganization[organization]; !ok {
+			organizations = append(organizations, organization)
+		}
+		byOrganization[organization] = append(byOrganization[organization], create)
+	}
+
+	for _, organization := range organizations {
+		creates := byOrganization[organization]
+		for start := 0; start < len(creates); start += size {
+			if outcome.Aborted() || ctx.Err() != nil {
+				return
+			}
+			batch := creates[start:min(start+size, len(creates))]
+			settings := batch[0].settings
+
+			workItems := make([]WorkItemCreate, 0, len(batch))
+			for _, create := range batch {
+				workItems = append(workItems, WorkItemCreate{Project: create.settings.Project, Type: create.workItemType, Payload: create.payload})
+			}
+			batchCtx, batchSpan := options.tracer().StartSpan(ctx, "work_item_batch", map[string]any{
+				"work_item.type":   batch[0].workItemType,
+				"work_items.count": len(batch),
+				"ado.organization": settings.Organization,
+			})
+			begin := time.Now()
+			ids, errs := c.CreateWorkItems(batchCtx, settings, workItems)
+			latency := time.Since(begin)
+			batchSpan.End(errors.Join(errs...))
+			c.Logger.Info("Work item batch sent", zap.String("type", batch[0].workItemType), zap.Int("work_items", len(batch)), zap.Duration("latency", latency))
+
+			for i, create := range batch {
+				id, err := ids[i], errs[i]
+				if err != nil && create.requestID != "" {
+					id, err = c.retryCreate(ctx, create.settings, create.workItemType, create.payload, create.requestID, options.Retries, id, err)
+				}
+				create.created(id, err, latency)
+			}
+		}
+	}
+}
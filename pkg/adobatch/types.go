@@ -0,0 +1,215 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// Work item types of the user stories and tasks that do not set a type
+const (
+	DefaultUserStoryType = "User Story"
+	DefaultTaskType      = "Task"
+)
+
+// Types of the items files written before the type was used, which stand for
+// the default types
+const (
+	legacyUserStoryType = "user_story"
+	legacyTaskType      = "task"
+)
+
+// UserStoryType returns the work item type a user story is created as
+func UserStoryType(userStory models.UserStory) string {
+	return itemType(userStory.Type, DefaultUserStoryType, legacyUserStoryType)
+}
+
+// TaskType returns the work item type a task is created as
+func TaskType(task models.Task) string {
+	return itemType(task.Type, DefaultTaskType, legacyTaskType)
+}
+
+func itemType(workItemType, defaultType, legacyType string) string {
+	if workItemType = strings.TrimSpace(workItemType); workItemType == "" || strings.EqualFold(workItemType, legacyType) {
+		return defaultType
+	}
+
+	return workItemType
+}
+
+// WorkItemTypeError is returned when the type of an item is not a work item
+// type of the project, or is disabled in its process
+type WorkItemTypeError struct {
+	Type     string
+	Disabled bool
+	// Suggestions are the types closest to a type that is not found,
+	// closest first
+	Suggestions []WorkItemType
+	// Types are the enabled work item types of the project
+	Types []string
+}
+
+func (e *WorkItemTypeError) Error() string {
+	switch {
+	case e.Disabled:
+		return fmt.Sprintf("work item type %q is disabled in the process of the project", e.Type)
+	case len(e.Suggestions) > 0:
+		names := make([]string, 0, len(e.Suggestions))
+		for _, suggestion := range e.Suggestions {
+			names = append(names, fmt.Sprintf("%q", suggestion.Name))
+		}
+		return fmt.Sprintf("work item type %q not found, did you mean %s?", e.Type, strings.Join(names, " or "))
+	}
+
+	return fmt.Sprintf("work item type %q not found, expected one of %s", e.Type, strings.Join(e.Types, ", "))
+}
+
+// Unwrap matches ErrValidation
+func (e *WorkItemTypeError) Unwrap() error {
+	return ErrValidation
+}
+
+// ResolveWorkItemType returns the name of a work item type of the project
+// from its name, such as "Enabler", or its reference name, such as
+// Custom.Enabler, ignoring case. Disabled types are rejected.
+func ResolveWorkItemType(types []WorkItemType, name string) (string, error) {
+	trimmed := strings.TrimSpace(name)
+	enabled := make([]string, 0, len(types))
+	for _, workItemType := range types {
+		if strings.EqualFold(workItemType.Name, trimmed) || strings.EqualFold(workItemType.ReferenceName, trimmed) {
+			if workItemType.Disabled {
+				return "", &WorkItemTypeError{Type: name, Disabled: true}
+			}
+			return workItemType.Name, nil
+		}
+		if !workItemType.Disabled {
+			enabled = append(enabled, workItemType.Name)
+		}
+	}
+	sort.Strings(enabled)
+
+	suggestions := closest(name, types, func(workItemType WorkItemType) []string {
+		if workItemType.Disabled {
+			return nil
+		}
+		return []string{workItemType.Name, workItemType.ReferenceName}
+	})
+
+	return "", &WorkItemTypeError{Type: name, Suggestions: suggestions, Types: enabled}
+}
+
+// ResolveWorkItemTypes replaces the types set by the user stories and tasks
+// with the names of the work item types of their project, read once per
+// project. The items that do not set a type, or set the "user_story" and
+// "task" of older items files, are created as user stories and tasks. Every
+// unknown or disabled type is joined in the error.
+func (c *Client) ResolveWorkItemTypes(ctx context.Context, plan *Plan) error {
+	projects := map[[2]string][]WorkItemType{}
+	var errs []error
+	for i := range plan.Items {
+		userStory := &plan.Items[i]
+		if !setsType(*userStory) {
+			continue
+		}
+
+		settings := c.SettingsFor(*userStory)
+		key := [2]string{strings.ToLower(settings.Organization), strings.ToLower(settings.Project)}
+		types, ok := projects[key]
+		if !ok {
+			var err error
+			if types, err = c.WorkItemTypes(ctx, settings); err != nil {
+				return &WorkItemError{Op: "read", Type: "work item types", Err: err}
+			}
+			projects[key] = types
+		}
+
+		resolve := func(item string, workItemType *string, defaultType string) {
+			if *workItemType == defaultType {
+				return
+			}
+			name, err := ResolveWorkItemType(types, *workItemType)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%q: %w", item, err))
+				return
+			}
+			*workItemType = name
+		}
+		userStory.Type = UserStoryType(*userStory)
+		resolve(userStory.Name, &userStory.Type, DefaultUserStoryType)
+		for j := range userStory.Tasks {
+			task := &userStory.Tasks[j]
+			task.Type = TaskType(*task)
+			resolve(task.Name, &task.Type, DefaultTaskType)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setsType reports whether a user story or one of its tasks sets another
+// type than the default one
+func setsType(userStory models.UserStory) bool {
+	if UserStoryType(userStory) != DefaultUserStoryType {
+		return true
+	}
+	for _, task := range userStory.Tasks {
+		if TaskType(task) != DefaultTaskType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// processWorkItemTypes returns the work item types of the inherited process
+// of the project, with their customization, or none for the projects of
+// other processes
+func (c *Client) processWorkItemTypes(ctx context.Context, settings models.AdoSettings) ([]WorkItemType, error) {
+	projectURL := fmt.Sprintf("https://dev.azure.com/%s/_apis/projects/%s?includeCapabilities=true&api-version=7.0", settings.Organization, url.PathEscape(settings.Project))
+	var project struct {
+		Capabilities struct {
+			ProcessTemplate struct {
+				TemplateTypeID string `json:"templateTypeId"`
+			} `json:"processTemplate"`
+		} `json:"capabilities"`
+	}
+	if err := c.get(ctx, settings, projectURL, &project); err != nil {
+		return nil, err
+	}
+	processID := project.Capabilities.ProcessTemplate.TemplateTypeID
+	if processID == "" {
+		return nil, nil
+	}
+
+	typesURL := fmt.Sprintf("https://dev.azure.com/%s/_apis/work/processes/%s/workitemtypes?api-version=7.0", settings.Organization, url.PathEscape(processID))
+	var response struct {
+		Value []struct {
+			Name          string `json:"name"`
+			ReferenceName string `json:"referenceName"`
+			Description   string `json:"description"`
+			Customization string `json:"customization"`
+			IsDisabled    bool   `json:"isDisabled"`
+		} `json:"value"`
+	}
+	if err := c.get(ctx, settings, typesURL, &response); err != nil {
+		return nil, err
+	}
+
+	types := make([]WorkItemType, 0, len(response.Value))
+	for _, value := range response.Value {
+		types = append(types, WorkItemType{
+			Name:          value.Name,
+			ReferenceName: value.ReferenceName,
+			Description:   value.Description,
+			Customization: value.Customization,
+			Disabled:      value.IsDisabled,
+		})
+	}
+
+	return types, nil
+}
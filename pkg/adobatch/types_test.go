@@ -0,0 +1,120 @@
+package adobatch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+func TestItemTypes(t *testing.T) {
+	tests := []struct {
+		value         string
+		userStoryType string
+		taskType      string
+	}{
+		{"", DefaultUserStoryType, DefaultTaskType},
+		{"user_story", DefaultUserStoryType, "user_story"},
+		{" USER_STORY ", DefaultUserStoryType, "USER_STORY"},
+		{"task", "task", DefaultTaskType},
+		{"Task", "Task", DefaultTaskType},
+		{"Spike", "Spike", "Spike"},
+	}
+	for _, tt := range tests {
+		if got := UserStoryType(models.UserStory{Type: tt.value}); got != tt.userStoryType {
+			t.Errorf("UserStoryType(%q) = %q, want %q", tt.value, got, tt.userStoryType)
+		}
+		if got := TaskType(models.Task{Type: tt.value}); got != tt.taskType {
+			t.Errorf("TaskType(%q) = %q, want %q", tt.value, got, tt.taskType)
+		}
+	}
+}
+
+func TestApplyLegacyTypes(t *testing.T) {
+	client, server := newTestClient(t)
+
+	plan := &Plan{Items: []models.UserStory{{
+		Name:  "US1",
+		Type:  "user_story",
+		Tasks: []models.Task{{Name: "Task 1", Type: "task"}, {Name: "Task 2"}},
+	}}}
+	results := client.Apply(context.Background(), plan, Options{})
+	if results.AbortReason != "" {
+		t.Fatalf("run aborted: %s", results.AbortReason)
+	}
+
+	want := map[string]string{"US1": "User Story", "Task 1": "Task", "Task 2": "Task"}
+	for _, item := range server.WorkItems() {
+		title := item.Fields["System.Title"].(string)
+		if got := item.Fields["System.WorkItemType"]; got != want[title] {
+			t.Errorf("%s created as %v, want %s", title, got, want[title])
+		}
+		delete(want, title)
+	}
+	if len(want) > 0 {
+		t.Errorf("not created: %v", want)
+	}
+	for _, request := range server.Requests() {
+		if strings.HasSuffix(request.Path, "/_apis/wit/workitemtypes") {
+			t.Errorf("work item types read for the default types")
+		}
+	}
+}
+
+func TestResolveWorkItemTypes(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	plan := &Plan{Items: []models.UserStory{{
+		Name:  "US1",
+		Type:  "custom.enabler",
+		Tasks: []models.Task{{Name: "Task 1", Type: "bug"}, {Name: "Task 2", Type: "task"}},
+	}}}
+	if err := client.ResolveWorkItemTypes(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+	userStory := plan.Items[0]
+	if userStory.Type != "Enabler" || userStory.Tasks[0].Type != "Bug" || userStory.Tasks[1].Type != DefaultTaskType {
+		t.Errorf("types = %q, %q, %q", userStory.Type, userStory.Tasks[0].Type, userStory.Tasks[1].Type)
+	}
+
+	plan = &Plan{Items: []models.UserStory{{Name: "US1", Type: "Enablr", Tasks: []models.Task{{Name: "Task 1", Type: "Issue"}}}}}
+	err := client.ResolveWorkItemTypes(context.Background(), plan)
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("error = %v, want a validation error", err)
+	}
+	for _, want := range []string{`did you mean "Enabler"`, `"Issue" is disabled`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestExportTypes(t *testing.T) {
+	client, server := newTestClient(t)
+	server.AddWorkItem("User Story", map[string]any{"System.Title": "US1", "System.TeamProject": "project"})
+	server.AddWorkItem("Enabler", map[string]any{"System.Title": "Enabler 1", "System.TeamProject": "project"})
+	server.AddWorkItem("Task", map[string]any{"System.Title": "Task 1", "System.TeamProject": "project"})
+
+	plan, err := client.Export(context.Background(), client.Settings, "SELECT [System.Id] FROM WorkItems WHERE [System.TeamProject] = @project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Items) != 2 {
+		t.Fatalf("exported %d items, want 2", len(plan.Items))
+	}
+	if plan.Items[0].Type != "" || plan.Items[1].Type != "Enabler" {
+		t.Errorf("types = %q, %q, want none and Enabler", plan.Items[0].Type, plan.Items[1].Type)
+	}
+
+	// The exported items apply again
+	results := client.Apply(context.Background(), plan, Options{})
+	if results.AbortReason != "" || results.Summary.Created != 2 {
+		t.Fatalf("applied the export: aborted %q, %d created", results.AbortReason, results.Summary.Created)
+	}
+	item, _ := server.WorkItem(results.Items[1].ID)
+	if item.Fields["System.WorkItemType"] != "Enabler" {
+		t.Errorf("re-created as %v, want Enabler", item.Fields["System.WorkItemType"])
+	}
+}
@@ -0,0 +1,45 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// UpdateWorkItem applies a JSON patch document to an existing work item
+func (c *Client) UpdateWorkItem(ctx context.Context, settings models.AdoSettings, id int, payload any) error {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workitems/%d?api-version=7.0", settings.Organization, settings.Project, id)
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	c.Logger.Debug("Work item update payload", zap.Int("id", id), zap.ByteString("payload", payloadBytes))
+
+	resp, err := c.do(ctx, settings, "PATCH", url, "application/json-patch+json", payloadBytes, http.StatusOK)
+	if err != nil {
+		return &WorkItemError{Op: "update", Type: fmt.Sprintf("work item %d", id), Err: err}
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// DeleteWorkItem moves a work item to the Recycle Bin of its project, where
+// it can be restored
+func (c *Client) DeleteWorkItem(ctx context.Context, settings models.AdoSettings, id int) error {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/workitems/%d?api-version=7.0", settings.Organization, settings.Project, id)
+
+	resp, err := c.do(ctx, settings, "DELETE", url, "application/json", nil, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return &WorkItemError{Op: "delete", Type: fmt.Sprintf("work item %d", id), Err: err}
+	}
+	resp.Body.Close()
+
+	return nil
+}
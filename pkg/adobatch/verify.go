@@ -0,0 +1,138 @@
+package adobatch
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// Drift is a field of a created work item that does not hold the value of
+// the plan, for instance because a process rule rewrote it. A deleted work
+// item is reported with the System.Id field and an empty Actual value.
+type Drift struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	ID       int    `json:"id"`
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// Verify reads the work items created for the results back from Azure
+// DevOps and returns the fields that differ from their item. Only the fields
+// the item sets are checked, Azure DevOps fills the others with defaults.
+func (c *Client) Verify(ctx context.Context, results []Result) ([]Drift, error) {
+	var drifts []Drift
+	for _, result := range results {
+		if result.Status != models.StatusCreated {
+			continue
+		}
+		settings := c.SettingsFor(result.Item)
+
+		ids := []int{result.ID}
+		for _, task := range result.Tasks {
+			if task.Status == models.StatusCreated {
+				ids = append(ids, task.ID)
+			}
+		}
+		workItems, err := c.getWorkItems(ctx, settings, ids, nil)
+		if err != nil {
+			return drifts, err
+		}
+		found := make(map[int]workItem, len(workItems))
+		for _, workItem := range workItems {
+			found[workItem.ID] = workItem
+		}
+
+		userStory := result.Item
+		check := newDriftCheck(UserStoryType(userStory), userStory.Name, result.ID, found, &drifts)
+		check.fields(userStory.Name, userStory.Description, userStory.Owner, userStory.State, userStory.Priority, userStory.Area)
+		check.parent(userStory.Parent)
+
+		for _, task := range result.Tasks {
+			if task.Status != models.StatusCreated {
+				continue
+			}
+			check := newDriftCheck(TaskType(task.Item), task.Item.Name, task.ID, found, &drifts)
+			check.fields(task.Item.Name, task.Item.Description, task.Item.Owner, task.Item.State, task.Item.Priority, userStory.Area)
+			check.parent(result.ID)
+		}
+	}
+
+	return drifts, nil
+}
+
+// driftCheck compares a work item with the values it was created with
+type driftCheck struct {
+	Drift
+	workItem workItem
+	found    bool
+	drifts   *[]Drift
+}
+
+func newDriftCheck(workItemType, name string, id int, found map[int]workItem, drifts *[]Drift) *driftCheck {
+	check := &driftCheck{Drift: Drift{Type: workItemType, Name: name, ID: id}, drifts: drifts}
+	check.workItem, check.found = found[id]
+	if !check.found {
+		check.report("System.Id", strconv.Itoa(id), "")
+	}
+
+	return check
+}
+
+// fields checks the fields set by the engine when creating a work item
+func (d *driftCheck) fields(title, description, owner, state string, priority models.Priority, area string) {
+	if !d.found {
+		return
+	}
+
+	d.compare("System.Title", title, d.workItem.field("System.Title"))
+	d.compare("System.Description", description, d.workItem.field("System.Description"))
+	d.compare("System.State", state, d.workItem.field("System.State"))
+	d.compare("System.AreaPath", area, d.workItem.field("System.AreaPath"))
+	if priority != 0 {
+		d.compare("Microsoft.VSTS.Common.Priority", strconv.Itoa(int(priority)), strconv.Itoa(int(d.workItem.priority())))
+	}
+
+	// The owner is resolved to an identity, matched by unique or display name
+	if owner != "" {
+		identity, _ := d.workItem.Fields["System.AssignedTo"].(map[string]any)
+		uniqueName, _ := identity["uniqueName"].(string)
+		displayName, _ := identity["displayName"].(string)
+		if !strings.EqualFold(owner, uniqueName) && !strings.EqualFold(owner, displayName) {
+			d.report("System.AssignedTo", owner, uniqueName)
+		}
+	}
+}
+
+// parent checks the work item is linked under parentID
+func (d *driftCheck) parent(parentID int) {
+	if !d.found || parentID == 0 {
+		return
+	}
+
+	parents := d.workItem.linked("System.LinkTypes.Hierarchy-Reverse")
+	if len(parents) == 0 {
+		d.report("System.Parent", strconv.Itoa(parentID), "")
+	} else if parents[0] != parentID {
+		d.report("System.Parent", strconv.Itoa(parentID), strconv.Itoa(parents[0]))
+	}
+}
+
+// compare reports a drift when the item sets a value the work item does not
+// hold
+func (d *driftCheck) compare(field, expected, actual string) {
+	if expected != "" && strings.TrimSpace(expected) != strings.TrimSpace(actual) {
+		d.report(field, expected, actual)
+	}
+}
+
+func (d *driftCheck) report(field, expected, actual string) {
+	drift := d.Drift
+	drift.Field = field
+	drift.Expected = expected
+	drift.Actual = actual
+	*d.drifts = append(*d.drifts, drift)
+}
@@ -0,0 +1,69 @@
+package adobatch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+// AutomationTag is added to every work item created by the engine
+const AutomationTag = "system_automated"
+
+// QueryWorkItems runs a WIQL query and returns the IDs of the matching work
+// items
+func (c *Client) QueryWorkItems(ctx context.Context, settings models.AdoSettings, query string) ([]int, error) {
+	url := fmt.Sprintf("https://dev.azure.com/%s/%s/_apis/wit/wiql?api-version=7.0", settings.Organization, settings.Project)
+
+	payloadBytes, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	resp, err := c.do(ctx, settings, "POST", url, "application/json", payloadBytes, http.StatusOK)
+	if err != nil {
+		return nil, &WorkItemError{Op: "query", Type: "work items", Err: err}
+	}
+	defer resp.Body.Close()
+
+	var responseBody struct {
+		WorkItems []struct {
+			Id int `json:"id"`
+		} `json:"workItems"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	ids := make([]int, 0, len(responseBody.WorkItems))
+	for _, workItem := range responseBody.WorkItems {
+		ids = append(ids, workItem.Id)
+	}
+
+	return ids, nil
+}
+
+// FindExistingUserStory returns the ID of a user story of a work item type
+// with the same title previously created by the engine, or 0 when there is
+// none
+func (c *Client) FindExistingUserStory(ctx context.Context, settings models.AdoSettings, workItemType, title string) (int, error) {
+	query := fmt.Sprintf(
+		"SELECT [System.Id] FROM WorkItems WHERE [System.TeamProject] = @project AND [System.WorkItemType] = %s AND [System.Title] = %s AND [System.Tags] CONTAINS %s",
+		WIQLString(workItemType), WIQLString(title), WIQLString(AutomationTag),
+	)
+
+	ids, err := c.QueryWorkItems(ctx, settings, query)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	return ids[0], nil
+}
+
+// WIQLString quotes a value to be used as a WIQL string literal
+func WIQLString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,31 @@
+// Package adotest provides a fake of the Azure DevOps work item APIs used by
+// the adobatch engine, to test batches without an organization. The fake keeps
+// work items in memory: creates, updates, links, deletes and reads them, and
+// answers simple WIQL queries.
+//
+// A Server is pointed at by the client of a test through its transport,
+// which sends every request to the fake whatever its host:
+//
+//	server := adotest.NewServer()
+//	defer server.Close()
+//
+//	client := adobatch.NewClient(models.AdoSettings{Organization: "org", Project: "project", Pat: "pat"})
+//	client.HTTPClient = server.Client()
+//	results := client.Apply(ctx, plan, adobatch.Options{})
+//
+//	item, _ := server.WorkItem(results.Items[0].ID)
+//	if item.Fields["System.Title"] != "US1" {
+//		t.Errorf("title = %v", item.Fields["System.Title"])
+//	}
+//
+// Rules answer the requests they match with canned responses before the
+// fake does, such as to reject a payload or throttle the client:
+//
+//	server.AddRule(adotest.Rule{
+//		Method: http.MethodPost,
+//		Path:   "/_apis/wit/workitems/$Task",
+//		Times:  1,
+//		Status: http.StatusTooManyRequests,
+//		Headers: map[string]string{"Retry-After": "1"},
+//	})
+package adotest
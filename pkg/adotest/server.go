@@ -0,0 +1,516 @@
+package adotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an in-memory fake of the Azure DevOps work item APIs. Its
+// methods are safe to call while requests are served.
+type Server struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	nextID    int
+	workItems map[int]*WorkItem
+	rules     []*Rule
+	requests  []Request
+	latency   time.Duration
+}
+
+// WorkItem is a work item of the fake
+type WorkItem struct {
+	ID  int `json:"id"`
+	Rev int `json:"rev"`
+	// Fields are the values set by the requests, with System.Id,
+	// System.Rev, System.WorkItemType, System.TeamProject and System.State.
+	// System.AssignedTo is an identity, with a displayName and a uniqueName.
+	Fields    map[string]any   `json:"fields"`
+	Relations []map[string]any `json:"relations,omitempty"`
+	URL       string           `json:"url"`
+}
+
+// Request is a request received by the fake
+type Request struct {
+	Method string
+	// Path and Query are the path and query string of the request URL
+	Path  string
+	Query string
+	Body  []byte
+}
+
+// Rule answers the requests it matches with a canned response instead of the
+// fake
+type Rule struct {
+	// Method and Path match the requests with that method, any when empty,
+	// and whose path contains Path
+	Method string
+	Path   string
+	// Times is the number of requests the rule answers, every request when 0
+	Times int
+
+	Status  int
+	Headers map[string]string
+	// Body is written as JSON, unless it is a string or a byte slice
+	Body any
+
+	answered int
+}
+
+// States are the states of every work item type of the fake, in the order
+// of the process
+var States = []struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}{
+	{"New", "Proposed"},
+	{"Active", "InProgress"},
+	{"Resolved", "Resolved"},
+	{"Closed", "Completed"},
+	{"Removed", "Removed"},
+}
+
+// Fields are the fields of the projects of the fake, with a custom field of
+// an inherited process
+var Fields = []map[string]any{
+	{"name": "ID", "referenceName": "System.Id", "type": "integer", "readOnly": true},
+	{"name": "Title", "referenceName": "System.Title", "type": "string"},
+	{"name": "Description", "referenceName": "System.Description", "type": "html"},
+	{"name": "Assigned To", "referenceName": "System.AssignedTo", "type": "identity"},
+	{"name": "State", "referenceName": "System.State", "type": "string"},
+	{"name": "Tags", "referenceName": "System.Tags", "type": "plainText"},
+	{"name": "Area Path", "referenceName": "System.AreaPath", "type": "treePath"},
+	{"name": "Iteration Path", "referenceName": "System.IterationPath", "type": "treePath"},
+	{"name": "Priority", "referenceName": "Microsoft.VSTS.Common.Priority", "type": "integer"},
+	{"name": "Story Points", "referenceName": "Microsoft.VSTS.Scheduling.StoryPoints", "type": "double"},
+	{"name": "Cost Center", "referenceName": "Custom.CostCenter", "type": "string"},
+}
+
+// ProcessID is the inherited process of the projects of the fake
+const ProcessID = "c0a5d1f2-7e53-4a4e-9d5c-0b1c2a3d4e5f"
+
+// Types are the work item types of the projects of the fake, with a custom
+// type and a disabled one of the inherited process
+var Types = []map[string]any{
+	{"name": "User Story", "referenceName": "Custom.UserStory", "customization": "inherited"},
+	{"name": "Task", "referenceName": "Custom.Task", "customization": "inherited"},
+	{"name": "Bug", "referenceName": "Microsoft.VSTS.WorkItemTypes.Bug", "customization": "system"},
+	{"name": "Enabler", "referenceName": "Custom.Enabler", "customization": "custom"},
+	{"name": "Issue", "referenceName": "Microsoft.VSTS.WorkItemTypes.Issue", "customization": "system", "isDisabled": true},
+}
+
+// NewServer starts a fake on a loopback address
+func NewServer() *Server {
+	s := &Server{nextID: 1, workItems: map[int]*WorkItem{}}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// Close stops the fake
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL is the base URL of the fake
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Client returns an HTTP client sending every request to the fake
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: s.Transport()}
+}
+
+// Transport returns a transport sending every request to the fake, whatever
+// its host, such as dev.azure.com or vssps.dev.azure.com
+func (s *Server) Transport() http.RoundTripper {
+	return transport{s}
+}
+
+type transport struct {
+	s *Server
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, err := url.Parse(t.s.server.URL)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host, req.Host = target.Scheme, target.Host, ""
+
+	return t.s.server.Client().Transport.RoundTrip(req)
+}
+
+// SetLatency delays every response by latency, as a network round trip and
+// Azure DevOps would, such as to compare concurrency settings. Requests are
+// delayed concurrently.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+// AddRule adds a rule, matched before the rules added before it
+func (s *Server) AddRule(rule Rule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = append([]*Rule{&rule}, s.rules...)
+}
+
+// AddWorkItem adds a work item to the fake, such as one a previous run
+// created, and returns its ID
+func (s *Server) AddWorkItem(workItemType string, fields map[string]any) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := s.newWorkItem("", workItemType)
+	for field, value := range fields {
+		item.Fields[field] = value
+	}
+	item.Rev = 1
+	item.Fields["System.Rev"] = item.Rev
+
+	return item.ID
+}
+
+// WorkItem returns a copy of a work item
+func (s *Server) WorkItem(id int) (WorkItem, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.workItems[id]
+	if !ok {
+		return WorkItem{}, false
+	}
+
+	return item.copy(), true
+}
+
+// WorkItems returns a copy of every work item, by ID
+func (s *Server) WorkItems() []WorkItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]WorkItem, 0, len(s.workItems))
+	for _, item := range s.workItems {
+		items = append(items, item.copy())
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+	return items
+}
+
+// Requests returns the requests received, in order
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+func (w *WorkItem) copy() WorkItem {
+	item := *w
+	item.Fields = make(map[string]any, len(w.Fields))
+	for field, value := range w.Fields {
+		item.Fields[field] = value
+	}
+	item.Relations = append([]map[string]any(nil), w.Relations...)
+
+	return item
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+	time.Sleep(latency)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Body: body})
+
+	for _, rule := range s.rules {
+		if rule.matches(r) {
+			rule.answered++
+			rule.write(w)
+			return
+		}
+	}
+
+	status, response := s.handle(r, body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (r *Rule) matches(req *http.Request) bool {
+	return (r.Method == "" || strings.EqualFold(r.Method, req.Method)) &&
+		strings.Contains(req.URL.Path, r.Path) &&
+		(r.Times == 0 || r.answered < r.Times)
+}
+
+func (r *Rule) write(w http.ResponseWriter) {
+	var body []byte
+	switch value := r.Body.(type) {
+	case nil:
+	case string:
+		body = []byte(value)
+	case []byte:
+		body = value
+	default:
+		body, _ = json.Marshal(value)
+		w.Header().Set("Content-Type", "application/json")
+	}
+	for header, value := range r.Headers {
+		w.Header().Set(header, value)
+	}
+	w.WriteHeader(r.Status)
+	w.Write(body)
+}
+
+// handle answers a request with the fake, and returns the status and the
+// JSON response
+func (s *Server) handle(r *http.Request, body []byte) (int, any) {
+	// Paths are /{organization}[/{project}[/{team}]]/_apis/{area}/...
+	prefix, api, ok := strings.Cut(r.URL.Path, "/_apis/")
+	if !ok {
+		return http.StatusNotFound, message("not an API path")
+	}
+	project := ""
+	if segments := strings.Split(strings.Trim(prefix, "/"), "/"); len(segments) > 1 {
+		project = segments[1]
+	}
+	parts := strings.Split(api, "/")
+
+	switch {
+	case api == "connectionData":
+		return http.StatusOK, map[string]any{"authenticatedUser": map[string]any{"providerDisplayName": "Test User"}}
+	case len(parts) == 4 && parts[0] == "wit" && parts[1] == "workitemtypes" && parts[3] == "states":
+		return http.StatusOK, map[string]any{"value": States}
+	case len(parts) == 3 && parts[0] == "wit" && parts[1] == "workitemtypes":
+		return http.StatusOK, map[string]any{"name": parts[2]}
+	case api == "wit/workitemtypes":
+		return http.StatusOK, map[string]any{"count": len(Types), "value": Types}
+	case len(parts) == 2 && parts[0] == "projects":
+		return http.StatusOK, map[string]any{"name": parts[1], "capabilities": map[string]any{"processTemplate": map[string]string{"templateTypeId": ProcessID}}}
+	case api == "work/processes/"+ProcessID+"/workitemtypes":
+		return http.StatusOK, map[string]any{"count": len(Types), "value": Types}
+	case api == "wit/fields":
+		return http.StatusOK, map[string]any{"count": len(Fields), "value": Fields}
+	case api == "wit/wiql":
+		return s.query(project, body)
+	case api == "wit/$batch":
+		return s.batch(body)
+	case api == "wit/workitems" && r.Method == http.MethodGet:
+		return http.StatusOK, s.list(strings.Split(r.URL.Query().Get("ids"), ","))
+	case api == "wit/workitemsbatch":
+		var request struct {
+			IDs []int `json:"ids"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			return http.StatusBadRequest, message(err.Error())
+		}
+		ids := make([]string, 0, len(request.IDs))
+		for _, id := range request.IDs {
+			ids = append(ids, strconv.Itoa(id))
+		}
+		return http.StatusOK, s.list(ids)
+	case len(parts) == 3 && parts[0] == "wit" && parts[1] == "workitems" && strings.HasPrefix(parts[2], "$"):
+		if r.URL.Query().Get("validateOnly") == "true" {
+			return http.StatusOK, map[string]any{}
+		}
+		return s.create(r, project, strings.TrimPrefix(parts[2], "$"), body)
+	case len(parts) == 4 && parts[0] == "wit" && parts[1] == "workitems" && parts[3] == "comments":
+		return http.StatusOK, map[string]any{"id": 1}
+	case len(parts) == 3 && parts[0] == "wit" && parts[1] == "workitems":
+		return s.workItem(r, parts[2], body)
+	case api == "work/teamsettings/iterations":
+		return http.StatusOK, map[string]any{"value": []map[string]any{sprint(project, r.URL.Query().Get("$timeframe"))}}
+	default:
+		return http.StatusOK, map[string]any{"count": 0, "value": []any{}}
+	}
+}
+
+func message(text string) map[string]any {
+	return map[string]any{"message": text}
+}
+
+func (s *Server) newWorkItem(project, workItemType string) *WorkItem {
+	item := &WorkItem{
+		ID:     s.nextID,
+		Fields: map[string]any{"System.Id": s.nextID, "System.WorkItemType": workItemType, "System.State": States[0].Name},
+		URL:    fmt.Sprintf("%s/_apis/wit/workItems/%d", s.server.URL, s.nextID),
+	}
+	if project != "" {
+		item.Fields["System.TeamProject"] = project
+	}
+	s.workItems[item.ID] = item
+	s.nextID++
+
+	return item
+}
+
+// create creates a work item from a JSON patch document
+func (s *Server) create(r *http.Request, project, workItemType string, body []byte) (int, any) {
+	item := s.newWorkItem(project, workItemType)
+	if err := item.patch(body); err != nil {
+		delete(s.workItems, item.ID)
+		return http.StatusBadRequest, message(err.Error())
+	}
+
+	return http.StatusOK, item
+}
+
+// workItem reads, updates or deletes a work item
+func (s *Server) workItem(r *http.Request, segment string, body []byte) (int, any) {
+	id, _ := strconv.Atoi(segment)
+	item, ok := s.workItems[id]
+	if !ok {
+		return http.StatusNotFound, message(fmt.Sprintf("TF401232: Work item %s does not exist.", segment))
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		if err := item.patch(body); err != nil {
+			return http.StatusBadRequest, message(err.Error())
+		}
+		return http.StatusOK, item
+	case http.MethodDelete:
+		delete(s.workItems, id)
+		return http.StatusOK, map[string]any{"id": id}
+	default:
+		return http.StatusOK, item
+	}
+}
+
+// list reads the work items of a list of IDs, the missing ones left out
+func (s *Server) list(ids []string) map[string]any {
+	items := []*WorkItem{}
+	for _, value := range ids {
+		id, _ := strconv.Atoi(value)
+		if item, ok := s.workItems[id]; ok {
+			items = append(items, item)
+		}
+	}
+
+	return map[string]any{"count": len(items), "value": items}
+}
+
+// batch applies the creates and updates of a $batch request
+func (s *Server) batch(body []byte) (int, any) {
+	var requests []struct {
+		URI  string          `json:"uri"`
+		Body json.RawMessage `json:"body"`
+	}
+	if err := json.Unmarshal(body, &requests); err != nil {
+		return http.StatusBadRequest, message(err.Error())
+	}
+
+	responses := make([]map[string]any, 0, len(requests))
+	for _, request := range requests {
+		prefix, path, _ := strings.Cut(request.URI, "_apis/wit/workitems/")
+		segment, _, _ := strings.Cut(path, "?")
+		if workItemType, ok := strings.CutPrefix(segment, "$"); ok {
+			project, _ := url.PathUnescape(strings.Trim(prefix, "/"))
+			workItemType, _ = url.PathUnescape(workItemType)
+			status, response := s.create(nil, project, workItemType, request.Body)
+			data, _ := json.Marshal(response)
+			responses = append(responses, map[string]any{"code": status, "body": string(data)})
+			continue
+		}
+		id, _ := strconv.Atoi(segment)
+		item, ok := s.workItems[id]
+		if !ok {
+			responses = append(responses, map[string]any{"code": http.StatusNotFound, "body": `{"message":"work item not found"}`})
+			continue
+		}
+		if err := item.patch(request.Body); err != nil {
+			data, _ := json.Marshal(message(err.Error()))
+			responses = append(responses, map[string]any{"code": http.StatusBadRequest, "body": string(data)})
+			continue
+		}
+		responses = append(responses, map[string]any{"code": http.StatusOK, "body": "{}"})
+	}
+
+	return http.StatusOK, map[string]any{"count": len(responses), "value": responses}
+}
+
+// patch applies a JSON patch document to a work item: add operations on
+// fields and relations, and test operations on the revision
+func (w *WorkItem) patch(body []byte) error {
+	var operations []struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+	if err := json.Unmarshal(body, &operations); err != nil {
+		return fmt.Errorf("invalid JSON patch document: %w", err)
+	}
+
+	for _, operation := range operations {
+		switch {
+		case operation.Op == "test" && operation.Path == "/rev":
+			if fmt.Sprint(operation.Value) != strconv.Itoa(w.Rev) {
+				return fmt.Errorf("TF26071: This work item has been changed by someone else since you opened it")
+			}
+		case operation.Op != "add":
+			return fmt.Errorf("unsupported operation %s %s", operation.Op, operation.Path)
+		case operation.Path == "/relations/-":
+			relation, _ := operation.Value.(map[string]any)
+			w.Relations = append(w.Relations, relation)
+		case operation.Path == "/fields/System.State" && operation.Value == "":
+			// Azure DevOps keeps the initial state
+		case operation.Path == "/fields/System.AssignedTo" && operation.Value != "":
+			// Azure DevOps returns the identity
+			w.Fields["System.AssignedTo"] = map[string]any{"displayName": operation.Value, "uniqueName": operation.Value}
+		case strings.HasPrefix(operation.Path, "/fields/"):
+			w.Fields[strings.TrimPrefix(operation.Path, "/fields/")] = operation.Value
+		default:
+			return fmt.Errorf("unsupported operation %s %s", operation.Op, operation.Path)
+		}
+	}
+	w.Rev++
+	w.Fields["System.Rev"] = w.Rev
+
+	return nil
+}
+
+// sprint returns the iteration of every team in a timeframe: the two week
+// sprint of today, or the next one
+func sprint(project, timeframe string) map[string]any {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	start := today.AddDate(0, 0, -int(today.Weekday()-time.Monday+7)%7)
+	number := 1
+	if timeframe == "future" {
+		start, number = start.AddDate(0, 0, 14), 2
+	}
+
+	return map[string]any{
+		"id":   fmt.Sprintf("sprint-%d", number),
+		"name": fmt.Sprintf("Sprint %d", number),
+		"path": fmt.Sprintf(`%s\Sprint %d`, project, number),
+		"attributes": map[string]any{
+			"startDate":  start,
+			"finishDate": start.AddDate(0, 0, 11),
+		},
+	}
+}
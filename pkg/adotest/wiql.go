@@ -0,0 +1,199 @@
+package adotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	selectClause = regexp.MustCompile(`(?is)^\s*SELECT\s+(.*?)\s+FROM\s+(\w+)(?:\s+WHERE\s+(.*?))?(?:\s+ORDER\s+BY\s+.*)?\s*$`)
+	condition    = regexp.MustCompile(`(?is)^\[([^\]]+)\]\s*(=|<>|NOT\s+CONTAINS|CONTAINS|NOT\s+IN|IN|UNDER)\s*(.+)$`)
+)
+
+// query answers a WIQL query with the work items matching it, in ID order.
+// Conditions are joined with AND, or with OR in parentheses, and compare a
+// field with =, <>, CONTAINS, NOT CONTAINS, IN, NOT IN or UNDER. Conditions
+// the fake does not understand, such as on dates, match every work item.
+// Link queries are not supported.
+func (s *Server) query(project string, body []byte) (int, any) {
+	var request struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return http.StatusBadRequest, message(err.Error())
+	}
+	match := selectClause.FindStringSubmatch(request.Query)
+	if match == nil {
+		return http.StatusBadRequest, message("TF51006: The query statement is not valid")
+	}
+	if !strings.EqualFold(match[2], "WorkItems") {
+		return http.StatusBadRequest, message(fmt.Sprintf("the fake does not support queries from %s", match[2]))
+	}
+
+	columns := []map[string]string{}
+	for _, column := range strings.Split(match[1], ",") {
+		field := strings.Trim(strings.TrimSpace(column), "[]")
+		columns = append(columns, map[string]string{"referenceName": field, "name": field})
+	}
+
+	references := []map[string]any{}
+	for _, item := range s.sortedWorkItems() {
+		if matchesAll(item, split(match[3], "AND"), project) {
+			references = append(references, map[string]any{"id": item.ID, "url": item.URL})
+		}
+	}
+
+	return http.StatusOK, map[string]any{"queryType": "flat", "columns": columns, "workItems": references}
+}
+
+func (s *Server) sortedWorkItems() []*WorkItem {
+	items := make([]*WorkItem, 0, len(s.workItems))
+	for _, item := range s.workItems {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+	return items
+}
+
+func matchesAll(item *WorkItem, conditions []string, project string) bool {
+	for _, c := range conditions {
+		if !matches(item, c, project) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches evaluates a condition, or conditions joined with OR in parentheses
+func matches(item *WorkItem, c, project string) bool {
+	c = strings.TrimSpace(c)
+	if strings.HasPrefix(c, "(") && strings.HasSuffix(c, ")") {
+		for _, alternative := range split(c[1:len(c)-1], "OR") {
+			if matchesAll(item, split(alternative, "AND"), project) {
+				return true
+			}
+		}
+		return false
+	}
+
+	match := condition.FindStringSubmatch(c)
+	if match == nil {
+		return true
+	}
+	value := fieldValue(item, match[1])
+	operator := strings.ToUpper(strings.Join(strings.Fields(match[2]), " "))
+	operands := literals(match[3], project)
+	if operands == nil {
+		return true
+	}
+
+	switch operator {
+	case "=":
+		return strings.EqualFold(value, operands[0])
+	case "<>":
+		return !strings.EqualFold(value, operands[0])
+	case "CONTAINS", "NOT CONTAINS":
+		contains := strings.Contains(strings.ToLower(value), strings.ToLower(operands[0]))
+		if match[1] == "System.Tags" {
+			contains = hasTag(value, operands[0])
+		}
+		return contains == (operator == "CONTAINS")
+	case "IN", "NOT IN":
+		in := false
+		for _, operand := range operands {
+			in = in || strings.EqualFold(value, operand)
+		}
+		return in == (operator == "IN")
+	default: // UNDER
+		return strings.EqualFold(value, operands[0]) || strings.HasPrefix(strings.ToLower(value), strings.ToLower(operands[0])+`\`)
+	}
+}
+
+// fieldValue returns the value of a field as text, the unique name for
+// identities
+func fieldValue(item *WorkItem, field string) string {
+	switch value := item.Fields[field].(type) {
+	case nil:
+		return ""
+	case map[string]any:
+		uniqueName, _ := value["uniqueName"].(string)
+		return uniqueName
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func hasTag(tags, tag string) bool {
+	for _, t := range strings.Split(tags, ";") {
+		if strings.EqualFold(strings.TrimSpace(t), tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// literals parses a string or number literal, @project, or a list of them
+// in parentheses. It returns nil for what it does not understand.
+func literals(text, project string) []string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		var values []string
+		for _, part := range split(text[1:len(text)-1], ",") {
+			value := literals(part, project)
+			if len(value) != 1 {
+				return nil
+			}
+			values = append(values, value[0])
+		}
+		return values
+	}
+
+	switch {
+	case strings.EqualFold(text, "@project"):
+		return []string{project}
+	case len(text) >= 2 && strings.HasPrefix(text, "'") && strings.HasSuffix(text, "'"):
+		return []string{strings.ReplaceAll(text[1:len(text)-1], "''", "'")}
+	case strings.HasPrefix(text, "@"):
+		return nil
+	default:
+		return []string{text}
+	}
+}
+
+// split splits text on a keyword, or a comma, outside string literals and
+// parentheses
+func split(text, separator string) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	var parts []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\'':
+			quoted = !quoted
+		case quoted:
+		case text[i] == '(':
+			depth++
+		case text[i] == ')':
+			depth--
+		case depth == 0 && separator == "," && text[i] == ',':
+			parts = append(parts, text[start:i])
+			start = i + 1
+		case depth == 0 && separator != "," && i > 0 && text[i-1] == ' ' && len(text) > i+len(separator) &&
+			strings.EqualFold(text[i:i+len(separator)], separator) && text[i+len(separator)] == ' ':
+			parts = append(parts, text[start:i])
+			start = i + len(separator)
+		}
+	}
+
+	return append(parts, text[start:])
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// pluginAPIVersion is the version of the JSON documents exchanged with
+// plugins, bumped on incompatible changes
+const pluginAPIVersion = 1
+
+// pluginRequest is written to the stdin of a plugin
+type pluginRequest struct {
+	APIVersion int                `json:"apiVersion"`
+	Items      []models.UserStory `json:"items"`
+}
+
+// pluginResponse is read from the stdout of a plugin. Errors reject the
+// whole batch, items dropped from the response are not created.
+type pluginResponse struct {
+	Items  []models.UserStory `json:"items"`
+	Errors []string           `json:"errors"`
+}
+
+// applyPlugins passes the user stories through every plugin command in
+// order, each receiving the output of the previous one
+func applyPlugins(ctx context.Context, plugins []string, userStories []models.UserStory, logger *zap.Logger) ([]models.UserStory, error) {
+	for _, plugin := range plugins {
+		request, err := json.Marshal(pluginRequest{APIVersion: pluginAPIVersion, Items: userStories})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal plugin request: %w", err)
+		}
+
+		var stdout bytes.Buffer
+		cmd := shellCommand(ctx, plugin)
+		cmd.Stdin = bytes.NewReader(request)
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("plugin %q failed: %w", plugin, err)
+		}
+
+		var response pluginResponse
+		if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+			return nil, fmt.Errorf("failed to decode the output of plugin %q: %w", plugin, err)
+		}
+		if len(response.Errors) > 0 {
+			return nil, fmt.Errorf("plugin %q rejected the items: %s", plugin, strings.Join(response.Errors, "; "))
+		}
+		if response.Items == nil {
+			return nil, fmt.Errorf("plugin %q returned no items field", plugin)
+		}
+
+		if dropped := len(userStories) - len(response.Items); dropped > 0 {
+			logger.Info("Plugin dropped user stories", zap.String("plugin", plugin), zap.Int("dropped", dropped))
+		}
+		userStories = response.Items
+	}
+
+	return userStories, nil
+}
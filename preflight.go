@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// preflight checks that the credentials work and can read and write work
+// items before the batch starts, instead of failing on the first create. A
+// PAT expiring within warnDays is reported as a warning.
+func preflight(ctx context.Context, settings models.AdoSettings, patExpiresOn time.Time, warnDays int, logger *zap.Logger) error {
+	base := fmt.Sprintf("https://dev.azure.com/%s", settings.Organization)
+
+	var connection struct {
+		AuthenticatedUser struct {
+			ProviderDisplayName string `json:"providerDisplayName"`
+		} `json:"authenticatedUser"`
+	}
+	if err := preflightRequest(ctx, settings, "GET", base+"/_apis/connectionData", nil, &connection); err != nil {
+		return fmt.Errorf("credentials rejected, check the PAT is valid and not expired: %w", err)
+	}
+	logger.Info("Authenticated to Azure DevOps", zap.String("user", connection.AuthenticatedUser.ProviderDisplayName))
+
+	// Work Items (read), the types of every process, such as Basic or Scrum
+	// without a User Story type
+	readURL := fmt.Sprintf("%s/%s/_apis/wit/workitemtypes?api-version=7.0", base, url.PathEscape(settings.Project))
+	var types struct {
+		Value []struct {
+			Name string `json:"name"`
+		} `json:"value"`
+	}
+	if err := preflightRequest(ctx, settings, "GET", readURL, nil, &types); err != nil {
+		return fmt.Errorf("missing Work Items (read) scope or access to project %s: %w", settings.Project, err)
+	}
+	// Writes are checked with the User Story type, or the first type of
+	// the processes without one
+	writeType := adobatch.DefaultUserStoryType
+	for i, workItemType := range types.Value {
+		if workItemType.Name == adobatch.DefaultUserStoryType {
+			writeType = workItemType.Name
+			break
+		}
+		if i == 0 {
+			writeType = workItemType.Name
+		}
+	}
+
+	// Work Items (read & write), validateOnly checks the create without saving
+	writeURL := fmt.Sprintf("%s/%s/_apis/wit/workitems/$%s?validateOnly=true&api-version=7.0", base, url.PathEscape(settings.Project), url.PathEscape(writeType))
+	payload := []map[string]any{{"op": "add", "path": "/fields/System.Title", "value": "ado_batch_creator preflight"}}
+	if err := preflightRequest(ctx, settings, "POST", writeURL, payload, nil); err != nil {
+		// Only auth failures matter, rules of the process may reject the
+		// minimal payload
+		if errors.Is(err, adobatch.ErrAuth) {
+			return fmt.Errorf("missing Work Items (read & write) scope: %w", err)
+		}
+		logger.Debug("Preflight create validation failed", zap.Error(err))
+	}
+
+	if !patExpiresOn.IsZero() && (settings.Auth == "" || settings.Auth == authPAT) {
+		remaining := time.Until(patExpiresOn)
+		switch {
+		case remaining <= 0:
+			return fmt.Errorf("PAT expired on %s: %w", patExpiresOn.Format(time.DateOnly), adobatch.ErrAuth)
+		case remaining < time.Duration(warnDays)*24*time.Hour:
+			logger.Warn("PAT expires soon, renew it", zap.String("expires_on", patExpiresOn.Format(time.DateOnly)), zap.Int("days_left", int(remaining.Hours()/24)))
+		}
+	}
+
+	return nil
+}
+
+// preflightOrganizations checks the credentials of the other organizations
+// items can target are accepted, so a run creating items in several
+// organizations does not fail halfway through. Their projects are set per
+// item and are not checked.
+func preflightOrganizations(ctx context.Context, settings models.AdoSettings, logger *zap.Logger) error {
+	names := make([]string, 0, len(settings.Organizations))
+	for name := range settings.Organizations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		orgSettings := settings.Organizations[name]
+		connectionURL := fmt.Sprintf("https://dev.azure.com/%s/_apis/connectionData", orgSettings.Organization)
+		if err := preflightRequest(ctx, orgSettings, "GET", connectionURL, nil, nil); err != nil {
+			return fmt.Errorf("credentials of organization %s rejected, check devops.organizations.%s: %w", orgSettings.Organization, name, err)
+		}
+		logger.Debug("Authenticated to Azure DevOps", zap.String("organization", orgSettings.Organization))
+	}
+
+	return nil
+}
+
+// preflightRequest sends an authenticated request and decodes the JSON
+// response into v when set
+func preflightRequest(ctx context.Context, settings models.AdoSettings, method, url string, payload any, v any) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	if err := authorize(ctx, req, settings); err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return adobatch.NewAPIError(resp, body)
+	}
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+	"go.uber.org/zap"
+)
+
+func TestPreflightProcesses(t *testing.T) {
+	tests := []struct {
+		name      string
+		types     []string
+		writeType string
+	}{
+		{"agile", []string{"Bug", "User Story", "Task"}, "User Story"},
+		{"scrum", []string{"Product Backlog Item", "Task", "Bug"}, "Product Backlog Item"},
+		{"basic", []string{"Epic", "Issue", "Task"}, "Epic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := adotest.NewServer()
+			t.Cleanup(server.Close)
+			transport := httpClient.Transport
+			httpClient.Transport = server.Transport()
+			t.Cleanup(func() { httpClient.Transport = transport })
+
+			value := make([]map[string]string, 0, len(tt.types))
+			for _, name := range tt.types {
+				value = append(value, map[string]string{"name": name})
+			}
+			server.AddRule(adotest.Rule{Method: http.MethodGet, Path: "/_apis/wit/workitemtypes", Status: http.StatusOK, Body: map[string]any{"value": value}})
+			// The project has none of the other types
+			server.AddRule(adotest.Rule{Method: http.MethodGet, Path: "/_apis/wit/workitemtypes/", Status: http.StatusNotFound})
+
+			settings := models.AdoSettings{Organization: "org", Project: "project", Pat: "pat"}
+			if err := preflight(context.Background(), settings, time.Time{}, 0, zap.NewNop()); err != nil {
+				t.Fatal(err)
+			}
+
+			writes := 0
+			for _, request := range server.Requests() {
+				if request.Method != http.MethodPost {
+					continue
+				}
+				writes++
+				if !strings.HasSuffix(request.Path, "/_apis/wit/workitems/$"+tt.writeType) {
+					t.Errorf("write checked with %s, want the %s type", request.Path, tt.writeType)
+				}
+			}
+			if writes != 1 {
+				t.Errorf("write checked %d times, want once", writes)
+			}
+		})
+	}
+}
+
+func TestPreflightRejected(t *testing.T) {
+	server := adotest.NewServer()
+	t.Cleanup(server.Close)
+	transport := httpClient.Transport
+	httpClient.Transport = server.Transport()
+	t.Cleanup(func() { httpClient.Transport = transport })
+	server.AddRule(adotest.Rule{Method: http.MethodPost, Path: "/_apis/wit/workitems/", Status: http.StatusForbidden})
+
+	settings := models.AdoSettings{Organization: "org", Project: "project", Pat: "pat"}
+	err := preflight(context.Background(), settings, time.Time{}, 0, zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), "Work Items (read & write)") {
+		t.Errorf("error = %v, want the missing write scope", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"html"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// provenanceComment returns the comment added to every work item of the run
+// with --provenance-comment: who ran the tool, from where, the items file, the
+// commit of the repository holding it and the run ID
+func provenanceComment(ctx context.Context, options applyOptions) string {
+	var lines []string
+	add := func(label, value string) {
+		if value != "" {
+			lines = append(lines, "<li><b>"+label+":</b> "+html.EscapeString(value)+"</li>")
+		}
+	}
+
+	add("Run by", runner())
+	if hostname, err := os.Hostname(); err == nil {
+		add("Host", hostname)
+	}
+	if options.itemsPath != "" {
+		add("Items file", options.itemsPath)
+		add("Commit", gitCommit(ctx, options.itemsPath))
+	}
+	add("Run ID", options.runID)
+	add("Pipeline run", ciRunURL())
+	add("Started at", time.Now().UTC().Format(time.RFC3339))
+
+	return "<p>Created by ado_batch_creator</p><ul>" + strings.Join(lines, "") + "</ul>"
+}
+
+// runner returns the user who ran the tool: the user who triggered the CI run,
+// or the user of the process
+func runner() string {
+	for _, name := range []string{"GITHUB_ACTOR", "BUILD_REQUESTEDFOR"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+
+	return ""
+}
+
+// gitCommit returns the commit checked out in the repository holding path,
+// noting when the file has uncommitted changes, or an empty string when path
+// is not in a git repository
+func gitCommit(ctx context.Context, path string) string {
+	dir := filepath.Dir(path)
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(out))
+
+	status, err := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain", "--", filepath.Base(path)).Output()
+	if err == nil && len(strings.TrimSpace(string(status))) > 0 {
+		commit += " (file modified)"
+	}
+
+	return commit
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// queryCellWidth truncates long values, such as HTML descriptions, in the
+// query table
+const queryCellWidth = 60
+
+// runQuery runs a WIQL query and prints the work items it returns as a
+// table, JSON or CSV
+func runQuery(ctx context.Context, settings models.AdoSettings, query, output string, logger *zap.Logger) int {
+	if query == "" {
+		logger.Error("Missing WIQL query: query \"SELECT ...\" or --query")
+		return exitValidation
+	}
+
+	result, err := newClient(settings, logger).RunQuery(ctx, settings, query)
+	if err != nil {
+		logger.Error("Failed to run query", zap.Error(err))
+		return queryExitCode(err)
+	}
+	logger.Debug("Query finished", zap.String("query_type", result.QueryType), zap.Int("work_items", len(result.Rows)))
+
+	if output == outputCSV {
+		err = renderQueryCSV(os.Stdout, result)
+	} else {
+		err = printOutput(os.Stdout, output, result, func(w io.Writer) { printQueryTable(w, result) })
+	}
+	if err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+		return exitError
+	}
+
+	return exitSuccess
+}
+
+// printQueryTable writes a row per work item, titles of tree queries are
+// indented by their level
+func printQueryTable(w io.Writer, result *adobatch.QueryResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"ID"}
+	for _, column := range result.Columns {
+		if column.ReferenceName != "System.Id" {
+			header = append(header, strings.ToUpper(column.Name))
+		}
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, row := range result.Rows {
+		cells := []string{strconv.Itoa(row.ID)}
+		for _, column := range result.Columns {
+			if column.ReferenceName == "System.Id" {
+				continue
+			}
+			cell := strings.Join(strings.Fields(queryValue(row.Fields[column.ReferenceName])), " ")
+			if len([]rune(cell)) > queryCellWidth {
+				cell = string([]rune(cell)[:queryCellWidth-3]) + "..."
+			}
+			if column.ReferenceName == "System.Title" {
+				cell = strings.Repeat("  ", row.Depth) + cell
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\n%d work items\n", len(result.Rows))
+}
+
+// renderQueryCSV writes a row per work item with the full values of the
+// columns, and the level of the work item for tree queries
+func renderQueryCSV(w io.Writer, result *adobatch.QueryResult) error {
+	tree := result.QueryType != "" && result.QueryType != "flat"
+
+	writer := csv.NewWriter(w)
+	header := []string{"id"}
+	if tree {
+		header = append(header, "depth")
+	}
+	for _, column := range result.Columns {
+		if column.ReferenceName != "System.Id" {
+			header = append(header, column.ReferenceName)
+		}
+	}
+	writer.Write(header)
+
+	for _, row := range result.Rows {
+		record := []string{strconv.Itoa(row.ID)}
+		if tree {
+			record = append(record, strconv.Itoa(row.Depth))
+		}
+		for _, column := range result.Columns {
+			if column.ReferenceName != "System.Id" {
+				record = append(record, queryValue(row.Fields[column.ReferenceName]))
+			}
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV output: %w", err)
+	}
+
+	return nil
+}
+
+// queryValue formats a field value, identities are shown by their display
+// name
+func queryValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case map[string]any:
+		if name, ok := value["displayName"].(string); ok {
+			return name
+		}
+	}
+
+	return fmt.Sprint(value)
+}
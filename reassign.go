@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/mail"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// reassignWorkItems assigns every work item of a query, or of the selection,
+// to a new owner
+func reassignWorkItems(ctx context.Context, settings models.AdoSettings, query string, selection bulkSelection, owner string, options applyOptions, logger *zap.Logger) int {
+	if owner == "" {
+		logger.Error("Missing new owner: reassign --to <user>")
+		return exitValidation
+	}
+
+	client := newClient(settings, logger)
+	if options.resolveOwners {
+		identity, err := client.ResolveIdentity(ctx, settings, owner, options.fuzzyOwners)
+		if err != nil {
+			logger.Error("Failed to resolve --to", zap.String("to", owner), zap.Error(err))
+			return queryExitCode(err)
+		}
+		owner = identity.UniqueName
+	} else if _, err := mail.ParseAddress(owner); err != nil {
+		// Owners are identities, an address must at least parse
+		logger.Error("Invalid --to, expected the email address of the new owner", zap.String("to", owner), zap.Error(err))
+		return exitValidation
+	}
+
+	if query == "" {
+		var err error
+		if query, err = selection.query(); err != nil {
+			logger.Error("Invalid reassign selection, set --query, --tag, --run or --from", zap.Error(err))
+			return exitValidation
+		}
+	} else if selection != (bulkSelection{}) {
+		logger.Error("--query cannot be used with --tag, --run or --from")
+		return exitValidation
+	}
+
+	results, err := selectWorkItems(ctx, client, settings, query)
+	if err != nil {
+		logger.Error("Failed to run query", zap.Error(err))
+		return queryExitCode(err)
+	}
+	logger.Info("Reassigning work items", zap.Int("work_items", len(results)), zap.String("to", owner))
+
+	payload := []map[string]interface{}{
+		{
+			"op":    "add",
+			"path":  "/fields/System.AssignedTo",
+			"value": owner,
+		},
+	}
+
+	return runBulk(ctx, results, "reassign", models.StatusUpdated, func(ctx context.Context, id int) error {
+		return client.UpdateWorkItem(ctx, settings, id, payload)
+	}, options, logger)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redacted replaces secrets in logs, reports and error messages
+const redacted = "[REDACTED]"
+
+// knownSecrets holds every secret the process learned: the PAT, client
+// secrets and the access tokens acquired at runtime
+var knownSecrets struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// registerSecrets adds secrets to redact from every log line and report
+func registerSecrets(secrets ...string) {
+	knownSecrets.mu.Lock()
+	defer knownSecrets.mu.Unlock()
+
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		// A PAT is sent base64 encoded in the basic auth header
+		knownSecrets.values = append(knownSecrets.values, secret, base64.StdEncoding.EncodeToString([]byte(":"+secret)))
+	}
+}
+
+// redactSecrets replaces every occurrence of the secrets, and of the
+// registered secrets, in value
+func redactSecrets(value string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			value = strings.ReplaceAll(value, secret, redacted)
+		}
+	}
+
+	knownSecrets.mu.RLock()
+	defer knownSecrets.mu.RUnlock()
+	for _, secret := range knownSecrets.values {
+		value = strings.ReplaceAll(value, secret, redacted)
+	}
+
+	return value
+}
+
+// redactingCore redacts the registered secrets from log messages and fields
+// before they reach the underlying core
+type redactingCore struct {
+	zapcore.Core
+}
+
+// newRedactingCore wraps a core, for use with zap.WrapCore
+func newRedactingCore(core zapcore.Core) zapcore.Core {
+	return redactingCore{Core: core}
+}
+
+func (c redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+
+	return checked
+}
+
+func (c redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = redactSecrets(entry.Message, nil)
+	entry.Stack = redactSecrets(entry.Stack, nil)
+
+	return c.Core.Write(entry, redactFields(fields))
+}
+
+// redactFields returns a copy of fields with the secrets redacted. Errors
+// and reflected values are flattened to their redacted string form.
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redactedFields := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch field.Type {
+		case zapcore.StringType:
+			field.String = redactSecrets(field.String, nil)
+		case zapcore.ByteStringType:
+			field = zap.String(field.Key, redactSecrets(string(field.Interface.([]byte)), nil))
+		case zapcore.ErrorType:
+			field = zap.String(field.Key, redactSecrets(field.Interface.(error).Error(), nil))
+		case zapcore.ReflectType:
+			if data, err := json.Marshal(field.Interface); err == nil {
+				field = zap.Reflect(field.Key, json.RawMessage(redactSecrets(string(data), nil)))
+			}
+		}
+		redactedFields[i] = field
+	}
+
+	return redactedFields
+}
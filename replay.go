@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+var (
+	// createWorkItemPath matches the path of a work item creation call
+	createWorkItemPath = regexp.MustCompile(`^/([^/]+)/([^/]+)/_apis/wit/workitems/\$(.+)$`)
+	// batchPath matches the path of a batch call, which two-phase runs create
+	// their user stories with
+	batchPath = regexp.MustCompile(`^/([^/]+)/_apis/wit/\$batch$`)
+	// batchCreatePath matches the path of a work item creation in a batch
+	batchCreatePath = regexp.MustCompile(`^/([^/]+)/_apis/wit/workitems/\$(.+)$`)
+	// workItemLinkURL matches the work item REST URL used by relations
+	workItemLinkURL = regexp.MustCompile(`/_apis/wit/workItems/(\d+)$`)
+)
+
+// replayOperation is a successful work item creation recorded in an audit log
+type replayOperation struct {
+	workItemType  string
+	sourceProject string
+	originalID    int
+	payload       []map[string]any
+}
+
+// replayResult is the outcome of replaying a single operation
+type replayResult struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	OriginalID int    `json:"originalId"`
+	Id         int    `json:"id,omitempty"`
+	Url        string `json:"url,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// replayAuditLog re-creates the work items recorded in an audit log in the
+// configured organization and project. Links between replayed work items are
+// remapped to the new IDs, and area and iteration paths are moved to the new
+// project.
+func replayAuditLog(ctx context.Context, settings models.AdoSettings, path string, options applyOptions, logger *zap.Logger) int {
+	if path == "" {
+		logger.Error("Missing audit log path: replay <audit-log>")
+		return exitValidation
+	}
+
+	operations, err := readReplayOperations(path)
+	if err != nil {
+		logger.Error("Failed to read audit log", zap.String("path", path), zap.Error(err))
+		return exitValidation
+	}
+	logger.Info("Replaying audit log", zap.String("path", path), zap.Int("operations", len(operations)),
+		zap.String("organization", settings.Organization), zap.String("project", settings.Project))
+
+	client := newClient(settings, logger)
+	outcome := adobatch.NewOutcome(len(operations), adobatch.FailurePolicy{FailFast: options.failFast})
+	newIDs := map[int]int{}
+	results := make([]replayResult, 0, len(operations))
+	for _, operation := range operations {
+		result := replayResult{
+			Type:       operation.workItemType,
+			Title:      replayTitle(operation.payload),
+			OriginalID: operation.originalID,
+			Status:     models.StatusSkipped,
+		}
+		if outcome.Aborted() || ctx.Err() != nil {
+			results = append(results, result)
+			continue
+		}
+
+		id, err := replayOperationTo(ctx, client, settings, operation, newIDs)
+		if err != nil {
+			logger.Error("Failed to replay work item", zap.String("title", result.Title), zap.Int("original_id", operation.originalID), zap.Error(err))
+			result.Status = models.StatusFailed
+			result.Error = err.Error()
+			outcome.Record(err)
+		} else {
+			newIDs[operation.originalID] = id
+			result.Status = models.StatusCreated
+			result.Id = id
+			result.Url = adobatch.WorkItemURL(settings.Organization, settings.Project, id)
+			logger.Info("Work item replayed", zap.String("title", result.Title), zap.Int("original_id", operation.originalID), zap.Int("id", id), zap.String("url", result.Url))
+		}
+		results = append(results, result)
+	}
+
+	if err := printOutput(os.Stdout, options.output, results, func(w io.Writer) { printReplayResults(w, results) }); err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+	}
+
+	return exitCodeFor(outcome.Status())
+}
+
+// readReplayOperations returns the successful work item creations of an
+// audit log, in the order they were made, including those of batch calls
+func readReplayOperations(path string) ([]replayOperation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var operations []replayOperation
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record struct {
+			Method       string          `json:"method"`
+			URL          string          `json:"url"`
+			Status       int             `json:"status"`
+			RequestBody  json.RawMessage `json:"requestBody"`
+			ResponseBody json.RawMessage `json:"responseBody"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if record.Method != http.MethodPost || (record.Status != http.StatusOK && record.Status != http.StatusCreated) {
+			continue
+		}
+
+		recordURL, err := url.Parse(record.URL)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if batchPath.MatchString(recordURL.Path) {
+			batchOperations, err := readBatchOperations(record.RequestBody, record.ResponseBody)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			operations = append(operations, batchOperations...)
+			continue
+		}
+		match := createWorkItemPath.FindStringSubmatch(recordURL.Path)
+		if match == nil {
+			continue
+		}
+
+		operation := replayOperation{workItemType: match[3], sourceProject: match[2]}
+		if err := json.Unmarshal(record.RequestBody, &operation.payload); err != nil {
+			return nil, fmt.Errorf("line %d: invalid request body: %w", line, err)
+		}
+		var response struct {
+			Id int `json:"id"`
+		}
+		if err := json.Unmarshal(record.ResponseBody, &response); err != nil {
+			return nil, fmt.Errorf("line %d: invalid response body: %w", line, err)
+		}
+		operation.originalID = response.Id
+		operations = append(operations, operation)
+	}
+
+	return operations, scanner.Err()
+}
+
+// readBatchOperations returns the successful work item creations of a batch
+// call. Its other requests, such as the updates of follow-ups, are ignored.
+func readBatchOperations(requestBody, responseBody json.RawMessage) ([]replayOperation, error) {
+	var requests []struct {
+		Method string           `json:"method"`
+		URI    string           `json:"uri"`
+		Body   []map[string]any `json:"body"`
+	}
+	if err := json.Unmarshal(requestBody, &requests); err != nil {
+		return nil, fmt.Errorf("invalid batch request body: %w", err)
+	}
+	var response struct {
+		Value []struct {
+			Code int    `json:"code"`
+			Body string `json:"body"`
+		} `json:"value"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil {
+		return nil, fmt.Errorf("invalid batch response body: %w", err)
+	}
+
+	var operations []replayOperation
+	for i, request := range requests {
+		if request.Method != http.MethodPatch || i >= len(response.Value) || response.Value[i].Code != http.StatusOK {
+			continue
+		}
+		uri, err := url.Parse(request.URI)
+		if err != nil {
+			return nil, fmt.Errorf("batch request %d: %w", i, err)
+		}
+		match := batchCreatePath.FindStringSubmatch(uri.Path)
+		if match == nil {
+			continue
+		}
+
+		var body struct {
+			Id int `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(response.Value[i].Body), &body); err != nil {
+			return nil, fmt.Errorf("batch response %d: %w", i, err)
+		}
+		operations = append(operations, replayOperation{workItemType: match[2], sourceProject: match[1], originalID: body.Id, payload: request.Body})
+	}
+
+	return operations, nil
+}
+
+// replayOperationTo rewrites the operation for the target project and
+// creates the work item
+func replayOperationTo(ctx context.Context, client *adobatch.Client, settings models.AdoSettings, operation replayOperation, newIDs map[int]int) (int, error) {
+	payload := make([]map[string]any, 0, len(operation.payload))
+	for _, patch := range operation.payload {
+		rewritten := make(map[string]any, len(patch))
+		for key, value := range patch {
+			rewritten[key] = value
+		}
+
+		switch path, _ := patch["path"].(string); path {
+		case "/relations/-":
+			relation, ok := patch["value"].(map[string]any)
+			if !ok {
+				break
+			}
+			linkURL, _ := relation["url"].(string)
+			match := workItemLinkURL.FindStringSubmatch(linkURL)
+			if match == nil {
+				break
+			}
+			originalID, _ := strconv.Atoi(match[1])
+			newID, ok := newIDs[originalID]
+			if !ok {
+				return 0, fmt.Errorf("work item links to work item %d which was not replayed", originalID)
+			}
+			relation = copyMap(relation)
+			relation["url"] = adobatch.WorkItemAPIURL(settings.Organization, newID)
+			rewritten["value"] = relation
+		case "/fields/System.AreaPath", "/fields/System.IterationPath":
+			if value, ok := patch["value"].(string); ok {
+				rewritten["value"] = moveClassificationPath(value, operation.sourceProject, settings.Project)
+			}
+		}
+
+		payload = append(payload, rewritten)
+	}
+
+	return client.CreateWorkItem(ctx, settings, operation.workItemType, payload)
+}
+
+// moveClassificationPath replaces the project at the root of an area or
+// iteration path
+func moveClassificationPath(value, from, to string) string {
+	if strings.EqualFold(value, from) {
+		return to
+	}
+	if prefix := from + "\\"; len(value) > len(prefix) && strings.EqualFold(value[:len(prefix)], prefix) {
+		return to + "\\" + value[len(prefix):]
+	}
+
+	return value
+}
+
+func copyMap(m map[string]any) map[string]any {
+	copied := make(map[string]any, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+
+	return copied
+}
+
+func replayTitle(payload []map[string]any) string {
+	for _, patch := range payload {
+		if patch["path"] == "/fields/System.Title" {
+			title, _ := patch["value"].(string)
+			return title
+		}
+	}
+
+	return ""
+}
+
+func printReplayResults(w io.Writer, results []replayResult) {
+	color := useColor(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tTITLE\tORIGINAL ID\tID\tSTATUS\tURL")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", result.Type, result.Title, result.OriginalID, formatID(result.Id), colorStatus(result.Status, color), result.Url)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adotest"
+	"go.uber.org/zap"
+)
+
+func TestReplayTwoPhaseRun(t *testing.T) {
+	source, target := adotest.NewServer(), adotest.NewServer()
+	t.Cleanup(source.Close)
+	t.Cleanup(target.Close)
+	transport := httpClient.Transport
+	t.Cleanup(func() { httpClient.Transport = transport })
+
+	dir := t.TempDir()
+	itemsPath, auditPath := filepath.Join(dir, "items.json"), filepath.Join(dir, "audit.jsonl")
+	items := `[{"name": "US1", "tasks": [{"name": "Task 1"}, {"name": "Task 2"}]}, {"name": "US2", "tasks": [{"name": "Task 3"}]}]`
+	if err := os.WriteFile(itemsPath, []byte(items), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The PAT is redacted from the log, it must not appear in the payloads
+	const pat = "test-pat"
+	audit, err := newAuditTransport(auditPath, source.Transport(), pat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpClient.Transport = audit
+	code := applyItems(context.Background(), models.AdoSettings{Organization: "test-org", Project: "test", Pat: pat}, applyOptions{itemsPath: itemsPath, twoPhase: true, output: outputJSON}, zap.NewNop())
+	audit.Close()
+	if code != exitSuccess {
+		t.Fatalf("apply exited with %d", code)
+	}
+
+	// The IDs of the target differ from those of the recorded run
+	target.AddWorkItem("Bug", map[string]any{"System.Title": "Existing", "System.TeamProject": "prod"})
+	httpClient.Transport = target.Transport()
+	settings := models.AdoSettings{Organization: "prod-org", Project: "prod", Pat: pat}
+	if code := replayAuditLog(context.Background(), settings, auditPath, applyOptions{output: outputJSON}, zap.NewNop()); code != exitSuccess {
+		t.Fatalf("replay exited with %d", code)
+	}
+
+	ids := map[string]int{}
+	parents := map[string]int{}
+	for _, item := range target.WorkItems() {
+		title, _ := item.Fields["System.Title"].(string)
+		ids[title] = item.ID
+		for _, relation := range item.Relations {
+			if relation["rel"] == "System.LinkTypes.Hierarchy-Reverse" {
+				url, _ := relation["url"].(string)
+				parents[title] = workItemIDOf(url)
+			}
+		}
+	}
+	if len(ids) != 6 {
+		t.Fatalf("replayed %d work items, want the 5 of the run: %v", len(ids)-1, ids)
+	}
+	for task, userStory := range map[string]string{"Task 1": "US1", "Task 2": "US1", "Task 3": "US2"} {
+		if parents[task] != ids[userStory] {
+			t.Errorf("parent of %s = %d, want %s (%d)", task, parents[task], userStory, ids[userStory])
+		}
+	}
+}
+
+// workItemIDOf returns the ID at the end of a work item URL
+func workItemIDOf(url string) int {
+	match := workItemLinkURL.FindStringSubmatch(url)
+	if match == nil {
+		return 0
+	}
+	id := 0
+	for _, digit := range match[1] {
+		id = id*10 + int(digit-'0')
+	}
+
+	return id
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// writeCSVReport writes one row per user story and task of the run
+func writeCSVReport(path string, results adobatch.Results) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV report: %w", err)
+	}
+	defer file.Close()
+
+	if err := renderCSVReport(file, results); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// renderCSVReport writes the CSV report of the run to w
+func renderCSVReport(w io.Writer, results adobatch.Results) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"title", "type", "id", "url", "parent id", "status", "error"})
+	for _, story := range results.UserStories {
+		writer.Write(csvRow(story, 0))
+		for _, task := range story.Tasks {
+			writer.Write(csvRow(task, story.Id))
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV report: %w", err)
+	}
+
+	return nil
+}
+
+func csvRow(item adobatch.ItemResult, parentID int) []string {
+	return []string{item.Name, item.Type, csvID(item.Id), item.Url, csvID(parentID), item.Status, item.Error}
+}
+
+func csvID(id int) string {
+	if id == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(id)
+}
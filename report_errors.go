@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// errorReport lists the failed work items of a run with everything needed to
+// diagnose and re-run them without scraping the logs
+type errorReport struct {
+	RunID  string       `json:"runId,omitempty"`
+	Errors []errorEntry `json:"errors"`
+}
+
+type errorEntry struct {
+	Type       string          `json:"type"`
+	Name       string          `json:"name"`
+	Parent     string          `json:"parent,omitempty"`
+	StatusCode int             `json:"statusCode,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Error      string          `json:"error"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+// newErrorReport collects the failed work items of a run. Secrets are
+// redacted from the payloads.
+func newErrorReport(runID string, items []adobatch.Result, secrets ...string) errorReport {
+	report := errorReport{RunID: runID, Errors: []errorEntry{}}
+	for _, story := range items {
+		if story.Err != nil {
+			report.Errors = append(report.Errors, newErrorEntry(adobatch.UserStoryType(story.Item), story.Item.Name, "", story.Err, secrets))
+		}
+		for _, task := range story.Tasks {
+			if task.Err != nil {
+				report.Errors = append(report.Errors, newErrorEntry(adobatch.TaskType(task.Item), task.Item.Name, story.Item.Name, task.Err, secrets))
+			}
+		}
+	}
+
+	return report
+}
+
+func newErrorEntry(itemType, name, parent string, err error, secrets []string) errorEntry {
+	entry := errorEntry{Type: itemType, Name: name, Parent: parent, Error: redactSecrets(err.Error(), secrets)}
+
+	var apiErr *adobatch.APIError
+	if errors.As(err, &apiErr) {
+		entry.StatusCode = apiErr.StatusCode
+		entry.Message = redactSecrets(apiErr.Message, secrets)
+		if json.Valid(apiErr.Payload) {
+			entry.Payload = json.RawMessage(redactSecrets(string(apiErr.Payload), secrets))
+		}
+	}
+
+	return entry
+}
+
+// writeErrorReport writes the error report as indented JSON
+func writeErrorReport(path string, report errorReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal error report: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write error report: %w", err)
+	}
+
+	return nil
+}
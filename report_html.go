@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// htmlReportTemplate is a standalone page, styles and charts are inlined so
+// the file can be published as a pipeline artifact as is
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Azure DevOps batch report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Roboto, sans-serif; margin: 2rem; color: #222; }
+h1 { font-size: 1.6rem; }
+h2 { font-size: 1.2rem; margin-top: 2rem; }
+.stats { display: flex; gap: 1rem; }
+.stat { border: 1px solid #ddd; border-radius: 6px; padding: 0.8rem 1.2rem; }
+.stat strong { display: block; font-size: 1.6rem; }
+.charts { display: flex; flex-wrap: wrap; gap: 2rem; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #eee; padding: 0.4rem; text-align: left; }
+.created { color: #1a7f37; }
+.skipped { color: #9a6700; }
+.failed { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>Azure DevOps batch report</h1>
+{{if .RunID}}<p>Run <code>{{.RunID}}</code></p>{{end}}
+<div class="stats">
+<div class="stat"><strong>{{.Total}}</strong>work items</div>
+<div class="stat created"><strong>{{.Created}}</strong>created</div>
+<div class="stat skipped"><strong>{{.Skipped}}</strong>skipped</div>
+<div class="stat failed"><strong>{{.Failed}}</strong>failed</div>
+</div>
+<div class="charts">
+{{range .Charts}}<div>
+<h2>{{.Title}}</h2>
+{{if .Bars}}<svg width="460" height="{{.Height}}" role="img" aria-label="{{.Title}}">
+{{range $i, $bar := .Bars}}<g transform="translate(0 {{$bar.Y}})">
+<text x="0" y="14" font-size="12">{{$bar.Label}}</text>
+<rect x="150" y="2" width="{{$bar.Width}}" height="16" fill="#0969da"></rect>
+<text x="{{$bar.ValueX}}" y="14" font-size="12">{{$bar.Value}}</text>
+</g>
+{{end}}</svg>{{else}}<p>No data</p>{{end}}
+</div>
+{{end}}</div>
+{{if .Failures}}<h2>Failures</h2>
+<table>
+<tr><th>Type</th><th>Name</th><th>Error</th></tr>
+{{range .Failures}}<tr><td>{{.Type}}</td><td>{{.Name}}</td><td class="failed">{{.Error}}</td></tr>
+{{end}}</table>{{end}}
+<h2>Work items</h2>
+<table>
+<tr><th>Type</th><th>Name</th><th>ID</th><th>State</th><th>Owner</th><th>Status</th></tr>
+{{range .Items}}<tr><td>{{.Type}}</td><td>{{if .Url}}<a href="{{.Url}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td><td>{{if .Id}}{{.Id}}{{end}}</td><td>{{.State}}</td><td>{{.Owner}}</td><td class="{{.Status}}">{{.Status}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type htmlReport struct {
+	RunID    string
+	Total    int
+	Created  int
+	Skipped  int
+	Failed   int
+	Charts   []htmlChart
+	Failures []adobatch.ItemResult
+	Items    []adobatch.ItemResult
+}
+
+type htmlChart struct {
+	Title  string
+	Height int
+	Bars   []htmlBar
+}
+
+type htmlBar struct {
+	Label  string
+	Value  int
+	Y      int
+	Width  int
+	ValueX int
+}
+
+// writeHTMLReport writes a standalone HTML report with the run statistics
+func writeHTMLReport(path string, results adobatch.Results) error {
+	report := htmlReport{RunID: results.RunID}
+
+	byState := map[string]int{}
+	byStatus := map[string]int{}
+	estimateByOwner := map[string]int{}
+	for _, story := range results.UserStories {
+		items := append([]adobatch.ItemResult{story}, story.Tasks...)
+		for i, item := range items {
+			report.Items = append(report.Items, item)
+			report.Total++
+			byState[valueOr(item.State, "(none)")]++
+			byStatus[item.Status]++
+			// Tasks follow their user story
+			if i > 0 {
+				estimateByOwner[valueOr(item.Owner, "(unassigned)")] += item.Estimate
+			}
+			if item.Status == models.StatusFailed {
+				report.Failures = append(report.Failures, item)
+			}
+		}
+	}
+	report.Created = byStatus[models.StatusCreated]
+	report.Skipped = byStatus[models.StatusSkipped]
+	report.Failed = byStatus[models.StatusFailed]
+
+	report.Charts = []htmlChart{
+		newHTMLChart("Work items by state", byState),
+		newHTMLChart("Estimates by assignee", estimateByOwner),
+		newHTMLChart("Work items by status", byStatus),
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create HTML report: %w", err)
+	}
+	defer file.Close()
+
+	if err := htmlReportTemplate.Execute(file, report); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+
+	return file.Close()
+}
+
+// newHTMLChart builds a horizontal bar chart, largest values first
+func newHTMLChart(title string, values map[string]int) htmlChart {
+	const barHeight, maxWidth = 22, 260
+
+	labels := make([]string, 0, len(values))
+	max := 0
+	for label, value := range values {
+		labels = append(labels, label)
+		if value > max {
+			max = value
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if values[labels[i]] != values[labels[j]] {
+			return values[labels[i]] > values[labels[j]]
+		}
+		return labels[i] < labels[j]
+	})
+
+	chart := htmlChart{Title: title, Height: len(labels) * barHeight}
+	for i, label := range labels {
+		width := 0
+		if max > 0 {
+			width = values[label] * maxWidth / max
+		}
+		chart.Bars = append(chart.Bars, htmlBar{
+			Label:  label,
+			Value:  values[label],
+			Y:      i * barHeight,
+			Width:  width,
+			ValueX: 150 + width + 6,
+		})
+	}
+
+	return chart
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
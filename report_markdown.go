@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// renderMarkdownReport renders the results of a run as Markdown, grouped by
+// user story, suitable for a wiki page or pull request description
+func renderMarkdownReport(results adobatch.Results) string {
+	var b strings.Builder
+
+	b.WriteString("# Azure DevOps batch report\n\n")
+	if results.RunID != "" {
+		fmt.Fprintf(&b, "Run `%s`\n\n", results.RunID)
+	}
+
+	counts := map[string]int{}
+	total := 0
+	for _, story := range results.UserStories {
+		counts[story.Status]++
+		total++
+		for _, task := range story.Tasks {
+			counts[task.Status]++
+			total++
+		}
+	}
+	fmt.Fprintf(&b, "%d work items: %d created, %d skipped, %d failed.\n", total, counts[models.StatusCreated], counts[models.StatusSkipped], counts[models.StatusFailed])
+
+	for _, story := range results.UserStories {
+		fmt.Fprintf(&b, "\n## %s\n\n", markdownLink(story))
+		fmt.Fprintf(&b, "Status: **%s**%s\n", story.Status, markdownError(story))
+		if len(story.Tasks) == 0 {
+			continue
+		}
+
+		b.WriteString("\n| Task | Status | Error |\n| --- | --- | --- |\n")
+		for _, task := range story.Tasks {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", markdownLink(task), task.Status, markdownEscape(task.Error))
+		}
+	}
+
+	return b.String()
+}
+
+// writeMarkdownReport writes the Markdown report of a run
+func writeMarkdownReport(path string, results adobatch.Results) error {
+	if err := os.WriteFile(path, []byte(renderMarkdownReport(results)), 0o644); err != nil {
+		return fmt.Errorf("failed to write Markdown report: %w", err)
+	}
+
+	return nil
+}
+
+// markdownLink returns the item name, linked to its work item when it exists
+func markdownLink(item adobatch.ItemResult) string {
+	name := markdownEscape(item.Name)
+	if item.Url == "" {
+		return name
+	}
+
+	return fmt.Sprintf("[%s](%s) (#%d)", name, item.Url, item.Id)
+}
+
+func markdownError(item adobatch.ItemResult) string {
+	if item.Error == "" {
+		return ""
+	}
+
+	return " - " + markdownEscape(item.Error)
+}
+
+// markdownEscape keeps values from breaking tables and links
+func markdownEscape(value string) string {
+	return strings.NewReplacer("|", "\\|", "[", "\\[", "]", "\\]", "\n", " ").Replace(value)
+}
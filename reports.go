@@ -0,0 +1,44 @@
+package main
+
+import (
+	"go.uber.org/zap"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// reportOptions lists the report files to write at the end of a run
+type reportOptions struct {
+	resultsFile    string
+	csvReport      string
+	markdownReport string
+	htmlReport     string
+	junitReport    string
+}
+
+// writeReports writes every configured report. Failing to write a report is
+// logged but does not fail the run, the work items already exist.
+func writeReports(options reportOptions, results adobatch.Results, logger *zap.Logger) {
+	reports := []struct {
+		name  string
+		path  string
+		write func(string, adobatch.Results) error
+	}{
+		{"results file", options.resultsFile, writeResultsFile},
+		{"CSV report", options.csvReport, writeCSVReport},
+		{"Markdown report", options.markdownReport, writeMarkdownReport},
+		{"HTML report", options.htmlReport, writeHTMLReport},
+		{"JUnit report", options.junitReport, writeJUnitReport},
+	}
+
+	for _, report := range reports {
+		if report.path == "" {
+			continue
+		}
+
+		if err := report.write(report.path, results); err != nil {
+			logger.Error("Failed to write "+report.name, zap.String("path", report.path), zap.Error(err))
+			continue
+		}
+		logger.Info("Wrote "+report.name, zap.String("path", report.path))
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// writeResultsFile writes the results of a run as indented JSON
+func writeResultsFile(path string, results adobatch.Results) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write results file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// rolloverOptions selects the team the rollover command carries the sprint
+// of over
+type rolloverOptions struct {
+	// team is the team of the sprint, the default team of the project when
+	// empty
+	team string
+	// resetRemaining sets the remaining work of the tasks carried over to 0
+	resetRemaining bool
+	// dryRun lists the work items without moving them
+	dryRun bool
+}
+
+// rolloverSprint moves the work items of a team that are still open in its
+// current iteration to its next iteration
+func rolloverSprint(ctx context.Context, settings models.AdoSettings, rollover rolloverOptions, options applyOptions, logger *zap.Logger) int {
+	client := newClient(settings, logger)
+	current, err := client.CurrentIteration(ctx, settings, rollover.team)
+	if err != nil {
+		logger.Error("Failed to read the current iteration", zap.String("team", rollover.team), zap.Error(err))
+		return queryExitCode(err)
+	}
+	next, err := client.NextIteration(ctx, settings, rollover.team)
+	if err != nil {
+		logger.Error("Failed to read the next iteration", zap.String("team", rollover.team), zap.Error(err))
+		return queryExitCode(err)
+	}
+	areas, err := client.TeamAreas(ctx, settings, rollover.team)
+	if err != nil {
+		logger.Error("Failed to read the areas of the team", zap.String("team", rollover.team), zap.Error(err))
+		return queryExitCode(err)
+	}
+
+	results, err := selectWorkItems(ctx, client, settings, rolloverQuery(current.Path, areas))
+	if err != nil {
+		logger.Error("Failed to run query", zap.Error(err))
+		return queryExitCode(err)
+	}
+	if len(results) == 0 {
+		logger.Info("No open work items to carry over", zap.String("iteration", current.Path))
+		return exitSuccess
+	}
+
+	if rollover.dryRun {
+		logger.Info("Dry run, work items are not moved", zap.Int("work_items", len(results)), zap.String("from", current.Path), zap.String("to", next.Path))
+		printBulkResults(os.Stderr, results)
+		return exitSuccess
+	}
+	logger.Info("Carrying work items over", zap.Int("work_items", len(results)), zap.String("from", current.Path), zap.String("to", next.Path))
+
+	types := make(map[int]string, len(results))
+	for _, result := range results {
+		types[result.Id] = result.Type
+	}
+
+	return runBulk(ctx, results, "rollover", models.StatusUpdated, func(ctx context.Context, id int) error {
+		payload := []map[string]interface{}{{"op": "add", "path": "/fields/System.IterationPath", "value": next.Path}}
+		// Only tasks track the remaining work
+		if rollover.resetRemaining && types[id] == "Task" {
+			payload = append(payload, map[string]interface{}{"op": "add", "path": "/fields/Microsoft.VSTS.Scheduling.RemainingWork", "value": 0})
+		}
+		return client.UpdateWorkItem(ctx, settings, id, payload)
+	}, options, logger)
+}
+
+// rolloverQuery returns the WIQL query selecting the open work items of an
+// iteration in the areas of a team
+func rolloverQuery(iteration string, areas []adobatch.TeamArea) string {
+	conditions := []string{
+		"[System.TeamProject] = @project",
+		"[System.IterationPath] = " + adobatch.WIQLString(iteration),
+		adobatch.OpenCondition(),
+	}
+	var areaConditions []string
+	for _, area := range areas {
+		operator := " = "
+		if area.IncludeChildren {
+			operator = " UNDER "
+		}
+		areaConditions = append(areaConditions, "[System.AreaPath]"+operator+adobatch.WIQLString(area.Path))
+	}
+	if len(areaConditions) > 0 {
+		conditions = append(conditions, "("+strings.Join(areaConditions, " OR ")+")")
+	}
+
+	return "SELECT [System.Id], [System.WorkItemType], [System.Title] FROM WorkItems WHERE " + strings.Join(conditions, " AND ") + " ORDER BY [System.Id]"
+}
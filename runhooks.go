@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// runHooks are shell commands run around a batch. Each receives a JSON
+// document on stdin and ADO_BATCH_* environment variables.
+type runHooks struct {
+	// preRun receives the user stories of the batch, the batch is aborted
+	// when it fails
+	preRun string
+	// postItem receives the result of every user story with its tasks
+	postItem string
+	// postRun receives the results of the run
+	postRun string
+}
+
+// runHook runs a hook command with the input as JSON on stdin. Its output
+// goes to stderr, stdout is kept for the results of the run.
+func runHook(ctx context.Context, name, command string, input any, env map[string]string) error {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s input: %w", name, err)
+	}
+
+	cmd := shellCommand(ctx, command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "ADO_BATCH_HOOK="+name)
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hooks.%s failed: %w", name, err)
+	}
+
+	return nil
+}
+
+// shellCommand runs command with sh, or cmd on Windows
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// runPreRunHook runs hooks.preRun with the user stories of the batch
+func runPreRunHook(ctx context.Context, hooks runHooks, runID string, userStories []models.UserStory) error {
+	if hooks.preRun == "" {
+		return nil
+	}
+
+	input := map[string]any{"runId": runID, "userStories": userStories}
+	return runHook(ctx, "preRun", hooks.preRun, input, map[string]string{
+		"ADO_BATCH_RUN_ID":       runID,
+		"ADO_BATCH_USER_STORIES": strconv.Itoa(len(userStories)),
+	})
+}
+
+// runPostItemHook runs hooks.postItem with the result of a user story
+func runPostItemHook(ctx context.Context, hooks runHooks, runID string, item adobatch.Result) error {
+	if hooks.postItem == "" {
+		return nil
+	}
+
+	result := adobatch.NewResults(runID, []adobatch.Result{item}, item.Latency).UserStories[0]
+	return runHook(ctx, "postItem", hooks.postItem, result, map[string]string{
+		"ADO_BATCH_RUN_ID":      runID,
+		"ADO_BATCH_ITEM_NAME":   result.Name,
+		"ADO_BATCH_ITEM_ID":     strconv.Itoa(result.Id),
+		"ADO_BATCH_ITEM_URL":    result.Url,
+		"ADO_BATCH_ITEM_STATUS": result.Status,
+	})
+}
+
+// runPostRunHook runs hooks.postRun with the results of the run
+func runPostRunHook(ctx context.Context, hooks runHooks, results adobatch.Results, exitCode int) error {
+	if hooks.postRun == "" {
+		return nil
+	}
+
+	return runHook(ctx, "postRun", hooks.postRun, results, map[string]string{
+		"ADO_BATCH_RUN_ID":    results.RunID,
+		"ADO_BATCH_CREATED":   strconv.Itoa(results.Summary.Created),
+		"ADO_BATCH_SKIPPED":   strconv.Itoa(results.Summary.Skipped),
+		"ADO_BATCH_FAILED":    strconv.Itoa(results.Summary.Failed),
+		"ADO_BATCH_EXIT_CODE": strconv.Itoa(exitCode),
+	})
+}
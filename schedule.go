@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// scheduleItems keeps the process running and applies the items file every
+// time the schedule triggers, until the context is cancelled. Each run tags
+// its work items with its own run ID.
+func scheduleItems(ctx context.Context, settings models.AdoSettings, options applyOptions, schedule *cronSchedule, logger *zap.Logger) int {
+	for {
+		next := schedule.next(time.Now())
+		if next.IsZero() {
+			logger.Error("Schedule never triggers")
+			return exitValidation
+		}
+		logger.Info("Waiting for next scheduled run", zap.Time("at", next))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("Scheduler stopped")
+			return exitSuccess
+		case <-timer.C:
+		}
+
+		runOptions := options
+		runOptions.runID = newRunID(time.Now())
+		logger.Info("Starting scheduled run", zap.String("run_id", runOptions.runID))
+		applyItems(ctx, settings, runOptions, logger)
+	}
+}
+
+// newRunID returns an identifier for a run started at t
+func newRunID(t time.Time) string {
+	return t.UTC().Format("20060102-150405")
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// maxBatchSize limits the size of a submitted items payload
+const maxBatchSize = 10 << 20
+
+// errBatchQueueFull is returned when too many batches wait to run
+var errBatchQueueFull = errors.New("too many queued batches, retry later")
+
+// Batch statuses
+const (
+	batchQueued   = "queued"
+	batchRunning  = "running"
+	batchFinished = "finished"
+)
+
+// batch is a submitted items payload and, once run, its results
+type batch struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	// UserStories is the size of the batch, Processed how many were run
+	UserStories int               `json:"userStories"`
+	Processed   int               `json:"processed"`
+	ExitCode    *int              `json:"exitCode,omitempty"`
+	Results     *adobatch.Results `json:"results,omitempty"`
+	// Error is why a batch finished without running
+	Error string `json:"error,omitempty"`
+
+	userStories []models.UserStory
+}
+
+// serverOptions controls the listeners of the serve command
+type serverOptions struct {
+	addr string
+	// grpcAddr, when set, serves the gRPC API on this address
+	grpcAddr string
+	token    string
+	hooks    hookOptions
+}
+
+// batchServer accepts batches over HTTP and runs them one at a time, so
+// concurrent submissions do not multiply the load on Azure DevOps
+type batchServer struct {
+	settings models.AdoSettings
+	options  applyOptions
+	token    string
+	hooks    hookOptions
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	batches map[string]*batch
+	queue   chan *batch
+}
+
+// serveBatches runs the REST API on addr until the context is cancelled
+func serveBatches(ctx context.Context, settings models.AdoSettings, options applyOptions, server serverOptions, logger *zap.Logger) int {
+	s := &batchServer{
+		settings: settings,
+		options:  options,
+		token:    server.token,
+		hooks:    server.hooks,
+		logger:   logger,
+		batches:  map[string]*batch{},
+		queue:    make(chan *batch, 100),
+	}
+	go s.work(ctx)
+	if server.grpcAddr != "" {
+		go s.serveGRPC(ctx, server.grpcAddr)
+	}
+
+	ready := &readinessCheck{settings: settings, ttl: 30 * time.Second}
+	mux := http.NewServeMux()
+	mux.Handle("/", opsHandler(ready.check))
+	mux.HandleFunc("POST /batches", s.authenticated(s.submit))
+	mux.HandleFunc("GET /batches", s.authenticated(s.list))
+	mux.HandleFunc("GET /batches/{id}", s.authenticated(s.get))
+	if s.hooks.template != "" {
+		mux.HandleFunc("POST /hooks/workitems", s.authenticated(s.hook))
+	}
+
+	httpServer := &http.Server{Addr: server.addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdown)
+	}()
+
+	logger.Info("Serving batch API", zap.String("addr", server.addr))
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("Batch API stopped", zap.String("addr", server.addr), zap.Error(err))
+		return exitError
+	}
+	logger.Info("Batch API stopped")
+
+	return exitSuccess
+}
+
+// work runs the queued batches until the context is cancelled
+func (s *batchServer) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case b := <-s.queue:
+			s.run(ctx, b)
+		}
+	}
+}
+
+// run runs a batch, tagging its work items with the batch ID
+func (s *batchServer) run(ctx context.Context, b *batch) {
+	started := time.Now()
+	s.mu.Lock()
+	b.Status = batchRunning
+	b.StartedAt = &started
+	s.mu.Unlock()
+
+	options := s.options
+	options.runID = b.ID
+	options.progress = func(adobatch.Result) {
+		s.mu.Lock()
+		b.Processed++
+		s.mu.Unlock()
+	}
+	s.logger.Info("Starting batch", zap.String("batch_id", b.ID))
+	userStories, err := transformItems(ctx, options, b.userStories, s.logger)
+	if err != nil {
+		s.logger.Error("Failed to transform items", zap.String("batch_id", b.ID), zap.Error(err))
+		s.finish(b, exitValidation, nil, err)
+		return
+	}
+	s.mu.Lock()
+	b.UserStories = len(userStories)
+	s.mu.Unlock()
+
+	results, exitCode := runBatch(ctx, s.settings, userStories, options, s.logger)
+	notifyRun(ctx, options.notifications, results, s.logger)
+
+	s.finish(b, exitCode, &results, nil)
+}
+
+// finish records the outcome of a batch
+func (s *batchServer) finish(b *batch, exitCode int, results *adobatch.Results, err error) {
+	finished := time.Now()
+	s.mu.Lock()
+	b.Status = batchFinished
+	b.FinishedAt = &finished
+	b.ExitCode = &exitCode
+	b.Results = results
+	if err != nil {
+		b.Error = err.Error()
+	}
+	b.userStories = nil
+	s.mu.Unlock()
+}
+
+// submit queues the items of the request body, in the items file format
+func (s *batchServer) submit(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchSize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "failed to read items: "+err.Error())
+		return
+	}
+
+	plan, err := adobatch.LoadPlan(data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "failed to decode items: "+err.Error())
+		return
+	}
+
+	b, err := s.enqueue(plan.Items)
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/batches/"+b.ID)
+	writeJSON(w, http.StatusAccepted, b)
+}
+
+// enqueue queues a batch and returns a snapshot of it
+func (s *batchServer) enqueue(userStories []models.UserStory) (batch, error) {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	b := &batch{
+		ID:          newRunID(time.Now()) + "-" + hex.EncodeToString(suffix),
+		Status:      batchQueued,
+		SubmittedAt: time.Now(),
+		UserStories: len(userStories),
+		userStories: userStories,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case s.queue <- b:
+	default:
+		return batch{}, errBatchQueueFull
+	}
+	s.batches[b.ID] = b
+	s.logger.Info("Batch submitted", zap.String("batch_id", b.ID), zap.Int("user_stories", len(userStories)))
+
+	return *b, nil
+}
+
+// get returns the status of a batch and its results once finished
+func (s *batchServer) get(w http.ResponseWriter, r *http.Request) {
+	b, ok := s.lookup(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, b)
+}
+
+// lookup returns a snapshot of a batch, copied under the lock as the worker
+// updates it
+func (s *batchServer) lookup(id string) (batch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.batches[id]
+	if !ok {
+		return batch{}, false
+	}
+
+	return *b, true
+}
+
+// list returns every batch without their results, newest first
+func (s *batchServer) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	batches := make([]batch, 0, len(s.batches))
+	for _, b := range s.batches {
+		summary := *b
+		summary.Results = nil
+		batches = append(batches, summary)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(batches, func(i, j int) bool { return batches[i].SubmittedAt.After(batches[j].SubmittedAt) })
+	writeJSON(w, http.StatusOK, map[string]any{"batches": batches})
+}
+
+// authenticated requires the bearer token of the server when one is set
+func (s *batchServer) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
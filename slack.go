@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// slackMessage returns an incoming webhook message with compact Block Kit
+// blocks summarizing a run, linking the created user stories and the
+// reports
+func slackMessage(results adobatch.Results, reportURL string) map[string]any {
+	title := notificationTitle(results)
+	summary := fmt.Sprintf("*Created* %d   *Skipped* %d   *Failed* %d   *Duration* %.1fs",
+		results.Summary.Created, results.Summary.Skipped, results.Summary.Failed, results.Summary.DurationSeconds)
+
+	blocks := []map[string]any{
+		{"type": "header", "text": slackText("plain_text", title)},
+		{"type": "section", "text": slackText("mrkdwn", summary)},
+	}
+
+	created, failed := notableItems(results)
+	if len(created) > 0 {
+		lines := []string{"*Created user stories*"}
+		for _, item := range created {
+			lines = append(lines, fmt.Sprintf("• <%s|%s>", item.Url, slackEscape(item.Name)))
+		}
+		blocks = append(blocks, map[string]any{"type": "section", "text": slackText("mrkdwn", strings.Join(lines, "\n"))})
+	}
+	if len(failed) > 0 {
+		lines := []string{"*Failures*"}
+		for _, item := range failed {
+			lines = append(lines, fmt.Sprintf("• %s %s: %s", item.Type, slackEscape(item.Name), slackEscape(item.Error)))
+		}
+		blocks = append(blocks, map[string]any{"type": "section", "text": slackText("mrkdwn", strings.Join(lines, "\n"))})
+	}
+
+	if reportURL != "" {
+		blocks = append(blocks, map[string]any{
+			"type":     "actions",
+			"elements": []map[string]any{{"type": "button", "text": slackText("plain_text", "View report"), "url": reportURL}},
+		})
+	}
+
+	// text is the fallback shown in notifications
+	return map[string]any{"text": title, "blocks": blocks}
+}
+
+func slackText(kind, text string) map[string]string {
+	// Slack rejects section texts over 3000 characters
+	if len(text) > 3000 {
+		text = text[:2997] + "..."
+	}
+
+	return map[string]string{"type": kind, "text": text}
+}
+
+// slackEscape escapes the control characters of Slack mrkdwn
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// openItemsFile opens the items file, decrypting it when it is
+// SOPS-encrypted. Plain files are read as they are decoded.
+func openItemsFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, binary := sopsDocument(file)
+	if !encrypted {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+	file.Close()
+
+	// SOPS only encrypts JSON objects, an items array is encrypted as a
+	// binary file, stored as {"data": "ENC[...]", "sops": {...}}
+	outputType := "json"
+	if binary {
+		outputType = "binary"
+	}
+	data, err := sopsDecrypt(path, "json", outputType)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// sopsDocument reports whether r holds a SOPS-encrypted JSON document, and
+// whether it encrypts a binary file, with the data key first. SOPS encrypts
+// every value as an ENC[...] string, so only the tokens up to the first value
+// are read, not the whole file.
+func sopsDocument(r io.Reader) (encrypted, binary bool) {
+	decoder := json.NewDecoder(r)
+	// open holds for every open object whether its key comes next ('k') or
+	// its value ('v'), and 'a' for arrays
+	var open []byte
+	firstKey := ""
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false, false
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			if len(open) > 0 && open[len(open)-1] == 'v' {
+				open[len(open)-1] = 'k'
+			}
+			if token == json.Delim('{') {
+				open = append(open, 'k')
+			} else {
+				open = append(open, 'a')
+			}
+		case json.Delim('}'), json.Delim(']'):
+			open = open[:len(open)-1]
+			if len(open) == 0 {
+				return false, false
+			}
+		default:
+			if len(open) == 0 {
+				return false, false
+			}
+			if open[len(open)-1] == 'k' {
+				if len(open) == 1 && firstKey == "" {
+					firstKey, _ = token.(string)
+				}
+				open[len(open)-1] = 'v'
+				continue
+			}
+
+			// The first value
+			value, _ := token.(string)
+			encrypted = strings.HasPrefix(value, "ENC[")
+			return encrypted, encrypted && len(open) == 1 && firstKey == "data"
+		}
+	}
+}
+
+// isSOPSConfig reports whether a YAML config file is SOPS-encrypted
+func isSOPSConfig(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("sops:")) || bytes.Contains(data, []byte("\nsops:"))
+}
+
+// sopsDecrypt decrypts a file with the sops binary, which resolves the age,
+// PGP, cloud KMS or Azure Key Vault keys listed in the file metadata
+func sopsDecrypt(path, inputType, outputType string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sops", "--decrypt", "--input-type", inputType, "--output-type", outputType, path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("%s is SOPS-encrypted but sops is not installed", filepath.Base(path))
+		}
+		return nil, fmt.Errorf("failed to decrypt %s with sops: %s", path, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSOPSDocument(t *testing.T) {
+	tests := []struct {
+		name      string
+		document  string
+		encrypted bool
+		binary    bool
+	}{
+		{"array", `[{"name": "US1", "tasks": []}]`, false, false},
+		{"object", `{"defaults": {}, "items": [{"name": "US1"}]}`, false, false},
+		{"empty", `{"items": []}`, false, false},
+		{"not JSON", `items: []`, false, false},
+		{"encrypted object", `{"defaults": {}, "items": [{"name": "ENC[AES256_GCM,data:abc,type:str]"}], "sops": {"version": "3.9.0"}}`, true, false},
+		{"encrypted number", `{"items": [{"priority": "ENC[AES256_GCM,data:Mg==,type:int]"}], "sops": {}}`, true, false},
+		{"encrypted binary", `{"data": "ENC[AES256_GCM,data:abc,type:str]", "sops": {"version": "3.9.0"}}`, true, true},
+	}
+	for _, tt := range tests {
+		encrypted, binary := sopsDocument(strings.NewReader(tt.document))
+		if encrypted != tt.encrypted || binary != tt.binary {
+			t.Errorf("%s: encrypted, binary = %t, %t, want %t, %t", tt.name, encrypted, binary, tt.encrypted, tt.binary)
+		}
+	}
+
+	// Only the start of the file is read, the rest is not even valid
+	if encrypted, _ := sopsDocument(strings.NewReader(`{"items": [{"name": "ENC[AES256_GCM,data:abc,type:str]"` + strings.Repeat("}", 10))); !encrypted {
+		t.Errorf("encrypted file not detected from its first value")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.starlark.net/starlark"
+)
+
+// applyScript calls the transform function of a Starlark script with every
+// user story, as a dict in the items file format. The function returns the
+// item to create, possibly modified, or None to drop it. fail() rejects the
+// batch.
+func applyScript(path string, userStories []models.UserStory) ([]models.UserStory, error) {
+	if path == "" {
+		return userStories, nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+
+	thread := &starlark.Thread{Name: "transform"}
+	globals, err := starlark.ExecFile(thread, path, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load script %s: %w", path, err)
+	}
+	transform, ok := globals["transform"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script %s must define a transform(item) function", path)
+	}
+
+	transformed := make([]models.UserStory, 0, len(userStories))
+	for _, userStory := range userStories {
+		var item any
+		data, err := json.Marshal(userStory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal user story %q: %w", userStory.Name, err)
+		}
+		if err := json.Unmarshal(data, &item); err != nil {
+			return nil, fmt.Errorf("failed to marshal user story %q: %w", userStory.Name, err)
+		}
+
+		value, err := toStarlark(item)
+		if err != nil {
+			return nil, err
+		}
+		result, err := starlark.Call(thread, transform, starlark.Tuple{value}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("script rejected user story %q: %w", userStory.Name, err)
+		}
+		if result == starlark.None {
+			continue
+		}
+
+		item, err = fromStarlark(result)
+		if err != nil {
+			return nil, fmt.Errorf("invalid result for user story %q: %w", userStory.Name, err)
+		}
+		if data, err = json.Marshal(item); err != nil {
+			return nil, fmt.Errorf("invalid result for user story %q: %w", userStory.Name, err)
+		}
+		var out models.UserStory
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, fmt.Errorf("invalid result for user story %q: %w", userStory.Name, err)
+		}
+		transformed = append(transformed, out)
+	}
+
+	return transformed, nil
+}
+
+// toStarlark converts a decoded JSON value to a Starlark value
+func toStarlark(value any) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case float64:
+		if v == math.Trunc(v) {
+			return starlark.MakeInt64(int64(v)), nil
+		}
+		return starlark.Float(v), nil
+	case string:
+		return starlark.String(v), nil
+	case []any:
+		elems := make([]starlark.Value, 0, len(v))
+		for _, elem := range v {
+			converted, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, converted)
+		}
+		return starlark.NewList(elems), nil
+	case map[string]any:
+		dict := starlark.NewDict(len(v))
+		for key, elem := range v {
+			converted, err := toStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value %T", value)
+}
+
+// fromStarlark converts a Starlark value to a value encodable as JSON
+func fromStarlark(value starlark.Value) (any, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("integer %s out of range", v)
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case *starlark.List:
+		elems := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			elem, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return elems, nil
+	case starlark.Tuple:
+		elems := make([]any, 0, len(v))
+		for _, elem := range v {
+			converted, err := fromStarlark(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, converted)
+		}
+		return elems, nil
+	case *starlark.Dict:
+		m := make(map[string]any, v.Len())
+		for _, pair := range v.Items() {
+			key, ok := starlark.AsString(pair[0])
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is not a string", pair[0])
+			}
+			elem, err := fromStarlark(pair[1])
+			if err != nil {
+				return nil, err
+			}
+			m[key] = elem
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("unsupported %s value", value.Type())
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+)
+
+const testScript = `
+def transform(item):
+    if item["name"].startswith("[drop]"):
+        return None
+    if not item["owner"]:
+        fail("user story %s has no owner" % item["name"])
+    item["priority"] = 4
+    item["tags"] = item.get("tags", []) + ["team-" + item["owner"].split("@")[0]]
+    for task in item["tasks"] or []:
+        task["estimate"] = task["estimate"] or 1
+    return item
+`
+
+func TestApplyScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.star")
+	if err := os.WriteFile(path, []byte(testScript), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	userStories, err := applyScript(path, []models.UserStory{
+		{Name: "US1", Owner: "ana@example.com", Tags: []string{"backend"}, Tasks: []models.Task{{Name: "T1"}, {Name: "T2", Estimate: 3}}},
+		{Name: "[drop] US2", Owner: "ana@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userStories) != 1 {
+		t.Fatalf("%d user stories, want the dropped one removed", len(userStories))
+	}
+	userStory := userStories[0]
+	if userStory.Priority != 4 {
+		t.Errorf("priority = %d, want 4", userStory.Priority)
+	}
+	if want := []string{"backend", "team-ana"}; !slices.Equal(userStory.Tags, want) {
+		t.Errorf("tags = %v, want %v", userStory.Tags, want)
+	}
+	if userStory.Tasks[0].Estimate != 1 || userStory.Tasks[1].Estimate != 3 {
+		t.Errorf("estimates = %d, %d, want 1, 3", userStory.Tasks[0].Estimate, userStory.Tasks[1].Estimate)
+	}
+
+	_, err = applyScript(path, []models.UserStory{{Name: "US3"}})
+	if err == nil || !strings.Contains(err.Error(), "user story US3 has no owner") {
+		t.Errorf("error = %v, want the item rejected", err)
+	}
+}
+
+func TestApplyScriptInvalid(t *testing.T) {
+	tests := map[string]string{
+		"syntax error":   "def transform(item)\n    return item\n",
+		"no transform":   "def other(item):\n    return item\n",
+		"invalid result": "def transform(item):\n    return 1\n",
+	}
+	for name, script := range tests {
+		path := filepath.Join(t.TempDir(), "transform.star")
+		if err := os.WriteFile(path, []byte(script), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := applyScript(path, []models.UserStory{{Name: "US1"}}); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// ANSI color codes used for the status column. All codes have the same
+// length so the table stays aligned when colors are enabled.
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+)
+
+// printSummary writes a table of every user story and task processed in the
+// run, followed by the run ID and counters
+func printSummary(w io.Writer, results adobatch.Results) {
+	items, summary := results.Items, results.Summary
+	color := useColor(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tID\tSTATUS\tURL")
+	// The counters follow the order the types first appear in the table
+	var types []string
+	seen := map[string]bool{}
+	addType := func(workItemType string) string {
+		if !seen[workItemType] {
+			seen[workItemType] = true
+			types = append(types, workItemType)
+		}
+		return workItemType
+	}
+	for _, story := range items {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", addType(adobatch.UserStoryType(story.Item)), story.Item.Name, formatID(story.ID), colorStatus(story.Status, color), story.URL)
+		for _, task := range story.Tasks {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", addType(adobatch.TaskType(task.Item)), task.Item.Name, formatID(task.ID), colorStatus(task.Status, color), task.URL)
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	if results.RunID != "" {
+		fmt.Fprintf(w, "Run: %s\n", results.RunID)
+	}
+	for _, workItemType := range types {
+		counts := summary.ByType[workItemType]
+		fmt.Fprintf(w, "%s: %d created, %d skipped, %d failed", workItemType, counts.Created, counts.Skipped, counts.Failed)
+		if counts.Updated > 0 {
+			fmt.Fprintf(w, ", %d updated", counts.Updated)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "Duration: %s, average request latency: %.0fms (p50 %.0fms, p95 %.0fms)\n", time.Duration(summary.DurationSeconds*float64(time.Second)).Round(time.Millisecond), summary.AverageLatencyMs, summary.P50LatencyMs, summary.P95LatencyMs)
+	if len(summary.Slowest) > 0 {
+		fmt.Fprintln(w, "Slowest:")
+		for _, item := range summary.Slowest {
+			fmt.Fprintf(w, "  %.0fms\t%s %s\n", item.LatencyMs, item.Type, item.Name)
+		}
+	}
+	if len(summary.ByIteration) > 0 {
+		printEstimates(w, "ITERATION", "(none)", summary.ByIteration)
+		printEstimates(w, "ASSIGNEE", "(unassigned)", summary.ByOwner)
+	}
+}
+
+// printEstimates writes a table of the hours and points of the work items
+// created, by the iteration or assignee in the first column
+func printEstimates(w io.Writer, column, none string, estimates map[string]adobatch.Estimate) {
+	keys := make([]string, 0, len(estimates))
+	for key := range estimates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tHOURS\tPOINTS\n", column)
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", valueOr(key, none), estimates[key].Hours, strconv.FormatFloat(estimates[key].Points, 'f', -1, 64))
+	}
+	tw.Flush()
+}
+
+// colorStatus wraps the status in the color matching its outcome
+func colorStatus(status string, color bool) string {
+	if !color {
+		return status
+	}
+
+	switch status {
+	case models.StatusCreated, models.StatusUpdated, models.StatusDeleted:
+		return colorGreen + status + colorReset
+	case models.StatusSkipped:
+		return colorYellow + status + colorReset
+	default:
+		return colorRed + status + colorReset
+	}
+}
+
+// useColor reports whether w is a terminal that should receive colored output
+func useColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func formatID(id int) string {
+	if id == 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(id)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+func TestPrintSummary(t *testing.T) {
+	items := []adobatch.Result{
+		{
+			Item:   models.UserStory{Name: "PBI 1", Type: "Product Backlog Item"},
+			ID:     101,
+			Status: models.StatusCreated,
+			Tasks: []adobatch.TaskResult{
+				{Item: models.Task{Name: "Task 1"}, ID: 102, Status: models.StatusCreated},
+				{Item: models.Task{Name: "Task 2"}, Status: models.StatusFailed, Err: errors.New("bad request")},
+			},
+		},
+		{Item: models.UserStory{Name: "Bug 1", Type: "Bug"}, ID: 103, Status: models.StatusUpdated},
+	}
+	var out bytes.Buffer
+	printSummary(&out, adobatch.NewResults("20261016-090000", items, time.Second))
+
+	for _, want := range []string{
+		"Product Backlog Item  PBI 1",
+		"  Task                Task 2",
+		"Bug                   Bug 1",
+		"Run: 20261016-090000\nProduct Backlog Item: 1 created, 0 skipped, 0 failed\nTask: 1 created, 0 skipped, 1 failed\nBug: 0 created, 0 skipped, 0 failed, 1 updated\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("summary has no %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "User Story") {
+		t.Errorf("summary counts types the run did not create:\n%s", out.String())
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// tagsOptions selects the work items of the tags command and the tags to
+// change
+type tagsOptions struct {
+	query string
+	runID string
+	// from is the tag renamed or removed, to the new name
+	from string
+	to   string
+}
+
+// manageTags renames or removes a tag on every work item of a query, or on
+// every work item with the tag
+func manageTags(ctx context.Context, settings models.AdoSettings, action string, tags tagsOptions, options applyOptions, logger *zap.Logger) int {
+	switch {
+	case action != "rename" && action != "remove":
+		logger.Error("Unknown tags action, expected tags rename or tags remove", zap.String("action", action))
+		return exitValidation
+	case tags.from == "":
+		logger.Error("Missing tag: tags " + action + " --from <tag>")
+		return exitValidation
+	case action == "rename" && tags.to == "":
+		logger.Error("Missing new tag: tags rename --from <tag> --to <tag>")
+		return exitValidation
+	case action == "remove" && tags.to != "":
+		logger.Error("--to cannot be used with tags remove")
+		return exitValidation
+	}
+
+	query := tags.query
+	if query == "" {
+		query, _ = bulkSelection{tag: tags.from, runID: tags.runID}.query()
+	} else if tags.runID != "" {
+		logger.Error("--query cannot be used with --run")
+		return exitValidation
+	}
+
+	client := newClient(settings, logger)
+	results, err := selectWorkItems(ctx, client, settings, query)
+	if err != nil {
+		logger.Error("Failed to run query", zap.Error(err))
+		return queryExitCode(err)
+	}
+	logger.Info("Changing tags", zap.String("action", action), zap.Int("work_items", len(results)), zap.String("from", tags.from), zap.String("to", tags.to))
+
+	return runBulk(ctx, results, action+" tag on", models.StatusUpdated, func(ctx context.Context, id int) error {
+		changed, err := client.RenameTag(ctx, settings, id, tags.from, tags.to)
+		if err == nil && !changed {
+			return fmt.Errorf("no tag %q: %w", tags.from, errBulkSkipped)
+		}
+		return err
+	}, options, logger)
+}
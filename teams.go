@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// teamsMessage returns an incoming webhook message holding an adaptive card
+// with the summary of a run and links to the created user stories and the
+// reports
+func teamsMessage(results adobatch.Results, reportURL string) map[string]any {
+	color := "Good"
+	if results.Summary.Failed > 0 {
+		color = "Attention"
+	}
+
+	body := []map[string]any{
+		{"type": "TextBlock", "text": notificationTitle(results), "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+		{"type": "FactSet", "facts": []map[string]string{
+			{"title": "Created", "value": strconv.Itoa(results.Summary.Created)},
+			{"title": "Skipped", "value": strconv.Itoa(results.Summary.Skipped)},
+			{"title": "Failed", "value": strconv.Itoa(results.Summary.Failed)},
+			{"title": "Duration", "value": fmt.Sprintf("%.1fs", results.Summary.DurationSeconds)},
+		}},
+	}
+
+	created, failed := notableItems(results)
+	if len(created) > 0 {
+		body = append(body, map[string]any{"type": "TextBlock", "text": "Created user stories", "weight": "Bolder", "spacing": "Medium"})
+		for _, item := range created {
+			body = append(body, map[string]any{"type": "TextBlock", "text": fmt.Sprintf("- [%s](%s)", item.Name, item.Url), "wrap": true, "spacing": "None"})
+		}
+	}
+	if len(failed) > 0 {
+		body = append(body, map[string]any{"type": "TextBlock", "text": "Failures", "weight": "Bolder", "color": "Attention", "spacing": "Medium"})
+		for _, item := range failed {
+			body = append(body, map[string]any{"type": "TextBlock", "text": fmt.Sprintf("- %s %q: %s", item.Type, item.Name, item.Error), "wrap": true, "spacing": "None"})
+		}
+	}
+
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if reportURL != "" {
+		card["actions"] = []map[string]string{{"type": "Action.OpenUrl", "title": "View report", "url": reportURL}}
+	}
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	}
+}
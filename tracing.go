@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+)
+
+// OTLP span kinds and status codes
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	statusCodeError  = 2
+)
+
+// tracer records spans and exports them to an OpenTelemetry collector with
+// OTLP/HTTP JSON. A nil tracer disables tracing.
+type tracer struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+
+	mu       sync.Mutex
+	finished []otlpSpan
+}
+
+// appTracer traces the process, it is nil unless an OTLP endpoint is set
+var appTracer *tracer
+
+// newTracer builds a tracer exporting to endpoint, configured with the
+// standard OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME variables
+func newTracer(endpoint string) *tracer {
+	t := &tracer{
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		headers:     map[string]string{},
+		serviceName: os.Getenv("OTEL_SERVICE_NAME"),
+	}
+	if !strings.HasSuffix(t.endpoint, "/v1/traces") {
+		t.endpoint += "/v1/traces"
+	}
+	if t.serviceName == "" {
+		t.serviceName = "ado_batch_creator"
+	}
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, ok := strings.Cut(header, "="); ok {
+			t.headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return t
+}
+
+// span is an operation of a trace
+type span struct {
+	tracer     *tracer
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	attributes map[string]any
+}
+
+type spanContextKey struct{}
+
+// startSpan starts a span, child of the span in ctx if any, and returns a
+// context carrying it
+func startSpan(ctx context.Context, name string, kind int, attributes map[string]any) (context.Context, *span) {
+	if appTracer == nil {
+		return ctx, nil
+	}
+
+	s := &span{tracer: appTracer, name: name, kind: kind, start: time.Now(), attributes: attributes}
+	if s.attributes == nil {
+		s.attributes = map[string]any{}
+	}
+	if parent, ok := ctx.Value(spanContextKey{}).(*span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// setAttribute adds an attribute to the span
+func (s *span) setAttribute(key string, value any) {
+	if s != nil {
+		s.attributes[key] = value
+	}
+}
+
+// traceparent returns the W3C trace context header of the span
+func (s *span) traceparent() string {
+	return fmt.Sprintf("00-%x-%x-01", s.traceID, s.spanID)
+}
+
+// end finishes the span, marking it as failed when err is set
+func (s *span) end(err error) {
+	if s == nil {
+		return
+	}
+
+	exported := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attributes),
+	}
+	if s.parentID != [8]byte{} {
+		exported.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if err != nil {
+		exported.Status = &otlpStatus{Code: statusCodeError, Message: redactSecrets(err.Error(), nil)}
+	}
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.finished = append(s.tracer.finished, exported)
+}
+
+// flush exports the finished spans
+func (t *tracer) flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	spans := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(map[string]any{"service.name": t.serviceName})},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "ado_batch_creator"},
+				"spans": spans,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	// Not the shared client, exporting must not be traced or audited itself
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// otlpAttributes converts attributes to OTLP key values, sorted by key
+func otlpAttributes(attributes map[string]any) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	converted := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]any
+		switch v := attributes[key].(type) {
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": redactSecrets(fmt.Sprint(v), nil)}
+		}
+		converted = append(converted, otlpAttribute{Key: key, Value: value})
+	}
+
+	return converted
+}
+
+// tracingTransport records a client span for every API call and propagates
+// the trace context
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, s := startSpan(req.Context(), "HTTP "+req.Method, spanKindClient, map[string]any{
+		"http.request.method": req.Method,
+		"url.full":            req.URL.String(),
+	})
+	if s == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(ctx)
+	req.Header.Set("traceparent", s.traceparent())
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		s.end(err)
+		return nil, err
+	}
+
+	s.setAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		s.end(fmt.Errorf("status: %s", resp.Status))
+	} else {
+		s.end(nil)
+	}
+
+	return resp, nil
+}
+
+// engineTracer records the spans of the engine with the tracer of the
+// command
+type engineTracer struct{}
+
+func (engineTracer) StartSpan(ctx context.Context, name string, attributes map[string]any) (context.Context, adobatch.Span) {
+	ctx, s := startSpan(ctx, name, spanKindInternal, attributes)
+	return ctx, engineSpan{s}
+}
+
+type engineSpan struct {
+	span *span
+}
+
+func (s engineSpan) SetAttribute(key string, value any) {
+	s.span.setAttribute(key, value)
+}
+
+func (s engineSpan) End(err error) {
+	s.span.end(err)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracingExport(t *testing.T) {
+	var exported struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	var path, apiKey string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, apiKey = r.URL.Path, r.Header.Get("x-api-key")
+		if err := json.NewDecoder(r.Body).Decode(&exported); err != nil {
+			t.Errorf("invalid export: %v", err)
+		}
+	}))
+	t.Cleanup(collector.Close)
+	var traceparent string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(api.Close)
+
+	t.Setenv("OTEL_SERVICE_NAME", "batch-test")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-api-key=collector-key")
+	appTracer = newTracer(collector.URL)
+	t.Cleanup(func() { appTracer = nil })
+
+	ctx, root := engineTracer{}.StartSpan(context.Background(), "apply", map[string]any{"run.id": "20261016-090000"})
+	root.SetAttribute("work_items", 2)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, api.URL+"/org/project/_apis/wit/workitems/$Task", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: tracingTransport{next: http.DefaultTransport}}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	root.End(nil)
+
+	if err := appTracer.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/traces" || apiKey != "collector-key" {
+		t.Errorf("exported to %s with key %q, want /v1/traces with the OTEL_EXPORTER_OTLP_HEADERS", path, apiKey)
+	}
+	if len(exported.ResourceSpans) != 1 || len(exported.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("export = %+v, want one resource and scope", exported)
+	}
+	if service := attributeValues(exported.ResourceSpans[0].Resource.Attributes)["service.name"]; service != "stringValue=batch-test" {
+		t.Errorf("service name = %s, want batch-test", service)
+	}
+
+	spans := map[string]otlpSpan{}
+	for _, span := range exported.ResourceSpans[0].ScopeSpans[0].Spans {
+		spans[span.Name] = span
+	}
+	client, apply := spans["HTTP POST"], spans["apply"]
+	if len(spans) != 2 || client.SpanID == "" || apply.SpanID == "" {
+		t.Fatalf("spans = %+v, want apply and HTTP POST", spans)
+	}
+	if apply.ParentSpanID != "" || apply.Kind != spanKindInternal {
+		t.Errorf("apply span has parent %q and kind %d, want a root internal span", apply.ParentSpanID, apply.Kind)
+	}
+	if client.TraceID != apply.TraceID || client.ParentSpanID != apply.SpanID || client.Kind != spanKindClient {
+		t.Errorf("HTTP span in trace %s under %s, kind %d, want a client span under %s in %s", client.TraceID, client.ParentSpanID, client.Kind, apply.SpanID, apply.TraceID)
+	}
+	if want := fmt.Sprintf("00-%s-%s-01", client.TraceID, client.SpanID); traceparent != want {
+		t.Errorf("traceparent = %q, want %q", traceparent, want)
+	}
+
+	if got := attributeValues(apply.Attributes); got["run.id"] != "stringValue=20261016-090000" || got["work_items"] != "intValue=2" {
+		t.Errorf("apply attributes = %v", got)
+	}
+	got := attributeValues(client.Attributes)
+	if got["http.request.method"] != "stringValue=POST" || got["url.full"] != "stringValue="+req.URL.String() || got["http.response.status_code"] != "intValue=500" {
+		t.Errorf("HTTP attributes = %v", got)
+	}
+	if client.Status == nil || client.Status.Code != statusCodeError || apply.Status != nil {
+		t.Errorf("statuses = %+v and %+v, want only the HTTP span failed", client.Status, apply.Status)
+	}
+}
+
+// attributeValues returns the OTLP attributes by key, as "type=value"
+func attributeValues(attributes []otlpAttribute) map[string]string {
+	values := map[string]string{}
+	for _, attribute := range attributes {
+		for kind, value := range attribute.Value {
+			values[attribute.Key] = fmt.Sprintf("%s=%v", kind, value)
+		}
+	}
+
+	return values
+}
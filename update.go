@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"go.uber.org/zap"
+)
+
+// fieldUpdate is a field set by the update command
+type fieldUpdate struct {
+	field string
+	value string
+}
+
+// parseFieldUpdates parses the --set values, given as Field=Value
+func parseFieldUpdates(values []string) ([]fieldUpdate, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("set at least one field with --set Field=Value")
+	}
+
+	updates := make([]fieldUpdate, 0, len(values))
+	for _, set := range values {
+		field, value, ok := strings.Cut(set, "=")
+		field = strings.TrimSpace(field)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid --set %q: expected Field=Value, e.g. System.IterationPath=\"my-project\\Sprint 43\"", set)
+		}
+		updates = append(updates, fieldUpdate{field: field, value: value})
+	}
+
+	return updates, nil
+}
+
+// updateWorkItems sets fields on every work item returned by a WIQL query
+// with a JSON patch document
+func updateWorkItems(ctx context.Context, settings models.AdoSettings, query string, sets []string, options applyOptions, logger *zap.Logger) int {
+	if query == "" {
+		logger.Error("Missing WIQL query: update --query \"SELECT ...\"")
+		return exitValidation
+	}
+	updates, err := parseFieldUpdates(sets)
+	if err != nil {
+		logger.Error("Invalid field update", zap.Error(err))
+		return exitValidation
+	}
+
+	payload := make([]map[string]interface{}, 0, len(updates))
+	for _, update := range updates {
+		payload = append(payload, map[string]interface{}{
+			"op":    "add",
+			"path":  "/fields/" + update.field,
+			"value": update.value,
+		})
+	}
+
+	client := newClient(settings, logger)
+	results, err := selectWorkItems(ctx, client, settings, query)
+	if err != nil {
+		logger.Error("Failed to run query", zap.Error(err))
+		return queryExitCode(err)
+	}
+	logger.Info("Updating work items", zap.Int("work_items", len(results)), zap.Int("fields", len(updates)))
+
+	return runBulk(ctx, results, "update", models.StatusUpdated, func(ctx context.Context, id int) error {
+		return client.UpdateWorkItem(ctx, settings, id, payload)
+	}, options, logger)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// itemProblem is a value of the items file the project does not accept
+type itemProblem struct {
+	// Item locates the item, e.g. items[2].tasks[0]
+	Item    string `json:"item"`
+	Name    string `json:"name"`
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Problem string `json:"problem"`
+}
+
+// validateItems checks the items file against the metadata of the project
+// without creating anything
+func validateItems(ctx context.Context, settings models.AdoSettings, options applyOptions, cache metadataCache, logger *zap.Logger) int {
+	file, err := openItemsFile(options.itemsPath)
+	if err != nil {
+		logger.Error("Failed to read items file", zap.String("path", options.itemsPath), zap.Error(err))
+		return exitValidation
+	}
+	plan, err := adobatch.DecodePlan(file)
+	file.Close()
+	if err != nil {
+		logger.Error("Failed to decode items file", zap.String("path", options.itemsPath), zap.Error(err))
+		return exitValidation
+	}
+	userStories, err := transformItems(ctx, options, plan.Items, logger)
+	if err != nil {
+		logger.Error("Failed to transform items", zap.Error(err))
+		return exitValidation
+	}
+
+	for i := range userStories {
+		if userStories[i].Iteraction == nil && options.iteration != "" {
+			userStories[i].Iteraction = &options.iteration
+		}
+	}
+
+	// Descriptions and titles are checked as the run will create them
+	rendered := &adobatch.Plan{Items: userStories}
+	if err := rendered.CheckLinks(); err != nil {
+		logger.Error("Invalid links", zap.Error(err))
+		return exitValidation
+	}
+	if err := rendered.RenderDescriptions(""); err != nil {
+		logger.Error("Invalid description templates", zap.Error(err))
+		return exitValidation
+	}
+	rendered.FormatTitles(options.titles)
+	if err := rendered.FitTitles(options.titles.Overflow); err != nil {
+		logger.Error("Titles too long", zap.Error(err))
+		return exitValidation
+	}
+
+	metadata, err := loadMetadata(ctx, settings, cache, logger)
+	if err != nil {
+		logger.Error("Failed to load project metadata", zap.Error(err))
+		return queryExitCode(err)
+	}
+
+	problems := checkItems(settings, userStories, metadata, options.fuzzyOwners, logger)
+	if err := printOutput(os.Stdout, options.output, problems, func(w io.Writer) { printItemProblems(w, problems) }); err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+	}
+
+	if len(problems) > 0 {
+		logger.Error("Items file is invalid for the project", zap.String("path", options.itemsPath), zap.Int("problems", len(problems)))
+		return exitValidation
+	}
+	logger.Info("Items file is valid", zap.String("path", options.itemsPath), zap.Int("work_items", (&adobatch.Plan{Items: userStories}).WorkItems()))
+
+	return exitSuccess
+}
+
+// checkItems returns the values of the user stories and tasks that do not
+// exist in the project. Items targeting another organization or project are
+// not checked. With fuzzyOwners, an owner with a single closest user is
+// accepted, as --resolve-owners would pick it.
+func checkItems(settings models.AdoSettings, userStories []models.UserStory, metadata *adobatch.Metadata, fuzzyOwners bool, logger *zap.Logger) []itemProblem {
+	areas := map[string]bool{}
+	for _, area := range metadata.Areas {
+		areas[strings.ToLower(area.Path)] = true
+	}
+	iterations := map[string]bool{}
+	for _, iteration := range metadata.Iterations {
+		iterations[strings.ToLower(iteration.Path)] = true
+	}
+	states := map[string][]string{}
+	for _, workItemType := range metadata.Types {
+		states[workItemType.Name] = workItemType.States
+	}
+	users := map[string]bool{}
+	for _, user := range metadata.Users {
+		users[strings.ToLower(user.UniqueName)] = true
+		users[strings.ToLower(user.DisplayName)] = true
+	}
+
+	teams := map[string]bool{}
+	for _, team := range metadata.Teams {
+		teams[strings.ToLower(team.Name)] = true
+	}
+
+	problems := []itemProblem{}
+	check := func(item, name, field, value string, ok bool, problem string) {
+		if value != "" && !ok {
+			problems = append(problems, itemProblem{Item: item, Name: name, Field: field, Value: value, Problem: problem})
+		}
+	}
+	checkOwner := func(item, name, owner string) {
+		if team, ok := strings.CutPrefix(owner, adobatch.TeamOwnerPrefix); ok {
+			// Caches written before teams were fetched have none
+			check(item, name, "owner", owner, metadata.Teams == nil || teams[strings.ToLower(strings.TrimSpace(team))], "unknown team, see `list teams`")
+			return
+		}
+		// Without team members, owners cannot be checked
+		if owner == "" || len(users) == 0 || users[strings.ToLower(owner)] {
+			return
+		}
+		problem := "not a member of a team of the project"
+		suggestions := adobatch.SuggestIdentities(owner, metadata.Users)
+		if fuzzyOwners && len(suggestions) == 1 {
+			logger.Warn("Owner not found, --resolve-owners will use the closest user", zap.String("item", item), zap.String("owner", owner), zap.String("user", suggestions[0].UniqueName))
+			return
+		}
+		if len(suggestions) > 0 {
+			names := make([]string, 0, len(suggestions))
+			for _, suggestion := range suggestions {
+				names = append(names, suggestion.UniqueName)
+			}
+			problem += ", did you mean " + strings.Join(names, " or ") + "?"
+		}
+		problems = append(problems, itemProblem{Item: item, Name: name, Field: "owner", Value: owner, Problem: problem})
+	}
+	checkFields := func(item, name string, values map[string]any) {
+		// Caches written before fields were fetched have none
+		if metadata.Fields == nil {
+			return
+		}
+		for _, field := range slices.Sorted(maps.Keys(values)) {
+			if _, err := adobatch.ResolveField(metadata.Fields, field); err != nil {
+				problems = append(problems, itemProblem{Item: item, Name: name, Field: "fields", Value: field, Problem: err.Error()})
+			}
+		}
+	}
+	// checkType returns the name of the work item type of an item
+	checkType := func(item, name, workItemType, defaultType string) string {
+		if workItemType == defaultType {
+			return workItemType
+		}
+		resolved, err := adobatch.ResolveWorkItemType(metadata.Types, workItemType)
+		if err != nil {
+			problems = append(problems, itemProblem{Item: item, Name: name, Field: "type", Value: workItemType, Problem: err.Error()})
+		}
+		return resolved
+	}
+	checkState := func(item, name, workItemType, state string) {
+		// Processes without the type use other work item types
+		if _, ok := states[workItemType]; !ok {
+			return
+		}
+		check(item, name, "state", state, containsFold(states[workItemType], state),
+			fmt.Sprintf("not a state of %s, expected one of %s", workItemType, strings.Join(states[workItemType], ", ")))
+	}
+
+	for i, userStory := range userStories {
+		if (userStory.Organization != "" && !strings.EqualFold(userStory.Organization, settings.Organization)) ||
+			(userStory.Project != "" && !strings.EqualFold(userStory.Project, settings.Project)) {
+			continue
+		}
+
+		item := fmt.Sprintf("items[%d]", i)
+		if userStory.Name == "" {
+			problems = append(problems, itemProblem{Item: item, Field: "name", Problem: "missing"})
+		}
+		check(item, userStory.Name, "area", userStory.Area, areas[strings.ToLower(userStory.Area)], "unknown area, see `list areas`")
+		// The current iteration is only known at the time of the run
+		if userStory.Iteraction != nil && !strings.EqualFold(*userStory.Iteraction, adobatch.CurrentIteration) {
+			check(item, userStory.Name, "iteraction", *userStory.Iteraction, iterations[strings.ToLower(*userStory.Iteraction)], "unknown iteration, see `list iterations`")
+		}
+		checkState(item, userStory.Name, checkType(item, userStory.Name, adobatch.UserStoryType(userStory), adobatch.DefaultUserStoryType), userStory.State)
+		checkOwner(item, userStory.Name, userStory.Owner)
+		checkFields(item, userStory.Name, userStory.Fields)
+
+		for j, task := range userStory.Tasks {
+			item := fmt.Sprintf("items[%d].tasks[%d]", i, j)
+			if task.Name == "" {
+				problems = append(problems, itemProblem{Item: item, Field: "name", Problem: "missing"})
+			}
+			checkState(item, task.Name, checkType(item, task.Name, adobatch.TaskType(task), adobatch.DefaultTaskType), task.State)
+			checkOwner(item, task.Name, task.Owner)
+			checkFields(item, task.Name, task.Fields)
+		}
+	}
+
+	return problems
+}
+
+// printItemProblems writes a table of the problems of the items file
+func printItemProblems(w io.Writer, problems []itemProblem) {
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "Items file is valid")
+		return
+	}
+
+	printTable(w, []string{"ITEM", "NAME", "FIELD", "VALUE", "PROBLEM"}, len(problems), func(i int) []string {
+		return []string{problems[i].Item, problems[i].Name, problems[i].Field, problems[i].Value, problems[i].Problem}
+	})
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"filipevrevez.github.com/ado_batch_creator/pkg/adobatch"
+	"go.uber.org/zap"
+)
+
+// verifyResultsFile checks the work items of a results file against the
+// items file they were created from, and prints the drift found
+func verifyResultsFile(ctx context.Context, settings models.AdoSettings, path string, options applyOptions, logger *zap.Logger) int {
+	if path == "" {
+		logger.Error("Missing results file: verify <results-file> or --results-file")
+		return exitValidation
+	}
+
+	items, err := readVerifiedItems(ctx, path, options, logger)
+	if err != nil {
+		logger.Error("Failed to match results file with items file", zap.String("path", path), zap.String("items_path", options.itemsPath), zap.Error(err))
+		return exitValidation
+	}
+
+	drifts, err := newClient(settings, logger).Verify(ctx, items)
+	if err != nil {
+		logger.Error("Failed to verify work items", zap.Error(err))
+		if errors.Is(err, adobatch.ErrAuth) {
+			return exitAuth
+		}
+		return exitError
+	}
+
+	if drifts == nil {
+		drifts = []adobatch.Drift{}
+	}
+	if err := printOutput(os.Stdout, options.output, drifts, func(w io.Writer) { printDrifts(w, drifts) }); err != nil {
+		logger.Error("Failed to print results", zap.Error(err))
+	}
+
+	if len(drifts) > 0 {
+		logger.Warn("Work items drifted from the items file", zap.Int("drifts", len(drifts)))
+		return exitPartialFailure
+	}
+	logger.Info("Work items match the items file")
+
+	return exitSuccess
+}
+
+// readVerifiedItems pairs the work items of a results file with the items of
+// the items file, results list the items in the order of the file
+func readVerifiedItems(ctx context.Context, path string, options applyOptions, logger *zap.Logger) ([]adobatch.Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var results adobatch.Results
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("failed to parse results file: %w", err)
+	}
+
+	file, err := openItemsFile(options.itemsPath)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := adobatch.DecodePlan(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	// The work items were created from the transformed items
+	userStories, err := transformItems(ctx, options, plan.Items, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userStories) != len(results.UserStories) {
+		return nil, fmt.Errorf("results file has %d user stories, items file has %d", len(results.UserStories), len(userStories))
+	}
+	items := make([]adobatch.Result, 0, len(userStories))
+	for i, userStory := range userStories {
+		story := results.UserStories[i]
+		if story.Name != userStory.Name || len(story.Tasks) != len(userStory.Tasks) {
+			return nil, fmt.Errorf("user story %d is %q in the results file and %q in the items file", i+1, story.Name, userStory.Name)
+		}
+
+		item := adobatch.Result{Item: userStory, ID: story.Id, URL: story.Url, Status: story.Status}
+		for j, task := range userStory.Tasks {
+			item.Tasks = append(item.Tasks, adobatch.TaskResult{Item: task, ID: story.Tasks[j].Id, URL: story.Tasks[j].Url, Status: story.Tasks[j].Status})
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// verifyRun checks the work items created by a run and logs the drift found
+func verifyRun(ctx context.Context, settings models.AdoSettings, items []adobatch.Result, logger *zap.Logger) {
+	drifts, err := newClient(settings, logger).Verify(ctx, items)
+	if err != nil {
+		logger.Error("Failed to verify work items", zap.Error(err))
+		return
+	}
+
+	for _, drift := range drifts {
+		logger.Warn("Work item drifted from the items file", zap.String("type", drift.Type), zap.String("name", drift.Name), zap.Int("id", drift.ID),
+			zap.String("field", drift.Field), zap.String("expected", drift.Expected), zap.String("actual", drift.Actual))
+	}
+	logger.Info("Work items verified", zap.Int("drifts", len(drifts)))
+}
+
+// printDrifts writes a table of the drifted fields
+func printDrifts(w io.Writer, drifts []adobatch.Drift) {
+	if len(drifts) == 0 {
+		fmt.Fprintln(w, "No drift, every work item matches the items file")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAME\tID\tFIELD\tEXPECTED\tACTUAL")
+	for _, drift := range drifts {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", drift.Type, drift.Name, drift.ID, drift.Field, drift.Expected, drift.Actual)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"filipevrevez.github.com/ado_batch_creator/models"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watchDebounce groups the bursts of events editors emit when saving a file
+const watchDebounce = 500 * time.Millisecond
+
+// watchItems applies the items file and re-applies it every time it changes,
+// until the context is cancelled. User stories created by a previous apply are
+// skipped, so only new ones are created.
+func watchItems(ctx context.Context, settings models.AdoSettings, options applyOptions, logger *zap.Logger) int {
+	target, err := filepath.Abs(options.itemsPath)
+	if err != nil {
+		logger.Error("Failed to resolve items file path", zap.String("path", options.itemsPath), zap.Error(err))
+		return exitValidation
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("Failed to create file watcher", zap.Error(err))
+		return exitError
+	}
+	defer watcher.Close()
+
+	// Watch the directory, editors often replace the file instead of writing to it
+	if err := watcher.Add(filepath.Dir(target)); err != nil {
+		logger.Error("Failed to watch items file", zap.String("path", options.itemsPath), zap.Error(err))
+		return exitValidation
+	}
+
+	applyItems(ctx, settings, options, logger)
+	logger.Info("Watching items file for changes", zap.String("path", options.itemsPath))
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopped watching items file")
+			return exitSuccess
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return exitSuccess
+			}
+			if event.Name != target || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+				continue
+			}
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return exitSuccess
+			}
+			logger.Warn("File watcher error", zap.Error(err))
+		case <-debounce:
+			debounce = nil
+			logger.Info("Items file changed, applying", zap.String("path", options.itemsPath))
+			applyItems(ctx, settings, options, logger)
+		}
+	}
+}